@@ -24,15 +24,28 @@ type ActualStateAbsent struct {
 
 // A ActualStateDir represents the state of a directory in the filesystem.
 type ActualStateDir struct {
-	absPath AbsPath
-	perm    fs.FileMode
+	absPath    AbsPath
+	perm       fs.FileMode
+	owner      string
+	group      string
+	xattrsFunc func() (map[string][]byte, error)
 }
 
 // A ActualStateFile represents the state of a file in the filesystem.
 type ActualStateFile struct {
 	absPath      AbsPath
 	perm         fs.FileMode
+	owner        string
+	group        string
 	contentsFunc ContentsFunc
+	xattrsFunc   func() (map[string][]byte, error)
+}
+
+// A ActualStateHardlink represents the state of a file in the filesystem that
+// is a hard link to another file.
+type ActualStateHardlink struct {
+	absPath  AbsPath
+	linkname RelPath
 }
 
 // A ActualStateSymlink represents the state of a symlink in the filesystem.
@@ -57,17 +70,29 @@ func NewActualStateEntry(system System, absPath AbsPath, fileInfo fs.FileInfo, e
 	}
 	switch fileInfo.Mode().Type() {
 	case 0:
+		owner, group := fileOwnership(fileInfo)
 		return &ActualStateFile{
 			absPath: absPath,
 			perm:    fileInfo.Mode().Perm(),
+			owner:   owner,
+			group:   group,
 			contentsFunc: sync.OnceValues(func() ([]byte, error) {
 				return system.ReadFile(absPath)
 			}),
+			xattrsFunc: sync.OnceValues(func() (map[string][]byte, error) {
+				return system.Lgetxattrs(absPath)
+			}),
 		}, nil
 	case fs.ModeDir:
+		owner, group := fileOwnership(fileInfo)
 		return &ActualStateDir{
 			absPath: absPath,
 			perm:    fileInfo.Mode().Perm(),
+			owner:   owner,
+			group:   group,
+			xattrsFunc: sync.OnceValues(func() (map[string][]byte, error) {
+				return system.Lgetxattrs(absPath)
+			}),
 		}, nil
 	case fs.ModeSymlink:
 		return &ActualStateSymlink{
@@ -117,9 +142,16 @@ func (s *ActualStateAbsent) Remove(system System) error {
 
 // EntryState returns s's entry state.
 func (s *ActualStateDir) EntryState() (*EntryState, error) {
+	xattrs, err := s.Xattrs()
+	if err != nil {
+		return nil, err
+	}
 	return &EntryState{
-		Type: EntryStateTypeDir,
-		Mode: fs.ModeDir | s.perm,
+		Type:   EntryStateTypeDir,
+		Mode:   fs.ModeDir | s.perm,
+		Owner:  s.owner,
+		Group:  s.group,
+		Xattrs: xattrsHexBytes(xattrs),
 	}, nil
 }
 
@@ -143,6 +175,11 @@ func (s *ActualStateDir) Remove(system System) error {
 	return system.RemoveAll(s.absPath)
 }
 
+// Xattrs returns s's managed extended attributes.
+func (s *ActualStateDir) Xattrs() (map[string][]byte, error) {
+	return s.xattrsFunc()
+}
+
 // Contents returns s's contents.
 func (s *ActualStateFile) Contents() ([]byte, error) {
 	return s.contentsFunc()
@@ -154,11 +191,18 @@ func (s *ActualStateFile) EntryState() (*EntryState, error) {
 	if err != nil {
 		return nil, err
 	}
+	xattrs, err := s.Xattrs()
+	if err != nil {
+		return nil, err
+	}
 	contentsSHA256 := sha256.Sum256(contents)
 	return &EntryState{
 		Type:           EntryStateTypeFile,
 		Mode:           s.perm,
 		ContentsSHA256: HexBytes(contentsSHA256[:]),
+		Owner:          s.owner,
+		Group:          s.group,
+		Xattrs:         xattrsHexBytes(xattrs),
 		contents:       contents,
 	}, nil
 }
@@ -188,6 +232,42 @@ func (s *ActualStateFile) Remove(system System) error {
 	return system.RemoveAll(s.absPath)
 }
 
+// Xattrs returns s's managed extended attributes.
+func (s *ActualStateFile) Xattrs() (map[string][]byte, error) {
+	return s.xattrsFunc()
+}
+
+// EntryState returns s's entry state.
+func (s *ActualStateHardlink) EntryState() (*EntryState, error) {
+	return hardlinkEntryState(s.linkname), nil
+}
+
+// IsExternal returns if s is an external.
+func (s *ActualStateHardlink) IsExternal() bool {
+	return false
+}
+
+// Linkname returns the path of the file that s links to, relative to the
+// target directory.
+func (s *ActualStateHardlink) Linkname() RelPath {
+	return s.linkname
+}
+
+// OriginString returns s's origin.
+func (s *ActualStateHardlink) OriginString() string {
+	return s.absPath.String()
+}
+
+// Path returns s's path.
+func (s *ActualStateHardlink) Path() AbsPath {
+	return s.absPath
+}
+
+// Remove removes s.
+func (s *ActualStateHardlink) Remove(system System) error {
+	return system.RemoveAll(s.absPath)
+}
+
 // EntryState returns s's entry state.
 func (s *ActualStateSymlink) EntryState() (*EntryState, error) {
 	linkname, err := s.Linkname()
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"os"
 	"os/exec"
+	"slices"
 
 	"filippo.io/age"
 	"filippo.io/age/armor"
@@ -93,6 +94,25 @@ func (e *AgeEncryption) EncryptedSuffix() string {
 	return e.Suffix
 }
 
+// withRecipients implements recipientsEncryption.withRecipients. Recipients
+// that e already encrypts to are not added again.
+func (e *AgeEncryption) withRecipients(recipients []string, replace bool) Encryption {
+	ageEncryption := *e
+	if replace {
+		ageEncryption.Recipient = ""
+		ageEncryption.Recipients = nil
+		ageEncryption.RecipientsFile = EmptyAbsPath
+		ageEncryption.RecipientsFiles = nil
+	}
+	ageEncryption.Recipients = slices.Clone(ageEncryption.Recipients)
+	for _, recipient := range recipients {
+		if recipient != ageEncryption.Recipient && !slices.Contains(ageEncryption.Recipients, recipient) {
+			ageEncryption.Recipients = append(ageEncryption.Recipients, recipient)
+		}
+	}
+	return &ageEncryption
+}
+
 // builtinDecrypt decrypts ciphertext using the builtin age.
 func (e *AgeEncryption) builtinDecrypt(ciphertext []byte) ([]byte, error) {
 	identities, err := e.builtinIdentities()
@@ -120,6 +140,9 @@ func (e *AgeEncryption) builtinEncrypt(plaintext []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if fingerprintsRecipient, ok := newAgeFingerprintsRecipient(recipients); ok {
+		recipients = append(recipients, fingerprintsRecipient)
+	}
 	ciphertextBuffer := &bytes.Buffer{}
 	armoredCiphertextWriter := armor.NewWriter(ciphertextBuffer)
 	ciphertextWriteCloser, err := age.Encrypt(armoredCiphertextWriter, recipients...)
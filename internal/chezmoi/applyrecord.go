@@ -0,0 +1,65 @@
+package chezmoi
+
+import (
+	"encoding/hex"
+	"time"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoiset"
+)
+
+// ApplyRecordIDFormat is the format of apply record IDs. Apply record IDs sort
+// in the order in which the applies were made.
+const ApplyRecordIDFormat = "20060102T150405.000000000Z"
+
+// An ApplyRecord records the state of the targets modified by an apply before
+// the apply was made.
+type ApplyRecord struct {
+	ID          string                  `json:"id"          yaml:"id"`
+	Time        time.Time               `json:"time"        yaml:"time"`
+	Journal     []*JournalEntry         `json:"journal"     yaml:"journal"`
+	EntryStates map[AbsPath]*EntryState `json:"entryStates" yaml:"entryStates"`
+}
+
+// NewApplyRecord returns a new ApplyRecord made at t.
+func NewApplyRecord(t time.Time) *ApplyRecord {
+	t = t.UTC()
+	return &ApplyRecord{
+		ID:          t.Format(ApplyRecordIDFormat),
+		Time:        t,
+		EntryStates: make(map[AbsPath]*EntryState),
+	}
+}
+
+// TargetAbsPaths returns the paths of the targets in r, in the order in which
+// they were first modified.
+func (r *ApplyRecord) TargetAbsPaths() []AbsPath {
+	var targetAbsPaths []AbsPath
+	seen := make(map[AbsPath]struct{})
+	for _, entry := range r.Journal {
+		if _, ok := seen[entry.AbsPath]; ok {
+			continue
+		}
+		seen[entry.AbsPath] = struct{}{}
+		targetAbsPaths = append(targetAbsPaths, entry.AbsPath)
+	}
+	return targetAbsPaths
+}
+
+// ContentsSHA256s returns the hex-encoded SHA256 sums of the contents of all
+// files in r's journal.
+func (r *ApplyRecord) ContentsSHA256s() chezmoiset.Set[string] {
+	contentsSHA256s := chezmoiset.New[string]()
+	var addContentsSHA256s func(*JournalEntry)
+	addContentsSHA256s = func(entry *JournalEntry) {
+		if entry.Type == EntryStateTypeFile {
+			contentsSHA256s.Add(hex.EncodeToString(entry.ContentsSHA256))
+		}
+		for _, child := range entry.Children {
+			addContentsSHA256s(child)
+		}
+	}
+	for _, entry := range r.Journal {
+		addContentsSHA256s(entry)
+	}
+	return contentsSHA256s
+}
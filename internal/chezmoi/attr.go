@@ -13,14 +13,15 @@ var (
 )
 
 // A SourceFileTargetType is a the type of a target represented by a file in the
-// source state. A file in the source state can represent a file, script, or
-// symlink in the target state.
+// source state. A file in the source state can represent a file, hard link,
+// script, or symlink in the target state.
 type SourceFileTargetType int
 
 // Source file types.
 const (
 	SourceFileTypeCreate SourceFileTargetType = iota
 	SourceFileTypeFile
+	SourceFileTypeHardlink
 	SourceFileTypeModify
 	SourceFileTypeRemove
 	SourceFileTypeScript
@@ -28,12 +29,13 @@ const (
 )
 
 var sourceFileTypeStrs = map[SourceFileTargetType]string{
-	SourceFileTypeCreate:  "create",
-	SourceFileTypeFile:    "file",
-	SourceFileTypeModify:  "modify",
-	SourceFileTypeRemove:  "remove",
-	SourceFileTypeScript:  "script",
-	SourceFileTypeSymlink: "symlink",
+	SourceFileTypeCreate:   "create",
+	SourceFileTypeFile:     "file",
+	SourceFileTypeHardlink: "hardlink",
+	SourceFileTypeModify:   "modify",
+	SourceFileTypeRemove:   "remove",
+	SourceFileTypeScript:   "script",
+	SourceFileTypeSymlink:  "symlink",
 }
 
 // A ScriptOrder defines when a script should be executed.
@@ -69,16 +71,17 @@ type DirAttr struct {
 
 // A FileAttr holds attributes parsed from a source file name.
 type FileAttr struct {
-	TargetName string
-	Type       SourceFileTargetType
-	Condition  ScriptCondition
-	Empty      bool
-	Encrypted  bool
-	Executable bool
-	Order      ScriptOrder
-	Private    bool
-	ReadOnly   bool
-	Template   bool
+	TargetName      string
+	Type            SourceFileTargetType
+	Condition       ScriptCondition
+	Empty           bool
+	Encrypted       bool
+	EncryptedValues bool
+	Executable      bool
+	Order           ScriptOrder
+	Private         bool
+	ReadOnly        bool
+	Template        bool
 }
 
 // parseDirAttr parses a single directory name in the source state.
@@ -192,6 +195,9 @@ func parseFileAttr(name, encryptedSuffix string) (FileAttr, error) {
 		name, readOnly = strings.CutPrefix(name, readOnlyPrefix)
 		name, empty = strings.CutPrefix(name, emptyPrefix)
 		name, executable = strings.CutPrefix(name, executablePrefix)
+	case strings.HasPrefix(name, hardlinkPrefix):
+		sourceFileType = SourceFileTypeHardlink
+		name = name[len(hardlinkPrefix):]
 	case strings.HasPrefix(name, removePrefix):
 		sourceFileType = SourceFileTypeRemove
 		name = name[len(removePrefix):]
@@ -277,6 +283,7 @@ func (fa FileAttr) LogValue() slog.Value {
 		slog.String("Condition", string(fa.Condition)),
 		slog.Bool("Empty", fa.Empty),
 		slog.Bool("Encrypted", fa.Encrypted),
+		slog.Bool("EncryptedValues", fa.EncryptedValues),
 		slog.Bool("Executable", fa.Executable),
 		slog.Int("Order", int(fa.Order)),
 		slog.Bool("Private", fa.Private),
@@ -322,6 +329,8 @@ func (fa FileAttr) SourceName(encryptedSuffix string) string {
 		if fa.Executable {
 			sourceName += executablePrefix
 		}
+	case SourceFileTypeHardlink:
+		sourceName = hardlinkPrefix
 	case SourceFileTypeModify:
 		sourceName = modifyPrefix
 		if fa.Encrypted {
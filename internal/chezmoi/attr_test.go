@@ -88,6 +88,7 @@ func TestFileAttr(t *testing.T) {
 		"create_name",
 		"dot_name",
 		"exact_name",
+		"hardlink_name",
 		"literal_name",
 		"literal_name",
 		"modify_name",
@@ -136,6 +137,15 @@ func TestFileAttr(t *testing.T) {
 		ReadOnly:   []bool{false, true},
 		Template:   []bool{false, true},
 	}))
+	assert.NoError(t, combinator.Generate(&fileAttrs, struct {
+		Type       SourceFileTargetType
+		TargetName []string
+		Template   []bool
+	}{
+		Type:       SourceFileTypeHardlink,
+		TargetName: targetNames,
+		Template:   []bool{false, true},
+	}))
 	assert.NoError(t, combinator.Generate(&fileAttrs, struct {
 		Type       SourceFileTargetType
 		TargetName []string
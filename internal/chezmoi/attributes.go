@@ -0,0 +1,311 @@
+package chezmoi
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoiset"
+)
+
+// Attribute names in .chezmoiattributes files.
+const (
+	createAttribute          = "create"
+	encryptedAttribute       = "encrypted"
+	encryptedValuesAttribute = "encryptedvalues"
+	encryptionAttribute      = "encryption"
+	exactAttribute           = "exact"
+	executableAttribute      = "executable"
+	modeAttribute            = "mode"
+	privateAttribute         = "private"
+	tagsAttribute            = "tags"
+	templateAttribute        = "template"
+)
+
+var (
+	boolAttributes = chezmoiset.New(
+		createAttribute,
+		encryptedAttribute,
+		encryptedValuesAttribute,
+		exactAttribute,
+		executableAttribute,
+		privateAttribute,
+		templateAttribute,
+	)
+	patternMetaRx = regexp.MustCompile(`[*?[\]{}\\]`)
+	tagRx         = regexp.MustCompile(`\A[0-9A-Za-z][-.0-9A-Z_a-z]*\z`)
+)
+
+// An attribute is an attribute in a .chezmoiattributes file. As in
+// gitattributes, an attribute is either set (name), unset (-name), or set to a
+// value (name=value).
+type attribute struct {
+	name  string
+	unset bool
+	value string
+}
+
+// An attributeRule assigns attributes to all targets that match pattern.
+type attributeRule struct {
+	pattern    string
+	attributes []attribute
+}
+
+// targetAttributes are the attributes of a target, accumulated from all
+// attribute rules that match the target. Later rules take precedence over
+// earlier rules, except for tags, which accumulate.
+type targetAttributes struct {
+	bools      map[string]bool
+	encryption string
+	hasMode    bool
+	mode       fs.FileMode
+	tags       []string
+}
+
+// String returns a's representation in a .chezmoiattributes file.
+func (a attribute) String() string {
+	switch {
+	case a.unset:
+		return "-" + a.name
+	case a.value != "":
+		return a.name + "=" + a.value
+	default:
+		return a.name
+	}
+}
+
+// parseAttribute parses an attribute from s.
+func parseAttribute(s string) (attribute, error) {
+	var a attribute
+	switch name, value, ok := strings.Cut(s, "="); {
+	case strings.HasPrefix(s, "-"):
+		a = attribute{
+			name:  s[1:],
+			unset: true,
+		}
+	case ok:
+		a = attribute{
+			name:  name,
+			value: value,
+		}
+	default:
+		a = attribute{
+			name: s,
+		}
+	}
+	switch {
+	case boolAttributes.Contains(a.name):
+		if a.value != "" {
+			return attribute{}, fmt.Errorf("%s: attribute does not take a value", a.name)
+		}
+	case a.name == encryptionAttribute:
+		if !a.unset && a.value == "" {
+			return attribute{}, fmt.Errorf("%s: attribute requires a value", a.name)
+		}
+	case a.name == modeAttribute:
+		if a.unset {
+			break
+		}
+		if _, err := parseModeAttribute(a.value); err != nil {
+			return attribute{}, err
+		}
+	case a.name == tagsAttribute:
+		if a.unset {
+			break
+		}
+		if _, err := parseTagsAttribute(a.value); err != nil {
+			return attribute{}, err
+		}
+	default:
+		return attribute{}, fmt.Errorf("%s: unknown attribute", a.name)
+	}
+	return a, nil
+}
+
+// parseAttributesLine parses a line from a .chezmoiattributes file. It returns
+// an empty pattern if the line is blank.
+func parseAttributesLine(line []byte) (string, []attribute, error) {
+	fields := bytes.Fields(commentRx.ReplaceAll(line, nil))
+	if len(fields) == 0 {
+		return "", nil, nil
+	}
+	attributes := make([]attribute, 0, len(fields)-1)
+	for _, field := range fields[1:] {
+		a, err := parseAttribute(string(field))
+		if err != nil {
+			return "", nil, err
+		}
+		attributes = append(attributes, a)
+	}
+	return string(fields[0]), attributes, nil
+}
+
+// parseModeAttribute parses the value of the mode attribute, which is an octal
+// permission mode.
+func parseModeAttribute(value string) (fs.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode&^uint64(fs.ModePerm) != 0 {
+		return 0, fmt.Errorf("%s: invalid mode", value)
+	}
+	return fs.FileMode(mode), nil
+}
+
+// parseTagsAttribute parses the value of the tags attribute, which is a
+// comma-separated list of tags.
+func parseTagsAttribute(value string) ([]string, error) {
+	tags := strings.Split(value, ",")
+	for _, tag := range tags {
+		if !tagRx.MatchString(tag) {
+			return nil, fmt.Errorf("%q: invalid tag", tag)
+		}
+	}
+	return tags, nil
+}
+
+// attributesPattern returns a pattern that matches exactly targetRelPath.
+func attributesPattern(targetRelPath RelPath) string {
+	return patternMetaRx.ReplaceAllString(targetRelPath.String(), `\$0`)
+}
+
+// matchAttributes returns the accumulated attributes of all rules in
+// attributeRules that match targetRelPath, or nil if no rules match.
+func matchAttributes(attributeRules []attributeRule, targetRelPath RelPath) *targetAttributes {
+	var result *targetAttributes
+	for _, attributeRule := range attributeRules {
+		if ok, _ := doublestar.Match(attributeRule.pattern, targetRelPath.String()); !ok {
+			continue
+		}
+		if result == nil {
+			result = &targetAttributes{
+				bools: make(map[string]bool),
+			}
+		}
+		for _, a := range attributeRule.attributes {
+			switch a.name {
+			case encryptionAttribute:
+				result.encryption = a.value
+			case modeAttribute:
+				result.hasMode = !a.unset
+				result.mode, _ = parseModeAttribute(a.value)
+			case tagsAttribute:
+				if a.unset {
+					result.tags = nil
+					continue
+				}
+				tags, _ := parseTagsAttribute(a.value)
+				for _, tag := range tags {
+					if !slices.Contains(result.tags, tag) {
+						result.tags = append(result.tags, tag)
+					}
+				}
+			default:
+				result.bools[a.name] = !a.unset
+			}
+		}
+	}
+	if result != nil {
+		slices.Sort(result.tags)
+	}
+	return result
+}
+
+// modifyDirAttr returns da modified by ta.
+func (ta *targetAttributes) modifyDirAttr(da DirAttr) DirAttr {
+	if exact, ok := ta.bools[exactAttribute]; ok {
+		da.Exact = exact
+	}
+	if private, ok := ta.bools[privateAttribute]; ok {
+		da.Private = private
+	}
+	return da
+}
+
+// modifyFileAttr returns fa modified by ta. Attributes that do not apply to
+// fa's type are ignored.
+func (ta *targetAttributes) modifyFileAttr(fa FileAttr) FileAttr {
+	switch fa.Type {
+	case SourceFileTypeCreate, SourceFileTypeFile:
+		switch create, ok := ta.bools[createAttribute]; {
+		case ok && create:
+			fa.Type = SourceFileTypeCreate
+		case ok && !create:
+			fa.Type = SourceFileTypeFile
+		}
+		if encrypted, ok := ta.bools[encryptedAttribute]; ok {
+			fa.Encrypted = encrypted
+		}
+		if encryptedValues, ok := ta.bools[encryptedValuesAttribute]; ok {
+			fa.EncryptedValues = encryptedValues
+		}
+		fallthrough
+	case SourceFileTypeModify:
+		if executable, ok := ta.bools[executableAttribute]; ok {
+			fa.Executable = executable
+		}
+		if private, ok := ta.bools[privateAttribute]; ok {
+			fa.Private = private
+		}
+		fallthrough
+	case SourceFileTypeHardlink, SourceFileTypeScript, SourceFileTypeSymlink:
+		if template, ok := ta.bools[templateAttribute]; ok {
+			fa.Template = template
+		}
+	case SourceFileTypeRemove:
+	}
+	return fa
+}
+
+// updateAttributesFile returns data, the contents of a .chezmoiattributes file,
+// with the boolean attributes of the line whose pattern is pattern updated to
+// values. True values are set and false values are unset. If there is no line
+// for pattern then one is appended.
+func updateAttributesFile(data []byte, pattern string, values map[string]bool) ([]byte, error) {
+	update := func(attributes []attribute) []byte {
+		attributes = slices.DeleteFunc(attributes, func(a attribute) bool {
+			_, ok := values[a.name]
+			return ok
+		})
+		for _, name := range slices.Sorted(maps.Keys(values)) {
+			attributes = append(attributes, attribute{
+				name:  name,
+				unset: !values[name],
+			})
+		}
+		fields := make([]string, 0, 1+len(attributes))
+		fields = append(fields, pattern)
+		for _, a := range attributes {
+			fields = append(fields, a.String())
+		}
+		return []byte(strings.Join(fields, " ") + "\n")
+	}
+
+	var buffer bytes.Buffer
+	found := false
+	lineNumber := 0
+	for line := range bytes.Lines(data) {
+		lineNumber++
+		switch linePattern, attributes, err := parseAttributesLine(line); {
+		case err != nil:
+			return nil, fmt.Errorf("%d: %w", lineNumber, err)
+		case linePattern == pattern && !found:
+			buffer.Write(update(attributes))
+			found = true
+		default:
+			buffer.Write(line)
+			if !bytes.HasSuffix(line, []byte{'\n'}) {
+				buffer.WriteByte('\n')
+			}
+		}
+	}
+	if !found {
+		buffer.Write(update(nil))
+	}
+	return buffer.Bytes(), nil
+}
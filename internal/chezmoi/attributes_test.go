@@ -0,0 +1,278 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoitest"
+)
+
+func TestParseAttributesLine(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		line               string
+		expectedPattern    string
+		expectedAttributes []attribute
+		expectedErr        string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "comment",
+			line: "# comment",
+		},
+		{
+			name:            "attributes",
+			line:            ".ssh/** private -template mode=0600 tags=ssh,work # comment",
+			expectedPattern: ".ssh/**",
+			expectedAttributes: []attribute{
+				{name: "private"},
+				{name: "template", unset: true},
+				{name: "mode", value: "0600"},
+				{name: "tags", value: "ssh,work"},
+			},
+		},
+		{
+			name:            "unset_value",
+			line:            ".file -mode -tags",
+			expectedPattern: ".file",
+			expectedAttributes: []attribute{
+				{name: "mode", unset: true},
+				{name: "tags", unset: true},
+			},
+		},
+		{
+			name:        "unknown_attribute",
+			line:        ".file readonly",
+			expectedErr: "readonly: unknown attribute",
+		},
+		{
+			name:        "bool_value",
+			line:        ".file private=true",
+			expectedErr: "private: attribute does not take a value",
+		},
+		{
+			name:        "invalid_mode",
+			line:        ".file mode=0999",
+			expectedErr: "0999: invalid mode",
+		},
+		{
+			name:            "encryption",
+			line:            ".secret encryption=gpg",
+			expectedPattern: ".secret",
+			expectedAttributes: []attribute{
+				{name: "encryption", value: "gpg"},
+			},
+		},
+		{
+			name:        "encryption_without_value",
+			line:        ".secret encryption",
+			expectedErr: "encryption: attribute requires a value",
+		},
+		{
+			name:        "invalid_tag",
+			line:        ".file tags=work,",
+			expectedErr: `"": invalid tag`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actualPattern, actualAttributes, err := parseAttributesLine([]byte(tc.line))
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPattern, actualPattern)
+			if tc.expectedAttributes != nil {
+				assert.Equal(t, tc.expectedAttributes, actualAttributes)
+			}
+		})
+	}
+}
+
+func TestMatchAttributes(t *testing.T) {
+	attributeRules := []attributeRule{
+		{
+			pattern: ".ssh/**",
+			attributes: []attribute{
+				{name: "private"},
+				{name: "tags", value: "ssh"},
+			},
+		},
+		{
+			pattern: ".ssh/config",
+			attributes: []attribute{
+				{name: "private", unset: true},
+				{name: "template"},
+				{name: "mode", value: "0640"},
+				{name: "tags", value: "work,ssh"},
+			},
+		},
+		{
+			pattern: ".ssh/id_*",
+			attributes: []attribute{
+				{name: "encryption", value: "gpg"},
+			},
+		},
+		{
+			pattern: ".ssh/known_hosts",
+			attributes: []attribute{
+				{name: "tags", unset: true},
+			},
+		},
+	}
+	for _, tc := range []struct {
+		targetRelPath RelPath
+		expected      *targetAttributes
+	}{
+		{
+			targetRelPath: NewRelPath(".bashrc"),
+		},
+		{
+			targetRelPath: NewRelPath(".ssh/authorized_keys"),
+			expected: &targetAttributes{
+				bools: map[string]bool{
+					"private": true,
+				},
+				tags: []string{"ssh"},
+			},
+		},
+		{
+			targetRelPath: NewRelPath(".ssh/config"),
+			expected: &targetAttributes{
+				bools: map[string]bool{
+					"private":  false,
+					"template": true,
+				},
+				hasMode: true,
+				mode:    0o640,
+				tags:    []string{"ssh", "work"},
+			},
+		},
+		{
+			targetRelPath: NewRelPath(".ssh/id_ed25519"),
+			expected: &targetAttributes{
+				bools: map[string]bool{
+					"private": true,
+				},
+				encryption: "gpg",
+				tags:       []string{"ssh"},
+			},
+		},
+		{
+			targetRelPath: NewRelPath(".ssh/known_hosts"),
+			expected: &targetAttributes{
+				bools: map[string]bool{
+					"private": true,
+				},
+			},
+		},
+	} {
+		t.Run(tc.targetRelPath.String(), func(t *testing.T) {
+			assert.Equal(t, tc.expected, matchAttributes(attributeRules, tc.targetRelPath))
+		})
+	}
+}
+
+func TestTargetAttributesModifyFileAttr(t *testing.T) {
+	ta := &targetAttributes{
+		bools: map[string]bool{
+			"create":     true,
+			"encrypted":  true,
+			"executable": true,
+			"private":    false,
+			"template":   true,
+		},
+	}
+	assert.Equal(t, FileAttr{
+		TargetName: ".file",
+		Type:       SourceFileTypeCreate,
+		Encrypted:  true,
+		Executable: true,
+		Template:   true,
+	}, ta.modifyFileAttr(FileAttr{
+		TargetName: ".file",
+		Type:       SourceFileTypeFile,
+		Private:    true,
+	}))
+	assert.Equal(t, FileAttr{
+		TargetName: ".symlink",
+		Type:       SourceFileTypeSymlink,
+		Template:   true,
+	}, ta.modifyFileAttr(FileAttr{
+		TargetName: ".symlink",
+		Type:       SourceFileTypeSymlink,
+	}))
+}
+
+func TestUpdateAttributesFile(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		data     string
+		pattern  string
+		values   map[string]bool
+		expected string
+	}{
+		{
+			name:    "empty",
+			pattern: ".file",
+			values: map[string]bool{
+				"template": true,
+				"private":  true,
+			},
+			expected: chezmoitest.JoinLines(
+				".file private template",
+			),
+		},
+		{
+			name: "append",
+			data: chezmoitest.JoinLines(
+				"# comment",
+				".dir exact",
+			),
+			pattern: ".file",
+			values: map[string]bool{
+				"private": false,
+			},
+			expected: chezmoitest.JoinLines(
+				"# comment",
+				".dir exact",
+				".file -private",
+			),
+		},
+		{
+			name: "update",
+			data: chezmoitest.JoinLines(
+				".file private tags=work",
+				"bin/* executable",
+			),
+			pattern: ".file",
+			values: map[string]bool{
+				"private":  false,
+				"template": true,
+			},
+			expected: chezmoitest.JoinLines(
+				".file tags=work -private template",
+				"bin/* executable",
+			),
+		},
+		{
+			name:    "escape",
+			pattern: attributesPattern(NewRelPath("[dir]/*.txt")),
+			values: map[string]bool{
+				"template": true,
+			},
+			expected: chezmoitest.JoinLines(
+				`\[dir\]/\*.txt template`,
+			),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := updateAttributesFile([]byte(tc.data), tc.pattern, tc.values)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(actual))
+		})
+	}
+}
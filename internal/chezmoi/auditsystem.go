@@ -0,0 +1,345 @@
+package chezmoi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"os/exec"
+	"slices"
+	"sync"
+	"time"
+
+	vfs "github.com/twpayne/go-vfs/v5"
+)
+
+// An AuditRecord is a record of a single change made by an AuditSystem.
+type AuditRecord struct {
+	Time         time.Time   `json:"time"`
+	Command      string      `json:"command,omitempty"`
+	Op           string      `json:"op"`
+	Target       AbsPath     `json:"target"`
+	OldTarget    AbsPath     `json:"oldTarget,omitempty"`
+	Source       AbsPath     `json:"source,omitempty"`
+	Script       RelPath     `json:"script,omitzero"`
+	Args         []string    `json:"args,omitempty"`
+	Mode         fs.FileMode `json:"mode,omitempty"`
+	ModTime      time.Time   `json:"modTime,omitzero"`
+	UID          int         `json:"uid,omitempty"`
+	GID          int         `json:"gid,omitempty"`
+	Xattrs       []string    `json:"xattrs,omitempty"`
+	BeforeSHA256 HexBytes    `json:"beforeSHA256,omitempty"`
+	AfterSHA256  HexBytes    `json:"afterSHA256,omitempty"`
+	Error        string      `json:"error,omitempty"`
+	PrevSHA256   HexBytes    `json:"prevSHA256,omitempty"`
+}
+
+// AuditSystemOptions are options to NewAuditSystem.
+type AuditSystemOptions struct {
+	// Command is the command recorded in each record.
+	Command string
+	// PrevSHA256 is the SHA256 of the last record already written, if any.
+	PrevSHA256 []byte
+	// SourceAbsPathFunc, if not nil, returns the source path of the entry that
+	// caused a change to a target.
+	SourceAbsPathFunc func(targetAbsPath AbsPath) AbsPath
+	// TimeNowFunc, if not nil, returns the current time.
+	TimeNowFunc func() time.Time
+}
+
+// An AuditSystem is a System that writes a record of every change to a
+// System to a log in JSON Lines format. Each record includes the SHA256 of the
+// previous record, so the log is tamper-evident.
+type AuditSystem struct {
+	system            System
+	writer            io.Writer
+	command           string
+	sourceAbsPathFunc func(AbsPath) AbsPath
+	timeNowFunc       func() time.Time
+	mutex             sync.Mutex
+	prevSHA256        []byte
+}
+
+// NewAuditSystem returns a new AuditSystem that wraps system and writes
+// records to w.
+func NewAuditSystem(system System, w io.Writer, options AuditSystemOptions) *AuditSystem {
+	timeNowFunc := options.TimeNowFunc
+	if timeNowFunc == nil {
+		timeNowFunc = time.Now
+	}
+	return &AuditSystem{
+		system:            system,
+		writer:            w,
+		command:           options.Command,
+		sourceAbsPathFunc: options.SourceAbsPathFunc,
+		timeNowFunc:       timeNowFunc,
+		prevSHA256:        options.PrevSHA256,
+	}
+}
+
+// LastSHA256 returns the SHA256 of the last record written by s, or of the
+// last record already written if s has not written any records.
+func (s *AuditSystem) LastSHA256() []byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.prevSHA256
+}
+
+// LastAuditRecordSHA256 returns the SHA256 of the last record in data, which
+// should be the contents of an audit log, or nil if there are no records.
+func LastAuditRecordSHA256(data []byte) []byte {
+	data = bytes.TrimRight(data, "\n")
+	if len(data) == 0 {
+		return nil
+	}
+	if index := bytes.LastIndexByte(data, '\n'); index != -1 {
+		data = data[index+1:]
+	}
+	return sha256Sum(data)
+}
+
+// Chmod implements System.Chmod.
+func (s *AuditSystem) Chmod(name AbsPath, mode fs.FileMode) error {
+	err := s.system.Chmod(name, mode)
+	return s.record(err, &AuditRecord{
+		Op:     "Chmod",
+		Target: name,
+		Mode:   mode,
+	})
+}
+
+// Chown implements System.Chown.
+func (s *AuditSystem) Chown(name AbsPath, uid, gid int) error {
+	err := s.system.Chown(name, uid, gid)
+	return s.record(err, &AuditRecord{
+		Op:     "Chown",
+		Target: name,
+		UID:    uid,
+		GID:    gid,
+	})
+}
+
+// Chtimes implements System.Chtimes.
+func (s *AuditSystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
+	err := s.system.Chtimes(name, atime, mtime)
+	return s.record(err, &AuditRecord{
+		Op:      "Chtimes",
+		Target:  name,
+		ModTime: mtime,
+	})
+}
+
+// Glob implements System.Glob.
+func (s *AuditSystem) Glob(pattern string) ([]string, error) {
+	return s.system.Glob(pattern)
+}
+
+// Lgetxattrs implements System.Lgetxattrs.
+func (s *AuditSystem) Lgetxattrs(name AbsPath) (map[string][]byte, error) {
+	return s.system.Lgetxattrs(name)
+}
+
+// Link implements System.Link.
+func (s *AuditSystem) Link(oldName, newName AbsPath) error {
+	beforeSHA256 := s.contentsSHA256(newName)
+	afterSHA256 := s.contentsSHA256(oldName)
+	err := s.system.Link(oldName, newName)
+	return s.record(err, &AuditRecord{
+		Op:           "Link",
+		Target:       newName,
+		OldTarget:    oldName,
+		BeforeSHA256: beforeSHA256,
+		AfterSHA256:  afterSHA256,
+	})
+}
+
+// Lsetxattrs implements System.Lsetxattrs.
+func (s *AuditSystem) Lsetxattrs(name AbsPath, xattrs map[string][]byte) error {
+	err := s.system.Lsetxattrs(name, xattrs)
+	return s.record(err, &AuditRecord{
+		Op:     "Lsetxattrs",
+		Target: name,
+		Xattrs: slices.Sorted(maps.Keys(xattrs)),
+	})
+}
+
+// Lstat implements System.Lstat.
+func (s *AuditSystem) Lstat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Lstat(name)
+}
+
+// Mkdir implements System.Mkdir.
+func (s *AuditSystem) Mkdir(name AbsPath, perm fs.FileMode) error {
+	err := s.system.Mkdir(name, perm)
+	return s.record(err, &AuditRecord{
+		Op:     "Mkdir",
+		Target: name,
+		Mode:   perm,
+	})
+}
+
+// RawPath implements System.RawPath.
+func (s *AuditSystem) RawPath(path AbsPath) (AbsPath, error) {
+	return s.system.RawPath(path)
+}
+
+// ReadDir implements System.ReadDir.
+func (s *AuditSystem) ReadDir(name AbsPath) ([]fs.DirEntry, error) {
+	return s.system.ReadDir(name)
+}
+
+// ReadFile implements System.ReadFile.
+func (s *AuditSystem) ReadFile(name AbsPath) ([]byte, error) {
+	return s.system.ReadFile(name)
+}
+
+// Readlink implements System.Readlink.
+func (s *AuditSystem) Readlink(name AbsPath) (string, error) {
+	return s.system.Readlink(name)
+}
+
+// Remove implements System.Remove.
+func (s *AuditSystem) Remove(name AbsPath) error {
+	beforeSHA256 := s.contentsSHA256(name)
+	err := s.system.Remove(name)
+	return s.record(err, &AuditRecord{
+		Op:           "Remove",
+		Target:       name,
+		BeforeSHA256: beforeSHA256,
+	})
+}
+
+// RemoveAll implements System.RemoveAll.
+func (s *AuditSystem) RemoveAll(name AbsPath) error {
+	beforeSHA256 := s.contentsSHA256(name)
+	err := s.system.RemoveAll(name)
+	return s.record(err, &AuditRecord{
+		Op:           "RemoveAll",
+		Target:       name,
+		BeforeSHA256: beforeSHA256,
+	})
+}
+
+// Rename implements System.Rename.
+func (s *AuditSystem) Rename(oldPath, newPath AbsPath) error {
+	beforeSHA256 := s.contentsSHA256(newPath)
+	afterSHA256 := s.contentsSHA256(oldPath)
+	err := s.system.Rename(oldPath, newPath)
+	return s.record(err, &AuditRecord{
+		Op:           "Rename",
+		Target:       newPath,
+		OldTarget:    oldPath,
+		BeforeSHA256: beforeSHA256,
+		AfterSHA256:  afterSHA256,
+	})
+}
+
+// RunCmd implements System.RunCmd.
+func (s *AuditSystem) RunCmd(cmd *exec.Cmd) error {
+	err := s.system.RunCmd(cmd)
+	return s.record(err, &AuditRecord{
+		Op:     "RunCmd",
+		Target: NewAbsPath(cmd.Dir),
+		Args:   cmd.Args,
+	})
+}
+
+// RunScript implements System.RunScript.
+func (s *AuditSystem) RunScript(scriptName RelPath, dir AbsPath, data []byte, options RunScriptOptions) error {
+	err := s.system.RunScript(scriptName, dir, data, options)
+	return s.record(err, &AuditRecord{
+		Op:          "RunScript",
+		Target:      dir,
+		Script:      options.SourceRelPath.RelPath(),
+		AfterSHA256: sha256Sum(data),
+	})
+}
+
+// Stat implements System.Stat.
+func (s *AuditSystem) Stat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Stat(name)
+}
+
+// UnderlyingFS implements System.UnderlyingFS.
+func (s *AuditSystem) UnderlyingFS() vfs.FS {
+	return s.system.UnderlyingFS()
+}
+
+// WriteFile implements System.WriteFile.
+func (s *AuditSystem) WriteFile(name AbsPath, data []byte, perm fs.FileMode) error {
+	beforeSHA256 := s.contentsSHA256(name)
+	err := s.system.WriteFile(name, data, perm)
+	return s.record(err, &AuditRecord{
+		Op:           "WriteFile",
+		Target:       name,
+		Mode:         perm,
+		BeforeSHA256: beforeSHA256,
+		AfterSHA256:  sha256Sum(data),
+	})
+}
+
+// WriteSymlink implements System.WriteSymlink.
+func (s *AuditSystem) WriteSymlink(oldName string, newName AbsPath) error {
+	beforeSHA256 := s.contentsSHA256(newName)
+	err := s.system.WriteSymlink(oldName, newName)
+	return s.record(err, &AuditRecord{
+		Op:           "WriteSymlink",
+		Target:       newName,
+		BeforeSHA256: beforeSHA256,
+		AfterSHA256:  sha256Sum([]byte(oldName)),
+	})
+}
+
+// record completes auditRecord with the result err of the change and writes
+// it to s's log. It returns err, or the error writing the record.
+func (s *AuditSystem) record(err error, auditRecord *AuditRecord) error {
+	auditRecord.Time = s.timeNowFunc()
+	auditRecord.Command = s.command
+	if s.sourceAbsPathFunc != nil && auditRecord.Script.IsEmpty() && auditRecord.Args == nil {
+		auditRecord.Source = s.sourceAbsPathFunc(auditRecord.Target)
+	}
+	if err != nil {
+		auditRecord.Error = err.Error()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	auditRecord.PrevSHA256 = s.prevSHA256
+	data, marshalErr := json.Marshal(auditRecord)
+	if marshalErr != nil {
+		return errors.Join(err, marshalErr)
+	}
+	if _, writeErr := s.writer.Write(append(data, '\n')); writeErr != nil {
+		return errors.Join(err, writeErr)
+	}
+	s.prevSHA256 = sha256Sum(data)
+	return err
+}
+
+// contentsSHA256 returns the SHA256 of the contents of the file, or the target of the
+// symlink, at name, or nil if name does not exist or is a directory.
+func (s *AuditSystem) contentsSHA256(name AbsPath) []byte {
+	fileInfo, err := s.system.Lstat(name)
+	if err != nil {
+		return nil
+	}
+	switch fileInfo.Mode().Type() {
+	case 0:
+		data, err := s.system.ReadFile(name)
+		if err != nil {
+			return nil
+		}
+		return sha256Sum(data)
+	case fs.ModeSymlink:
+		linkname, err := s.system.Readlink(name)
+		if err != nil {
+			return nil
+		}
+		return sha256Sum([]byte(linkname))
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,166 @@
+package chezmoi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v5"
+	"github.com/twpayne/go-vfs/v5/vfst"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoitest"
+)
+
+var _ System = &AuditSystem{}
+
+func TestAuditSystem(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user": map[string]any{
+			".dir":     &vfst.Dir{Perm: fs.ModePerm},
+			".file":    "# contents of .file\n",
+			".symlink": &vfst.Symlink{Target: ".file"},
+		},
+	}, func(fileSystem vfs.FS) {
+		now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+		prevSHA256 := sha256Sum([]byte("previous record"))
+		buffer := &bytes.Buffer{}
+		system := NewAuditSystem(NewRealSystem(fileSystem), buffer, AuditSystemOptions{
+			Command:    "chezmoi apply",
+			PrevSHA256: prevSHA256,
+			SourceAbsPathFunc: func(targetAbsPath AbsPath) AbsPath {
+				if targetAbsPath == NewAbsPath("/home/user/.file") {
+					return NewAbsPath("/home/user/.local/share/chezmoi/dot_file")
+				}
+				return EmptyAbsPath
+			},
+			TimeNowFunc: func() time.Time {
+				return now
+			},
+		})
+
+		assert.NoError(t, system.WriteFile(NewAbsPath("/home/user/.file"), []byte("# new contents of .file\n"), 0o666))
+		assert.NoError(t, system.Chmod(NewAbsPath("/home/user/.file"), 0o600))
+		assert.NoError(t, system.Chtimes(NewAbsPath("/home/user/.file"), now, now))
+		assert.NoError(t, system.WriteSymlink(".dir", NewAbsPath("/home/user/.symlink")))
+		assert.NoError(t, system.Rename(NewAbsPath("/home/user/.file"), NewAbsPath("/home/user/.renamed")))
+		assert.NoError(t, system.Remove(NewAbsPath("/home/user/.renamed")))
+		assert.Error(t, system.Remove(NewAbsPath("/home/user/.missing")))
+		assert.NoError(t, system.RemoveAll(NewAbsPath("/home/user/.dir")))
+
+		lines := bytes.Split(bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), []byte("\n"))
+		auditRecords := make([]AuditRecord, 0, len(lines))
+		for i, line := range lines {
+			var auditRecord AuditRecord
+			assert.NoError(t, json.Unmarshal(line, &auditRecord))
+			if i == 0 {
+				assert.Equal(t, HexBytes(prevSHA256), auditRecord.PrevSHA256)
+			} else {
+				assert.Equal(t, HexBytes(sha256Sum(lines[i-1])), auditRecord.PrevSHA256)
+			}
+			auditRecord.PrevSHA256 = nil
+			auditRecords = append(auditRecords, auditRecord)
+		}
+		assert.Equal(t, sha256Sum(lines[len(lines)-1]), LastAuditRecordSHA256(buffer.Bytes()))
+		assert.Equal(t, sha256Sum(lines[len(lines)-1]), system.LastSHA256())
+
+		assert.Equal(t, []AuditRecord{
+			{
+				Time:         now,
+				Command:      "chezmoi apply",
+				Op:           "WriteFile",
+				Target:       NewAbsPath("/home/user/.file"),
+				Source:       NewAbsPath("/home/user/.local/share/chezmoi/dot_file"),
+				Mode:         0o666,
+				BeforeSHA256: sha256Sum([]byte("# contents of .file\n")),
+				AfterSHA256:  sha256Sum([]byte("# new contents of .file\n")),
+			},
+			{
+				Time:    now,
+				Command: "chezmoi apply",
+				Op:      "Chmod",
+				Target:  NewAbsPath("/home/user/.file"),
+				Source:  NewAbsPath("/home/user/.local/share/chezmoi/dot_file"),
+				Mode:    0o600,
+			},
+			{
+				Time:    now,
+				Command: "chezmoi apply",
+				Op:      "Chtimes",
+				Target:  NewAbsPath("/home/user/.file"),
+				Source:  NewAbsPath("/home/user/.local/share/chezmoi/dot_file"),
+				ModTime: now,
+			},
+			{
+				Time:         now,
+				Command:      "chezmoi apply",
+				Op:           "WriteSymlink",
+				Target:       NewAbsPath("/home/user/.symlink"),
+				BeforeSHA256: sha256Sum([]byte(".file")),
+				AfterSHA256:  sha256Sum([]byte(".dir")),
+			},
+			{
+				Time:        now,
+				Command:     "chezmoi apply",
+				Op:          "Rename",
+				Target:      NewAbsPath("/home/user/.renamed"),
+				OldTarget:   NewAbsPath("/home/user/.file"),
+				AfterSHA256: sha256Sum([]byte("# new contents of .file\n")),
+			},
+			{
+				Time:         now,
+				Command:      "chezmoi apply",
+				Op:           "Remove",
+				Target:       NewAbsPath("/home/user/.renamed"),
+				BeforeSHA256: sha256Sum([]byte("# new contents of .file\n")),
+			},
+			{
+				Time:    now,
+				Command: "chezmoi apply",
+				Op:      "Remove",
+				Target:  NewAbsPath("/home/user/.missing"),
+				Error:   auditRecords[6].Error,
+			},
+			{
+				Time:    now,
+				Command: "chezmoi apply",
+				Op:      "RemoveAll",
+				Target:  NewAbsPath("/home/user/.dir"),
+			},
+		}, auditRecords)
+		assert.NotZero(t, auditRecords[6].Error)
+	})
+}
+
+func TestLastAuditRecordSHA256(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		data     string
+		expected []byte
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "one_record",
+			data:     "{\"op\":\"WriteFile\"}\n",
+			expected: sha256Sum([]byte("{\"op\":\"WriteFile\"}")),
+		},
+		{
+			name:     "two_records",
+			data:     "{\"op\":\"WriteFile\"}\n{\"op\":\"Remove\"}\n",
+			expected: sha256Sum([]byte("{\"op\":\"Remove\"}")),
+		},
+		{
+			name:     "no_trailing_newline",
+			data:     "{\"op\":\"WriteFile\"}\n{\"op\":\"Remove\"}",
+			expected: sha256Sum([]byte("{\"op\":\"Remove\"}")),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, LastAuditRecordSHA256([]byte(tc.data)))
+		})
+	}
+}
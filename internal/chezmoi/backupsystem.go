@@ -0,0 +1,420 @@
+package chezmoi
+
+import (
+	"errors"
+	"io/fs"
+	"os/exec"
+	"sync"
+	"time"
+
+	vfs "github.com/twpayne/go-vfs/v5"
+)
+
+// BackupManifestName is the name of the manifest in a backup.
+const BackupManifestName = ".chezmoibackup.json"
+
+// A BackupManifest records the metadata of a backup that is not recorded by
+// the backed up entries themselves.
+type BackupManifest struct {
+	// DirPerms contains the original permissions of the directories that were
+	// backed up. Directories in the backup that are not in DirPerms were only
+	// created to contain backed up entries.
+	DirPerms map[RelPath]fs.FileMode `json:"dirPerms" yaml:"dirPerms"`
+	// Owners contains the original owners of the entries that were backed up,
+	// if known.
+	Owners map[RelPath]BackupOwner `json:"owners,omitempty" yaml:"owners,omitempty"`
+	// Xattrs contains the original extended attributes of the entries that
+	// were backed up that had extended attributes.
+	Xattrs map[RelPath]map[string]HexBytes `json:"xattrs,omitempty" yaml:"xattrs,omitempty"`
+}
+
+// A BackupOwner is the owner of a backed up entry.
+type BackupOwner struct {
+	UID int `json:"uid" yaml:"uid"`
+	GID int `json:"gid" yaml:"gid"`
+}
+
+// A BackupSystem is a System that copies entries in a directory to a backup
+// System before they are overwritten or removed.
+type BackupSystem struct {
+	system           System
+	dirAbsPath       AbsPath
+	backupSystem     System
+	backupDirAbsPath AbsPath
+	mutex            sync.Mutex
+	backedUp         map[AbsPath]struct{}
+	absent           map[AbsPath]struct{}
+	backupDirs       map[AbsPath]struct{}
+	manifest         BackupManifest
+}
+
+// NewBackupSystem returns a new BackupSystem that wraps system and copies
+// entries in dirAbsPath to backupDirAbsPath in backupSystem before they are
+// overwritten or removed. backupDirAbsPath is created on the first backup,
+// unless it is DotAbsPath. Its parent directory must already exist.
+func NewBackupSystem(system System, dirAbsPath AbsPath, backupSystem System, backupDirAbsPath AbsPath) *BackupSystem {
+	return &BackupSystem{
+		system:           system,
+		dirAbsPath:       dirAbsPath,
+		backupSystem:     backupSystem,
+		backupDirAbsPath: backupDirAbsPath,
+		backedUp:         make(map[AbsPath]struct{}),
+		absent:           make(map[AbsPath]struct{}),
+		backupDirs:       make(map[AbsPath]struct{}),
+		manifest: BackupManifest{
+			DirPerms: make(map[RelPath]fs.FileMode),
+			Owners:   make(map[RelPath]BackupOwner),
+			Xattrs:   make(map[RelPath]map[string]HexBytes),
+		},
+	}
+}
+
+// BackedUp returns true if s has backed up any entries.
+func (s *BackupSystem) BackedUp() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.backedUp) > 0
+}
+
+// Finish writes the manifest of the backup, if s has backed up any entries. It
+// must be called after the last entry is backed up.
+func (s *BackupSystem) Finish() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.backedUp) == 0 {
+		return nil
+	}
+	data, err := FormatJSON.Marshal(&s.manifest)
+	if err != nil {
+		return err
+	}
+	return s.backupSystem.WriteFile(s.backupDirAbsPath.JoinString(BackupManifestName), data, 0o600)
+}
+
+// Chmod implements System.Chmod.
+func (s *BackupSystem) Chmod(name AbsPath, mode fs.FileMode) error {
+	if err := s.backupMetadata(name); err != nil {
+		return err
+	}
+	return s.system.Chmod(name, mode)
+}
+
+// Chown implements System.Chown.
+func (s *BackupSystem) Chown(name AbsPath, uid, gid int) error {
+	if err := s.backupMetadata(name); err != nil {
+		return err
+	}
+	return s.system.Chown(name, uid, gid)
+}
+
+// Chtimes implements System.Chtimes.
+func (s *BackupSystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
+	return s.system.Chtimes(name, atime, mtime)
+}
+
+// Glob implements System.Glob.
+func (s *BackupSystem) Glob(pattern string) ([]string, error) {
+	return s.system.Glob(pattern)
+}
+
+// Lgetxattrs implements System.Lgetxattrs.
+func (s *BackupSystem) Lgetxattrs(name AbsPath) (map[string][]byte, error) {
+	return s.system.Lgetxattrs(name)
+}
+
+// Link implements System.Link.
+func (s *BackupSystem) Link(oldName, newName AbsPath) error {
+	if err := s.backup(newName); err != nil {
+		return err
+	}
+	return s.system.Link(oldName, newName)
+}
+
+// Lsetxattrs implements System.Lsetxattrs.
+func (s *BackupSystem) Lsetxattrs(name AbsPath, xattrs map[string][]byte) error {
+	if err := s.backupMetadata(name); err != nil {
+		return err
+	}
+	return s.system.Lsetxattrs(name, xattrs)
+}
+
+// Lstat implements System.Lstat.
+func (s *BackupSystem) Lstat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Lstat(name)
+}
+
+// Mkdir implements System.Mkdir.
+func (s *BackupSystem) Mkdir(name AbsPath, perm fs.FileMode) error {
+	if _, err := s.system.Lstat(name); errors.Is(err, fs.ErrNotExist) {
+		s.mutex.Lock()
+		s.absent[name] = struct{}{}
+		s.mutex.Unlock()
+	}
+	return s.system.Mkdir(name, perm)
+}
+
+// RawPath implements System.RawPath.
+func (s *BackupSystem) RawPath(path AbsPath) (AbsPath, error) {
+	return s.system.RawPath(path)
+}
+
+// ReadDir implements System.ReadDir.
+func (s *BackupSystem) ReadDir(name AbsPath) ([]fs.DirEntry, error) {
+	return s.system.ReadDir(name)
+}
+
+// ReadFile implements System.ReadFile.
+func (s *BackupSystem) ReadFile(name AbsPath) ([]byte, error) {
+	return s.system.ReadFile(name)
+}
+
+// Readlink implements System.Readlink.
+func (s *BackupSystem) Readlink(name AbsPath) (string, error) {
+	return s.system.Readlink(name)
+}
+
+// Remove implements System.Remove.
+func (s *BackupSystem) Remove(name AbsPath) error {
+	if err := s.backup(name); err != nil {
+		return err
+	}
+	return s.system.Remove(name)
+}
+
+// RemoveAll implements System.RemoveAll.
+func (s *BackupSystem) RemoveAll(name AbsPath) error {
+	if err := s.backup(name); err != nil {
+		return err
+	}
+	return s.system.RemoveAll(name)
+}
+
+// Rename implements System.Rename.
+func (s *BackupSystem) Rename(oldPath, newPath AbsPath) error {
+	if err := s.backup(newPath); err != nil {
+		return err
+	}
+	return s.system.Rename(oldPath, newPath)
+}
+
+// RunCmd implements System.RunCmd.
+func (s *BackupSystem) RunCmd(cmd *exec.Cmd) error {
+	return s.system.RunCmd(cmd)
+}
+
+// RunScript implements System.RunScript.
+func (s *BackupSystem) RunScript(scriptName RelPath, dir AbsPath, data []byte, options RunScriptOptions) error {
+	return s.system.RunScript(scriptName, dir, data, options)
+}
+
+// Stat implements System.Stat.
+func (s *BackupSystem) Stat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Stat(name)
+}
+
+// UnderlyingFS implements System.UnderlyingFS.
+func (s *BackupSystem) UnderlyingFS() vfs.FS {
+	return s.system.UnderlyingFS()
+}
+
+// WriteFile implements System.WriteFile.
+func (s *BackupSystem) WriteFile(name AbsPath, data []byte, perm fs.FileMode) error {
+	if err := s.backup(name); err != nil {
+		return err
+	}
+	return s.system.WriteFile(name, data, perm)
+}
+
+// WriteSymlink implements System.WriteSymlink.
+func (s *BackupSystem) WriteSymlink(oldName string, newName AbsPath) error {
+	if err := s.backup(newName); err != nil {
+		return err
+	}
+	return s.system.WriteSymlink(oldName, newName)
+}
+
+// backup copies absPath to the backup directory, if it exists, is in s's
+// directory, and has not already been backed up.
+func (s *BackupSystem) backup(absPath AbsPath) error {
+	relPath, err := absPath.TrimDirPrefix(s.dirAbsPath)
+	if err != nil || relPath.IsEmpty() {
+		return nil //nolint:nilerr
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.isBackedUp(absPath) {
+		return nil
+	}
+	fileInfo, err := s.system.Lstat(absPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		s.absent[absPath] = struct{}{}
+		return nil
+	case err != nil:
+		return err
+	}
+	if err := s.mkdirAll(s.backupDirAbsPath.Join(relPath.Dir())); err != nil {
+		return err
+	}
+	if err := s.copy(absPath, relPath, fileInfo); err != nil {
+		return err
+	}
+	s.backedUp[absPath] = struct{}{}
+	return nil
+}
+
+// backupMetadata backs up absPath before its permissions, ownership, or
+// extended attributes are changed. Directories are backed up without their
+// children.
+func (s *BackupSystem) backupMetadata(absPath AbsPath) error {
+	fileInfo, err := s.system.Lstat(absPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	case !fileInfo.IsDir():
+		return s.backup(absPath)
+	}
+	relPath, err := absPath.TrimDirPrefix(s.dirAbsPath)
+	if err != nil || relPath.IsEmpty() {
+		return nil //nolint:nilerr
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.isBackedUp(absPath) {
+		return nil
+	}
+	if err := s.mkdirAll(s.backupDirAbsPath.Join(relPath.Dir())); err != nil {
+		return err
+	}
+	backupAbsPath := s.backupDirAbsPath.Join(relPath)
+	if _, ok := s.backupDirs[backupAbsPath]; !ok {
+		if err := s.backupSystem.Mkdir(backupAbsPath, fileInfo.Mode().Perm()|0o700); err != nil {
+			return err
+		}
+		s.backupDirs[backupAbsPath] = struct{}{}
+	}
+	return s.recordMetadata(absPath, relPath, fileInfo)
+}
+
+// recordMetadata records the permissions, if absPath is a directory,
+// ownership, and extended attributes of absPath, with fs.FileInfo fileInfo, in
+// the manifest, unless they have already been recorded.
+func (s *BackupSystem) recordMetadata(absPath AbsPath, relPath RelPath, fileInfo fs.FileInfo) error {
+	if fileInfo.IsDir() {
+		if _, ok := s.manifest.DirPerms[relPath]; ok {
+			return nil
+		}
+		s.manifest.DirPerms[relPath] = fileInfo.Mode().Perm()
+	}
+	if uid, gid, ok := fileOwnerIDs(fileInfo); ok {
+		s.manifest.Owners[relPath] = BackupOwner{
+			UID: uid,
+			GID: gid,
+		}
+	}
+	xattrs, err := s.system.Lgetxattrs(absPath)
+	if err != nil {
+		return err
+	}
+	if len(xattrs) > 0 {
+		s.manifest.Xattrs[relPath] = make(map[string]HexBytes, len(xattrs))
+		for name, value := range xattrs {
+			s.manifest.Xattrs[relPath][name] = value
+		}
+	}
+	return nil
+}
+
+// copy copies absPath, with fs.FileInfo fileInfo, to relPath in the backup
+// directory.
+func (s *BackupSystem) copy(absPath AbsPath, relPath RelPath, fileInfo fs.FileInfo) error {
+	backupAbsPath := s.backupDirAbsPath.Join(relPath)
+	switch fileInfo.Mode().Type() {
+	case 0, fs.ModeDir, fs.ModeSymlink:
+		if err := s.recordMetadata(absPath, relPath, fileInfo); err != nil {
+			return err
+		}
+	}
+	switch fileInfo.Mode().Type() {
+	case 0:
+		data, err := s.system.ReadFile(absPath)
+		if err != nil {
+			return err
+		}
+		return s.backupSystem.WriteFile(backupAbsPath, data, fileInfo.Mode().Perm())
+	case fs.ModeDir:
+		if _, ok := s.backupDirs[backupAbsPath]; !ok {
+			if err := s.backupSystem.Mkdir(backupAbsPath, fileInfo.Mode().Perm()|0o700); err != nil {
+				return err
+			}
+			s.backupDirs[backupAbsPath] = struct{}{}
+		}
+		dirEntries, err := s.system.ReadDir(absPath)
+		if err != nil {
+			return err
+		}
+		for _, dirEntry := range dirEntries {
+			childFileInfo, err := dirEntry.Info()
+			if err != nil {
+				return err
+			}
+			childAbsPath := absPath.JoinString(dirEntry.Name())
+			if _, ok := s.backedUp[childAbsPath]; ok {
+				continue
+			}
+			if err := s.copy(childAbsPath, relPath.JoinString(dirEntry.Name()), childFileInfo); err != nil {
+				return err
+			}
+		}
+		return nil
+	case fs.ModeSymlink:
+		linkname, err := s.system.Readlink(absPath)
+		if err != nil {
+			return err
+		}
+		return s.backupSystem.WriteSymlink(linkname, backupAbsPath)
+	default:
+		return &UnsupportedFileTypeError{
+			absPath: absPath,
+			mode:    fileInfo.Mode(),
+		}
+	}
+}
+
+// isBackedUp returns true if absPath or any of its parent directories have
+// already been backed up, or did not exist when they were first modified.
+func (s *BackupSystem) isBackedUp(absPath AbsPath) bool {
+	for absPath != s.dirAbsPath {
+		if _, ok := s.backedUp[absPath]; ok {
+			return true
+		}
+		if _, ok := s.absent[absPath]; ok {
+			return true
+		}
+		absPath = absPath.Dir()
+	}
+	return false
+}
+
+// mkdirAll creates dirAbsPath and any missing parent directories in the backup
+// directory. The directories are not recorded in the manifest, so their
+// permissions are not restored.
+func (s *BackupSystem) mkdirAll(dirAbsPath AbsPath) error {
+	if _, ok := s.backupDirs[dirAbsPath]; ok {
+		return nil
+	}
+	if dirAbsPath != s.backupDirAbsPath {
+		if err := s.mkdirAll(dirAbsPath.Dir()); err != nil {
+			return err
+		}
+	}
+	if dirAbsPath != DotAbsPath {
+		if err := s.backupSystem.Mkdir(dirAbsPath, 0o700); err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	}
+	s.backupDirs[dirAbsPath] = struct{}{}
+	return nil
+}
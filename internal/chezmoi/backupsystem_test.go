@@ -0,0 +1,111 @@
+package chezmoi
+
+import (
+	"io/fs"
+	"maps"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v5"
+	"github.com/twpayne/go-vfs/v5/vfst"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoitest"
+)
+
+var _ System = &BackupSystem{}
+
+func TestBackupSystem(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user": map[string]any{
+			".backup": &vfst.Dir{Perm: fs.ModePerm},
+			".dir": map[string]any{
+				"file":    "# contents of .dir/file\n",
+				"subfile": "# contents of .dir/subfile\n",
+			},
+			".dir2": map[string]any{
+				"file": "# contents of .dir2/file\n",
+			},
+			".file":    "# contents of .file\n",
+			".private": "# contents of .private\n",
+			".symlink": &vfst.Symlink{Target: ".file"},
+		},
+	}, func(fileSystem vfs.FS) {
+		realSystem := NewRealSystem(fileSystem)
+		system := NewBackupSystem(
+			realSystem,
+			NewAbsPath("/home/user"),
+			realSystem,
+			NewAbsPath("/home/user/.backup/backup"),
+		)
+
+		assert.False(t, system.BackedUp())
+		assert.NoError(t, system.WriteFile(NewAbsPath("/home/user/.new"), nil, 0o666))
+		assert.NoError(t, system.Chmod(NewAbsPath("/home/user/.new"), 0o600))
+		assert.False(t, system.BackedUp())
+
+		assert.NoError(t, system.WriteFile(NewAbsPath("/home/user/.dir/file"), []byte("# new contents of .dir/file\n"), 0o666))
+		assert.NoError(t, system.RemoveAll(NewAbsPath("/home/user/.dir")))
+		assert.NoError(t, system.WriteFile(NewAbsPath("/home/user/.file"), []byte("# new contents of .file\n"), 0o666))
+		assert.NoError(t, system.WriteFile(NewAbsPath("/home/user/.file"), []byte("# newer contents of .file\n"), 0o666))
+		assert.NoError(t, system.Remove(NewAbsPath("/home/user/.symlink")))
+		assert.NoError(t, system.Chmod(NewAbsPath("/home/user/.private"), 0o600))
+		assert.NoError(t, system.Chmod(NewAbsPath("/home/user/.dir2"), 0o700))
+		assert.True(t, system.BackedUp())
+		assert.NoError(t, system.Finish())
+
+		manifestData, err := realSystem.ReadFile(NewAbsPath("/home/user/.backup/backup").JoinString(BackupManifestName))
+		assert.NoError(t, err)
+		var manifest BackupManifest
+		assert.NoError(t, FormatJSON.Unmarshal(manifestData, &manifest))
+		assert.Equal(t, map[RelPath]fs.FileMode{
+			NewRelPath(".dir"):  fs.ModePerm &^ chezmoitest.Umask,
+			NewRelPath(".dir2"): fs.ModePerm &^ chezmoitest.Umask,
+		}, manifest.DirPerms)
+		if runtime.GOOS != "windows" {
+			assert.Equal(t, []RelPath{
+				NewRelPath(".dir"),
+				NewRelPath(".dir/file"),
+				NewRelPath(".dir/subfile"),
+				NewRelPath(".dir2"),
+				NewRelPath(".file"),
+				NewRelPath(".private"),
+				NewRelPath(".symlink"),
+			}, slices.SortedFunc(maps.Keys(manifest.Owners), CompareRelPaths))
+		}
+
+		vfst.RunTests(t, fileSystem, "",
+			vfst.TestPath("/home/user/.backup/backup/.dir/file",
+				vfst.TestModeIsRegular(),
+				vfst.TestContentsString("# contents of .dir/file\n"),
+			),
+			vfst.TestPath("/home/user/.backup/backup/.dir/subfile",
+				vfst.TestModeIsRegular(),
+				vfst.TestContentsString("# contents of .dir/subfile\n"),
+			),
+			vfst.TestPath("/home/user/.backup/backup/.dir2",
+				vfst.TestIsDir(),
+			),
+			vfst.TestPath("/home/user/.backup/backup/.dir2/file",
+				vfst.TestDoesNotExist(),
+			),
+			vfst.TestPath("/home/user/.backup/backup/.file",
+				vfst.TestModeIsRegular(),
+				vfst.TestContentsString("# contents of .file\n"),
+			),
+			vfst.TestPath("/home/user/.backup/backup/.new",
+				vfst.TestDoesNotExist(),
+			),
+			vfst.TestPath("/home/user/.backup/backup/.private",
+				vfst.TestModeIsRegular(),
+				vfst.TestModePerm(0o666&^chezmoitest.Umask),
+				vfst.TestContentsString("# contents of .private\n"),
+			),
+			vfst.TestPath("/home/user/.backup/backup/.symlink",
+				vfst.TestModeType(fs.ModeSymlink),
+				vfst.TestSymlinkTarget(".file"),
+			),
+		)
+	})
+}
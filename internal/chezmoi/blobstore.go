@@ -0,0 +1,106 @@
+package chezmoi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoiset"
+)
+
+// A BlobStore is a content-addressed store of blobs, keyed by the SHA256 sum
+// of their contents. Blobs may be plaintext copies of private or encrypted
+// targets, so they are only accessible by the owner.
+type BlobStore struct {
+	system     System
+	dirAbsPath AbsPath
+}
+
+// NewBlobStore returns a new BlobStore that stores blobs in dirAbsPath in
+// system.
+func NewBlobStore(system System, dirAbsPath AbsPath) *BlobStore {
+	return &BlobStore{
+		system:     system,
+		dirAbsPath: dirAbsPath,
+	}
+}
+
+// Get returns the blob with SHA256 sum contentsSHA256.
+func (s *BlobStore) Get(contentsSHA256 []byte) ([]byte, error) {
+	data, err := s.system.ReadFile(s.absPath(contentsSHA256))
+	if err != nil {
+		return nil, err
+	}
+	if dataSHA256 := sha256.Sum256(data); !bytes.Equal(dataSHA256[:], contentsSHA256) {
+		return nil, fmt.Errorf("%x: blob is corrupt", contentsSHA256)
+	}
+	return data, nil
+}
+
+// Put stores data in s.
+func (s *BlobStore) Put(data []byte) error {
+	dataSHA256 := sha256.Sum256(data)
+	absPath := s.absPath(dataSHA256[:])
+	for _, dirAbsPath := range []AbsPath{s.dirAbsPath, absPath.Dir()} {
+		if err := MkdirAll(s.system, dirAbsPath, 0o700); err != nil {
+			return err
+		}
+		if err := s.system.Chmod(dirAbsPath, 0o700); err != nil {
+			return err
+		}
+	}
+	switch _, err := s.system.Lstat(absPath); {
+	case err == nil:
+		return s.system.Chmod(absPath, 0o600)
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	return s.system.WriteFile(absPath, data, 0o600)
+}
+
+// RemoveUnreferenced removes all blobs in s whose hex-encoded SHA256 sums are
+// not in referenced.
+func (s *BlobStore) RemoveUnreferenced(referenced chezmoiset.Set[string]) error {
+	dirEntries, err := s.system.ReadDir(s.dirAbsPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	}
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		dirAbsPath := s.dirAbsPath.JoinString(dirEntry.Name())
+		blobDirEntries, err := s.system.ReadDir(dirAbsPath)
+		if err != nil {
+			return err
+		}
+		remaining := len(blobDirEntries)
+		for _, blobDirEntry := range blobDirEntries {
+			if referenced.Contains(dirEntry.Name() + blobDirEntry.Name()) {
+				continue
+			}
+			if err := s.system.Remove(dirAbsPath.JoinString(blobDirEntry.Name())); err != nil {
+				return err
+			}
+			remaining--
+		}
+		if remaining == 0 {
+			if err := s.system.Remove(dirAbsPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// absPath returns the path of the blob with SHA256 sum contentsSHA256.
+func (s *BlobStore) absPath(contentsSHA256 []byte) AbsPath {
+	hexSHA256 := hex.EncodeToString(contentsSHA256)
+	return s.dirAbsPath.JoinString(hexSHA256[:2], hexSHA256[2:])
+}
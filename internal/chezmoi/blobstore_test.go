@@ -0,0 +1,49 @@
+package chezmoi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v5"
+	"github.com/twpayne/go-vfs/v5/vfst"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoiset"
+	"chezmoi.io/chezmoi/v2/internal/chezmoitest"
+)
+
+func TestBlobStore(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user/.cache/chezmoi": &vfst.Dir{Perm: fs.ModePerm},
+	}, func(fileSystem vfs.FS) {
+		system := NewRealSystem(fileSystem)
+		blobStore := NewBlobStore(system, NewAbsPath("/home/user/.cache/chezmoi/blobs"))
+
+		data := []byte("# contents of .file\n")
+		dataSHA256 := sha256.Sum256(data)
+
+		_, err := blobStore.Get(dataSHA256[:])
+		assert.IsError(t, err, fs.ErrNotExist)
+
+		assert.NoError(t, blobStore.Put(data))
+		assert.NoError(t, blobStore.Put(data))
+		actualData, err := blobStore.Get(dataSHA256[:])
+		assert.NoError(t, err)
+		assert.Equal(t, data, actualData)
+
+		otherData := []byte("# contents of .other\n")
+		otherDataSHA256 := sha256.Sum256(otherData)
+		assert.NoError(t, blobStore.Put(otherData))
+		assert.NoError(t, blobStore.RemoveUnreferenced(chezmoiset.New(hex.EncodeToString(dataSHA256[:]))))
+		_, err = blobStore.Get(otherDataSHA256[:])
+		assert.IsError(t, err, fs.ErrNotExist)
+		_, err = blobStore.Get(dataSHA256[:])
+		assert.NoError(t, err)
+
+		assert.NoError(t, system.WriteFile(blobStore.absPath(dataSHA256[:]), []byte("corrupt"), 0o666))
+		_, err = blobStore.Get(dataSHA256[:])
+		assert.Error(t, err)
+	})
+}
@@ -44,6 +44,7 @@ const (
 	exactPrefix      = "exact_"
 	executablePrefix = "executable_"
 	externalPrefix   = "external_"
+	hardlinkPrefix   = "hardlink_"
 	literalPrefix    = "literal_"
 	modifyPrefix     = "modify_"
 	oncePrefix       = "once_"
@@ -61,21 +62,26 @@ const (
 const (
 	Prefix = ".chezmoi"
 
+	RecipientsName   = Prefix + "recipients"
 	RootName         = Prefix + "root"
 	TemplatesDirName = Prefix + "templates"
+	TestsDirName     = Prefix + "tests"
 	VersionName      = Prefix + "version"
+	attributesName   = Prefix + "attributes"
 	dataName         = Prefix + "data"
 	externalName     = Prefix + "external"
 	externalsDirName = Prefix + "externals"
 	ignoreName       = Prefix + "ignore"
+	ownersName       = Prefix + "owners"
 	removeName       = Prefix + "remove"
 	scriptsDirName   = Prefix + "scripts"
+	xattrsName       = Prefix + "xattrs"
 )
 
 var (
 	dirPrefixRx  = regexp.MustCompile(`\A(dot|exact|literal|readonly|private)_`)
 	filePrefixRx = regexp.MustCompile(
-		`\A(after|before|create|dot|empty|encrypted|executable|literal|modify|once|private|readonly|remove|run|symlink)_`,
+		`\A(after|before|create|dot|empty|encrypted|executable|hardlink|literal|modify|once|private|readonly|remove|run|symlink)_`,
 	)
 	fileSuffixRx = regexp.MustCompile(`\.(literal|tmpl)\z`)
 	whitespaceRx = regexp.MustCompile(`\s+`)
@@ -86,8 +92,12 @@ var knownPrefixedFiles = chezmoiset.New(
 	Prefix+".json"+TemplateSuffix,
 	Prefix+".toml"+TemplateSuffix,
 	Prefix+".yaml"+TemplateSuffix,
+	RecipientsName+TemplateSuffix,
+	RecipientsName,
 	RootName,
 	VersionName,
+	attributesName+TemplateSuffix,
+	attributesName,
 	dataName+".json",
 	dataName+".toml",
 	dataName+".yaml",
@@ -99,13 +109,17 @@ var knownPrefixedFiles = chezmoiset.New(
 	externalName+".yaml",
 	ignoreName+TemplateSuffix,
 	ignoreName,
+	ownersName+TemplateSuffix,
+	ownersName,
 	removeName+TemplateSuffix,
 	removeName,
+	xattrsName,
 )
 
 // knownPrefixedDirs is a set of known dirnames with the .chezmoi prefix.
 var knownPrefixedDirs = chezmoiset.New(
 	TemplatesDirName,
+	TestsDirName,
 	dataName,
 	externalsDirName,
 	scriptsDirName,
@@ -384,6 +398,12 @@ func sha1Sum(data []byte) []byte {
 	return sha1SumArr[:]
 }
 
+// sha256Sum returns the SHA256 sum of data.
+func sha256Sum(data []byte) []byte {
+	sha256SumArr := sha256.Sum256(data)
+	return sha256SumArr[:]
+}
+
 // sha384Sum returns the SHA384 sum of data.
 func sha384Sum(data []byte) []byte {
 	sha384SumArr := sha512.Sum384(data)
@@ -5,6 +5,8 @@ package chezmoi
 import (
 	"io/fs"
 	"os"
+	"strconv"
+	"syscall"
 
 	"golang.org/x/sys/unix"
 )
@@ -26,8 +28,47 @@ func UserHomeDir() (string, error) {
 	return os.UserHomeDir()
 }
 
+// fileInode returns the inode of fileInfo, or zero if it is not known.
+func fileInode(fileInfo fs.FileInfo) uint64 {
+	if statT, ok := fileInfo.Sys().(*syscall.Stat_t); ok {
+		return uint64(statT.Ino) //nolint:gosec,unconvert
+	}
+	return 0
+}
+
+// fileOwnerIDs returns the user and group IDs of the owner of fileInfo, and
+// whether they are known.
+func fileOwnerIDs(fileInfo fs.FileInfo) (uid, gid int, ok bool) {
+	statT, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(statT.Uid), int(statT.Gid), true
+}
+
+// fileOwnership returns the names of the owner and group of fileInfo, or
+// empty strings if they are not known.
+func fileOwnership(fileInfo fs.FileInfo) (owner, group string) {
+	if statT, ok := fileInfo.Sys().(*syscall.Stat_t); ok {
+		owner = userName(strconv.FormatUint(uint64(statT.Uid), 10))
+		group = groupName(strconv.FormatUint(uint64(statT.Gid), 10))
+	}
+	return owner, group
+}
+
 // findExecutableExtensions returns valid OS executable extensions, on unix it
 // can be anything.
 func findExecutableExtensions(path string) []string {
 	return []string{path}
 }
+
+// sameFile returns true if fileInfo1 and fileInfo2 describe the same file,
+// i.e. they have the same device and inode.
+func sameFile(fileInfo1, fileInfo2 fs.FileInfo) bool {
+	statT1, ok1 := fileInfo1.Sys().(*syscall.Stat_t)
+	statT2, ok2 := fileInfo2.Sys().(*syscall.Stat_t)
+	if !ok1 || !ok2 {
+		return false
+	}
+	return statT1.Dev == statT2.Dev && statT1.Ino == statT2.Ino
+}
@@ -12,6 +12,21 @@ const nativeLineEnding = "\r\n"
 
 var pathExts = strings.Split(os.Getenv("PATHEXT"), string(filepath.ListSeparator))
 
+// fileInode returns zero as inodes are not available on Windows.
+func fileInode(fileInfo fs.FileInfo) uint64 {
+	return 0
+}
+
+// fileOwnerIDs returns false as ownership is not managed on Windows.
+func fileOwnerIDs(fileInfo fs.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// fileOwnership returns empty strings as ownership is not managed on Windows.
+func fileOwnership(fileInfo fs.FileInfo) (owner, group string) {
+	return "", ""
+}
+
 // findExecutableExtensions returns valid OS executable extensions for the
 // provided file if it does not already have an extension. The executable
 // extensions are derived from %PathExt%.
@@ -47,6 +62,11 @@ func IsExecutable(fileInfo fs.FileInfo) bool {
 	})
 }
 
+// sameFile returns true if fileInfo1 and fileInfo2 describe the same file.
+func sameFile(fileInfo1, fileInfo2 fs.FileInfo) bool {
+	return os.SameFile(fileInfo1, fileInfo2)
+}
+
 // UserHomeDir on Windows returns the value of $HOME if it is set and either
 // Cygwin or msys2 is detected, otherwise it falls back to os.UserHomeDir.
 func UserHomeDir() (string, error) {
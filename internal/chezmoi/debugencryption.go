@@ -65,3 +65,12 @@ func (e *DebugEncryption) EncryptFile(plaintextAbsPath AbsPath) ([]byte, error)
 func (e *DebugEncryption) EncryptedSuffix() string {
 	return e.encryption.EncryptedSuffix()
 }
+
+// withRecipients implements recipientsEncryption.withRecipients.
+func (e *DebugEncryption) withRecipients(recipients []string, replace bool) Encryption {
+	recipientsEncryption, ok := e.encryption.(recipientsEncryption)
+	if !ok {
+		return e
+	}
+	return NewDebugEncryption(recipientsEncryption.withRecipients(recipients, replace), e.logger)
+}
@@ -3,7 +3,9 @@ package chezmoi
 import (
 	"io/fs"
 	"log/slog"
+	"maps"
 	"os/exec"
+	"slices"
 	"time"
 
 	"github.com/twpayne/go-vfs/v5"
@@ -36,6 +38,17 @@ func (s *DebugSystem) Chmod(name AbsPath, mode fs.FileMode) error {
 	return err
 }
 
+// Chown implements System.Chown.
+func (s *DebugSystem) Chown(name AbsPath, uid, gid int) error {
+	err := s.system.Chown(name, uid, gid)
+	chezmoilog.InfoOrError(s.logger, "Chown", err,
+		chezmoilog.Stringer("name", name),
+		slog.Int("uid", uid),
+		slog.Int("gid", gid),
+	)
+	return err
+}
+
 // Chtimes implements System.Chtimes.
 func (s *DebugSystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
 	err := s.system.Chtimes(name, atime, mtime)
@@ -57,6 +70,16 @@ func (s *DebugSystem) Glob(name string) ([]string, error) {
 	return matches, err
 }
 
+// Lgetxattrs implements System.Lgetxattrs.
+func (s *DebugSystem) Lgetxattrs(name AbsPath) (map[string][]byte, error) {
+	xattrs, err := s.system.Lgetxattrs(name)
+	chezmoilog.InfoOrError(s.logger, "Lgetxattrs", err,
+		chezmoilog.Stringer("name", name),
+		slog.Int("len", len(xattrs)),
+	)
+	return xattrs, err
+}
+
 // Link implements System.Link.
 func (s *DebugSystem) Link(oldPath, newPath AbsPath) error {
 	err := s.system.Link(oldPath, newPath)
@@ -67,6 +90,16 @@ func (s *DebugSystem) Link(oldPath, newPath AbsPath) error {
 	return err
 }
 
+// Lsetxattrs implements System.Lsetxattrs.
+func (s *DebugSystem) Lsetxattrs(name AbsPath, xattrs map[string][]byte) error {
+	err := s.system.Lsetxattrs(name, xattrs)
+	chezmoilog.InfoOrError(s.logger, "Lsetxattrs", err,
+		chezmoilog.Stringer("name", name),
+		slog.Any("xattrs", slices.Sorted(maps.Keys(xattrs))),
+	)
+	return err
+}
+
 // Lstat implements System.Lstat.
 func (s *DebugSystem) Lstat(name AbsPath) (fs.FileInfo, error) {
 	fileInfo, err := s.system.Lstat(name)
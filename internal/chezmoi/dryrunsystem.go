@@ -28,6 +28,12 @@ func (s *DryRunSystem) Chmod(name AbsPath, mode fs.FileMode) error {
 	return nil
 }
 
+// Chown implements System.Chown.
+func (s *DryRunSystem) Chown(name AbsPath, uid, gid int) error {
+	s.setModified()
+	return nil
+}
+
 // Chtimes implements System.Chtimes.
 func (s *DryRunSystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
 	s.setModified()
@@ -45,12 +51,23 @@ func (s *DryRunSystem) IsModified() bool {
 	return s.modified
 }
 
+// Lgetxattrs implements System.Lgetxattrs.
+func (s *DryRunSystem) Lgetxattrs(name AbsPath) (map[string][]byte, error) {
+	return s.system.Lgetxattrs(name)
+}
+
 // Link implements System.Link.
 func (s *DryRunSystem) Link(oldName, newName AbsPath) error {
 	s.setModified()
 	return nil
 }
 
+// Lsetxattrs implements System.Lsetxattrs.
+func (s *DryRunSystem) Lsetxattrs(name AbsPath, xattrs map[string][]byte) error {
+	s.setModified()
+	return nil
+}
+
 // Lstat implements System.Lstat.
 func (s *DryRunSystem) Lstat(name AbsPath) (fs.FileInfo, error) {
 	return s.system.Lstat(name)
@@ -12,11 +12,12 @@ type DumpSystemDataType string
 
 // Dump system data types.
 const (
-	DumpSystemDataTypeCommand DumpSystemDataType = "command"
-	DumpSystemDataTypeDir     DumpSystemDataType = "dir"
-	DumpSystemDataTypeFile    DumpSystemDataType = "file"
-	DumpSystemDataTypeScript  DumpSystemDataType = "script"
-	DumpSystemDataTypeSymlink DumpSystemDataType = "symlink"
+	DumpSystemDataTypeCommand  DumpSystemDataType = "command"
+	DumpSystemDataTypeDir      DumpSystemDataType = "dir"
+	DumpSystemDataTypeFile     DumpSystemDataType = "file"
+	DumpSystemDataTypeHardlink DumpSystemDataType = "hardlink"
+	DumpSystemDataTypeScript   DumpSystemDataType = "script"
+	DumpSystemDataTypeSymlink  DumpSystemDataType = "symlink"
 )
 
 // A DumpSystem is a System that writes to a data file.
@@ -49,6 +50,13 @@ type DumpSystemFileData struct {
 	Perm     fs.FileMode        `json:"perm"     yaml:"perm"`
 }
 
+// A DumpSystemHardlinkData contains data about a hard link.
+type DumpSystemHardlinkData struct {
+	Type     DumpSystemDataType `json:"type"     yaml:"type"`
+	Name     AbsPath            `json:"name"     yaml:"name"`
+	Linkname AbsPath            `json:"linkname" yaml:"linkname"`
+}
+
 // A DumpSystemScriptData contains data about a script.
 type DumpSystemScriptData struct {
 	Type        DumpSystemDataType `json:"type"                  yaml:"type"`
@@ -72,11 +80,30 @@ func NewDumpSystem() *DumpSystem {
 	}
 }
 
+// Chown implements System.Chown.
+func (s *DumpSystem) Chown(name AbsPath, uid, gid int) error {
+	return nil
+}
+
 // Data returns s's data.
 func (s *DumpSystem) Data() map[string]any {
 	return s.data
 }
 
+// Link implements System.Link.
+func (s *DumpSystem) Link(oldName, newName AbsPath) error {
+	return s.setData(newName.String(), &DumpSystemHardlinkData{
+		Type:     DumpSystemDataTypeHardlink,
+		Name:     newName,
+		Linkname: oldName,
+	})
+}
+
+// Lsetxattrs implements System.Lsetxattrs.
+func (s *DumpSystem) Lsetxattrs(name AbsPath, xattrs map[string][]byte) error {
+	return nil
+}
+
 // Mkdir implements System.Mkdir.
 func (s *DumpSystem) Mkdir(dirname AbsPath, perm fs.FileMode) error {
 	return s.setData(dirname.String(), &DumpSystemDirData{
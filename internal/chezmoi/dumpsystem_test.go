@@ -26,8 +26,9 @@ func TestDumpSystem(t *testing.T) {
 			"dot_dir": map[string]any{
 				"file": "# contents of .dir/file\n",
 			},
-			"run_script":      "# contents of script\n",
-			"symlink_symlink": ".dir/subdir/file\n",
+			"hardlink_hardlink": ".dir/file\n",
+			"run_script":        "# contents of script\n",
+			"symlink_symlink":   ".dir/subdir/file\n",
 		},
 	}, func(fileSystem vfs.FS) {
 		ctx := t.Context()
@@ -64,6 +65,11 @@ func TestDumpSystem(t *testing.T) {
 				Contents: "# contents of .dir/file\n",
 				Perm:     0o666 &^ chezmoitest.Umask,
 			},
+			"hardlink": &DumpSystemHardlinkData{
+				Type:     DumpSystemDataTypeHardlink,
+				Name:     NewAbsPath("hardlink"),
+				Linkname: NewAbsPath(".dir/file"),
+			},
 			"script": &DumpSystemScriptData{
 				Type:      DumpSystemDataTypeScript,
 				Name:      NewAbsPath("script"),
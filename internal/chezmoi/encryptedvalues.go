@@ -0,0 +1,489 @@
+package chezmoi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
+	"github.com/tailscale/hujson"
+)
+
+// Encrypted value types. The bool, float, int, and str types contain the
+// value's canonical form and are only decrypted. The json, toml, and yaml types
+// contain the value's literal exactly as it was written in a document of that
+// format.
+const (
+	encryptedValueTypeBool   = "bool"
+	encryptedValueTypeFloat  = "float"
+	encryptedValueTypeInt    = "int"
+	encryptedValueTypeJSON   = "json"
+	encryptedValueTypeString = "str"
+	encryptedValueTypeTOML   = "toml"
+	encryptedValueTypeYAML   = "yaml"
+)
+
+var (
+	// encryptedValueRx matches an encrypted value, possibly quoted.
+	encryptedValueRx = regexp.MustCompile(
+		`(["']?)ENC\[(bool|float|int|json|str|toml|yaml):([+/0-9A-Za-z]+=*)\](["']?)`,
+	)
+
+	// wholeEncryptedValueRx matches a string that is an encrypted value.
+	wholeEncryptedValueRx = regexp.MustCompile(`\AENC\[(bool|float|int|json|str|toml|yaml):([+/0-9A-Za-z]+=*)\]\z`)
+)
+
+// A valueSpan is the location of a scalar value's literal in a document.
+type valueSpan struct {
+	path       string
+	start, end int
+}
+
+// EncryptValues returns the structured data plaintext in format with all
+// scalar values encrypted with encryption. Keys are not encrypted. Each value's
+// literal is replaced in place, so comments, key order, and formatting are
+// preserved and DecryptValues returns exactly plaintext. If oldCiphertext, the
+// previous result of EncryptValues, is not nil then values that are unchanged
+// keep their existing ciphertexts so that only changed values appear in diffs.
+func EncryptValues(encryption Encryption, format Format, plaintext, oldCiphertext []byte) ([]byte, error) {
+	valueType, spans, err := valueSpans(format, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	// If oldCiphertext cannot be parsed then ignore it and encrypt all values.
+	var oldEncryptedValues map[string]string
+	if oldCiphertext != nil {
+		if _, oldSpans, err := valueSpans(format, oldCiphertext); err == nil {
+			oldEncryptedValues = make(map[string]string, len(oldSpans))
+			for _, span := range oldSpans {
+				oldEncryptedValues[span.path] = string(oldCiphertext[span.start:span.end])
+			}
+		}
+	}
+
+	var builder strings.Builder
+	builder.Grow(len(plaintext))
+	offset := 0
+	for _, span := range spans {
+		literal := plaintext[span.start:span.end]
+		builder.Write(plaintext[offset:span.start])
+		offset = span.end
+		if wholeEncryptedValueRx.Match(bytes.Trim(literal, `"'`)) {
+			builder.Write(literal)
+			continue
+		}
+		if oldEncryptedValue, ok := oldEncryptedValues[span.path]; ok {
+			submatches := wholeEncryptedValueRx.FindStringSubmatch(strings.Trim(oldEncryptedValue, `"`))
+			if submatches != nil && submatches[1] == valueType {
+				if oldLiteral, err := decryptValuePlaintext(encryption, submatches[2]); err == nil &&
+					bytes.Equal(oldLiteral, literal) {
+					builder.WriteString(oldEncryptedValue)
+					continue
+				}
+			}
+		}
+		ciphertext, err := encryption.Encrypt(literal)
+		if err != nil {
+			return nil, err
+		}
+		builder.WriteString(`"` + encryptedValueString(valueType, ciphertext) + `"`)
+	}
+	builder.Write(plaintext[offset:])
+	return []byte(builder.String()), nil
+}
+
+// DecryptValues returns data with all encrypted values replaced by their
+// plaintext values. The rest of data, including comments, formatting, and
+// template actions, is unchanged.
+func DecryptValues(encryption Encryption, data []byte) ([]byte, error) {
+	var err error
+	result := encryptedValueRx.ReplaceAllFunc(data, func(match []byte) []byte {
+		if err != nil {
+			return match
+		}
+		submatches := encryptedValueRx.FindSubmatch(match)
+		openingQuote, valueType, ciphertext, closingQuote := submatches[1], submatches[2], submatches[3], submatches[4]
+		var literal []byte
+		if literal, err = decryptValueLiteral(encryption, string(valueType), string(ciphertext)); err != nil {
+			return match
+		}
+		if string(openingQuote) != string(closingQuote) {
+			return []byte(string(openingQuote) + string(literal) + string(closingQuote))
+		}
+		return literal
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// reencryptValues returns data with all encrypted values decrypted with
+// oldEncryption and encrypted again with newEncryption. The rest of data is
+// unchanged.
+func reencryptValues(oldEncryption, newEncryption Encryption, data []byte) ([]byte, error) {
+	var err error
+	result := encryptedValueRx.ReplaceAllFunc(data, func(match []byte) []byte {
+		if err != nil {
+			return match
+		}
+		submatches := encryptedValueRx.FindSubmatch(match)
+		openingQuote, valueType, ciphertext, closingQuote := submatches[1], submatches[2], submatches[3], submatches[4]
+		var plaintext, newCiphertext []byte
+		if plaintext, err = decryptValuePlaintext(oldEncryption, string(ciphertext)); err != nil {
+			return match
+		}
+		if newCiphertext, err = newEncryption.Encrypt(plaintext); err != nil {
+			return match
+		}
+		return []byte(string(openingQuote) + encryptedValueString(string(valueType), newCiphertext) + string(closingQuote))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// decryptValueTree returns value with all strings that are encrypted values
+// replaced by their plaintext values. Maps and slices are modified in place.
+func decryptValueTree(encryption Encryption, value any) (any, error) {
+	switch value := value.(type) {
+	case map[string]any:
+		for k, v := range value {
+			decryptedValue, err := decryptValueTree(encryption, v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			value[k] = decryptedValue
+		}
+		return value, nil
+	case []any:
+		for i, v := range value {
+			decryptedValue, err := decryptValueTree(encryption, v)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %w", i, err)
+			}
+			value[i] = decryptedValue
+		}
+		return value, nil
+	case []map[string]any:
+		for i, v := range value {
+			if _, err := decryptValueTree(encryption, v); err != nil {
+				return nil, fmt.Errorf("%d: %w", i, err)
+			}
+		}
+		return value, nil
+	case string:
+		submatches := wholeEncryptedValueRx.FindStringSubmatch(value)
+		if submatches == nil {
+			return value, nil
+		}
+		return decryptValue(encryption, submatches[1], submatches[2])
+	default:
+		return value, nil
+	}
+}
+
+// decryptValue decrypts the base64-encoded ciphertext of an encrypted value of
+// type valueType.
+func decryptValue(encryption Encryption, valueType, ciphertext string) (any, error) {
+	plaintext, err := decryptValuePlaintext(encryption, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	switch valueType {
+	case encryptedValueTypeBool:
+		return strconv.ParseBool(string(plaintext))
+	case encryptedValueTypeFloat:
+		return strconv.ParseFloat(string(plaintext), 64)
+	case encryptedValueTypeInt:
+		return strconv.ParseInt(string(plaintext), 10, 64)
+	case encryptedValueTypeString:
+		return string(plaintext), nil
+	case encryptedValueTypeJSON:
+		var value any
+		if err := FormatJSON.Unmarshal(plaintext, &value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	case encryptedValueTypeTOML:
+		var value map[string]any
+		if err := FormatTOML.Unmarshal([]byte("value = "+string(plaintext)), &value); err != nil {
+			return nil, err
+		}
+		return value["value"], nil
+	case encryptedValueTypeYAML:
+		var value map[string]any
+		if err := FormatYAML.Unmarshal([]byte("value: "+string(plaintext)), &value); err != nil {
+			return nil, err
+		}
+		return value["value"], nil
+	default:
+		return nil, fmt.Errorf("%s: unknown encrypted value type", valueType)
+	}
+}
+
+// decryptValueLiteral returns the literal of the encrypted value of type
+// valueType with the base64-encoded ciphertext.
+func decryptValueLiteral(encryption Encryption, valueType, ciphertext string) ([]byte, error) {
+	switch valueType {
+	case encryptedValueTypeJSON, encryptedValueTypeTOML, encryptedValueTypeYAML:
+		return decryptValuePlaintext(encryption, ciphertext)
+	}
+	value, err := decryptValue(encryption, valueType, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	literal, err := encryptedValueLiteral(value)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(literal), nil
+}
+
+// decryptValuePlaintext decrypts the base64-encoded ciphertext of an encrypted
+// value.
+func decryptValuePlaintext(encryption Encryption, ciphertext string) ([]byte, error) {
+	ciphertextBytes, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.Decrypt(ciphertextBytes)
+}
+
+// encryptedValueString returns the encrypted value of type valueType with
+// ciphertext.
+func encryptedValueString(valueType string, ciphertext []byte) string {
+	return "ENC[" + valueType + ":" + base64.StdEncoding.EncodeToString(ciphertext) + "]"
+}
+
+// encryptedValueLiteral returns value as a literal that is valid in JSON, TOML,
+// and YAML.
+func encryptedValueLiteral(value any) (string, error) {
+	switch value := value.(type) {
+	case float64:
+		literal := strconv.FormatFloat(value, 'g', -1, 64)
+		if !strings.ContainsAny(literal, ".eIN") {
+			literal += ".0"
+		}
+		return literal, nil
+	case string:
+		var builder strings.Builder
+		encoder := json.NewEncoder(&builder)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(value); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(builder.String(), "\n"), nil
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
+
+// valueSpans returns the encrypted value type for values in the structured data
+// data in format and the spans of the literals of all scalar values in data, in
+// order. null values are not included.
+func valueSpans(format Format, data []byte) (string, []valueSpan, error) {
+	switch format.Name() {
+	case FormatJSON.Name(), FormatJSONC.Name():
+		spans, err := jsonValueSpans(data)
+		return encryptedValueTypeJSON, spans, err
+	case FormatTOML.Name():
+		spans, err := tomlValueSpans(data)
+		return encryptedValueTypeTOML, spans, err
+	case FormatYAML.Name():
+		spans, err := yamlValueSpans(data)
+		return encryptedValueTypeYAML, spans, err
+	default:
+		return "", nil, fmt.Errorf("%s: unsupported format", format.Name())
+	}
+}
+
+// jsonValueSpans returns the spans of all scalar values in the JSON or JSONC
+// data.
+func jsonValueSpans(data []byte) ([]valueSpan, error) {
+	root, err := hujson.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	var spans []valueSpan
+	var addSpans func(string, *hujson.Value)
+	addSpans = func(path string, value *hujson.Value) {
+		switch trimmedValue := value.Value.(type) {
+		case *hujson.Object:
+			for i := range trimmedValue.Members {
+				member := &trimmedValue.Members[i]
+				name, _ := member.Name.Value.(hujson.Literal)
+				addSpans(path+"/"+name.String(), &member.Value)
+			}
+		case *hujson.Array:
+			for i := range trimmedValue.Elements {
+				addSpans(path+"/"+strconv.Itoa(i), &trimmedValue.Elements[i])
+			}
+		case hujson.Literal:
+			if trimmedValue.Kind() != 'n' {
+				spans = append(spans, valueSpan{
+					path:  path,
+					start: value.StartOffset,
+					end:   value.EndOffset,
+				})
+			}
+		}
+	}
+	addSpans("", &root)
+	return spans, nil
+}
+
+// yamlValueSpans returns the spans of all scalar values in the YAML data.
+// Aliases are not included and anchors and tags are kept outside and inside
+// the encrypted value respectively.
+func yamlValueSpans(data []byte) ([]valueSpan, error) {
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// The offsets in YAML token positions are not reliable, so compute offsets
+	// from lines and columns instead. Columns count runes.
+	lineOffsets := []int{0}
+	for i, b := range data {
+		if b == '\n' {
+			lineOffsets = append(lineOffsets, i+1)
+		}
+	}
+	lineOffset := func(position *token.Position) (int, error) {
+		if position.Line < 1 || position.Line > len(lineOffsets) {
+			return 0, fmt.Errorf("%d: invalid line", position.Line)
+		}
+		return lineOffsets[position.Line-1], nil
+	}
+	offset := func(position *token.Position) (int, error) {
+		offset, err := lineOffset(position)
+		if err != nil {
+			return 0, err
+		}
+		for column := 1; column < position.Column && offset < len(data) && data[offset] != '\n'; column++ {
+			_, size := utf8.DecodeRune(data[offset:])
+			offset += size
+		}
+		return offset, nil
+	}
+
+	// scalarSpan returns the start and end of the scalar node, and whether node
+	// is a scalar.
+	scalarSpan := func(node ast.Node) (int, int, bool, error) {
+		switch node := node.(type) {
+		case *ast.LiteralNode:
+			start, err := offset(node.Start.Position)
+			if err != nil {
+				return 0, 0, false, err
+			}
+			end := start + len(node.Start.Value)
+			if node.Value != nil {
+				contentToken := node.Value.GetToken()
+				if content := strings.TrimRight(contentToken.Origin, "\n"); content != "" {
+					contentStart, err := lineOffset(contentToken.Position)
+					if err != nil {
+						return 0, 0, false, err
+					}
+					end = contentStart + len(content)
+					if end > len(data) || string(data[contentStart:end]) != content {
+						return 0, 0, false, fmt.Errorf("%s: cannot locate value", node.GetPath())
+					}
+				}
+			}
+			return start, end, true, nil
+		case *ast.BoolNode, *ast.FloatNode, *ast.InfinityNode, *ast.IntegerNode, *ast.NanNode, *ast.StringNode:
+			valueToken := node.GetToken()
+			start, err := offset(valueToken.Position)
+			if err != nil {
+				return 0, 0, false, err
+			}
+			// The column of a value after a tag is the column of the preceding
+			// space.
+			for start < len(data) && (data[start] == ' ' || data[start] == '\t') {
+				start++
+			}
+			literal := strings.TrimSpace(valueToken.Origin)
+			end := start + len(literal)
+			if end > len(data) || string(data[start:end]) != literal {
+				return 0, 0, false, fmt.Errorf("%s: cannot locate value", node.GetPath())
+			}
+			return start, end, true, nil
+		default:
+			return 0, 0, false, nil
+		}
+	}
+
+	var spans []valueSpan
+	var addSpans func(string, ast.Node) error
+	addSpans = func(prefix string, node ast.Node) error {
+		switch node := node.(type) {
+		case nil, *ast.AliasNode, *ast.CommentGroupNode, *ast.NullNode:
+			return nil
+		case *ast.AnchorNode:
+			return addSpans(prefix, node.Value)
+		case *ast.MappingNode:
+			for _, value := range node.Values {
+				if err := addSpans(prefix, value.Value); err != nil {
+					return err
+				}
+			}
+			return nil
+		case *ast.MappingValueNode:
+			return addSpans(prefix, node.Value)
+		case *ast.SequenceNode:
+			for _, value := range node.Values {
+				if err := addSpans(prefix, value); err != nil {
+					return err
+				}
+			}
+			return nil
+		case *ast.TagNode:
+			_, end, ok, err := scalarSpan(node.Value)
+			switch {
+			case err != nil:
+				return err
+			case !ok:
+				return addSpans(prefix, node.Value)
+			}
+			start, err := offset(node.Start.Position)
+			if err != nil {
+				return err
+			}
+			spans = append(spans, valueSpan{
+				path:  prefix + node.GetPath(),
+				start: start,
+				end:   end,
+			})
+			return nil
+		}
+		start, end, ok, err := scalarSpan(node)
+		switch {
+		case err != nil:
+			return err
+		case !ok:
+			return fmt.Errorf("%s: unsupported YAML node type %s", node.GetPath(), node.Type())
+		}
+		spans = append(spans, valueSpan{
+			path:  prefix + node.GetPath(),
+			start: start,
+			end:   end,
+		})
+		return nil
+	}
+	for i, document := range file.Docs {
+		if err := addSpans(strconv.Itoa(i), document.Body); err != nil {
+			return nil, err
+		}
+	}
+	return spans, nil
+}
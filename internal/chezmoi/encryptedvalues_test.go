@@ -0,0 +1,227 @@
+package chezmoi
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoitest"
+)
+
+func TestEncryptValues(t *testing.T) {
+	encryption := &xorEncryption{
+		key: 0x55,
+	}
+	for _, tc := range []struct {
+		name      string
+		format    Format
+		plaintext string
+		secrets   []string
+	}{
+		{
+			name:   "json",
+			format: FormatJSON,
+			plaintext: chezmoitest.JoinLines(
+				`{"bool": true, "float": 1.50, "int": 1, "list": ["a", 2.0], "null": null, "string": "a\"b"}`,
+			),
+			secrets: []string{"true", "1.50", `"a"`, "2.0", `a\"b`},
+		},
+		{
+			name:   "jsonc",
+			format: FormatJSONC,
+			plaintext: chezmoitest.JoinLines(
+				`{`,
+				`  // comment`,
+				`  "z": "value",`,
+				`  "a": [1e3, {"nested": false},],`,
+				`}`,
+			),
+			secrets: []string{"value", "1e3", "false"},
+		},
+		{
+			name:   "toml",
+			format: FormatTOML,
+			plaintext: chezmoitest.JoinLines(
+				`# comment`,
+				`float = 2.0 # comment`,
+				`string = 'value'`,
+				`dotted.key = 0x1F`,
+				`date = 1979-05-27`,
+				`inline = { array = ["a", """`,
+				`b"""] }`,
+				`[[tables]]`,
+				`int = 1`,
+				`[[tables]]`,
+				`int = 2`,
+			),
+			secrets: []string{"2.0", "value", "0x1F", "1979", `"a"`, `"""`, "= 1", "= 2"},
+		},
+		{
+			name:   "toml_complex",
+			format: FormatTOML,
+			plaintext: chezmoitest.JoinLines(
+				`"quoted.key" = "value1" # comment with "quotes"`,
+				`'literal key' = """value2""""`,
+				`time = 1979-05-27 07:32:00Z`,
+				`nested = [[1_000, 'value3'], [], {}]`,
+				`multiline = [ # comment`,
+				`  +inf,`,
+				`  -4.5e2, # comment`,
+				`]`,
+				`[ table . "sub" ]`,
+				`escaped = "value4\""`,
+				`[[a]]`,
+				`[[a.b]]`,
+				`[[a]]`,
+				`[[a.b]]`,
+				`key = '''value5'''`,
+			),
+			secrets: []string{"value1", "value2", "1979", "1_000", "value3", "inf", "4.5e2", "value4", "value5"},
+		},
+		{
+			name:   "yaml",
+			format: FormatYAML,
+			plaintext: chezmoitest.JoinLines(
+				`# comment`,
+				`key:`,
+				`  nested: value # comment`,
+				`  ünïcode: "a\"b"`,
+				`single: 'it''s'`,
+				`anchor: &anchor 1.50`,
+				`alias: *anchor`,
+				`tag: !!str 1234`,
+				`null: ~`,
+				`flow: [true, {x: flowvalue}]`,
+				`literal: |2-`,
+				`    line1`,
+				``,
+				`   line2`,
+				`multiline: a`,
+				`  b`,
+				`---`,
+				`- last`,
+			),
+			secrets: []string{"value", `a\"b`, "it''s", "1.50", "1234", "true", "flowvalue", "line1", "line2", "a\n", "last"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ciphertext, err := EncryptValues(encryption, tc.format, []byte(tc.plaintext), nil)
+			assert.NoError(t, err)
+			assert.True(t, encryptedValueRx.Match(ciphertext))
+			for _, secret := range tc.secrets {
+				assert.False(t, strings.Contains(string(ciphertext), secret), secret)
+			}
+
+			var expectedValue, actualValue any
+			assert.NoError(t, tc.format.Unmarshal([]byte(tc.plaintext), &expectedValue))
+			assert.NoError(t, tc.format.Unmarshal(bytes.Clone(ciphertext), &actualValue))
+			actualValue, err = decryptValueTree(encryption, actualValue)
+			assert.NoError(t, err)
+			assert.Equal(t, expectedValue, actualValue)
+
+			actualPlaintext, err := DecryptValues(encryption, ciphertext)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.plaintext, string(actualPlaintext))
+
+			reencryptedCiphertext, err := EncryptValues(encryption, tc.format, actualPlaintext, ciphertext)
+			assert.NoError(t, err)
+			assert.Equal(t, string(ciphertext), string(reencryptedCiphertext))
+		})
+	}
+}
+
+func TestEncryptValuesReusesUnchangedValues(t *testing.T) {
+	recipient, identityAbsPath := builtinAgeGenerateKey(t)
+	encryption := &AgeEncryption{
+		UseBuiltin: true,
+		Identity:   identityAbsPath,
+		Recipient:  recipient.String(),
+	}
+
+	oldCiphertext, err := EncryptValues(encryption, FormatYAML, []byte("a: 1\nb: 2\n"), nil)
+	assert.NoError(t, err)
+	newCiphertext, err := EncryptValues(encryption, FormatYAML, []byte("a: 1\nb: 3\n"), oldCiphertext)
+	assert.NoError(t, err)
+
+	oldLines := strings.Split(string(oldCiphertext), "\n")
+	newLines := strings.Split(string(newCiphertext), "\n")
+	assert.Equal(t, oldLines[0], newLines[0])
+	assert.NotEqual(t, oldLines[1], newLines[1])
+
+	plaintext, err := DecryptValues(encryption, newCiphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, "a: 1\nb: 3\n", string(plaintext))
+}
+
+func TestDecryptValues(t *testing.T) {
+	encryption := &xorEncryption{
+		key: 0x55,
+	}
+	value := func(valueType, plaintext string) string {
+		ciphertext, err := encryption.Encrypt([]byte(plaintext))
+		assert.NoError(t, err)
+		return encryptedValueString(valueType, ciphertext)
+	}
+
+	data := chezmoitest.JoinLines(
+		`# {{ .comment }}`,
+		`double: "`+value(encryptedValueTypeString, "line1\nline2")+`"`,
+		`single: '`+value(encryptedValueTypeString, "it's")+`'`,
+		`plain: `+value(encryptedValueTypeFloat, "1"),
+		`bool: `+value(encryptedValueTypeBool, "false"),
+		`public: ENC`,
+	)
+	actual, err := DecryptValues(encryption, []byte(data))
+	assert.NoError(t, err)
+	assert.Equal(t, chezmoitest.JoinLines(
+		`# {{ .comment }}`,
+		`double: "line1\nline2"`,
+		`single: "it's"`,
+		`plain: 1.0`,
+		`bool: false`,
+		`public: ENC`,
+	), string(actual))
+
+	_, err = DecryptValues(encryption, []byte(value(encryptedValueTypeInt, "one")))
+	assert.Error(t, err)
+
+	templateData := map[string]any{
+		"list":   []any{value(encryptedValueTypeInt, "1")},
+		"map":    map[string]any{"string": value(encryptedValueTypeString, "secret")},
+		"public": "public",
+	}
+	actualTemplateData, err := decryptValueTree(encryption, templateData)
+	assert.NoError(t, err)
+	assert.Equal(t, any(map[string]any{
+		"list":   []any{int64(1)},
+		"map":    map[string]any{"string": "secret"},
+		"public": "public",
+	}), actualTemplateData)
+}
+
+func TestTOMLValueSpans(t *testing.T) {
+	data := chezmoitest.JoinLines(
+		`a.b = 1`,
+		`[[c]]`,
+		`d = [2, {e = 3}]`,
+		`[[c]]`,
+		`d = "4"`,
+		`[f."g.h"]`,
+		`i = 5`,
+	)
+	spans, err := tomlValueSpans([]byte(data))
+	assert.NoError(t, err)
+	actual := make([]string, 0, len(spans))
+	for _, span := range spans {
+		actual = append(actual, span.path+"="+data[span.start:span.end])
+	}
+	assert.Equal(t, []string{
+		"/a/b=1",
+		"/c/0/d/0=2",
+		"/c/0/d/1/e=3",
+		`/c/1/d="4"`,
+		"/f/g.h/i=5",
+	}, actual)
+}
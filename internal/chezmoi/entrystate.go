@@ -14,19 +14,23 @@ type EntryStateType string
 
 // Entry state types.
 const (
-	EntryStateTypeDir     EntryStateType = "dir"
-	EntryStateTypeFile    EntryStateType = "file"
-	EntryStateTypeSymlink EntryStateType = "symlink"
-	EntryStateTypeRemove  EntryStateType = "remove"
-	EntryStateTypeScript  EntryStateType = "script"
+	EntryStateTypeDir      EntryStateType = "dir"
+	EntryStateTypeFile     EntryStateType = "file"
+	EntryStateTypeHardlink EntryStateType = "hardlink"
+	EntryStateTypeSymlink  EntryStateType = "symlink"
+	EntryStateTypeRemove   EntryStateType = "remove"
+	EntryStateTypeScript   EntryStateType = "script"
 )
 
 // An EntryState represents the state of an entry. A nil EntryState is
 // equivalent to EntryStateTypeAbsent.
 type EntryState struct {
-	Type           EntryStateType `json:"type"                     yaml:"type"`
-	Mode           fs.FileMode    `json:"mode,omitempty"           yaml:"mode,omitempty"`
-	ContentsSHA256 HexBytes       `json:"contentsSHA256,omitempty" yaml:"contentsSHA256,omitempty"` //nolint:tagliatelle
+	Type           EntryStateType      `json:"type"                     yaml:"type"`
+	Mode           fs.FileMode         `json:"mode,omitempty"           yaml:"mode,omitempty"`
+	ContentsSHA256 HexBytes            `json:"contentsSHA256,omitempty" yaml:"contentsSHA256,omitempty"` //nolint:tagliatelle
+	Owner          string              `json:"owner,omitempty"          yaml:"owner,omitempty"`
+	Group          string              `json:"group,omitempty"          yaml:"group,omitempty"`
+	Xattrs         map[string]HexBytes `json:"xattrs,omitempty"         yaml:"xattrs,omitempty"`
 	contents       []byte
 	overwrite      bool
 }
@@ -36,7 +40,8 @@ func (s *EntryState) Contents() []byte {
 	return s.contents
 }
 
-// Equal returns true if s is equal to other.
+// Equal returns true if s is equal to other. Owners, groups, and extended
+// attributes are only compared if they are set in both s and other.
 func (s *EntryState) Equal(other *EntryState) bool {
 	if s.Type != other.Type {
 		return false
@@ -44,6 +49,15 @@ func (s *EntryState) Equal(other *EntryState) bool {
 	if runtime.GOOS != "windows" && s.Mode.Perm() != other.Mode.Perm() {
 		return false
 	}
+	if s.Owner != "" && other.Owner != "" && s.Owner != other.Owner {
+		return false
+	}
+	if s.Group != "" && other.Group != "" && s.Group != other.Group {
+		return false
+	}
+	if s.Xattrs != nil && other.Xattrs != nil && !xattrsEqual(s.Xattrs, other.Xattrs) {
+		return false
+	}
 	return bytes.Equal(s.ContentsSHA256, other.ContentsSHA256)
 }
 
@@ -69,6 +83,12 @@ func (s *EntryState) LogValue() slog.Value {
 		slog.Int("Mode", int(s.Mode)),
 		chezmoilog.Stringer("ContentsSHA256", s.ContentsSHA256),
 	}
+	if s.Owner != "" {
+		attrs = append(attrs, slog.String("Owner", s.Owner))
+	}
+	if s.Group != "" {
+		attrs = append(attrs, slog.String("Group", s.Group))
+	}
 	if len(s.contents) != 0 {
 		attrs = append(attrs, chezmoilog.FirstFewBytes("contents", s.contents))
 	}
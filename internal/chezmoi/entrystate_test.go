@@ -36,6 +36,19 @@ func TestEntryStateEquivalent(t *testing.T) {
 			Mode:           0o666,
 			ContentsSHA256: []byte{1},
 		},
+		"file1_root": {
+			Type:           EntryStateTypeFile,
+			Mode:           0o666,
+			ContentsSHA256: []byte{1},
+			Owner:          "root",
+			Group:          "root",
+		},
+		"file1_user": {
+			Type:           EntryStateTypeFile,
+			Mode:           0o666,
+			ContentsSHA256: []byte{1},
+			Owner:          "user",
+		},
 		"file2": {
 			Type:           EntryStateTypeFile,
 			Mode:           0o666,
@@ -70,6 +83,14 @@ func TestEntryStateEquivalent(t *testing.T) {
 		"file1_copy_file1":      true,
 		"file1_create":          true,
 		"file1_file1_copy":      true,
+		"file1_copy_file1_root": true,
+		"file1_copy_file1_user": true,
+		"file1_file1_root":      true,
+		"file1_file1_user":      true,
+		"file1_root_file1":      true,
+		"file1_root_file1_copy": true,
+		"file1_user_file1":      true,
+		"file1_user_file1_copy": true,
 		"nil1_remove":           true,
 		"nil2_remove":           true,
 		"remove_nil1":           true,
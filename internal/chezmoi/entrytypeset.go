@@ -155,6 +155,8 @@ func (s *EntryTypeSet) ContainsSourceStateEntry(sourceStateEntry SourceStateEntr
 			return true
 		case s.bits&EntryTypeFiles != 0 && sourceAttr.Type == SourceFileTypeFile:
 			return true
+		case s.bits&EntryTypeFiles != 0 && sourceAttr.Type == SourceFileTypeHardlink:
+			return true
 		case s.bits&EntryTypeFiles != 0 && sourceAttr.Type == SourceFileTypeModify:
 			return true
 		case s.bits&EntryTypeRemove != 0 && sourceAttr.Type == SourceFileTypeRemove:
@@ -208,6 +210,15 @@ func (s *EntryTypeSet) ContainsTargetStateEntry(targetStateEntry TargetStateEntr
 		default:
 			return false
 		}
+	case *TargetStateHardlink:
+		switch {
+		case s.bits&EntryTypeTemplates != 0 && sourceAttr.Template:
+			return true
+		case s.bits&EntryTypeFiles != 0:
+			return true
+		default:
+			return false
+		}
 	case *TargetStateModifyDirWithCmd:
 		switch {
 		case s.bits&EntryTypeExternals != 0 && sourceAttr.External:
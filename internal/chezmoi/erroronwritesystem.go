@@ -29,6 +29,11 @@ func (s *ErrorOnWriteSystem) Chmod(name AbsPath, mode fs.FileMode) error {
 	return s.err
 }
 
+// Chown implements System.Chown.
+func (s *ErrorOnWriteSystem) Chown(name AbsPath, uid, gid int) error {
+	return s.err
+}
+
 // Chtimes implements System.Chtimes.
 func (s *ErrorOnWriteSystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
 	return s.err
@@ -39,11 +44,21 @@ func (s *ErrorOnWriteSystem) Glob(pattern string) ([]string, error) {
 	return s.system.Glob(pattern)
 }
 
+// Lgetxattrs implements System.Lgetxattrs.
+func (s *ErrorOnWriteSystem) Lgetxattrs(name AbsPath) (map[string][]byte, error) {
+	return s.system.Lgetxattrs(name)
+}
+
 // Link implements System.Link.
 func (s *ErrorOnWriteSystem) Link(oldName, newName AbsPath) error {
 	return s.err
 }
 
+// Lsetxattrs implements System.Lsetxattrs.
+func (s *ErrorOnWriteSystem) Lsetxattrs(name AbsPath, xattrs map[string][]byte) error {
+	return s.err
+}
+
 // Lstat implements System.Lstat.
 func (s *ErrorOnWriteSystem) Lstat(name AbsPath) (fs.FileInfo, error) {
 	return s.system.Lstat(name)
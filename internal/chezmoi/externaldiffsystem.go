@@ -68,6 +68,11 @@ func (s *ExternalDiffSystem) Chmod(name AbsPath, mode fs.FileMode) error {
 	return s.system.Chmod(name, mode)
 }
 
+// Chown implements System.Chown.
+func (s *ExternalDiffSystem) Chown(name AbsPath, uid, gid int) error {
+	return s.system.Chown(name, uid, gid)
+}
+
 // Chtimes implements System.Chtimes.
 func (s *ExternalDiffSystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
 	return s.system.Chtimes(name, atime, mtime)
@@ -89,12 +94,22 @@ func (s *ExternalDiffSystem) Glob(pattern string) ([]string, error) {
 	return s.system.Glob(pattern)
 }
 
+// Lgetxattrs implements System.Lgetxattrs.
+func (s *ExternalDiffSystem) Lgetxattrs(name AbsPath) (map[string][]byte, error) {
+	return s.system.Lgetxattrs(name)
+}
+
 // Link implements System.Link.
 func (s *ExternalDiffSystem) Link(oldName, newName AbsPath) error {
 	// FIXME generate suitable inputs for s.command
 	return s.system.Link(oldName, newName)
 }
 
+// Lsetxattrs implements System.Lsetxattrs.
+func (s *ExternalDiffSystem) Lsetxattrs(name AbsPath, xattrs map[string][]byte) error {
+	return s.system.Lsetxattrs(name, xattrs)
+}
+
 // Lstat implements System.Lstat.
 func (s *ExternalDiffSystem) Lstat(name AbsPath) (fs.FileInfo, error) {
 	return s.system.Lstat(name)
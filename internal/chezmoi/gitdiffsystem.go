@@ -1,11 +1,14 @@
 package chezmoi
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"io/fs"
+	"maps"
 	"os/exec"
 	"runtime"
+	"slices"
 	"time"
 
 	"github.com/go-git/go-git/v5/plumbing"
@@ -80,6 +83,11 @@ func (s *GitDiffSystem) Chmod(name AbsPath, mode fs.FileMode) error {
 	return s.system.Chmod(name, mode)
 }
 
+// Chown implements System.Chown.
+func (s *GitDiffSystem) Chown(name AbsPath, uid, gid int) error {
+	return s.system.Chown(name, uid, gid)
+}
+
 // Chtimes implements system.Chtimes.
 func (s *GitDiffSystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
 	if s.isRemoved(name) {
@@ -105,12 +113,63 @@ func (s *GitDiffSystem) Glob(pattern string) ([]string, error) {
 	return matches[:n], nil
 }
 
-// Link implements System.Link.
+// Lgetxattrs implements System.Lgetxattrs.
+func (s *GitDiffSystem) Lgetxattrs(name AbsPath) (map[string][]byte, error) {
+	return s.system.Lgetxattrs(name)
+}
+
+// Link implements System.Link. The diff shows newName becoming a copy of
+// oldName, if oldName exists.
 func (s *GitDiffSystem) Link(oldName, newName AbsPath) error {
-	// LATER generate a diff
+	if s.filter.IncludeEntryTypeBits(EntryTypeFiles) {
+		switch fileInfo, err := s.system.Stat(oldName); {
+		case errors.Is(err, fs.ErrNotExist):
+			// Do nothing.
+		case err != nil:
+			return err
+		case fileInfo.Mode().IsRegular():
+			toData, err := s.system.ReadFile(oldName)
+			if err != nil {
+				return err
+			}
+			if err := s.encodeDiff(newName, toData, fileInfo.Mode()); err != nil {
+				return err
+			}
+		}
+	}
 	return s.system.Link(oldName, newName)
 }
 
+// Lsetxattrs implements System.Lsetxattrs. Changes to extended attributes are
+// written as a diff of a file named after the target with a :xattrs suffix.
+func (s *GitDiffSystem) Lsetxattrs(name AbsPath, xattrs map[string][]byte) error {
+	fromInfo, err := s.system.Lstat(name)
+	if err != nil {
+		return err
+	}
+	if s.filter.IncludeFileInfo(fromInfo) {
+		fromXattrs, err := s.system.Lgetxattrs(name)
+		if err != nil {
+			return err
+		}
+		toXattrs := maps.Clone(fromXattrs)
+		if toXattrs == nil {
+			toXattrs = make(map[string][]byte)
+		}
+		for attr, value := range xattrs {
+			if value == nil {
+				delete(toXattrs, attr)
+			} else {
+				toXattrs[attr] = value
+			}
+		}
+		if err := s.encodeXattrsDiff(name, fromXattrs, toXattrs); err != nil {
+			return err
+		}
+	}
+	return s.system.Lsetxattrs(name, xattrs)
+}
+
 // Lstat implements System.Lstat.
 func (s *GitDiffSystem) Lstat(name AbsPath) (fs.FileInfo, error) {
 	if s.isRemoved(name) {
@@ -380,6 +439,32 @@ func (s *GitDiffSystem) encodeDiff(absPath AbsPath, toData []byte, toMode fs.Fil
 	return s.unifiedEncoder.Encode(diffPatch)
 }
 
+// encodeXattrsDiff encodes the diff between fromXattrs and toXattrs of
+// absPath.
+func (s *GitDiffSystem) encodeXattrsDiff(absPath AbsPath, fromXattrs, toXattrs map[string][]byte) error {
+	formatXattrs := func(xattrs map[string][]byte) ([]byte, fs.FileMode) {
+		if len(xattrs) == 0 {
+			return nil, 0
+		}
+		var buffer bytes.Buffer
+		for _, attr := range slices.Sorted(maps.Keys(xattrs)) {
+			buffer.WriteString(attr + "=" + encodeXattrValue(xattrs[attr]) + "\n")
+		}
+		return buffer.Bytes(), 0o644
+	}
+	fromData, fromMode := formatXattrs(fromXattrs)
+	toData, toMode := formatXattrs(toXattrs)
+	if s.reverse {
+		fromData, toData = toData, fromData
+		fromMode, toMode = toMode, fromMode
+	}
+	diffPatch, err := DiffPatch(NewRelPath(s.trimPrefix(absPath).String()+":xattrs"), fromData, fromMode, toData, toMode)
+	if err != nil {
+		return err
+	}
+	return s.unifiedEncoder.Encode(diffPatch)
+}
+
 func (s *GitDiffSystem) isRemoved(absPath AbsPath) bool {
 	if s.removedEntries.IsEmpty() {
 		return false
@@ -1,7 +1,14 @@
 package chezmoi
 
 import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
 	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	vfs "github.com/twpayne/go-vfs/v5"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoitest"
 )
 
 var (
@@ -11,3 +18,40 @@ var (
 	_ diff.FilePatch = &gitDiffFilePatch{}
 	_ diff.Patch     = &gitDiffPatch{}
 )
+
+func TestGitDiffSystemLsetxattrs(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user/.file": "# contents of .file\n",
+	}, func(fileSystem vfs.FS) {
+		system := newXattrsSystem(NewRealSystem(fileSystem), map[AbsPath]map[string][]byte{
+			NewAbsPath("/home/user/.file"): {
+				"user.changed": []byte("old"),
+				"user.removed": []byte("old"),
+			},
+		})
+		buffer := &bytes.Buffer{}
+		gitDiffSystem := NewGitDiffSystem(system, buffer, NewAbsPath("/home/user"), &GitDiffSystemOptions{
+			Filter: NewEntryTypeFilter(EntryTypesAll, EntryTypesNone),
+		})
+		assert.NoError(t, gitDiffSystem.Lsetxattrs(NewAbsPath("/home/user/.file"), map[string][]byte{
+			"user.added":   []byte("new"),
+			"user.changed": []byte("new"),
+			"user.removed": nil,
+		}))
+		assert.Equal(t, chezmoitest.JoinLines(
+			"diff --git a/.file:xattrs b/.file:xattrs",
+			"index 86a3933197f9ca486e3e01038ba05efcd24692c4..fd108c0e05f6a21bde54a6c8aea8a30af9fdab31 100644",
+			"--- a/.file:xattrs",
+			"+++ b/.file:xattrs",
+			"@@ -1,2 +1,2 @@",
+			`-user.changed="old"`,
+			`-user.removed="old"`,
+			`+user.added="new"`,
+			`+user.changed="new"`,
+		), buffer.String())
+		assert.Equal(t, map[string][]byte{
+			"user.added":   []byte("new"),
+			"user.changed": []byte("new"),
+		}, system.xattrs[NewAbsPath("/home/user/.file")])
+	})
+}
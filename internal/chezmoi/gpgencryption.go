@@ -1,28 +1,53 @@
 package chezmoi
 
 import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
 
 	"chezmoi.io/chezmoi/v2/internal/chezmoierrors"
 	"chezmoi.io/chezmoi/v2/internal/chezmoilog"
 )
 
+// gpgMessageBlockType is the armor block type of OpenPGP messages.
+const gpgMessageBlockType = "PGP MESSAGE"
+
+var errIncorrectPassphrase = errors.New("incorrect passphrase")
+
 // A GPGEncryption uses gpg for encryption and decryption. See
 // https://gnupg.org/.
 type GPGEncryption struct {
-	Command    string   `json:"command"    mapstructure:"command"    yaml:"command"`
-	Args       []string `json:"args"       mapstructure:"args"       yaml:"args"`
-	Recipient  string   `json:"recipient"  mapstructure:"recipient"  yaml:"recipient"`
-	Recipients []string `json:"recipients" mapstructure:"recipients" yaml:"recipients"`
-	Symmetric  bool     `json:"symmetric"  mapstructure:"symmetric"  yaml:"symmetric"`
-	Suffix     string   `json:"suffix"     mapstructure:"suffix"     yaml:"suffix"`
+	UseBuiltin bool      `json:"useBuiltin" mapstructure:"useBuiltin" yaml:"useBuiltin"`
+	Command    string    `json:"command"    mapstructure:"command"    yaml:"command"`
+	Args       []string  `json:"args"       mapstructure:"args"       yaml:"args"`
+	Keyring    AbsPath   `json:"keyring"    mapstructure:"keyring"    yaml:"keyring"`
+	Keyrings   []AbsPath `json:"keyrings"   mapstructure:"keyrings"   yaml:"keyrings"`
+	Recipient  string    `json:"recipient"  mapstructure:"recipient"  yaml:"recipient"`
+	Recipients []string  `json:"recipients" mapstructure:"recipients" yaml:"recipients"`
+	Symmetric  bool      `json:"symmetric"  mapstructure:"symmetric"  yaml:"symmetric"`
+	Suffix     string    `json:"suffix"     mapstructure:"suffix"     yaml:"suffix"`
+
+	// Passphrase returns the passphrase for symmetric encryption and for
+	// encrypted private keys when using the builtin OpenPGP.
+	Passphrase func() (string, error) `json:"-" mapstructure:"-" yaml:"-"`
 }
 
 // Decrypt implements Encryption.Decrypt.
 func (e *GPGEncryption) Decrypt(ciphertext []byte) ([]byte, error) {
+	if e.UseBuiltin {
+		return e.builtinDecrypt(ciphertext)
+	}
+
 	var plaintext []byte
 	if err := withPrivateTempDir(func(tempDirAbsPath AbsPath) error {
 		ciphertextAbsPath := tempDirAbsPath.JoinString("ciphertext" + e.EncryptedSuffix())
@@ -47,6 +72,14 @@ func (e *GPGEncryption) Decrypt(ciphertext []byte) ([]byte, error) {
 
 // DecryptToFile implements Encryption.DecryptToFile.
 func (e *GPGEncryption) DecryptToFile(plaintextAbsPath AbsPath, ciphertext []byte) error {
+	if e.UseBuiltin {
+		plaintext, err := e.builtinDecrypt(ciphertext)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(plaintextAbsPath.String(), plaintext, 0o600)
+	}
+
 	return withPrivateTempDir(func(tempDirAbsPath AbsPath) error {
 		ciphertextAbsPath := tempDirAbsPath.JoinString("ciphertext" + e.EncryptedSuffix())
 		if err := os.WriteFile(ciphertextAbsPath.String(), ciphertext, 0o600); err != nil {
@@ -59,6 +92,10 @@ func (e *GPGEncryption) DecryptToFile(plaintextAbsPath AbsPath, ciphertext []byt
 
 // Encrypt implements Encryption.Encrypt.
 func (e *GPGEncryption) Encrypt(plaintext []byte) ([]byte, error) {
+	if e.UseBuiltin {
+		return e.builtinEncrypt(plaintext)
+	}
+
 	var ciphertext []byte
 	if err := withPrivateTempDir(func(tempDirAbsPath AbsPath) error {
 		plaintextAbsPath := tempDirAbsPath.JoinString("plaintext")
@@ -83,6 +120,14 @@ func (e *GPGEncryption) Encrypt(plaintext []byte) ([]byte, error) {
 
 // EncryptFile implements Encryption.EncryptFile.
 func (e *GPGEncryption) EncryptFile(plaintextAbsPath AbsPath) ([]byte, error) {
+	if e.UseBuiltin {
+		plaintext, err := os.ReadFile(plaintextAbsPath.String())
+		if err != nil {
+			return nil, err
+		}
+		return e.builtinEncrypt(plaintext)
+	}
+
 	var ciphertext []byte
 	if err := withPrivateTempDir(func(tempDirAbsPath AbsPath) error {
 		ciphertextAbsPath := tempDirAbsPath.JoinString("ciphertext" + e.EncryptedSuffix())
@@ -106,6 +151,181 @@ func (e *GPGEncryption) EncryptedSuffix() string {
 	return e.Suffix
 }
 
+// builtinDecrypt decrypts ciphertext using the builtin OpenPGP.
+func (e *GPGEncryption) builtinDecrypt(ciphertext []byte) ([]byte, error) {
+	if err := e.builtinCheckArgs(); err != nil {
+		return nil, err
+	}
+	// Symmetrically encrypted messages do not need a keyring.
+	var keyring openpgp.EntityList
+	if !e.Symmetric || len(e.builtinKeyringAbsPaths()) != 0 {
+		var err error
+		if keyring, err = e.builtinKeyring(); err != nil {
+			return nil, err
+		}
+	}
+	var ciphertextReader io.Reader = bytes.NewReader(ciphertext)
+	if bytes.HasPrefix(bytes.TrimSpace(ciphertext), []byte("-----BEGIN ")) {
+		block, err := armor.Decode(ciphertextReader)
+		if err != nil {
+			return nil, err
+		}
+		if block.Type != gpgMessageBlockType {
+			return nil, fmt.Errorf("%s: unexpected armor block type", block.Type)
+		}
+		ciphertextReader = block.Body
+	}
+
+	// The prompt function is called repeatedly until the passphrase is
+	// correct, so fail if it is called again after the passphrase was tried.
+	passphraseTried := false
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if passphraseTried {
+			return nil, errIncorrectPassphrase
+		}
+		passphraseTried = true
+		passphrase, err := e.builtinPassphrase()
+		if err != nil {
+			return nil, err
+		}
+		if symmetric {
+			return passphrase, nil
+		}
+		for _, key := range keys {
+			if key.PrivateKey != nil && key.PrivateKey.Encrypted {
+				if err := key.PrivateKey.Decrypt(passphrase); err == nil {
+					return nil, nil
+				}
+			}
+		}
+		return nil, errIncorrectPassphrase
+	}
+
+	messageDetails, err := openpgp.ReadMessage(ciphertextReader, keyring, prompt, nil)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(messageDetails.UnverifiedBody)
+}
+
+// builtinEncrypt encrypts plaintext using the builtin OpenPGP.
+func (e *GPGEncryption) builtinEncrypt(plaintext []byte) ([]byte, error) {
+	if err := e.builtinCheckArgs(); err != nil {
+		return nil, err
+	}
+	ciphertextBuffer := &bytes.Buffer{}
+	armoredCiphertextWriter, err := armor.Encode(ciphertextBuffer, gpgMessageBlockType, nil)
+	if err != nil {
+		return nil, err
+	}
+	var plaintextWriteCloser io.WriteCloser
+	if e.Symmetric {
+		passphrase, err := e.builtinPassphrase()
+		if err != nil {
+			return nil, err
+		}
+		plaintextWriteCloser, err = openpgp.SymmetricallyEncrypt(armoredCiphertextWriter, passphrase, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		recipients, err := e.builtinRecipients()
+		if err != nil {
+			return nil, err
+		}
+		plaintextWriteCloser, err = openpgp.Encrypt(armoredCiphertextWriter, recipients, nil, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := plaintextWriteCloser.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := plaintextWriteCloser.Close(); err != nil {
+		return nil, err
+	}
+	if err := armoredCiphertextWriter.Close(); err != nil {
+		return nil, err
+	}
+	ciphertextBuffer.WriteByte('\n')
+	return ciphertextBuffer.Bytes(), nil
+}
+
+// builtinCheckArgs returns an error if e has arguments, which only gpg
+// understands.
+func (e *GPGEncryption) builtinCheckArgs() error {
+	if len(e.Args) != 0 {
+		return errors.New("gpg.args is not supported by the builtin OpenPGP")
+	}
+	return nil
+}
+
+// builtinKeyring returns the keyring for the builtin OpenPGP, read from the
+// armored key files in e.Keyring and e.Keyrings.
+func (e *GPGEncryption) builtinKeyring() (openpgp.EntityList, error) {
+	keyringAbsPaths := e.builtinKeyringAbsPaths()
+	if len(keyringAbsPaths) == 0 {
+		return nil, errors.New("the builtin OpenPGP requires gpg.keyring or gpg.keyrings")
+	}
+	var keyring openpgp.EntityList
+	for _, keyringAbsPath := range keyringAbsPaths {
+		entities, err := parseKeyringFile(keyringAbsPath)
+		if err != nil {
+			return nil, err
+		}
+		keyring = append(keyring, entities...)
+	}
+	return keyring, nil
+}
+
+// builtinKeyringAbsPaths returns the paths of the armored key files of the
+// builtin OpenPGP.
+func (e *GPGEncryption) builtinKeyringAbsPaths() []AbsPath {
+	keyringAbsPaths := make([]AbsPath, 0, 1+len(e.Keyrings))
+	if !e.Keyring.IsEmpty() {
+		keyringAbsPaths = append(keyringAbsPaths, e.Keyring)
+	}
+	return append(keyringAbsPaths, e.Keyrings...)
+}
+
+// builtinPassphrase returns the passphrase for the builtin OpenPGP.
+func (e *GPGEncryption) builtinPassphrase() ([]byte, error) {
+	if e.Passphrase == nil {
+		return nil, errors.New("passphrase required")
+	}
+	passphrase, err := e.Passphrase()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(passphrase), nil
+}
+
+// builtinRecipients returns the entities in the keyring that match e's
+// recipients.
+func (e *GPGEncryption) builtinRecipients() ([]*openpgp.Entity, error) {
+	keyring, err := e.builtinKeyring()
+	if err != nil {
+		return nil, err
+	}
+	recipients := make([]string, 0, 1+len(e.Recipients))
+	if e.Recipient != "" {
+		recipients = append(recipients, e.Recipient)
+	}
+	recipients = append(recipients, e.Recipients...)
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients")
+	}
+	entities := make([]*openpgp.Entity, 0, len(recipients))
+	for _, recipient := range recipients {
+		entity, err := findGPGEntity(keyring, recipient)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, nil
+}
+
 // decryptArgs returns the arguments for decryption.
 func (e *GPGEncryption) decryptArgs(plaintextAbsPath, ciphertextAbsPath AbsPath) []string {
 	args := []string{"--output", plaintextAbsPath.String()}
@@ -147,6 +367,47 @@ func (e *GPGEncryption) run(args []string) error {
 	return chezmoilog.LogCmdRun(slog.Default(), cmd)
 }
 
+// findGPGEntity returns the entity in keyring that matches recipient. Like gpg,
+// recipient is matched against fingerprints, key IDs, and user IDs.
+func findGPGEntity(keyring openpgp.EntityList, recipient string) (*openpgp.Entity, error) {
+	keyID := strings.ToUpper(strings.TrimPrefix(strings.ReplaceAll(recipient, " ", ""), "0x"))
+	if _, err := hex.DecodeString(keyID); err == nil && len(keyID) >= 8 {
+		for _, entity := range keyring {
+			if strings.HasSuffix(strings.ToUpper(hex.EncodeToString(entity.PrimaryKey.Fingerprint)), keyID) {
+				return entity, nil
+			}
+			for _, subkey := range entity.Subkeys {
+				if strings.HasSuffix(strings.ToUpper(hex.EncodeToString(subkey.PublicKey.Fingerprint)), keyID) {
+					return entity, nil
+				}
+			}
+		}
+	}
+	lowerRecipient := strings.ToLower(recipient)
+	for _, entity := range keyring {
+		for name := range entity.Identities {
+			if strings.Contains(strings.ToLower(name), lowerRecipient) {
+				return entity, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s: no public key", recipient)
+}
+
+// parseKeyringFile parses the entities from the armored key file
+// keyringAbsPath.
+func parseKeyringFile(keyringAbsPath AbsPath) (entities openpgp.EntityList, err error) {
+	var file *os.File
+	if file, err = os.Open(keyringAbsPath.String()); err != nil {
+		return nil, err
+	}
+	defer chezmoierrors.CombineFunc(&err, file.Close)
+	if entities, err = openpgp.ReadArmoredKeyRing(file); err != nil {
+		return nil, fmt.Errorf("%s: %w", keyringAbsPath, err)
+	}
+	return entities, nil
+}
+
 // withPrivateTempDir creates a private temporary and calls f.
 func withPrivateTempDir(f func(tempDirAbsPath AbsPath) error) (err error) {
 	var tempDir string
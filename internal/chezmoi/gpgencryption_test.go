@@ -1,9 +1,14 @@
 package chezmoi
 
 import (
+	"os"
+	"os/exec"
+	"path/filepath"
 	"runtime"
 	"testing"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
 	"github.com/alecthomas/assert/v2"
 
 	"chezmoi.io/chezmoi/v2/internal/chezmoitest"
@@ -47,3 +52,162 @@ func TestGPGEncryption(t *testing.T) {
 		})
 	}
 }
+
+func TestBuiltinGPGEncryption(t *testing.T) {
+	passphrase := "chezmoi-test-builtin-gpg-passphrase"
+	keyringAbsPath := builtinGPGGenerateKey(t, "chezmoi-test-builtin-gpg-key", "")
+	encryptedKeyringAbsPath := builtinGPGGenerateKey(t, "chezmoi-test-builtin-gpg-encrypted-key", passphrase)
+
+	for _, tc := range []struct {
+		name       string
+		encryption *GPGEncryption
+	}{
+		{
+			name: "asymmetric",
+			encryption: &GPGEncryption{
+				UseBuiltin: true,
+				Keyring:    keyringAbsPath,
+				Recipient:  "chezmoi-test-builtin-gpg-key",
+			},
+		},
+		{
+			name: "asymmetric_encrypted_key",
+			encryption: &GPGEncryption{
+				UseBuiltin: true,
+				Keyrings:   []AbsPath{keyringAbsPath, encryptedKeyringAbsPath},
+				Recipients: []string{"CHEZMOI-TEST-BUILTIN-GPG-ENCRYPTED-KEY"},
+				Passphrase: func() (string, error) {
+					return passphrase, nil
+				},
+			},
+		},
+		{
+			name: "symmetric",
+			encryption: &GPGEncryption{
+				UseBuiltin: true,
+				Symmetric:  true,
+				Passphrase: func() (string, error) {
+					return passphrase, nil
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testEncryption(t, tc.encryption)
+		})
+	}
+
+	t.Run("incorrect_passphrase", func(t *testing.T) {
+		ciphertext, err := (&GPGEncryption{
+			UseBuiltin: true,
+			Keyring:    encryptedKeyringAbsPath,
+			Recipient:  "chezmoi-test-builtin-gpg-encrypted-key",
+		}).Encrypt([]byte("plaintext\n"))
+		assert.NoError(t, err)
+		_, err = (&GPGEncryption{
+			UseBuiltin: true,
+			Keyring:    encryptedKeyringAbsPath,
+			Passphrase: func() (string, error) {
+				return "incorrect", nil
+			},
+		}).Decrypt(ciphertext)
+		assert.Error(t, err)
+	})
+
+	t.Run("no_public_key", func(t *testing.T) {
+		_, err := (&GPGEncryption{
+			UseBuiltin: true,
+			Keyring:    keyringAbsPath,
+			Recipient:  "unknown",
+		}).Encrypt([]byte("plaintext\n"))
+		assert.EqualError(t, err, "unknown: no public key")
+	})
+}
+
+func TestBuiltinGPGEncryptionCompatibility(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping gpg tests on Windows")
+	}
+	command := lookPathOrSkip(t, "gpg")
+
+	tempDir := t.TempDir()
+	key, passphrase, err := chezmoitest.GPGGenerateKey(command, tempDir)
+	assert.NoError(t, err)
+	args := []string{
+		"--homedir", tempDir,
+		"--no-tty",
+		"--passphrase", passphrase,
+		"--pinentry-mode", "loopback",
+	}
+	keyring, err := exec.Command(command, append(args, "--armor", "--export-secret-keys", key)...).Output() //nolint:gosec
+	assert.NoError(t, err)
+	keyringAbsPath := NewAbsPath(tempDir).JoinString("key.asc")
+	assert.NoError(t, os.WriteFile(keyringAbsPath.String(), keyring, 0o600))
+
+	for _, tc := range []struct {
+		name      string
+		symmetric bool
+	}{
+		{
+			name:      "asymmetric",
+			symmetric: false,
+		},
+		{
+			name:      "symmetric",
+			symmetric: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gpgEncryption := &GPGEncryption{
+				Command:   command,
+				Args:      args,
+				Recipient: key,
+				Symmetric: tc.symmetric,
+			}
+			builtinGPGEncryption := &GPGEncryption{
+				UseBuiltin: true,
+				Keyring:    keyringAbsPath,
+				Recipient:  key,
+				Symmetric:  tc.symmetric,
+				Passphrase: func() (string, error) {
+					return passphrase, nil
+				},
+			}
+			plaintext := []byte("plaintext\n")
+
+			ciphertext, err := gpgEncryption.Encrypt(plaintext)
+			assert.NoError(t, err)
+			actualPlaintext, err := builtinGPGEncryption.Decrypt(ciphertext)
+			assert.NoError(t, err)
+			assert.Equal(t, plaintext, actualPlaintext)
+
+			ciphertext, err = builtinGPGEncryption.Encrypt(plaintext)
+			assert.NoError(t, err)
+			actualPlaintext, err = gpgEncryption.Decrypt(ciphertext)
+			assert.NoError(t, err)
+			assert.Equal(t, plaintext, actualPlaintext)
+		})
+	}
+}
+
+func builtinGPGGenerateKey(t *testing.T, name, passphrase string) AbsPath {
+	t.Helper()
+	entity, err := openpgp.NewEntity(name, "", "", nil)
+	assert.NoError(t, err)
+	if passphrase != "" {
+		assert.NoError(t, entity.EncryptPrivateKeys([]byte(passphrase), nil))
+	}
+	keyringFile := filepath.Join(t.TempDir(), name+".asc")
+	file, err := os.Create(keyringFile)
+	assert.NoError(t, err)
+	defer file.Close()
+	armoredWriter, err := armor.Encode(file, openpgp.PrivateKeyType, nil)
+	assert.NoError(t, err)
+	if passphrase != "" {
+		assert.NoError(t, entity.SerializePrivateWithoutSigning(armoredWriter, nil))
+	} else {
+		assert.NoError(t, entity.SerializePrivate(armoredWriter, nil))
+	}
+	assert.NoError(t, armoredWriter.Close())
+	return NewAbsPath(keyringFile)
+}
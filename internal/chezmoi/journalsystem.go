@@ -0,0 +1,474 @@
+package chezmoi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"slices"
+	"sync"
+	"time"
+
+	vfs "github.com/twpayne/go-vfs/v5"
+)
+
+// A JournalEntry records the state of an entry before it was modified. UID and
+// GID are nil if the entry's ownership is not known, and Xattrs is nil if the
+// entry's extended attributes are not known.
+type JournalEntry struct {
+	AbsPath        AbsPath             `json:"absPath"                  yaml:"absPath"`
+	Type           EntryStateType      `json:"type"                     yaml:"type"`
+	Mode           fs.FileMode         `json:"mode,omitempty"           yaml:"mode,omitempty"`
+	UID            *int                `json:"uid,omitempty"            yaml:"uid,omitempty"`
+	GID            *int                `json:"gid,omitempty"            yaml:"gid,omitempty"`
+	Xattrs         map[string]HexBytes `json:"xattrs,omitempty"         yaml:"xattrs,omitempty"`
+	ContentsSHA256 HexBytes            `json:"contentsSHA256,omitempty" yaml:"contentsSHA256,omitempty"` //nolint:tagliatelle
+	Linkname       string              `json:"linkname,omitempty"       yaml:"linkname,omitempty"`
+	Children       []*JournalEntry     `json:"children,omitempty"       yaml:"children,omitempty"`
+	Shallow        bool                `json:"shallow,omitempty"        yaml:"shallow,omitempty"`
+	contents       []byte
+}
+
+// JournalSystemOptions are options for NewJournalSystem.
+type JournalSystemOptions struct {
+	// SkipUnsupported, if true, skips modified entries of unsupported types
+	// with a warning instead of returning an error.
+	SkipUnsupported bool
+	// WarnFunc, if not nil, is called with a warning for each entry that
+	// cannot be recorded.
+	WarnFunc WarnFunc
+}
+
+// A JournalSystem is a System that records the previous state of every entry
+// before it is modified so that the modifications can be rolled back.
+//
+// Scripts and commands run by a JournalSystem are not recorded and cannot be
+// rolled back. Entries that are neither files, directories, nor symlinks, for
+// example sockets and FIFOs, cannot be recorded, so modifying them returns an
+// error. Such entries inside a recorded directory are skipped with a warning
+// and are not restored.
+type JournalSystem struct {
+	system          System
+	skipUnsupported bool
+	warnFunc        WarnFunc
+	mutex           sync.Mutex
+	journal         []*JournalEntry
+}
+
+// NewJournalSystem returns a new JournalSystem that wraps system.
+func NewJournalSystem(system System, options JournalSystemOptions) *JournalSystem {
+	return &JournalSystem{
+		system:          system,
+		skipUnsupported: options.SkipUnsupported,
+		warnFunc:        options.WarnFunc,
+	}
+}
+
+// Chmod implements System.Chmod.
+func (s *JournalSystem) Chmod(name AbsPath, mode fs.FileMode) error {
+	if err := s.record(name, true); err != nil {
+		return err
+	}
+	return s.system.Chmod(name, mode)
+}
+
+// Chown implements System.Chown.
+func (s *JournalSystem) Chown(name AbsPath, uid, gid int) error {
+	if err := s.record(name, true); err != nil {
+		return err
+	}
+	return s.system.Chown(name, uid, gid)
+}
+
+// Chtimes implements System.Chtimes.
+func (s *JournalSystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
+	return s.system.Chtimes(name, atime, mtime)
+}
+
+// Glob implements System.Glob.
+func (s *JournalSystem) Glob(pattern string) ([]string, error) {
+	return s.system.Glob(pattern)
+}
+
+// Journal returns the entries recorded by s, in the order in which they were
+// recorded.
+func (s *JournalSystem) Journal() []*JournalEntry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return slices.Clone(s.journal)
+}
+
+// Lgetxattrs implements System.Lgetxattrs.
+func (s *JournalSystem) Lgetxattrs(name AbsPath) (map[string][]byte, error) {
+	return s.system.Lgetxattrs(name)
+}
+
+// Link implements System.Link.
+func (s *JournalSystem) Link(oldName, newName AbsPath) error {
+	if err := s.record(newName, false); err != nil {
+		return err
+	}
+	return s.system.Link(oldName, newName)
+}
+
+// Lsetxattrs implements System.Lsetxattrs.
+func (s *JournalSystem) Lsetxattrs(name AbsPath, xattrs map[string][]byte) error {
+	if err := s.record(name, true); err != nil {
+		return err
+	}
+	return s.system.Lsetxattrs(name, xattrs)
+}
+
+// Lstat implements System.Lstat.
+func (s *JournalSystem) Lstat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Lstat(name)
+}
+
+// Mkdir implements System.Mkdir.
+func (s *JournalSystem) Mkdir(name AbsPath, perm fs.FileMode) error {
+	if err := s.record(name, true); err != nil {
+		return err
+	}
+	return s.system.Mkdir(name, perm)
+}
+
+// RawPath implements System.RawPath.
+func (s *JournalSystem) RawPath(path AbsPath) (AbsPath, error) {
+	return s.system.RawPath(path)
+}
+
+// ReadDir implements System.ReadDir.
+func (s *JournalSystem) ReadDir(name AbsPath) ([]fs.DirEntry, error) {
+	return s.system.ReadDir(name)
+}
+
+// ReadFile implements System.ReadFile.
+func (s *JournalSystem) ReadFile(name AbsPath) ([]byte, error) {
+	return s.system.ReadFile(name)
+}
+
+// Readlink implements System.Readlink.
+func (s *JournalSystem) Readlink(name AbsPath) (string, error) {
+	return s.system.Readlink(name)
+}
+
+// Remove implements System.Remove.
+func (s *JournalSystem) Remove(name AbsPath) error {
+	if err := s.record(name, false); err != nil {
+		return err
+	}
+	return s.system.Remove(name)
+}
+
+// RemoveAll implements System.RemoveAll.
+func (s *JournalSystem) RemoveAll(name AbsPath) error {
+	if err := s.record(name, false); err != nil {
+		return err
+	}
+	return s.system.RemoveAll(name)
+}
+
+// Rename implements System.Rename.
+func (s *JournalSystem) Rename(oldPath, newPath AbsPath) error {
+	if err := s.record(newPath, false); err != nil {
+		return err
+	}
+	if err := s.record(oldPath, false); err != nil {
+		return err
+	}
+	return s.system.Rename(oldPath, newPath)
+}
+
+// Rollback restores every entry modified through s to its state before it was
+// first modified, in reverse order, and then clears the journal.
+func (s *JournalSystem) Rollback() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	err := RestoreJournal(s.system, s.journal)
+	s.journal = nil
+	return err
+}
+
+// RunCmd implements System.RunCmd.
+func (s *JournalSystem) RunCmd(cmd *exec.Cmd) error {
+	return s.system.RunCmd(cmd)
+}
+
+// RunScript implements System.RunScript.
+func (s *JournalSystem) RunScript(scriptName RelPath, dir AbsPath, data []byte, options RunScriptOptions) error {
+	return s.system.RunScript(scriptName, dir, data, options)
+}
+
+// Stat implements System.Stat.
+func (s *JournalSystem) Stat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Stat(name)
+}
+
+// UnderlyingFS implements System.UnderlyingFS.
+func (s *JournalSystem) UnderlyingFS() vfs.FS {
+	return s.system.UnderlyingFS()
+}
+
+// WriteFile implements System.WriteFile.
+func (s *JournalSystem) WriteFile(name AbsPath, data []byte, perm fs.FileMode) error {
+	if err := s.record(name, false); err != nil {
+		return err
+	}
+	return s.system.WriteFile(name, data, perm)
+}
+
+// WriteSymlink implements System.WriteSymlink.
+func (s *JournalSystem) WriteSymlink(oldName string, newName AbsPath) error {
+	if err := s.record(newName, false); err != nil {
+		return err
+	}
+	return s.system.WriteSymlink(oldName, newName)
+}
+
+// record appends the current state of absPath to s's journal. If shallow is
+// true then the contents of directories are not recorded.
+func (s *JournalSystem) record(absPath AbsPath, shallow bool) error {
+	entry, err := s.snapshot(absPath, shallow)
+	var unsupportedFileTypeError *UnsupportedFileTypeError
+	switch {
+	case errors.As(err, &unsupportedFileTypeError) && s.skipUnsupported:
+		s.warnNotRecorded(err)
+		return nil
+	case err != nil:
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.journal = append(s.journal, entry)
+	return nil
+}
+
+// snapshot returns a JournalEntry recording the current state of absPath. If
+// shallow is true then the contents of directories are not recorded. If
+// absPath is of an unsupported type then snapshot returns an
+// *UnsupportedFileTypeError. Children of unsupported types are skipped with a
+// warning.
+func (s *JournalSystem) snapshot(absPath AbsPath, shallow bool) (*JournalEntry, error) {
+	fileInfo, err := s.system.Lstat(absPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return &JournalEntry{
+			AbsPath: absPath,
+			Type:    EntryStateTypeRemove,
+		}, nil
+	case err != nil:
+		return nil, err
+	}
+	entry := &JournalEntry{
+		AbsPath: absPath,
+		Mode:    fileInfo.Mode(),
+	}
+	if uid, gid, ok := fileOwnerIDs(fileInfo); ok {
+		entry.UID = &uid
+		entry.GID = &gid
+	}
+	switch fileInfo.Mode().Type() {
+	case 0, fs.ModeDir, fs.ModeSymlink:
+		xattrs, err := s.system.Lgetxattrs(absPath)
+		if err != nil {
+			return nil, err
+		}
+		if xattrs != nil {
+			entry.Xattrs = make(map[string]HexBytes, len(xattrs))
+			for name, value := range xattrs {
+				entry.Xattrs[name] = value
+			}
+		}
+	}
+	switch fileInfo.Mode().Type() {
+	case 0:
+		entry.Type = EntryStateTypeFile
+		if entry.contents, err = s.system.ReadFile(absPath); err != nil {
+			return nil, err
+		}
+		contentsSHA256 := sha256.Sum256(entry.contents)
+		entry.ContentsSHA256 = contentsSHA256[:]
+	case fs.ModeDir:
+		entry.Type = EntryStateTypeDir
+		entry.Shallow = shallow
+		if shallow {
+			return entry, nil
+		}
+		dirEntries, err := s.system.ReadDir(absPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, dirEntry := range dirEntries {
+			child, err := s.snapshot(absPath.JoinString(dirEntry.Name()), false)
+			var unsupportedFileTypeError *UnsupportedFileTypeError
+			switch {
+			case errors.As(err, &unsupportedFileTypeError):
+				s.warnNotRecorded(err)
+			case err != nil:
+				return nil, err
+			default:
+				entry.Children = append(entry.Children, child)
+			}
+		}
+	case fs.ModeSymlink:
+		entry.Type = EntryStateTypeSymlink
+		if entry.Linkname, err = s.system.Readlink(absPath); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, &UnsupportedFileTypeError{
+			absPath: absPath,
+			mode:    fileInfo.Mode(),
+		}
+	}
+	return entry, nil
+}
+
+// warnNotRecorded warns that an entry was not recorded because of err.
+func (s *JournalSystem) warnNotRecorded(err error) {
+	if s.warnFunc != nil {
+		s.warnFunc("warning: %s, not recorded\n", err)
+	}
+}
+
+// Contents returns e's contents, if available.
+func (e *JournalEntry) Contents() []byte {
+	return e.contents
+}
+
+// Load loads the contents of e and its children from blobStore.
+func (e *JournalEntry) Load(blobStore *BlobStore) error {
+	if e.Type == EntryStateTypeFile {
+		contents, err := blobStore.Get(e.ContentsSHA256)
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.AbsPath, err)
+		}
+		e.contents = contents
+	}
+	for _, child := range e.Children {
+		if err := child.Load(blobStore); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore restores e in system.
+func (e *JournalEntry) Restore(system System) error {
+	if e.Shallow && e.Type == EntryStateTypeDir {
+		if fileInfo, err := system.Lstat(e.AbsPath); err == nil && fileInfo.IsDir() {
+			if err := system.Chmod(e.AbsPath, e.Mode.Perm()); err != nil {
+				return err
+			}
+			return e.restoreOwnershipAndXattrs(system)
+		}
+	}
+	if err := system.RemoveAll(e.AbsPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return e.recreate(system)
+}
+
+// Save saves the contents of e and its children to blobStore.
+func (e *JournalEntry) Save(blobStore *BlobStore) error {
+	if e.Type == EntryStateTypeFile {
+		if err := blobStore.Put(e.contents); err != nil {
+			return err
+		}
+	}
+	for _, child := range e.Children {
+		if err := child.Save(blobStore); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recreate recreates e, which must not exist, in system.
+func (e *JournalEntry) recreate(system System) error {
+	switch e.Type {
+	case EntryStateTypeRemove:
+		return nil
+	case EntryStateTypeDir:
+		if err := system.Mkdir(e.AbsPath, e.Mode.Perm()); err != nil {
+			return err
+		}
+		for _, child := range e.Children {
+			if err := child.recreate(system); err != nil {
+				return err
+			}
+		}
+	case EntryStateTypeFile:
+		if err := system.WriteFile(e.AbsPath, e.contents, e.Mode.Perm()); err != nil {
+			return err
+		}
+	case EntryStateTypeSymlink:
+		if err := system.WriteSymlink(e.Linkname, e.AbsPath); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%s: %s: unsupported entry type", e.AbsPath, e.Type)
+	}
+	return e.restoreOwnershipAndXattrs(system)
+}
+
+// restoreOwnershipAndXattrs restores the ownership and extended attributes of
+// e, if they were recorded, in system.
+func (e *JournalEntry) restoreOwnershipAndXattrs(system System) error {
+	return RestoreOwnershipAndXattrs(system, e.AbsPath, e.UID, e.GID, e.Xattrs)
+}
+
+// RestoreOwnershipAndXattrs sets the owner of absPath in system to uid and gid,
+// if they are not nil, and its extended attributes to exactly xattrs, if xattrs
+// is not nil. Only changed values are set.
+func RestoreOwnershipAndXattrs(system System, absPath AbsPath, uid, gid *int, xattrs map[string]HexBytes) error {
+	if uid != nil && gid != nil {
+		fileInfo, err := system.Lstat(absPath)
+		if err != nil {
+			return err
+		}
+		if actualUID, actualGID, ok := fileOwnerIDs(fileInfo); ok && (actualUID != *uid || actualGID != *gid) {
+			if err := system.Chown(absPath, *uid, *gid); err != nil {
+				return err
+			}
+		}
+	}
+
+	if xattrs == nil {
+		return nil
+	}
+	actualXattrs, err := system.Lgetxattrs(absPath)
+	if err != nil {
+		return err
+	}
+	changedXattrs := make(map[string][]byte)
+	for name := range actualXattrs {
+		if _, ok := xattrs[name]; !ok {
+			changedXattrs[name] = nil
+		}
+	}
+	for name, value := range xattrs {
+		if actualValue, ok := actualXattrs[name]; !ok || !bytes.Equal(actualValue, value) {
+			// A nil value removes the extended attribute, so restore empty
+			// values as non-nil empty values.
+			changedXattrs[name] = append([]byte{}, value...)
+		}
+	}
+	if len(changedXattrs) == 0 {
+		return nil
+	}
+	return system.Lsetxattrs(absPath, changedXattrs)
+}
+
+// RestoreJournal restores every entry in journal in system, in reverse order.
+func RestoreJournal(system System, journal []*JournalEntry) error {
+	var errs []error
+	for _, entry := range slices.Backward(journal) {
+		if err := entry.Restore(system); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,46 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v5"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoitest"
+)
+
+func TestJournalSystemRollbackXattrs(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user/.file": "# contents of .file\n",
+	}, func(fileSystem vfs.FS) {
+		realSystem := NewRealSystem(fileSystem)
+		absPath := NewAbsPath("/home/user/.file")
+		if err := realSystem.Lsetxattrs(absPath, map[string][]byte{
+			"user.chezmoi.test1": []byte("value1"),
+		}); err != nil {
+			t.Skipf("extended attributes not supported: %v", err)
+		}
+		if xattrs, err := realSystem.Lgetxattrs(absPath); err != nil || xattrs == nil {
+			t.Skip("extended attributes not supported")
+		}
+
+		system := NewJournalSystem(realSystem, JournalSystemOptions{})
+		assert.NoError(t, system.Lsetxattrs(absPath, map[string][]byte{
+			"user.chezmoi.test1": nil,
+			"user.chezmoi.test2": []byte("value2"),
+		}))
+		xattrs, err := realSystem.Lgetxattrs(absPath)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]byte{
+			"user.chezmoi.test2": []byte("value2"),
+		}, xattrs)
+
+		assert.NoError(t, system.Rollback())
+
+		xattrs, err = realSystem.Lgetxattrs(absPath)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]byte{
+			"user.chezmoi.test1": []byte("value1"),
+		}, xattrs)
+	})
+}
@@ -0,0 +1,67 @@
+package chezmoi
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v5"
+	"github.com/twpayne/go-vfs/v5/vfst"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoitest"
+)
+
+var _ System = &JournalSystem{}
+
+func TestJournalSystemRollback(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user": map[string]any{
+			".dir": map[string]any{
+				"file": "# contents of .dir/file\n",
+			},
+			".file":    "# contents of .file\n",
+			".old":     "# contents of .old\n",
+			".symlink": &vfst.Symlink{Target: ".file"},
+		},
+	}, func(fileSystem vfs.FS) {
+		system := NewJournalSystem(NewRealSystem(fileSystem), JournalSystemOptions{})
+
+		assert.NoError(t, system.WriteFile(NewAbsPath("/home/user/.file"), []byte("# new contents of .file\n"), 0o666))
+		assert.NoError(t, system.WriteFile(NewAbsPath("/home/user/.new"), []byte("# contents of .new\n"), 0o666))
+		assert.NoError(t, system.Mkdir(NewAbsPath("/home/user/.newdir"), 0o777))
+		assert.NoError(t, system.WriteFile(NewAbsPath("/home/user/.newdir/file"), nil, 0o666))
+		assert.NoError(t, system.RemoveAll(NewAbsPath("/home/user/.dir")))
+		assert.NoError(t, system.Rename(NewAbsPath("/home/user/.old"), NewAbsPath("/home/user/.renamed")))
+		assert.NoError(t, system.WriteSymlink(".new", NewAbsPath("/home/user/.symlink")))
+
+		assert.NoError(t, system.Rollback())
+
+		vfst.RunTests(t, fileSystem, "",
+			vfst.TestPath("/home/user/.dir/file",
+				vfst.TestModeIsRegular(),
+				vfst.TestContentsString("# contents of .dir/file\n"),
+			),
+			vfst.TestPath("/home/user/.file",
+				vfst.TestModeIsRegular(),
+				vfst.TestContentsString("# contents of .file\n"),
+			),
+			vfst.TestPath("/home/user/.new",
+				vfst.TestDoesNotExist(),
+			),
+			vfst.TestPath("/home/user/.newdir",
+				vfst.TestDoesNotExist(),
+			),
+			vfst.TestPath("/home/user/.old",
+				vfst.TestModeIsRegular(),
+				vfst.TestContentsString("# contents of .old\n"),
+			),
+			vfst.TestPath("/home/user/.renamed",
+				vfst.TestDoesNotExist(),
+			),
+			vfst.TestPath("/home/user/.symlink",
+				vfst.TestModeType(fs.ModeSymlink),
+				vfst.TestSymlinkTarget(".file"),
+			),
+		)
+	})
+}
@@ -0,0 +1,85 @@
+//go:build unix
+
+package chezmoi
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v5"
+	"github.com/twpayne/go-vfs/v5/vfst"
+	"golang.org/x/sys/unix"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoitest"
+)
+
+func TestJournalSystemSkipsUnsupportedFileTypes(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user/.dir/file": "# contents of .dir/file\n",
+	}, func(fileSystem vfs.FS) {
+		fifoName, err := fileSystem.RawPath("/home/user/.dir/fifo")
+		assert.NoError(t, err)
+		assert.NoError(t, unix.Mkfifo(fifoName, 0o600))
+
+		var warnings []string
+		system := NewJournalSystem(NewRealSystem(fileSystem), JournalSystemOptions{
+			WarnFunc: func(format string, args ...any) {
+				warnings = append(warnings, fmt.Sprintf(format, args...))
+			},
+		})
+		assert.NoError(t, system.RemoveAll(NewAbsPath("/home/user/.dir")))
+		assert.Equal(t, []string{
+			"warning: /home/user/.dir/fifo: unsupported file type named pipe, not recorded\n",
+		}, warnings)
+
+		assert.NoError(t, system.Rollback())
+
+		vfst.RunTests(t, fileSystem, "",
+			vfst.TestPath("/home/user/.dir/file",
+				vfst.TestModeIsRegular(),
+				vfst.TestContentsString("# contents of .dir/file\n"),
+			),
+			vfst.TestPath("/home/user/.dir/fifo",
+				vfst.TestDoesNotExist(),
+			),
+		)
+	})
+}
+
+func TestJournalSystemRejectsUnsupportedFileTypes(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user": &vfst.Dir{Perm: 0o777},
+	}, func(fileSystem vfs.FS) {
+		fifoName, err := fileSystem.RawPath("/home/user/.fifo")
+		assert.NoError(t, err)
+		assert.NoError(t, unix.Mkfifo(fifoName, 0o600))
+		fifoAbsPath := NewAbsPath("/home/user/.fifo")
+
+		system := NewJournalSystem(NewRealSystem(fileSystem), JournalSystemOptions{})
+		err = system.WriteFile(fifoAbsPath, []byte("# contents of .fifo\n"), 0o666)
+		var unsupportedFileTypeError *UnsupportedFileTypeError
+		assert.True(t, errors.As(err, &unsupportedFileTypeError))
+		assert.Equal(t, 0, len(system.Journal()))
+		vfst.RunTests(t, fileSystem, "",
+			vfst.TestPath("/home/user/.fifo",
+				vfst.TestModeType(fs.ModeNamedPipe),
+			),
+		)
+
+		var warnings []string
+		system = NewJournalSystem(NewRealSystem(fileSystem), JournalSystemOptions{
+			SkipUnsupported: true,
+			WarnFunc: func(format string, args ...any) {
+				warnings = append(warnings, fmt.Sprintf(format, args...))
+			},
+		})
+		assert.NoError(t, system.Remove(fifoAbsPath))
+		assert.Equal(t, []string{
+			"warning: /home/user/.fifo: unsupported file type named pipe, not recorded\n",
+		}, warnings)
+		assert.Equal(t, 0, len(system.Journal()))
+	})
+}
@@ -0,0 +1,717 @@
+package chezmoi
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template/parse"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoiset"
+)
+
+// A LintSeverity is the severity of a LintIssue.
+type LintSeverity string
+
+// LintSeverities.
+const (
+	LintSeverityError   LintSeverity = "error"
+	LintSeverityWarning LintSeverity = "warning"
+)
+
+// Lint rules.
+const (
+	LintRuleAttributes         = "attributes"
+	LintRuleDuplicateTarget    = "duplicate-target"
+	LintRuleInvalidSpecialFile = "invalid-special-file"
+	LintRuleMissingTemplate    = "missing-template"
+	LintRuleRemoveManaged      = "remove-managed"
+	LintRuleScriptInterpreter  = "script-interpreter"
+	LintRuleTemplateParse      = "template-parse"
+	LintRuleUndefinedData      = "undefined-data"
+	LintRuleUnreachable        = "unreachable"
+)
+
+// LintRuleDescriptions contains a short description of each lint rule.
+var LintRuleDescriptions = map[string]string{
+	LintRuleAttributes:         "Source name attributes that are ignored or have no effect",
+	LintRuleDuplicateTarget:    "Targets defined by both an external and the source state, or by several externals",
+	LintRuleInvalidSpecialFile: "Special files that cannot be read",
+	LintRuleMissingTemplate:    "References to templates or files that do not exist",
+	LintRuleRemoveManaged:      ".chezmoiremove patterns that match managed targets",
+	LintRuleScriptInterpreter:  "Scripts without a shebang or a configured interpreter",
+	LintRuleTemplateParse:      "Templates that cannot be parsed",
+	LintRuleUndefinedData:      "Template data keys that are not defined",
+	LintRuleUnreachable:        "Entries that are always ignored",
+}
+
+// A LintIssue is an issue found by SourceState.Lint.
+type LintIssue struct {
+	Rule          string       `json:"rule"           yaml:"rule"`
+	Severity      LintSeverity `json:"severity"       yaml:"severity"`
+	SourceAbsPath AbsPath      `json:"source"         yaml:"source"`
+	Line          int          `json:"line,omitempty" yaml:"line,omitempty"`
+	Message       string       `json:"message"        yaml:"message"`
+}
+
+var (
+	// attributePrefixes are the prefixes that are only recognized in specific
+	// positions of a source name.
+	attributePrefixes = []string{
+		afterPrefix,
+		beforePrefix,
+		createPrefix,
+		dotPrefix,
+		emptyPrefix,
+		encryptedPrefix,
+		exactPrefix,
+		executablePrefix,
+		externalPrefix,
+		hardlinkPrefix,
+		modifyPrefix,
+		oncePrefix,
+		onChangePrefix,
+		privatePrefix,
+		readOnlyPrefix,
+		removePrefix,
+		runPrefix,
+		symlinkPrefix,
+	}
+
+	templateErrorLineRx = regexp.MustCompile(`\Atemplate: .*?:(\d+): `)
+)
+
+// A lintEntry is a regular entry in the source state found while linting.
+type lintEntry struct {
+	sourceAbsPath AbsPath
+	targetRelPath RelPath
+	isDir         bool
+	fileType      SourceFileTargetType
+}
+
+// A lintRemoveFile is a .chezmoiremove file found while linting.
+type lintRemoveFile struct {
+	sourceAbsPath AbsPath
+	patternSet    *PatternSet
+}
+
+// A linter accumulates lint issues.
+type linter struct {
+	s            *SourceState
+	data         map[string]any
+	alwaysIgnore *PatternSet
+	entries      []lintEntry
+	removeFiles  []lintRemoveFile
+	issues       []*LintIssue
+}
+
+// Lint checks the source directories for problems without reading externals
+// or rendering templates to the destination. s must have been read with
+// WithTemplateDataOnly.
+func (s *SourceState) Lint(ctx context.Context) ([]*LintIssue, error) {
+	l := &linter{
+		s:            s,
+		data:         s.TemplateData(),
+		alwaysIgnore: NewPatternSet(),
+	}
+	if chezmoiTemplateData, ok := l.data["chezmoi"].(map[string]any); ok {
+		chezmoiTemplateData["sourceFile"] = ""
+		chezmoiTemplateData["targetFile"] = ""
+	}
+
+	var sourceDirAbsPaths []AbsPath
+	for _, sourceDirAbsPath := range s.SourceDirAbsPaths() {
+		switch fileInfo, err := s.system.Stat(sourceDirAbsPath); {
+		case errors.Is(err, fs.ErrNotExist):
+			continue
+		case err != nil:
+			return nil, err
+		case !fileInfo.IsDir():
+			return nil, fmt.Errorf("%s: not a directory", sourceDirAbsPath)
+		}
+		sourceDirAbsPaths = append(sourceDirAbsPaths, sourceDirAbsPath)
+	}
+
+	// Read templates from all source directories first so that templates can
+	// reference templates in any source directory.
+	for _, sourceDirAbsPath := range sourceDirAbsPaths {
+		if err := l.lintTemplatesDir(sourceDirAbsPath.JoinString(TemplatesDirName)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, sourceDirAbsPath := range sourceDirAbsPaths {
+		if err := walkSourceDir(s.system, s.system, sourceDirAbsPath, func(sourceAbsPath AbsPath, fileInfo fs.FileInfo, err error) error {
+			return l.walk(ctx, sourceDirAbsPath, sourceAbsPath, fileInfo, err)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	l.lintUnreachable()
+	l.lintDuplicateTargets()
+	l.lintRemoveManaged()
+
+	slices.SortFunc(l.issues, func(a, b *LintIssue) int {
+		return cmp.Or(
+			cmp.Compare(a.SourceAbsPath.String(), b.SourceAbsPath.String()),
+			cmp.Compare(a.Line, b.Line),
+			cmp.Compare(a.Rule, b.Rule),
+			cmp.Compare(a.Message, b.Message),
+		)
+	})
+	return l.issues, nil
+}
+
+// addIssue adds an issue.
+func (l *linter) addIssue(
+	rule string,
+	severity LintSeverity,
+	sourceAbsPath AbsPath,
+	line int,
+	format string,
+	args ...any,
+) {
+	l.issues = append(l.issues, &LintIssue{
+		Rule:          rule,
+		Severity:      severity,
+		SourceAbsPath: sourceAbsPath,
+		Line:          line,
+		Message:       fmt.Sprintf(format, args...),
+	})
+}
+
+// addSpecialFileIssue adds an issue for err, which occurred while reading the
+// special file at sourceAbsPath.
+func (l *linter) addSpecialFileIssue(sourceAbsPath AbsPath, err error) {
+	message := strings.TrimPrefix(err.Error(), sourceAbsPath.String()+": ")
+	l.addIssue(LintRuleInvalidSpecialFile, LintSeverityError, sourceAbsPath, 0, "%s", message)
+}
+
+// walk lints a single entry in the source directory sourceDirAbsPath.
+func (l *linter) walk(
+	ctx context.Context,
+	sourceDirAbsPath, sourceAbsPath AbsPath,
+	fileInfo fs.FileInfo,
+	err error,
+) error {
+	if err != nil {
+		return err
+	}
+	if sourceAbsPath == sourceDirAbsPath {
+		return nil
+	}
+
+	// Follow symlinks in the source directory.
+	if fileInfo.Mode().Type() == fs.ModeSymlink {
+		if strings.HasPrefix(fileInfo.Name(), ignorePrefix) && !strings.HasPrefix(fileInfo.Name(), Prefix) {
+			return nil
+		}
+		fileInfo, err = l.s.system.Stat(sourceAbsPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	sourceRelPath := SourceRelPath{
+		relPath: sourceAbsPath.MustTrimDirPrefix(sourceDirAbsPath),
+		isDir:   fileInfo.IsDir(),
+	}
+	parentSourceRelPath, sourceName := sourceRelPath.Split()
+	inScriptsDir := strings.Contains("/"+sourceRelPath.String(), "/"+scriptsDirName+"/")
+
+	switch kind := classifySourceEntry(fileInfo); {
+	case kind == sourceEntryKindDataDir || kind == sourceEntryKindTemplatesDir:
+		return fs.SkipDir
+	case kind == sourceEntryKindDataFile || kind == sourceEntryKindVersionFile:
+		return nil
+	case kind == sourceEntryKindExternalFile:
+		if l.lintTemplateFile(sourceAbsPath, true) {
+			parentAbsPath, _ := sourceAbsPath.Split()
+			if err := l.s.addExternal(sourceAbsPath, parentAbsPath); err != nil {
+				l.addSpecialFileIssue(sourceAbsPath, err)
+			}
+		}
+		return nil
+	case kind == sourceEntryKindExternalsDir:
+		if err := l.s.addExternalDir(ctx, sourceAbsPath); err != nil {
+			l.addSpecialFileIssue(sourceAbsPath, err)
+		}
+		return fs.SkipDir
+	case kind == sourceEntryKindIgnoreFile:
+		if l.lintTemplateFile(sourceAbsPath, true) {
+			l.addAlwaysIgnorePatterns(sourceAbsPath, parentSourceRelPath)
+			if err := l.s.addPatterns(l.s.ignore, sourceAbsPath, parentSourceRelPath); err != nil {
+				l.addSpecialFileIssue(sourceAbsPath, err)
+			}
+		}
+		return nil
+	case kind == sourceEntryKindRemoveFile:
+		if l.lintTemplateFile(sourceAbsPath, true) {
+			patternSet := NewPatternSet()
+			if err := l.s.addPatterns(patternSet, sourceAbsPath, parentSourceRelPath); err != nil {
+				l.addSpecialFileIssue(sourceAbsPath, err)
+			}
+			l.removeFiles = append(l.removeFiles, lintRemoveFile{
+				sourceAbsPath: sourceAbsPath,
+				patternSet:    patternSet,
+			})
+		}
+		return nil
+	case kind == sourceEntryKindAttributesFile:
+		if l.lintTemplateFile(sourceAbsPath, true) {
+			if err := l.s.addAttributeRules(sourceAbsPath, parentSourceRelPath); err != nil {
+				l.addSpecialFileIssue(sourceAbsPath, err)
+			}
+		}
+		return nil
+	case kind == sourceEntryKindOwnersFile:
+		if l.lintTemplateFile(sourceAbsPath, true) {
+			if err := l.s.addOwnerRules(sourceAbsPath, parentSourceRelPath); err != nil {
+				l.addSpecialFileIssue(sourceAbsPath, err)
+			}
+		}
+		return nil
+	case kind == sourceEntryKindRecipientsFile:
+		if l.lintTemplateFile(sourceAbsPath, true) {
+			if err := l.s.addRecipientsRule(sourceAbsPath, parentSourceRelPath); err != nil {
+				l.addSpecialFileIssue(sourceAbsPath, err)
+			}
+		}
+		return nil
+	case kind == sourceEntryKindXattrsFile:
+		if err := l.s.addXattrs(sourceAbsPath, parentSourceRelPath); err != nil {
+			l.addSpecialFileIssue(sourceAbsPath, err)
+		}
+		return nil
+	case kind == sourceEntryKindScriptsDir:
+		return nil
+	case kind == sourceEntryKindIgnored:
+		if fileInfo.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	case kind == sourceEntryKindDir && inScriptsDir:
+		return nil
+	case kind == sourceEntryKindDir:
+		da, err := parseDirAttr(sourceName.String())
+		if err != nil {
+			l.addIssue(LintRuleAttributes, LintSeverityError, sourceAbsPath, 0, "%v", err)
+			return fs.SkipDir
+		}
+		targetRelPath, err := parentSourceRelPath.Dir().TargetRelPath(l.s.encryption.EncryptedSuffix())
+		if err != nil {
+			return err
+		}
+		targetRelPath = targetRelPath.JoinString(da.TargetName)
+		l.lintAttributePrefixes(sourceAbsPath, sourceName.String(), da.TargetName)
+		if da.Remove && (da.Exact || da.External || da.Private || da.ReadOnly) {
+			l.addIssue(LintRuleAttributes, LintSeverityWarning, sourceAbsPath, 0,
+				"%s directories ignore all other attributes", strings.TrimSuffix(removePrefix, "_"))
+		}
+		l.entries = append(l.entries, lintEntry{
+			sourceAbsPath: sourceAbsPath,
+			targetRelPath: targetRelPath,
+			isDir:         true,
+		})
+		if da.External {
+			return fs.SkipDir
+		}
+		return nil
+	case kind == sourceEntryKindFile:
+		fa, err := parseFileAttr(sourceName.String(), EncryptedSuffixOf(l.s.encryption, sourceName.String()))
+		if err != nil {
+			l.addIssue(LintRuleAttributes, LintSeverityError, sourceAbsPath, 0, "%v", err)
+			return nil
+		}
+		if inScriptsDir && fa.Type != SourceFileTypeScript {
+			l.addIssue(LintRuleAttributes, LintSeverityError, sourceAbsPath, 0, "not a script")
+			return nil
+		}
+		targetRelPath, err := parentSourceRelPath.Dir().TargetRelPath(l.s.encryption.EncryptedSuffix())
+		if err != nil {
+			return err
+		}
+		targetRelPath = targetRelPath.JoinString(fa.TargetName)
+		if targetAttributes := l.s.targetAttributes(targetRelPath); targetAttributes != nil {
+			fa = targetAttributes.modifyFileAttr(fa)
+		}
+		l.lintFileAttr(sourceAbsPath, sourceName.String(), fa)
+		if !inScriptsDir {
+			l.entries = append(l.entries, lintEntry{
+				sourceAbsPath: sourceAbsPath,
+				targetRelPath: targetRelPath,
+				fileType:      fa.Type,
+			})
+		}
+		if fa.Encrypted {
+			return nil
+		}
+		if fa.Template {
+			l.lintTemplateFile(sourceAbsPath, fa.Type != SourceFileTypeModify)
+		}
+		if fa.Type == SourceFileTypeScript {
+			l.lintScript(sourceAbsPath, targetRelPath, fa)
+		}
+		return nil
+	default:
+		return &UnsupportedFileTypeError{
+			absPath: sourceAbsPath,
+			mode:    fileInfo.Mode(),
+		}
+	}
+}
+
+// lintAttributePrefixes checks that targetName does not start with an
+// attribute prefix that was ignored because it was not in the correct
+// position in sourceName.
+func (l *linter) lintAttributePrefixes(sourceAbsPath AbsPath, sourceName, targetName string) {
+	name := strings.TrimPrefix(targetName, ".")
+	if strings.Contains(sourceName, literalPrefix+name) {
+		return
+	}
+	for _, prefix := range attributePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			l.addIssue(LintRuleAttributes, LintSeverityWarning, sourceAbsPath, 0,
+				"%s: %s is not recognized in this position, target name is %s", sourceName, prefix, targetName)
+			return
+		}
+	}
+}
+
+// lintFileAttr checks fa, parsed from sourceName, for attributes that are
+// ignored or have no effect.
+func (l *linter) lintFileAttr(sourceAbsPath AbsPath, sourceName string, fa FileAttr) {
+	l.lintAttributePrefixes(sourceAbsPath, sourceName, fa.TargetName)
+	encryptedSuffix := EncryptedSuffixOf(l.s.encryption, sourceName)
+	if fa.Encrypted && encryptedSuffix != "" && !strings.HasSuffix(sourceName, encryptedSuffix) {
+		l.addIssue(LintRuleAttributes, LintSeverityWarning, sourceAbsPath, 0,
+			"encrypted file does not have the %s suffix", encryptedSuffix)
+	}
+	if fa.Type == SourceFileTypeRemove && fa.Template {
+		l.addIssue(LintRuleAttributes, LintSeverityWarning, sourceAbsPath, 0,
+			"%s suffix has no effect on remove entries", TemplateSuffix)
+	}
+}
+
+// lintScript checks that the script at sourceAbsPath can be executed.
+func (l *linter) lintScript(sourceAbsPath AbsPath, targetRelPath RelPath, fa FileAttr) {
+	extension := strings.ToLower(strings.TrimPrefix(targetRelPath.Ext(), "."))
+	if _, ok := l.s.interpreters[extension]; ok {
+		return
+	}
+	contents, err := l.s.system.ReadFile(sourceAbsPath)
+	if err != nil {
+		return
+	}
+	contents = bytes.TrimLeft(contents, "\r\n")
+	switch {
+	case len(bytes.TrimSpace(contents)) == 0:
+		// Empty scripts are not executed.
+	case bytes.HasPrefix(contents, []byte("#!")):
+		// The script has a shebang.
+	case fa.Template && bytes.Contains(contents, []byte("#!")):
+		// The template may generate a shebang.
+	default:
+		l.addIssue(LintRuleScriptInterpreter, LintSeverityWarning, sourceAbsPath, 1,
+			"script has no shebang and no interpreter is configured for its extension")
+	}
+}
+
+// lintTemplatesDir lints the templates in templatesDirAbsPath and adds the
+// templates that can be parsed to l.s.
+func (l *linter) lintTemplatesDir(templatesDirAbsPath AbsPath) error {
+	var templateAbsPaths []AbsPath
+	if err := walkSourceDir(l.s.system, l.s.system, templatesDirAbsPath, func(absPath AbsPath, fileInfo fs.FileInfo, err error) error {
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && absPath == templatesDirAbsPath:
+			return nil
+		case err != nil:
+			return err
+		case absPath == templatesDirAbsPath:
+			return nil
+		case strings.HasPrefix(fileInfo.Name(), ignorePrefix):
+			if fileInfo.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		case fileInfo.IsDir():
+			return nil
+		default:
+			templateAbsPaths = append(templateAbsPaths, absPath)
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	for _, templateAbsPath := range templateAbsPaths {
+		contents, err := l.s.system.ReadFile(templateAbsPath)
+		if err != nil {
+			return err
+		}
+		name := templateAbsPath.MustTrimDirPrefix(templatesDirAbsPath).String()
+		if tmpl := l.parseTemplate(templateAbsPath, name, contents); tmpl != nil {
+			l.s.templates[name] = tmpl
+		}
+	}
+
+	// Check references between templates once all templates are known.
+	for _, templateAbsPath := range templateAbsPaths {
+		name := templateAbsPath.MustTrimDirPrefix(templatesDirAbsPath).String()
+		if tmpl, ok := l.s.templates[name]; ok {
+			l.lintTemplate(templateAbsPath, tmpl, false)
+		}
+	}
+	return nil
+}
+
+// lintTemplateFile lints the template at sourceAbsPath. If checkData is true
+// then the template is assumed to be executed with the template data. It
+// returns true if the template can be parsed.
+func (l *linter) lintTemplateFile(sourceAbsPath AbsPath, checkData bool) bool {
+	contents, err := l.s.system.ReadFile(sourceAbsPath)
+	if err != nil {
+		l.addSpecialFileIssue(sourceAbsPath, err)
+		return false
+	}
+	name := sourceAbsPath.MustTrimDirPrefix(l.s.sourceDirAbsPathOf(sourceAbsPath)).String()
+	tmpl := l.parseTemplate(sourceAbsPath, name, contents)
+	if tmpl == nil {
+		return false
+	}
+	l.lintTemplate(sourceAbsPath, tmpl, checkData)
+	return true
+}
+
+// parseTemplate parses contents as a template named name, adding an issue and
+// returning nil if it cannot be parsed.
+func (l *linter) parseTemplate(sourceAbsPath AbsPath, name string, contents []byte) *Template {
+	tmpl, err := ParseTemplate(name, contents, TemplateOptions{
+		Funcs:   l.s.templateFuncs,
+		Options: slices.Clone(l.s.templateOptions),
+	})
+	if err != nil {
+		line := 0
+		message := err.Error()
+		if match := templateErrorLineRx.FindStringSubmatch(message); match != nil {
+			line, _ = strconv.Atoi(match[1])
+			message = message[len(match[0]):]
+		}
+		l.addIssue(LintRuleTemplateParse, LintSeverityError, sourceAbsPath, line, "%s", message)
+		return nil
+	}
+	return tmpl
+}
+
+// lintTemplate checks the parse trees of tmpl for references to missing
+// templates and, if checkData is true, undefined template data.
+func (l *linter) lintTemplate(sourceAbsPath AbsPath, tmpl *Template, checkData bool) {
+	definedTemplateNames := chezmoiset.New[string]()
+	for _, t := range tmpl.template.Templates() {
+		definedTemplateNames.Add(t.Name())
+	}
+	for _, t := range tmpl.template.Templates() {
+		w := &templateWalker{
+			tree: t.Tree,
+		}
+		w.dataFunc = func(node parse.Node, ident []string, guarded bool) {
+			if !guarded {
+				l.checkData(sourceAbsPath, w.line(node), ident)
+			}
+		}
+		w.funcFunc = func(cmd *parse.CommandNode, name string, dotIsData bool) {
+			if len(cmd.Args) < 2 {
+				return
+			}
+			if filename, ok := cmd.Args[1].(*parse.StringNode); ok {
+				l.checkInclude(sourceAbsPath, w.line(cmd), name, filename.Text)
+			}
+		}
+		w.templateFunc = func(node *parse.TemplateNode, dotIsData bool) {
+			if definedTemplateNames.Contains(node.Name) {
+				return
+			}
+			if _, ok := l.s.templates[node.Name]; !ok {
+				l.addIssue(LintRuleMissingTemplate, LintSeverityError, sourceAbsPath, w.line(node),
+					"%s: template not found in %s", node.Name, TemplatesDirName)
+			}
+		}
+		w.walk(checkData && t.Name() == tmpl.name)
+	}
+}
+
+// checkInclude checks that the file included by the template function
+// funcName exists.
+func (l *linter) checkInclude(sourceAbsPath AbsPath, line int, funcName, filename string) {
+	var searchDirAbsPaths []AbsPath
+	switch funcName {
+	case "include":
+		searchDirAbsPaths = []AbsPath{l.s.sourceDirAbsPath}
+	case "includeTemplate":
+		searchDirAbsPaths = []AbsPath{l.s.sourceDirAbsPath.JoinString(TemplatesDirName), l.s.sourceDirAbsPath}
+	default:
+		return
+	}
+	if strings.HasPrefix(filename, "/") {
+		return
+	}
+	for _, searchDirAbsPath := range searchDirAbsPaths {
+		if _, err := l.s.system.Stat(searchDirAbsPath.JoinString(filename)); err == nil {
+			return
+		}
+	}
+	l.addIssue(LintRuleMissingTemplate, LintSeverityError, sourceAbsPath, line,
+		"%s: %s: file not found", funcName, filename)
+}
+
+// checkData checks that the template data keys in ident are defined.
+func (l *linter) checkData(sourceAbsPath AbsPath, line int, ident []string) {
+	var value any = l.data
+	for i, key := range ident {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return
+		}
+		if value, ok = m[key]; !ok {
+			l.addIssue(LintRuleUndefinedData, LintSeverityWarning, sourceAbsPath, line,
+				".%s: undefined template data", strings.Join(ident[:i+1], "."))
+			return
+		}
+	}
+}
+
+// addAlwaysIgnorePatterns adds the patterns in the .chezmoiignore file at
+// sourceAbsPath that do not depend on the template data to l.alwaysIgnore.
+func (l *linter) addAlwaysIgnorePatterns(sourceAbsPath AbsPath, sourceRelPath SourceRelPath) {
+	contents, err := l.s.system.ReadFile(sourceAbsPath)
+	if err != nil {
+		return
+	}
+	tmpl, err := ParseTemplate(sourceAbsPath.Base(), contents, TemplateOptions{
+		Funcs:   l.s.templateFuncs,
+		Options: slices.Clone(l.s.templateOptions),
+	})
+	if err != nil {
+		return
+	}
+
+	// Only text at the top level of the template is unconditional. Replace
+	// all actions with a NUL byte so that lines containing actions are
+	// skipped.
+	var builder strings.Builder
+	for _, node := range tmpl.template.Tree.Root.Nodes {
+		if textNode, ok := node.(*parse.TextNode); ok {
+			builder.Write(textNode.Text)
+		} else {
+			builder.WriteByte(0)
+		}
+	}
+
+	dir, err := sourceRelPath.Dir().TargetRelPath("")
+	if err != nil {
+		return
+	}
+	for line := range strings.Lines(builder.String()) {
+		if strings.ContainsRune(line, 0) {
+			continue
+		}
+		line = strings.TrimSpace(commentRx.ReplaceAllString(line, ""))
+		if line == "" || strings.HasPrefix(line, "!") {
+			continue
+		}
+		_ = l.alwaysIgnore.Add(dir.JoinString(line).String(), PatternSetInclude)
+	}
+}
+
+// lintUnreachable reports entries that are always ignored. Entries whose
+// source name is the same as their target name, like README.md, are commonly
+// kept in the source directory and ignored deliberately, so they are not
+// reported.
+func (l *linter) lintUnreachable() {
+	unreachable := chezmoiset.New[RelPath]()
+	for _, entry := range l.entries {
+		if l.alwaysIgnore.Match(entry.targetRelPath.String()) != PatternSetMatchInclude {
+			continue
+		}
+		unreachable.Add(entry.targetRelPath)
+		if unreachable.Contains(entry.targetRelPath.Dir()) {
+			continue
+		}
+		if entry.sourceAbsPath.Base() == entry.targetRelPath.Base() {
+			continue
+		}
+		l.addIssue(LintRuleUnreachable, LintSeverityWarning, entry.sourceAbsPath, 0,
+			"%s: target is always ignored", entry.targetRelPath)
+	}
+}
+
+// lintDuplicateTargets reports targets that are defined by several externals
+// or by an external and a source entry.
+func (l *linter) lintDuplicateTargets() {
+	for _, externalRelPath := range slices.SortedFunc(maps.Keys(l.s.externals), CompareRelPaths) {
+		if l.alwaysIgnore.Match(externalRelPath.String()) == PatternSetMatchInclude {
+			continue
+		}
+		externals := l.s.externals[externalRelPath]
+		for _, external := range externals[1:] {
+			l.addIssue(LintRuleDuplicateTarget, LintSeverityError, external.sourceAbsPath, 0,
+				"%s: external is also defined in %s", externalRelPath, externals[0].sourceAbsPath)
+		}
+		external := externals[0]
+		for _, entry := range l.entries {
+			if l.alwaysIgnore.Match(entry.targetRelPath.String()) == PatternSetMatchInclude {
+				continue
+			}
+			switch {
+			case entry.fileType == SourceFileTypeScript:
+				continue
+			case entry.targetRelPath == externalRelPath:
+				if entry.isDir && external.Type != ExternalTypeFile && external.Type != ExternalTypeArchiveFile {
+					continue
+				}
+			case entry.targetRelPath.HasDirPrefix(externalRelPath):
+				if external.Type != ExternalTypeArchive && external.Type != ExternalTypeGitRepo {
+					continue
+				}
+			default:
+				continue
+			}
+			l.addIssue(LintRuleDuplicateTarget, LintSeverityError, entry.sourceAbsPath, 0,
+				"%s: target is also defined by external in %s", entry.targetRelPath, external.sourceAbsPath)
+		}
+	}
+}
+
+// lintRemoveManaged reports .chezmoiremove patterns that match managed
+// targets.
+func (l *linter) lintRemoveManaged() {
+	for _, removeFile := range l.removeFiles {
+		for _, entry := range l.entries {
+			switch {
+			case entry.fileType == SourceFileTypeRemove || entry.fileType == SourceFileTypeScript:
+				continue
+			case l.alwaysIgnore.Match(entry.targetRelPath.String()) == PatternSetMatchInclude:
+				continue
+			case removeFile.patternSet.Match(entry.targetRelPath.String()) != PatternSetMatchInclude:
+				continue
+			}
+			for _, pattern := range slices.Sorted(maps.Keys(removeFile.patternSet.IncludePatterns)) {
+				if ok, _ := doublestar.Match(pattern, entry.targetRelPath.String()); ok {
+					l.addIssue(LintRuleRemoveManaged, LintSeverityError, removeFile.sourceAbsPath, 0,
+						"%s: pattern matches managed target %s", pattern, entry.targetRelPath)
+					break
+				}
+			}
+		}
+	}
+}
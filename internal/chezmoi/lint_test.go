@@ -0,0 +1,174 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/twpayne/go-vfs/v5"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoitest"
+)
+
+func TestSourceStateLint(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		root           any
+		expectedIssues []*LintIssue
+	}{
+		{
+			name: "empty",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					"dot_file": "# contents of .file\n",
+				},
+			},
+		},
+		{
+			name: "attributes",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					"dot_executable_file":        "",
+					"encrypted_dot_file":         "",
+					"literal_private_file":       "",
+					"private_dot_dir":            map[string]any{},
+					"remove_dot_file.tmpl":       "",
+					"remove_exact_dot_dir":       map[string]any{},
+					"run_before_once_script.sh":  "#!/bin/sh\n",
+					"run_once_before_script2.sh": "#!/bin/sh\n",
+				},
+			},
+			expectedIssues: []*LintIssue{
+				{
+					Rule:          LintRuleAttributes,
+					Severity:      LintSeverityWarning,
+					SourceAbsPath: NewAbsPath("/home/user/.local/share/chezmoi/dot_executable_file"),
+					Message:       "dot_executable_file: executable_ is not recognized in this position, target name is .executable_file",
+				},
+				{
+					Rule:          LintRuleAttributes,
+					Severity:      LintSeverityWarning,
+					SourceAbsPath: NewAbsPath("/home/user/.local/share/chezmoi/encrypted_dot_file"),
+					Message:       "encrypted file does not have the .age suffix",
+				},
+				{
+					Rule:          LintRuleAttributes,
+					Severity:      LintSeverityWarning,
+					SourceAbsPath: NewAbsPath("/home/user/.local/share/chezmoi/remove_dot_file.tmpl"),
+					Message:       ".tmpl suffix has no effect on remove entries",
+				},
+				{
+					Rule:          LintRuleAttributes,
+					Severity:      LintSeverityWarning,
+					SourceAbsPath: NewAbsPath("/home/user/.local/share/chezmoi/remove_exact_dot_dir"),
+					Message:       "remove directories ignore all other attributes",
+				},
+				{
+					Rule:          LintRuleAttributes,
+					Severity:      LintSeverityWarning,
+					SourceAbsPath: NewAbsPath("/home/user/.local/share/chezmoi/run_before_once_script.sh"),
+					Message:       "run_before_once_script.sh: once_ is not recognized in this position, target name is once_script.sh",
+				},
+			},
+		},
+		{
+			name: "unreachable",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoiignore": chezmoitest.JoinLines(
+						"README.md",
+						".dir",
+						"{{ if true }}",
+						".conditional",
+						"{{ end }}",
+						".inline{{ .name }}",
+						"!.negated",
+					),
+					"README.md":       "",
+					"dot_conditional": "",
+					"dot_dir": map[string]any{
+						"file": "",
+					},
+					"dot_inline": "",
+				},
+			},
+			expectedIssues: []*LintIssue{
+				{
+					Rule:          LintRuleUnreachable,
+					Severity:      LintSeverityWarning,
+					SourceAbsPath: NewAbsPath("/home/user/.local/share/chezmoi/dot_dir"),
+					Message:       ".dir: target is always ignored",
+				},
+			},
+		},
+		{
+			name: "template",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoitemplates": map[string]any{
+						"partial": `{{ .anything }}{{ template "missing" }}`,
+					},
+					"dot_defined.tmpl": chezmoitest.JoinLines(
+						`{{ define "local" }}{{ .name }}{{ end }}`,
+						`{{ template "local" . }}{{ template "partial" . }}`,
+						`{{ with .nested }}{{ .anything }}{{ end }}`,
+						`{{ if .optional }}{{ .optional.key }}{{ end }}`,
+						`{{ $.nested.key }}`,
+					),
+					"dot_undefined.tmpl": chezmoitest.JoinLines(
+						`{{ .nested.undefined }}`,
+						`{{ $.undefined }}`,
+					),
+				},
+			},
+			expectedIssues: []*LintIssue{
+				{
+					Rule:          LintRuleMissingTemplate,
+					Severity:      LintSeverityError,
+					SourceAbsPath: NewAbsPath("/home/user/.local/share/chezmoi/.chezmoitemplates/partial"),
+					Line:          1,
+					Message:       "missing: template not found in .chezmoitemplates",
+				},
+				{
+					Rule:          LintRuleUndefinedData,
+					Severity:      LintSeverityWarning,
+					SourceAbsPath: NewAbsPath("/home/user/.local/share/chezmoi/dot_undefined.tmpl"),
+					Line:          1,
+					Message:       ".nested.undefined: undefined template data",
+				},
+				{
+					Rule:          LintRuleUndefinedData,
+					Severity:      LintSeverityWarning,
+					SourceAbsPath: NewAbsPath("/home/user/.local/share/chezmoi/dot_undefined.tmpl"),
+					Line:          2,
+					Message:       ".undefined: undefined template data",
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chezmoitest.WithTestFS(t, tc.root, func(fileSystem vfs.FS) {
+				ctx := t.Context()
+				system := NewRealSystem(fileSystem)
+				s := NewSourceState(
+					WithBaseSystem(system),
+					WithDestDir(NewAbsPath("/home/user")),
+					WithEncryption(&AgeEncryption{Suffix: ".age"}),
+					WithPriorityTemplateData(map[string]any{
+						"name": "user",
+						"nested": map[string]any{
+							"key": "value",
+						},
+					}),
+					WithReadTemplates(false),
+					WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+					WithSystem(system),
+					WithTemplateDataOnly(true),
+				)
+				assert.NoError(t, s.Read(ctx, nil))
+				actualIssues, err := s.Lint(ctx)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedIssues, actualIssues)
+			})
+		})
+	}
+}
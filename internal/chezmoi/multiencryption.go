@@ -0,0 +1,170 @@
+package chezmoi
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// A MultiEncryption combines several named encryptions. It encrypts with its
+// default encryption. It decrypts files with the encryption whose encrypted
+// suffix matches the file's name, and other data with the encryptions that
+// match the data's format, falling back to the first encryption that succeeds,
+// trying the default encryption first.
+type MultiEncryption struct {
+	defaultName string
+	encryptions map[string]Encryption
+	names       []string
+}
+
+// NewMultiEncryption returns a new MultiEncryption with encryptions, where
+// defaultName is the name of the default encryption.
+func NewMultiEncryption(defaultName string, encryptions map[string]Encryption) *MultiEncryption {
+	names := []string{defaultName}
+	for _, name := range slices.Sorted(maps.Keys(encryptions)) {
+		if name != defaultName {
+			names = append(names, name)
+		}
+	}
+	return &MultiEncryption{
+		defaultName: defaultName,
+		encryptions: encryptions,
+		names:       names,
+	}
+}
+
+// Decrypt implements Encryption.Decrypt.
+func (e *MultiEncryption) Decrypt(ciphertext []byte) ([]byte, error) {
+	var firstErr error
+	for _, name := range e.decryptionNames(ciphertext) {
+		plaintext, err := e.encryptions[name].Decrypt(ciphertext)
+		if err == nil {
+			return plaintext, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// DecryptToFile implements Encryption.DecryptToFile.
+func (e *MultiEncryption) DecryptToFile(plaintextAbsPath AbsPath, ciphertext []byte) error {
+	var firstErr error
+	for _, name := range e.decryptionNames(ciphertext) {
+		err := e.encryptions[name].DecryptToFile(plaintextAbsPath, ciphertext)
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Encrypt implements Encryption.Encrypt.
+func (e *MultiEncryption) Encrypt(plaintext []byte) ([]byte, error) {
+	return e.encryptions[e.defaultName].Encrypt(plaintext)
+}
+
+// EncryptFile implements Encryption.EncryptFile.
+func (e *MultiEncryption) EncryptFile(plaintextAbsPath AbsPath) ([]byte, error) {
+	return e.encryptions[e.defaultName].EncryptFile(plaintextAbsPath)
+}
+
+// EncryptedSuffix implements Encryption.EncryptedSuffix.
+func (e *MultiEncryption) EncryptedSuffix() string {
+	return e.encryptions[e.defaultName].EncryptedSuffix()
+}
+
+// ForSourceName returns the encryption whose encrypted suffix sourceName has,
+// or the default encryption if there is none.
+func (e *MultiEncryption) ForSourceName(sourceName string) Encryption {
+	for _, name := range e.names {
+		encryption := e.encryptions[name]
+		if encryptedSuffix := encryption.EncryptedSuffix(); encryptedSuffix != "" &&
+			strings.HasSuffix(sourceName, encryptedSuffix) {
+			return encryption
+		}
+	}
+	return e.encryptions[e.defaultName]
+}
+
+// decryptionNames returns the names of the encryptions to try to decrypt
+// ciphertext with, in order. If the format of ciphertext is recognized and
+// there are encryptions with that format then only they are tried.
+func (e *MultiEncryption) decryptionNames(ciphertext []byte) []string {
+	format := ciphertextFormat(ciphertext)
+	if format == "" {
+		return e.names
+	}
+	var names []string
+	for _, name := range e.names {
+		if encryptionFormat(e.encryptions[name]) == format {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return e.names
+	}
+	return names
+}
+
+// ciphertextFormat returns the format of ciphertext, either "age" or "gpg", or
+// the empty string if it is not recognized.
+func ciphertextFormat(ciphertext []byte) string {
+	armored := bytes.TrimLeft(ciphertext, " \t\r\n")
+	switch {
+	case bytes.HasPrefix(ciphertext, []byte("age-encryption.org/v1\n")):
+		return "age"
+	case bytes.HasPrefix(armored, []byte("-----BEGIN AGE ENCRYPTED FILE-----")):
+		return "age"
+	case bytes.HasPrefix(armored, []byte("-----BEGIN PGP MESSAGE-----")):
+		return "gpg"
+	case len(ciphertext) == 0 || ciphertext[0]&0x80 == 0:
+		return ""
+	}
+
+	// Binary OpenPGP messages start with a packet header. Old format packet
+	// headers have the tag in bits 5-2, new format packet headers in bits
+	// 5-0. Encrypted messages start with a public-key or symmetric-key
+	// encrypted session key packet, or with an encrypted data packet.
+	var tag byte
+	if ciphertext[0]&0x40 == 0 {
+		tag = ciphertext[0] >> 2 & 0x0f
+	} else {
+		tag = ciphertext[0] & 0x3f
+	}
+	switch tag {
+	case 1, 3, 9, 18, 20:
+		return "gpg"
+	default:
+		return ""
+	}
+}
+
+// encryptionFormat returns the format of ciphertexts produced by encryption,
+// either "age" or "gpg", or the empty string if it is not known.
+func encryptionFormat(encryption Encryption) string {
+	switch encryption := encryption.(type) {
+	case *AgeEncryption:
+		return "age"
+	case *GPGEncryption:
+		return "gpg"
+	case *DebugEncryption:
+		return encryptionFormat(encryption.encryption)
+	default:
+		return ""
+	}
+}
+
+// EncryptedSuffixOf returns the encrypted suffix of sourceName when encrypted
+// with encryption.
+func EncryptedSuffixOf(encryption Encryption, sourceName string) string {
+	if multiEncryption, ok := encryption.(*MultiEncryption); ok {
+		return multiEncryption.ForSourceName(sourceName).EncryptedSuffix()
+	}
+	return encryption.EncryptedSuffix()
+}
@@ -0,0 +1,110 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+var _ Encryption = &MultiEncryption{}
+
+func TestMultiEncryption(t *testing.T) {
+	recipient1, identityAbsPath1 := builtinAgeGenerateKey(t)
+	recipient2, identityAbsPath2 := builtinAgeGenerateKey(t)
+	ageEncryption1 := &AgeEncryption{
+		UseBuiltin: true,
+		Identity:   identityAbsPath1,
+		Recipient:  recipient1.String(),
+		Suffix:     ".age",
+	}
+	ageEncryption2 := &AgeEncryption{
+		UseBuiltin: true,
+		Identity:   identityAbsPath2,
+		Recipient:  recipient2.String(),
+		Suffix:     ".age2",
+	}
+	multiEncryption := NewMultiEncryption("age1", map[string]Encryption{
+		"age1": ageEncryption1,
+		"age2": ageEncryption2,
+	})
+
+	testEncryption(t, multiEncryption)
+
+	t.Run("DecryptOther", func(t *testing.T) {
+		ciphertext, err := ageEncryption2.Encrypt([]byte("plaintext\n"))
+		assert.NoError(t, err)
+		plaintext, err := multiEncryption.Decrypt(ciphertext)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("plaintext\n"), plaintext)
+	})
+
+	t.Run("ForSourceName", func(t *testing.T) {
+		assert.Equal(t, Encryption(ageEncryption1), multiEncryption.ForSourceName("encrypted_dot_file.age"))
+		assert.Equal(t, Encryption(ageEncryption2), multiEncryption.ForSourceName("encrypted_dot_file.age2"))
+		assert.Equal(t, Encryption(ageEncryption1), multiEncryption.ForSourceName("encrypted_dot_file"))
+	})
+
+	t.Run("EncryptedSuffixOf", func(t *testing.T) {
+		assert.Equal(t, ".age2", EncryptedSuffixOf(multiEncryption, "encrypted_dot_file.age2"))
+		assert.Equal(t, ".age", EncryptedSuffixOf(multiEncryption, "encrypted_dot_file"))
+		assert.Equal(t, ".age", EncryptedSuffixOf(ageEncryption1, "encrypted_dot_file.age2"))
+	})
+}
+
+func TestCiphertextFormat(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		ciphertext []byte
+		expected   string
+	}{
+		{
+			name:       "empty",
+			ciphertext: nil,
+			expected:   "",
+		},
+		{
+			name:       "age",
+			ciphertext: []byte("age-encryption.org/v1\n-> X25519 ...\n"),
+			expected:   "age",
+		},
+		{
+			name:       "age_armored",
+			ciphertext: []byte("\n-----BEGIN AGE ENCRYPTED FILE-----\n"),
+			expected:   "age",
+		},
+		{
+			name:       "gpg_armored",
+			ciphertext: []byte("-----BEGIN PGP MESSAGE-----\n"),
+			expected:   "gpg",
+		},
+		{
+			name:       "gpg_old_format_public_key_encrypted_session_key",
+			ciphertext: []byte{0x84, 0x5e},
+			expected:   "gpg",
+		},
+		{
+			name:       "gpg_new_format_public_key_encrypted_session_key",
+			ciphertext: []byte{0xc1, 0x5e},
+			expected:   "gpg",
+		},
+		{
+			name:       "gpg_new_format_symmetric_key_encrypted_session_key",
+			ciphertext: []byte{0xc3, 0x0d},
+			expected:   "gpg",
+		},
+		{
+			name:       "gpg_literal_data",
+			ciphertext: []byte{0xcb, 0x0d},
+			expected:   "",
+		},
+		{
+			name:       "plaintext",
+			ciphertext: []byte("plaintext\n"),
+			expected:   "",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ciphertextFormat(tc.ciphertext))
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package chezmoi
+
+import (
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+var (
+	groupNameCache sync.Map // groupNameCache maps group IDs to group names.
+	userNameCache  sync.Map // userNameCache maps user IDs to user names.
+)
+
+// groupName returns the name of group, which may be a group name or a numeric
+// group ID. If group is a numeric group ID that cannot be resolved then group
+// is returned.
+func groupName(group string) string {
+	if _, err := strconv.Atoi(group); err != nil {
+		return group
+	}
+	if name, ok := groupNameCache.Load(group); ok {
+		return name.(string) //nolint:forcetypeassert
+	}
+	name := group
+	if g, err := user.LookupGroupId(group); err == nil {
+		name = g.Name
+	}
+	groupNameCache.Store(group, name)
+	return name
+}
+
+// lookupGID returns the group ID of group, which may be a group name or a
+// numeric group ID.
+func lookupGID(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// lookupUID returns the user ID of owner, which may be a user name or a
+// numeric user ID.
+func lookupUID(owner string) (int, error) {
+	if uid, err := strconv.Atoi(owner); err == nil {
+		return uid, nil
+	}
+	u, err := user.Lookup(owner)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// userName returns the name of owner, which may be a user name or a numeric
+// user ID. If owner is a numeric user ID that cannot be resolved then owner is
+// returned.
+func userName(owner string) string {
+	if _, err := strconv.Atoi(owner); err != nil {
+		return owner
+	}
+	if name, ok := userNameCache.Load(owner); ok {
+		return name.(string) //nolint:forcetypeassert
+	}
+	name := owner
+	if u, err := user.LookupId(owner); err == nil {
+		name = u.Username
+	}
+	userNameCache.Store(owner, name)
+	return name
+}
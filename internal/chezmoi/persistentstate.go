@@ -1,6 +1,10 @@
 package chezmoi
 
 var (
+	// ApplyHistoryBucket is the bucket for recording the state of targets
+	// before each apply.
+	ApplyHistoryBucket = []byte("applyHistory")
+
 	// ConfigStateBucket is the bucket for recording the config state.
 	ConfigStateBucket = []byte("configState")
 
@@ -25,6 +25,11 @@ func (s *ReadOnlySystem) Glob(pattern string) ([]string, error) {
 	return s.system.Glob(pattern)
 }
 
+// Lgetxattrs implements System.Lgetxattrs.
+func (s *ReadOnlySystem) Lgetxattrs(name AbsPath) (map[string][]byte, error) {
+	return s.system.Lgetxattrs(name)
+}
+
 // Lstat implements System.Lstat.
 func (s *ReadOnlySystem) Lstat(filename AbsPath) (fs.FileInfo, error) {
 	return s.system.Lstat(filename)
@@ -30,11 +30,29 @@ func (s *RealSystem) Glob(pattern string) ([]string, error) {
 	return Glob(s.UnderlyingFS(), filepath.ToSlash(pattern))
 }
 
+// Lgetxattrs implements System.Lgetxattrs.
+func (s *RealSystem) Lgetxattrs(name AbsPath) (map[string][]byte, error) {
+	rawName, err := s.fileSystem.RawPath(name.String())
+	if err != nil {
+		return nil, err
+	}
+	return lgetxattrs(rawName)
+}
+
 // Link implements System.Link.
 func (s *RealSystem) Link(oldName, newName AbsPath) error {
 	return s.fileSystem.Link(oldName.String(), newName.String())
 }
 
+// Lsetxattrs implements System.Lsetxattrs.
+func (s *RealSystem) Lsetxattrs(name AbsPath, xattrs map[string][]byte) error {
+	rawName, err := s.fileSystem.RawPath(name.String())
+	if err != nil {
+		return err
+	}
+	return lsetxattrs(rawName, xattrs)
+}
+
 // Lstat implements System.Lstat.
 func (s *RealSystem) Lstat(filename AbsPath) (fs.FileInfo, error) {
 	return s.fileSystem.Lstat(filename.String())
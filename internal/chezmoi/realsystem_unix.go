@@ -59,6 +59,11 @@ func (s *RealSystem) Chmod(name AbsPath, mode fs.FileMode) error {
 	return s.fileSystem.Chmod(name.String(), mode)
 }
 
+// Chown implements System.Chown.
+func (s *RealSystem) Chown(name AbsPath, uid, gid int) error {
+	return s.fileSystem.Lchown(name.String(), uid, gid)
+}
+
 // Readlink implements System.Readlink.
 func (s *RealSystem) Readlink(name AbsPath) (string, error) {
 	return s.fileSystem.Readlink(name.String())
@@ -46,6 +46,11 @@ func (s *RealSystem) Chmod(name AbsPath, mode fs.FileMode) error {
 	return nil
 }
 
+// Chown implements System.Chown.
+func (s *RealSystem) Chown(name AbsPath, uid, gid int) error {
+	return nil
+}
+
 // Readlink implements System.Readlink.
 func (s *RealSystem) Readlink(name AbsPath) (string, error) {
 	linkname, err := s.fileSystem.Readlink(name.String())
@@ -0,0 +1,280 @@
+package chezmoi
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoiset"
+)
+
+// recipientsReplaceDirective is the line in a .chezmoirecipients file that
+// replaces the recipients of parent directories and the config file instead of
+// extending them.
+const recipientsReplaceDirective = "!replace"
+
+// A recipientsRule adds or replaces the recipients of all targets in dir.
+type recipientsRule struct {
+	dir        RelPath
+	recipients []string
+	replace    bool
+}
+
+// A recipientsEncryption is an Encryption whose recipients can be changed.
+type recipientsEncryption interface {
+	withRecipients(recipients []string, replace bool) Encryption
+}
+
+// ageFingerprintsStanzaType is the type of the age stanza in which the builtin
+// age records the fingerprints of the recipients that a file is encrypted to.
+// age identities ignore stanzas of unknown types.
+const ageFingerprintsStanzaType = "chezmoi-recipients"
+
+// A RecipientsMismatch is an encrypted file that is not encrypted to the
+// recipients from its .chezmoirecipients files. Missing contains the expected
+// recipients that the file is not encrypted to, if they can be identified.
+type RecipientsMismatch struct {
+	TargetRelPath RelPath
+	Expected      int
+	Actual        int
+	Missing       []string
+}
+
+// An ageFingerprintsRecipient is an age.Recipient that records the
+// fingerprints of the other recipients in the age header.
+type ageFingerprintsRecipient struct {
+	fingerprints []string
+}
+
+// newAgeFingerprintsRecipient returns a new ageFingerprintsRecipient for
+// recipients, if all of recipients can be fingerprinted.
+func newAgeFingerprintsRecipient(recipients []age.Recipient) (*ageFingerprintsRecipient, bool) {
+	if len(recipients) == 0 {
+		return nil, false
+	}
+	fingerprints := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		x25519Recipient, ok := recipient.(*age.X25519Recipient)
+		if !ok {
+			return nil, false
+		}
+		fingerprints = append(fingerprints, ageRecipientFingerprint(x25519Recipient.String()))
+	}
+	slices.Sort(fingerprints)
+	return &ageFingerprintsRecipient{
+		fingerprints: slices.Compact(fingerprints),
+	}, true
+}
+
+// Wrap implements age.Recipient.Wrap.
+func (r *ageFingerprintsRecipient) Wrap(fileKey []byte) ([]*age.Stanza, error) {
+	return []*age.Stanza{
+		{
+			Type: ageFingerprintsStanzaType,
+			Args: r.fingerprints,
+		},
+	}, nil
+}
+
+// ageRecipientFingerprint returns the fingerprint of recipient.
+func ageRecipientFingerprint(recipient string) string {
+	recipientSHA256 := sha256.Sum256([]byte(recipient))
+	return hex.EncodeToString(recipientSHA256[:8])
+}
+
+// parseRecipientsLine parses a line from a .chezmoirecipients file. It returns
+// the recipient and whether the line is the replace directive. The recipient is
+// empty if the line is blank or is a directive.
+func parseRecipientsLine(line []byte) (string, bool, error) {
+	fields := bytes.Fields(commentRx.ReplaceAll(line, nil))
+	switch {
+	case len(fields) == 0:
+		return "", false, nil
+	case len(fields) != 1:
+		return "", false, errors.New("expected one recipient per line")
+	case string(fields[0]) == recipientsReplaceDirective:
+		return "", true, nil
+	case bytes.HasPrefix(fields[0], []byte{'!'}):
+		return "", false, fmt.Errorf("%s: unknown directive", fields[0])
+	default:
+		return string(fields[0]), false, nil
+	}
+}
+
+// RecipientsMismatches returns the age encrypted files in s that are not
+// encrypted to the recipients that their .chezmoirecipients files require. The
+// recipients of files encrypted by the builtin age are compared with the
+// fingerprints recorded in the file. Otherwise, only the number of X25519
+// recipients is compared, as the recipients cannot be identified from the
+// ciphertext.
+func (s *SourceState) RecipientsMismatches() ([]RecipientsMismatch, error) {
+	var mismatches []RecipientsMismatch
+	if err := s.ForEach(func(targetRelPath RelPath, sourceStateEntry SourceStateEntry) error {
+		sourceStateFile, ok := sourceStateEntry.(*SourceStateFile)
+		if !ok || !sourceStateFile.attr.Encrypted || len(s.targetRecipientsRules(targetRelPath)) == 0 {
+			return nil
+		}
+		ageEncryption, ok := asAgeEncryption(sourceStateFile.encryption)
+		if !ok || ageEncryption.Passphrase || ageEncryption.Symmetric {
+			return nil
+		}
+		recipients, err := ageEncryption.builtinRecipients()
+		if err != nil {
+			return fmt.Errorf("%s: %w", targetRelPath, err)
+		}
+		sourceAbsPath := s.TargetSourceDirAbsPath(targetRelPath).Join(sourceStateFile.sourceRelPath.RelPath())
+		ciphertext, err := s.system.ReadFile(sourceAbsPath)
+		if err != nil {
+			return err
+		}
+		stanzas, err := ageHeaderStanzas(ciphertext)
+		if err != nil {
+			return fmt.Errorf("%s: %w", sourceAbsPath, err)
+		}
+
+		x25519RecipientCount := 0
+		var fingerprints chezmoiset.Set[string]
+		for _, stanza := range stanzas {
+			switch stanza[0] {
+			case "X25519":
+				x25519RecipientCount++
+			case ageFingerprintsStanzaType:
+				fingerprints = chezmoiset.New(stanza[1:]...)
+			}
+		}
+
+		mismatch := RecipientsMismatch{
+			TargetRelPath: targetRelPath,
+			Expected:      len(recipients),
+			Actual:        x25519RecipientCount,
+		}
+		if fingerprints != nil {
+			expectedFingerprints := chezmoiset.New[string]()
+			for _, recipient := range recipients {
+				if x25519Recipient, ok := recipient.(*age.X25519Recipient); ok {
+					fingerprint := ageRecipientFingerprint(x25519Recipient.String())
+					expectedFingerprints.Add(fingerprint)
+					if !fingerprints.Contains(fingerprint) && !slices.Contains(mismatch.Missing, x25519Recipient.String()) {
+						mismatch.Missing = append(mismatch.Missing, x25519Recipient.String())
+					}
+				}
+			}
+			if len(mismatch.Missing) != 0 || len(expectedFingerprints) != len(fingerprints) {
+				mismatch.Expected = len(expectedFingerprints)
+				mismatches = append(mismatches, mismatch)
+			}
+		} else if x25519RecipientCount != len(recipients) {
+			mismatches = append(mismatches, mismatch)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return mismatches, nil
+}
+
+// targetRecipientsRules returns the recipients rules that apply to
+// targetRelPath, outermost first.
+func (s *SourceState) targetRecipientsRules(targetRelPath RelPath) []recipientsRule {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var rules []recipientsRule
+	for _, rule := range s.recipientsRules {
+		if rule.dir == DotRelPath || rule.dir.IsEmpty() || targetRelPath.HasDirPrefix(rule.dir) {
+			rules = append(rules, rule)
+		}
+	}
+	slices.SortStableFunc(rules, func(a, b recipientsRule) int {
+		return cmp.Compare(len(a.dir.SplitAll()), len(b.dir.SplitAll()))
+	})
+	return rules
+}
+
+// withTargetRecipients returns encryption with the recipients from the
+// .chezmoirecipients files that apply to targetRelPath.
+func (s *SourceState) withTargetRecipients(encryption Encryption, targetRelPath RelPath) Encryption {
+	recipientsEncryption, ok := encryption.(recipientsEncryption)
+	if !ok {
+		return encryption
+	}
+	rules := s.targetRecipientsRules(targetRelPath)
+	if len(rules) == 0 {
+		return encryption
+	}
+	var recipients []string
+	replace := false
+	for _, rule := range rules {
+		if rule.replace {
+			recipients = nil
+			replace = true
+		}
+		recipients = append(recipients, rule.recipients...)
+	}
+	return recipientsEncryption.withRecipients(recipients, replace)
+}
+
+// ageX25519RecipientCount returns the number of X25519 recipients that the age
+// ciphertext is encrypted to.
+func ageX25519RecipientCount(ciphertext []byte) (int, error) {
+	stanzas, err := ageHeaderStanzas(ciphertext)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, stanza := range stanzas {
+		if stanza[0] == "X25519" {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ageHeaderStanzas returns the type and arguments of each stanza in the header
+// of the age ciphertext.
+func ageHeaderStanzas(ciphertext []byte) ([][]string, error) {
+	var ciphertextReader io.Reader = bytes.NewReader(ciphertext)
+	if bytes.HasPrefix(ciphertext, []byte(armor.Header)) {
+		ciphertextReader = armor.NewReader(ciphertextReader)
+	}
+	scanner := bufio.NewScanner(ciphertextReader)
+	if !scanner.Scan() || scanner.Text() != "age-encryption.org/v1" {
+		return nil, errors.New("not age ciphertext")
+	}
+	var stanzas [][]string
+	for scanner.Scan() {
+		switch line := scanner.Text(); {
+		case strings.HasPrefix(line, "---"):
+			return stanzas, nil
+		case strings.HasPrefix(line, "-> "):
+			if fields := strings.Fields(strings.TrimPrefix(line, "-> ")); len(fields) != 0 {
+				stanzas = append(stanzas, fields)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("truncated age header")
+}
+
+// asAgeEncryption returns the AgeEncryption underlying encryption, if any.
+func asAgeEncryption(encryption Encryption) (*AgeEncryption, bool) {
+	switch encryption := encryption.(type) {
+	case *AgeEncryption:
+		return encryption, true
+	case *DebugEncryption:
+		return asAgeEncryption(encryption.encryption)
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,136 @@
+package chezmoi
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestParseRecipientsLine(t *testing.T) {
+	for _, tc := range []struct {
+		name              string
+		line              string
+		expectedRecipient string
+		expectedReplace   bool
+		expectedErr       string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "comment",
+			line: "# comment\n",
+		},
+		{
+			name:              "recipient",
+			line:              "age1recipient1\n",
+			expectedRecipient: "age1recipient1",
+		},
+		{
+			name:              "recipient_with_comment",
+			line:              "age1recipient2 # comment\n",
+			expectedRecipient: "age1recipient2",
+		},
+		{
+			name:            "replace",
+			line:            "!replace\n",
+			expectedReplace: true,
+		},
+		{
+			name:        "multiple_recipients_per_line",
+			line:        "age1recipient1 age1recipient2\n",
+			expectedErr: "expected one recipient per line",
+		},
+		{
+			name:        "unknown_directive",
+			line:        "!extend\n",
+			expectedErr: "!extend: unknown directive",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actualRecipient, actualReplace, err := parseRecipientsLine([]byte(tc.line))
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRecipient, actualRecipient)
+			assert.Equal(t, tc.expectedReplace, actualReplace)
+		})
+	}
+}
+
+func TestAgeEncryptionWithRecipients(t *testing.T) {
+	recipient1, identityAbsPath1 := builtinAgeGenerateKey(t)
+	recipient2, identityAbsPath2 := builtinAgeGenerateKey(t)
+	recipient3, _ := builtinAgeGenerateKey(t)
+	ageEncryption := &AgeEncryption{
+		UseBuiltin: true,
+		Identity:   identityAbsPath1,
+		Recipient:  recipient1.String(),
+	}
+
+	extendedEncryption := ageEncryption.withRecipients([]string{recipient1.String(), recipient2.String()}, false)
+	assert.Equal(t, Encryption(&AgeEncryption{
+		UseBuiltin: true,
+		Identity:   identityAbsPath1,
+		Recipient:  recipient1.String(),
+		Recipients: []string{recipient2.String()},
+	}), extendedEncryption)
+	assert.Zero(t, ageEncryption.Recipients)
+
+	ciphertext, err := extendedEncryption.Encrypt([]byte("plaintext\n"))
+	assert.NoError(t, err)
+	x25519RecipientCount, err := ageX25519RecipientCount(ciphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, x25519RecipientCount)
+	plaintext, err := (&AgeEncryption{
+		UseBuiltin: true,
+		Identity:   identityAbsPath2,
+	}).Decrypt(ciphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("plaintext\n"), plaintext)
+
+	replacedEncryption := ageEncryption.withRecipients([]string{recipient3.String()}, true)
+	assert.Equal(t, Encryption(&AgeEncryption{
+		UseBuiltin: true,
+		Identity:   identityAbsPath1,
+		Recipients: []string{recipient3.String()},
+	}), replacedEncryption)
+	assert.Equal(t, replacedEncryption, replacedEncryption.(recipientsEncryption).withRecipients([]string{recipient3.String()}, true)) //nolint:forcetypeassert
+}
+
+func TestAgeX25519RecipientCount(t *testing.T) {
+	_, err := ageX25519RecipientCount([]byte("plaintext\n"))
+	assert.EqualError(t, err, "not age ciphertext")
+	_, err = ageX25519RecipientCount([]byte("age-encryption.org/v1\n-> X25519 share\n"))
+	assert.EqualError(t, err, "truncated age header")
+}
+
+func TestAgeFingerprintsRecipient(t *testing.T) {
+	recipient1, identityAbsPath1 := builtinAgeGenerateKey(t)
+	recipient2, _ := builtinAgeGenerateKey(t)
+	ageEncryption := &AgeEncryption{
+		UseBuiltin: true,
+		Identity:   identityAbsPath1,
+		Recipient:  recipient1.String(),
+		Recipients: []string{recipient2.String()},
+	}
+
+	ciphertext, err := ageEncryption.Encrypt([]byte("plaintext\n"))
+	assert.NoError(t, err)
+	stanzas, err := ageHeaderStanzas(ciphertext)
+	assert.NoError(t, err)
+	expectedFingerprints := []string{
+		ageRecipientFingerprint(recipient1.String()),
+		ageRecipientFingerprint(recipient2.String()),
+	}
+	slices.Sort(expectedFingerprints)
+	assert.Equal(t, []string{"X25519", "X25519", ageFingerprintsStanzaType}, []string{stanzas[0][0], stanzas[1][0], stanzas[2][0]})
+	assert.Equal(t, expectedFingerprints, stanzas[2][1:])
+
+	plaintext, err := ageEncryption.Decrypt(ciphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("plaintext\n"), plaintext)
+}
@@ -0,0 +1,259 @@
+package chezmoi
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoiset"
+)
+
+// RekeyOptions are options to SourceState.Rekey.
+type RekeyOptions struct {
+	Encryption     Encryption              // Encryption to re-encrypt with, if not each file's own.
+	KeepGoing      bool                    // Rekey the files that can be rekeyed even if others cannot.
+	TargetRelPaths chezmoiset.Set[RelPath] // Targets to rekey, or all targets if empty.
+}
+
+// rekeyStagedSuffix is the suffix of the temporary files in which re-encrypted
+// files are staged. Their names start with a dot so that they are ignored if
+// they are left behind.
+const rekeyStagedSuffix = ".chezmoi-rekey"
+
+// A rekeyedFile is an encrypted file in the source directory that has been
+// re-encrypted.
+type rekeyedFile struct {
+	oldAbsPath    AbsPath
+	newAbsPath    AbsPath
+	oldCiphertext []byte
+	ciphertext    []byte
+}
+
+// Rekey decrypts all encrypted files, files with encrypted values, and
+// encrypted externals with file:// URLs in s and re-encrypts them with their
+// current recipients, or with options.Encryption if set. If
+// options.Encryption has a different encrypted suffix then the source files
+// are renamed. No files are written unless all files can be rekeyed or
+// options.KeepGoing is set. The re-encrypted files are staged in temporary
+// files and renamed over the old files, which are restored if any file cannot
+// be replaced. It returns the absolute paths of all changed and removed files
+// in sourceSystem.
+func (s *SourceState) Rekey(sourceSystem System, options *RekeyOptions) ([]AbsPath, error) {
+	var rekeyedFiles []rekeyedFile
+	var errs []error
+
+	for _, targetRelPath := range s.TargetRelPaths() {
+		if len(options.TargetRelPaths) != 0 && !options.TargetRelPaths.Contains(targetRelPath) {
+			continue
+		}
+		sourceStateFile, ok := s.Get(targetRelPath).(*SourceStateFile)
+		if !ok || !sourceStateFile.attr.Encrypted && !sourceStateFile.attr.EncryptedValues {
+			continue
+		}
+		if _, ok := sourceStateFile.origin.(*External); ok {
+			continue
+		}
+		rekeyedFile, err := s.rekeyFile(targetRelPath, sourceStateFile, options)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rekeyedFiles = append(rekeyedFiles, rekeyedFile)
+	}
+
+	for _, externalRelPath := range slices.SortedFunc(maps.Keys(s.externals), CompareRelPaths) {
+		if len(options.TargetRelPaths) != 0 && !options.TargetRelPaths.Contains(externalRelPath) {
+			continue
+		}
+		for _, external := range s.externals[externalRelPath] {
+			if !external.Encrypted {
+				continue
+			}
+			for _, urlStr := range append([]string{external.URL}, external.URLs...) {
+				if urlStr == "" {
+					continue
+				}
+				rekeyedFile, err := s.rekeyExternal(externalRelPath, urlStr, options)
+				switch {
+				case errors.Is(err, fs.ErrNotExist) && len(external.URLs) != 0:
+					// Only the first of multiple URLs needs to exist.
+					continue
+				case err != nil:
+					errs = append(errs, err)
+					continue
+				}
+				rekeyedFiles = append(rekeyedFiles, rekeyedFile)
+			}
+		}
+	}
+
+	if len(errs) != 0 && !options.KeepGoing {
+		return nil, errors.Join(errs...)
+	}
+
+	// Stage all re-encrypted files in the same directories as their
+	// destinations so that they can be renamed into place.
+	stagedAbsPaths := make([]AbsPath, 0, len(rekeyedFiles))
+	removeStagedFiles := func() {
+		for _, stagedAbsPath := range stagedAbsPaths {
+			_ = sourceSystem.RemoveAll(stagedAbsPath)
+		}
+	}
+	for _, rekeyedFile := range rekeyedFiles {
+		stagedAbsPath := rekeyedFile.newAbsPath.Dir().JoinString("." + rekeyedFile.newAbsPath.Base() + rekeyStagedSuffix)
+		if err := sourceSystem.WriteFile(stagedAbsPath, rekeyedFile.ciphertext, 0o666&^s.umask); err != nil {
+			removeStagedFiles()
+			return nil, err
+		}
+		stagedAbsPaths = append(stagedAbsPaths, stagedAbsPath)
+	}
+
+	changedAbsPaths := make([]AbsPath, 0, len(rekeyedFiles))
+	for i, rekeyedFile := range rekeyedFiles {
+		err := sourceSystem.Rename(stagedAbsPaths[i], rekeyedFile.newAbsPath)
+		if err == nil && rekeyedFile.newAbsPath != rekeyedFile.oldAbsPath {
+			err = sourceSystem.Remove(rekeyedFile.oldAbsPath)
+		}
+		if err != nil {
+			removeStagedFiles()
+			return nil, errors.Join(err, s.restoreRekeyedFiles(sourceSystem, rekeyedFiles[:i+1]))
+		}
+		changedAbsPaths = append(changedAbsPaths, rekeyedFile.newAbsPath)
+		if rekeyedFile.newAbsPath != rekeyedFile.oldAbsPath {
+			changedAbsPaths = append(changedAbsPaths, rekeyedFile.oldAbsPath)
+		}
+	}
+	return changedAbsPaths, errors.Join(errs...)
+}
+
+// restoreRekeyedFiles restores the old files of rekeyedFiles.
+func (s *SourceState) restoreRekeyedFiles(sourceSystem System, rekeyedFiles []rekeyedFile) error {
+	var errs []error
+	for _, rekeyedFile := range rekeyedFiles {
+		if rekeyedFile.newAbsPath != rekeyedFile.oldAbsPath {
+			if err := sourceSystem.RemoveAll(rekeyedFile.newAbsPath); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if err := sourceSystem.WriteFile(rekeyedFile.oldAbsPath, rekeyedFile.oldCiphertext, 0o666&^s.umask); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// rekeyFile re-encrypts the encrypted file or file with encrypted values
+// sourceStateFile at targetRelPath. Files with encrypted values keep their
+// contents apart from the encrypted values themselves.
+func (s *SourceState) rekeyFile(
+	targetRelPath RelPath,
+	sourceStateFile *SourceStateFile,
+	options *RekeyOptions,
+) (rekeyedFile, error) {
+	oldAbsPath := s.TargetSourceDirAbsPath(targetRelPath).Join(sourceStateFile.sourceRelPath.RelPath())
+	ciphertext, err := s.system.ReadFile(oldAbsPath)
+	if err != nil {
+		return rekeyedFile{}, fmt.Errorf("%s: %w", targetRelPath, err)
+	}
+
+	if !sourceStateFile.attr.Encrypted {
+		valuesEncryption, err := s.addedEncryption(&AddOptions{Encryption: options.Encryption}, targetRelPath)
+		if err != nil {
+			return rekeyedFile{}, err
+		}
+		newContents, err := reencryptValues(s.encryption, valuesEncryption, ciphertext)
+		if err != nil {
+			return rekeyedFile{}, fmt.Errorf("%s: %w", targetRelPath, err)
+		}
+		return rekeyedFile{
+			oldAbsPath:    oldAbsPath,
+			newAbsPath:    oldAbsPath,
+			oldCiphertext: ciphertext,
+			ciphertext:    newContents,
+		}, nil
+	}
+
+	oldEncryption := sourceStateFile.encryption
+	if oldEncryption == nil {
+		return rekeyedFile{}, fmt.Errorf("%s: encryption not configured", targetRelPath)
+	}
+	plaintext, err := oldEncryption.Decrypt(ciphertext)
+	if err != nil {
+		return rekeyedFile{}, fmt.Errorf("%s: %w", targetRelPath, err)
+	}
+
+	newEncryption := oldEncryption
+	newAbsPath := oldAbsPath
+	if options.Encryption != nil {
+		newEncryption = s.withTargetRecipients(options.Encryption, targetRelPath)
+		oldSuffix, newSuffix := oldEncryption.EncryptedSuffix(), newEncryption.EncryptedSuffix()
+		switch name := oldAbsPath.Base(); {
+		case oldSuffix == newSuffix:
+		case oldSuffix != "" && strings.HasSuffix(name, oldSuffix):
+			newAbsPath = oldAbsPath.Dir().JoinString(strings.TrimSuffix(name, oldSuffix) + newSuffix)
+		default:
+			// The encryption is chosen by the encryption attribute, which would
+			// no longer match.
+			return rekeyedFile{}, fmt.Errorf("%s: encryption attribute does not match new encryption", targetRelPath)
+		}
+	}
+
+	if sourceStateFile.attr.EncryptedValues {
+		if plaintext, err = reencryptValues(s.encryption, newEncryption, plaintext); err != nil {
+			return rekeyedFile{}, fmt.Errorf("%s: %w", targetRelPath, err)
+		}
+	}
+	newCiphertext, err := newEncryption.Encrypt(plaintext)
+	if err != nil {
+		return rekeyedFile{}, fmt.Errorf("%s: %w", targetRelPath, err)
+	}
+	return rekeyedFile{
+		oldAbsPath:    oldAbsPath,
+		newAbsPath:    newAbsPath,
+		oldCiphertext: ciphertext,
+		ciphertext:    newCiphertext,
+	}, nil
+}
+
+// rekeyExternal re-encrypts the encrypted external at externalRelPath with URL
+// urlStr. Only externals with file:// URLs can be rekeyed. Their file names are
+// not changed as encrypted externals are decrypted with any encryption.
+func (s *SourceState) rekeyExternal(externalRelPath RelPath, urlStr string, options *RekeyOptions) (rekeyedFile, error) {
+	urlStruct, err := url.Parse(urlStr)
+	switch {
+	case err != nil:
+		return rekeyedFile{}, fmt.Errorf("%s: %s: %w", externalRelPath, urlStr, err)
+	case urlStruct.Scheme != "file":
+		return rekeyedFile{}, fmt.Errorf("%s: %s: only externals with file:// URLs can be rekeyed", externalRelPath, urlStr)
+	}
+	absPath := NewAbsPath(urlStruct.Path)
+	ciphertext, err := s.system.ReadFile(absPath)
+	if err != nil {
+		return rekeyedFile{}, fmt.Errorf("%s: %w", externalRelPath, err)
+	}
+	plaintext, err := s.encryption.Decrypt(ciphertext)
+	if err != nil {
+		return rekeyedFile{}, fmt.Errorf("%s: %s: %w", externalRelPath, urlStr, err)
+	}
+	var newEncryption Encryption
+	if options.Encryption != nil {
+		newEncryption = s.withTargetRecipients(options.Encryption, externalRelPath)
+	} else if newEncryption, err = s.encryptionOf(path.Base(urlStruct.Path), externalRelPath); err != nil {
+		return rekeyedFile{}, err
+	}
+	newCiphertext, err := newEncryption.Encrypt(plaintext)
+	if err != nil {
+		return rekeyedFile{}, fmt.Errorf("%s: %s: %w", externalRelPath, urlStr, err)
+	}
+	return rekeyedFile{
+		oldAbsPath:    absPath,
+		newAbsPath:    absPath,
+		oldCiphertext: ciphertext,
+		ciphertext:    newCiphertext,
+	}, nil
+}
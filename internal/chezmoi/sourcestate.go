@@ -30,8 +30,10 @@ import (
 	"time"
 	"unicode/utf8"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/coreos/go-semver/semver"
 	"github.com/mitchellh/copystructure"
+	"golang.org/x/sync/errgroup"
 
 	"chezmoi.io/chezmoi/v2/internal/chezmoierrors"
 	"chezmoi.io/chezmoi/v2/internal/chezmoilog"
@@ -117,22 +119,48 @@ type External struct {
 	sourceAbsPath   AbsPath
 }
 
+// A LayerConflict is a target that is defined in more than one source
+// directory layer. The entry in the highest layer is used and the entries in
+// the lower layers are shadowed.
+type LayerConflict struct {
+	TargetRelPath          RelPath   `json:"target"   yaml:"target"`
+	SourceAbsPath          AbsPath   `json:"source"   yaml:"source"`
+	ShadowedSourceAbsPaths []AbsPath `json:"shadowed" yaml:"shadowed"`
+}
+
+// An ownerRule sets the owner and group of all targets that match pattern. An
+// empty owner or group is not set.
+type ownerRule struct {
+	pattern string
+	owner   string
+	group   string
+}
+
 // A SourceState is a source state.
 type SourceState struct {
 	mutex                   sync.Mutex
 	root                    SourceStateEntryTreeNode
 	removeDirs              chezmoiset.Set[RelPath]
 	baseSystem              System
+	sourceStateCache        *SourceStateCache
 	system                  System
 	sourceDirAbsPath        AbsPath
+	lowerSourceDirAbsPaths  []AbsPath
+	targetSourceDirAbsPaths map[RelPath]AbsPath
+	layerConflicts          map[RelPath]*LayerConflict
 	destDirAbsPath          AbsPath
 	cacheDirAbsPath         AbsPath
 	createScriptTempDirOnce sync.Once
 	scriptTempDirAbsPath    AbsPath
 	umask                   fs.FileMode
 	encryption              Encryption
+	encryptions             map[string]Encryption
 	ignore                  *PatternSet
 	remove                  *PatternSet
+	attributeRules          []attributeRule
+	recipientsRules         []recipientsRule
+	ownerRules              []ownerRule
+	xattrs                  map[RelPath]map[string][]byte
 	interpreters            map[string]Interpreter
 	httpClient              *http.Client
 	logger                  *slog.Logger
@@ -146,8 +174,10 @@ type SourceState struct {
 	userTemplateData        map[string]any
 	priorityTemplateData    map[string]any
 	templateData            map[string]any
+	templateDataSHA256      []byte
 	templateFuncs           template.FuncMap
 	templateOptions         []string
+	templateProfiler        *TemplateProfiler
 	templates               map[string]*Template
 	externals               map[RelPath][]*External
 	ignoredRelPaths         chezmoiset.Set[RelPath]
@@ -192,6 +222,14 @@ func WithEncryption(encryption Encryption) SourceStateOption {
 	}
 }
 
+// WithEncryptions sets the encryptions that can be chosen by name with the
+// encryption attribute.
+func WithEncryptions(encryptions map[string]Encryption) SourceStateOption {
+	return func(s *SourceState) {
+		s.encryptions = encryptions
+	}
+}
+
 // WithHTTPClient sets the HTTP client.
 func WithHTTPClient(httpClient *http.Client) SourceStateOption {
 	return func(s *SourceState) {
@@ -213,6 +251,14 @@ func WithLogger(logger *slog.Logger) SourceStateOption {
 	}
 }
 
+// WithLowerSourceDirs sets the source directories that are layered below the
+// source directory, lowest first.
+func WithLowerSourceDirs(lowerSourceDirAbsPaths []AbsPath) SourceStateOption {
+	return func(s *SourceState) {
+		s.lowerSourceDirAbsPaths = lowerSourceDirAbsPaths
+	}
+}
+
 // WithMode sets the mode.
 func WithMode(mode Mode) SourceStateOption {
 	return func(s *SourceState) {
@@ -255,6 +301,13 @@ func WithSourceDir(sourceDirAbsPath AbsPath) SourceStateOption {
 	}
 }
 
+// WithSourceStateCache sets the source state cache.
+func WithSourceStateCache(sourceStateCache *SourceStateCache) SourceStateOption {
+	return func(s *SourceState) {
+		s.sourceStateCache = sourceStateCache
+	}
+}
+
 // WithSystem sets the system.
 func WithSystem(system System) SourceStateOption {
 	return func(s *SourceState) {
@@ -283,6 +336,13 @@ func WithTemplateOptions(templateOptions []string) SourceStateOption {
 	}
 }
 
+// WithTemplateProfiler sets the template profiler.
+func WithTemplateProfiler(templateProfiler *TemplateProfiler) SourceStateOption {
+	return func(s *SourceState) {
+		s.templateProfiler = templateProfiler
+	}
+}
+
 // WithUmask sets the umask.
 func WithUmask(umask fs.FileMode) SourceStateOption {
 	return func(s *SourceState) {
@@ -326,6 +386,7 @@ func NewSourceState(options ...SourceStateOption) *SourceState {
 		templates:            make(map[string]*Template),
 		externals:            make(map[RelPath][]*External),
 		ignoredRelPaths:      chezmoiset.New[RelPath](),
+		layerConflicts:       make(map[RelPath]*LayerConflict),
 	}
 	for _, option := range options {
 		option(s)
@@ -341,10 +402,12 @@ type ReplaceFunc func(targetRelPath RelPath, newSourceStateEntry, oldSourceState
 
 // AddOptions are options to SourceState.Add.
 type AddOptions struct {
+	AttributesFile      bool                    // Record attributes in .chezmoiattributes instead of source names.
 	AutoTemplate        bool                    // Automatically create templates, if possible.
 	Create              bool                    // Add create_ entries instead of normal entries.
 	Encrypt             bool                    // Encrypt files.
 	EncryptedSuffix     string                  // Suffix for encrypted files.
+	Encryption          Encryption              // Encryption for encrypted files, if not the default.
 	Errorf              func(string, ...any)    // Function to print errors.
 	Exact               bool                    // Add the exact_ attribute to added directories.
 	ExactTargetRelPaths chezmoiset.Set[RelPath] // Paths that should be marked exact (if nil and Exact is true, all dirs are exact).
@@ -357,6 +420,7 @@ type AddOptions struct {
 	ReplaceFunc         ReplaceFunc             // Function to be called before a source entry is replaced.
 	Template            bool                    // Add the .tmpl attribute to added files.
 	TemplateSymlinks    bool                    // Add symlinks with targets in the source or home directories as templates.
+	Xattrs              bool                    // Add extended attributes.
 }
 
 // shouldBeExact returns true if targetRelPath should have the exact attribute.
@@ -447,6 +511,8 @@ func (s *SourceState) Add(
 	nonEmptyDirs := chezmoiset.New[SourceRelPath]()
 	externalDirRelPaths := chezmoiset.New[RelPath]()
 	dirRenames := make(map[AbsPath]AbsPath)
+	addedXattrs := make(map[RelPath]map[string][]byte)
+	addedAttributes := make(map[RelPath]map[string]bool)
 DEST_ABS_PATH:
 	for _, destAbsPath := range destAbsPaths {
 		targetRelPath := destAbsPath.MustTrimDirPrefix(s.destDirAbsPath)
@@ -513,9 +579,19 @@ DEST_ABS_PATH:
 				Empty:      true,
 				Template:   options.Template,
 			}
-			sourceRelPath := parentSourceRelPath.Join(NewSourceRelPath(fileAttr.SourceName(s.encryption.EncryptedSuffix())))
+			var encryption Encryption
+			encryptedSuffix := s.encryption.EncryptedSuffix()
+			if options.Encrypt {
+				var err error
+				if encryption, err = s.addedEncryption(options, targetRelPath); err != nil {
+					return err
+				}
+				encryptedSuffix = encryption.EncryptedSuffix()
+			}
+			sourceRelPath := parentSourceRelPath.Join(NewSourceRelPath(fileAttr.SourceName(encryptedSuffix)))
 			newSourceStateEntry = &SourceStateFile{
 				attr:          fileAttr,
+				encryption:    encryption,
 				origin:        actualStateEntry,
 				sourceRelPath: sourceRelPath,
 				targetStateEntry: &TargetStateFile{
@@ -540,6 +616,12 @@ DEST_ABS_PATH:
 			}
 		}
 
+		if options.AttributesFile {
+			if attributes := s.moveAttributesFromSourceName(newSourceStateEntry, parentSourceRelPath, targetRelPath); len(attributes) != 0 {
+				addedAttributes[targetRelPath] = attributes
+			}
+		}
+
 		if options.PreAddFunc != nil && destAbsPathInfo != nil {
 			switch err := options.PreAddFunc(targetRelPath, destAbsPathInfo, newSourceStateEntry); {
 			case errors.Is(err, fs.SkipDir):
@@ -561,7 +643,9 @@ DEST_ABS_PATH:
 			sourceRelPaths: []SourceRelPath{sourceEntryRelPath},
 		}
 
-		if oldSourceStateEntry := s.root.Get(targetRelPath); oldSourceStateEntry != nil {
+		// Entries in lower source directories are overridden, not replaced.
+		if oldSourceStateEntry := s.root.Get(targetRelPath); oldSourceStateEntry != nil &&
+			s.TargetSourceDirAbsPath(targetRelPath) == s.sourceDirAbsPath {
 			oldSourceEntryRelPath := oldSourceStateEntry.SourceRelPath()
 			if !oldSourceEntryRelPath.IsEmpty() && oldSourceEntryRelPath != sourceEntryRelPath {
 				if options.ReplaceFunc != nil {
@@ -596,6 +680,20 @@ DEST_ABS_PATH:
 		newSourceStateEntries[sourceEntryRelPath] = newSourceStateEntry
 		newSourceStateEntriesByTargetRelPath[targetRelPath] = newSourceStateEntry
 
+		if options.Xattrs {
+			var xattrs map[string][]byte
+			switch actualStateEntry := actualStateEntry.(type) {
+			case *ActualStateDir:
+				xattrs, err = actualStateEntry.Xattrs()
+			case *ActualStateFile:
+				xattrs, err = actualStateEntry.Xattrs()
+			}
+			if err != nil {
+				return err
+			}
+			addedXattrs[targetRelPath] = xattrs
+		}
+
 		sourceUpdates = append(sourceUpdates, update)
 	}
 
@@ -670,6 +768,14 @@ DEST_ABS_PATH:
 
 	for _, sourceUpdate := range sourceUpdates {
 		for _, sourceRelPath := range sourceUpdate.sourceRelPaths {
+			// The parent directory might only exist in a lower source
+			// directory.
+			if len(s.lowerSourceDirAbsPaths) != 0 {
+				parentAbsPath := s.sourceDirAbsPath.Join(sourceRelPath.Dir().RelPath())
+				if err := MkdirAll(sourceSystem, parentAbsPath, fs.ModePerm&^s.umask); err != nil {
+					return err
+				}
+			}
 			err := targetSourceState.Apply(
 				sourceSystem,
 				sourceSystem,
@@ -697,6 +803,18 @@ DEST_ABS_PATH:
 		}
 	}
 
+	if len(addedXattrs) != 0 {
+		if err := s.writeXattrs(sourceSystem, addedXattrs); err != nil {
+			return err
+		}
+	}
+
+	if len(addedAttributes) != 0 {
+		if err := s.writeAttributes(sourceSystem, s.sourceDirAbsPath, addedAttributes); err != nil {
+			return err
+		}
+	}
+
 	// Rename directories last because updates assume that directory names have
 	// not changed. Rename directories in reverse order so children are renamed
 	// before their parents.
@@ -809,6 +927,12 @@ func (s *SourceState) Apply(
 	if err != nil {
 		return err
 	}
+	if targetStateHardlink, ok := targetStateEntry.(*TargetStateHardlink); ok {
+		actualStateEntry, err = targetStateHardlink.actualStateEntry(targetSystem, actualStateEntry)
+		if err != nil {
+			return err
+		}
+	}
 
 	if options.PreApplyFunc != nil {
 		var lastWrittenEntryState *EntryState
@@ -860,6 +984,70 @@ func (s *SourceState) Encryption() Encryption {
 	return s.encryption
 }
 
+// EvaluateOptions are options to SourceState.Evaluate.
+type EvaluateOptions struct {
+	Filter      *EntryTypeFilter
+	Parallelism int
+}
+
+// Evaluate evaluates the target state entries of targetRelPaths concurrently,
+// using at most options.Parallelism goroutines. Each entry caches the result of
+// its evaluation, including any error, so errors are not returned here but
+// instead by the subsequent call to Apply, in order. Encrypted entries are not
+// evaluated as decrypting them may prompt the user.
+func (s *SourceState) Evaluate(destSystem System, targetRelPaths []RelPath, options EvaluateOptions) {
+	var group errgroup.Group
+	group.SetLimit(max(options.Parallelism, 1))
+	for _, targetRelPath := range targetRelPaths {
+		sourceStateEntry := s.root.Get(targetRelPath)
+		if sourceStateEntry == nil || !options.Filter.IncludeSourceStateEntry(sourceStateEntry) {
+			continue
+		}
+		if sourceStateFile, ok := sourceStateEntry.(*SourceStateFile); ok && sourceStateFile.attr.Encrypted {
+			continue
+		}
+		group.Go(func() error {
+			destAbsPath := s.destDirAbsPath.Join(targetRelPath)
+			targetStateEntry, err := sourceStateEntry.TargetStateEntry(destSystem, destAbsPath)
+			if err != nil || !options.Filter.IncludeTargetStateEntry(targetStateEntry) {
+				return nil //nolint:nilerr
+			}
+			_ = targetStateEntry.Evaluate()
+			return nil
+		})
+	}
+	_ = group.Wait()
+}
+
+// EvaluationBatches splits targetRelPaths into consecutive batches whose target
+// state entries can be evaluated concurrently. Applying a script or a command
+// can change the target state of the entries that follow it, so each script
+// and command ends a batch. Templates in a batch are evaluated before any of
+// the batch's targets are applied, so they see the destination state from
+// before the batch.
+func (s *SourceState) EvaluationBatches(targetRelPaths []RelPath) [][]RelPath {
+	var batches [][]RelPath
+	start := 0
+	for i, targetRelPath := range targetRelPaths {
+		endsBatch := false
+		switch sourceStateEntry := s.root.Get(targetRelPath).(type) {
+		case *SourceStateCommand:
+			endsBatch = true
+		case *SourceStateFile:
+			endsBatch = sourceStateEntry.attr.Type == SourceFileTypeScript
+		}
+		if !endsBatch {
+			continue
+		}
+		batches = append(batches, targetRelPaths[start:i+1])
+		start = i + 1
+	}
+	if start < len(targetRelPaths) {
+		batches = append(batches, targetRelPaths[start:])
+	}
+	return batches
+}
+
 // ExecuteTemplateDataOptions are options to SourceState.ExecuteTemplateData.
 type ExecuteTemplateDataOptions struct {
 	NameRelPath     RelPath
@@ -871,6 +1059,8 @@ type ExecuteTemplateDataOptions struct {
 
 // ExecuteTemplateData returns the result of executing template data.
 func (s *SourceState) ExecuteTemplateData(options ExecuteTemplateDataOptions) ([]byte, error) {
+	defer s.templateProfiler.Start(TemplateProfileKindTemplate, options.NameRelPath.String())()
+
 	templateOptions := options.TemplateOptions
 	templateOptions.Funcs = s.templateFuncs
 	templateOptions.Options = slices.Clone(s.templateOptions)
@@ -990,6 +1180,72 @@ TARGET:
 	return nil
 }
 
+// A sourceEntryKind is the kind of an entry in a source directory.
+type sourceEntryKind int
+
+// Source entry kinds.
+const (
+	sourceEntryKindDataDir sourceEntryKind = iota
+	sourceEntryKindDataFile
+	sourceEntryKindTemplatesDir
+	sourceEntryKindExternalFile
+	sourceEntryKindExternalsDir
+	sourceEntryKindIgnoreFile
+	sourceEntryKindRemoveFile
+	sourceEntryKindAttributesFile
+	sourceEntryKindOwnersFile
+	sourceEntryKindRecipientsFile
+	sourceEntryKindXattrsFile
+	sourceEntryKindScriptsDir
+	sourceEntryKindVersionFile
+	sourceEntryKindIgnored
+	sourceEntryKindDir
+	sourceEntryKindFile
+	sourceEntryKindUnsupported
+)
+
+// classifySourceEntry returns the kind of the entry with fileInfo in a source
+// directory. Both SourceState.Read and SourceState.Lint use it so that they
+// agree on which entries are special.
+func classifySourceEntry(fileInfo fs.FileInfo) sourceEntryKind {
+	switch name := fileInfo.Name(); {
+	case name == dataName:
+		return sourceEntryKindDataDir
+	case isPrefixDotFormat(name, dataName):
+		return sourceEntryKindDataFile
+	case name == TemplatesDirName:
+		return sourceEntryKindTemplatesDir
+	case isPrefixDotFormat(name, externalName) || isPrefixDotFormatDotTmpl(name, externalName):
+		return sourceEntryKindExternalFile
+	case name == externalsDirName:
+		return sourceEntryKindExternalsDir
+	case name == ignoreName || name == ignoreName+TemplateSuffix:
+		return sourceEntryKindIgnoreFile
+	case name == removeName || name == removeName+TemplateSuffix:
+		return sourceEntryKindRemoveFile
+	case name == attributesName || name == attributesName+TemplateSuffix:
+		return sourceEntryKindAttributesFile
+	case name == ownersName || name == ownersName+TemplateSuffix:
+		return sourceEntryKindOwnersFile
+	case name == RecipientsName || name == RecipientsName+TemplateSuffix:
+		return sourceEntryKindRecipientsFile
+	case name == xattrsName:
+		return sourceEntryKindXattrsFile
+	case name == scriptsDirName:
+		return sourceEntryKindScriptsDir
+	case name == VersionName:
+		return sourceEntryKindVersionFile
+	case strings.HasPrefix(name, ignorePrefix):
+		return sourceEntryKindIgnored
+	case fileInfo.IsDir():
+		return sourceEntryKindDir
+	case fileInfo.Mode().IsRegular():
+		return sourceEntryKindFile
+	default:
+		return sourceEntryKindUnsupported
+	}
+}
+
 // ReadOptions are options to SourceState.Read.
 type ReadOptions struct {
 	ReadHTTPResponse func(string, *http.Response) ([]byte, error)
@@ -997,20 +1253,15 @@ type ReadOptions struct {
 	TimeNow          func() time.Time
 }
 
-// Read reads the source state from the source directory.
+// Read reads the source state from the source directories. Entries in later
+// source directories override entries for the same target in earlier source
+// directories.
 func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
-	switch fileInfo, err := s.system.Stat(s.sourceDirAbsPath); {
-	case errors.Is(err, fs.ErrNotExist):
-		return nil
-	case err != nil:
-		return err
-	case !fileInfo.IsDir():
-		return fmt.Errorf("%s: not a directory", s.sourceDirAbsPath)
-	}
-
-	// Read all source entries.
+	// Read all source entries. sourceDirAbsPath and allSourceStateEntries are
+	// set for each source directory in turn.
+	var sourceDirAbsPath AbsPath
 	var allSourceStateEntriesMu sync.Mutex
-	allSourceStateEntries := make(map[RelPath][]SourceStateEntry)
+	var allSourceStateEntries map[RelPath][]SourceStateEntry
 	addSourceStateEntries := func(relPath RelPath, sourceStateEntries ...SourceStateEntry) {
 		allSourceStateEntriesMu.Lock()
 		defer allSourceStateEntriesMu.Unlock()
@@ -1020,7 +1271,7 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 		if err != nil {
 			return err
 		}
-		if sourceAbsPath == s.sourceDirAbsPath {
+		if sourceAbsPath == sourceDirAbsPath {
 			return nil
 		}
 
@@ -1039,13 +1290,13 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 		}
 
 		sourceRelPath := SourceRelPath{
-			relPath: sourceAbsPath.MustTrimDirPrefix(s.sourceDirAbsPath),
+			relPath: sourceAbsPath.MustTrimDirPrefix(sourceDirAbsPath),
 			isDir:   fileInfo.IsDir(),
 		}
-		parentSourceRelPath, sourceName := sourceRelPath.Split()
+		parentSourceRelPath, _ := sourceRelPath.Split()
 
-		switch {
-		case fileInfo.Name() == dataName:
+		switch kind := classifySourceEntry(fileInfo); {
+		case kind == sourceEntryKindDataDir:
 			if !s.readTemplateData {
 				return nil
 			}
@@ -1053,12 +1304,12 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 				return err
 			}
 			return fs.SkipDir
-		case isPrefixDotFormat(fileInfo.Name(), dataName):
+		case kind == sourceEntryKindDataFile:
 			if !s.readTemplateData {
 				return nil
 			}
 			return s.addTemplateData(sourceAbsPath)
-		case fileInfo.Name() == TemplatesDirName:
+		case kind == sourceEntryKindTemplatesDir:
 			if s.readTemplates {
 				if err := s.addTemplatesDir(ctx, sourceAbsPath); err != nil {
 					return err
@@ -1067,19 +1318,27 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 			return fs.SkipDir
 		case s.templateDataOnly:
 			return nil
-		case isPrefixDotFormat(fileInfo.Name(), externalName) || isPrefixDotFormatDotTmpl(fileInfo.Name(), externalName):
+		case kind == sourceEntryKindExternalFile:
 			parentAbsPath, _ := sourceAbsPath.Split()
 			return s.addExternal(sourceAbsPath, parentAbsPath)
-		case fileInfo.Name() == externalsDirName:
+		case kind == sourceEntryKindExternalsDir:
 			if err := s.addExternalDir(ctx, sourceAbsPath); err != nil {
 				return err
 			}
 			return fs.SkipDir
-		case fileInfo.Name() == ignoreName || fileInfo.Name() == ignoreName+TemplateSuffix:
+		case kind == sourceEntryKindIgnoreFile:
 			return s.addPatterns(s.ignore, sourceAbsPath, parentSourceRelPath)
-		case fileInfo.Name() == removeName || fileInfo.Name() == removeName+TemplateSuffix:
+		case kind == sourceEntryKindRemoveFile:
 			return s.addPatterns(s.remove, sourceAbsPath, parentSourceRelPath)
-		case fileInfo.Name() == scriptsDirName:
+		case kind == sourceEntryKindAttributesFile:
+			return s.addAttributeRules(sourceAbsPath, parentSourceRelPath)
+		case kind == sourceEntryKindOwnersFile:
+			return s.addOwnerRules(sourceAbsPath, parentSourceRelPath)
+		case kind == sourceEntryKindRecipientsFile:
+			return s.addRecipientsRule(sourceAbsPath, parentSourceRelPath)
+		case kind == sourceEntryKindXattrsFile:
+			return s.addXattrs(sourceAbsPath, parentSourceRelPath)
+		case kind == sourceEntryKindScriptsDir:
 			scriptsDirSourceStateEntries, err := s.readScriptsDir(ctx, sourceAbsPath)
 			if err != nil {
 				return err
@@ -1088,17 +1347,15 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 				addSourceStateEntries(relPath, scriptSourceStateEntries...)
 			}
 			return fs.SkipDir
-		case fileInfo.Name() == VersionName:
+		case kind == sourceEntryKindVersionFile:
 			return s.readVersionFile(sourceAbsPath)
-		case strings.HasPrefix(fileInfo.Name(), Prefix):
-			fallthrough
-		case strings.HasPrefix(fileInfo.Name(), ignorePrefix):
+		case kind == sourceEntryKindIgnored:
 			if fileInfo.IsDir() {
 				return fs.SkipDir
 			}
 			return nil
-		case fileInfo.IsDir():
-			da, err := parseDirAttr(sourceName.String())
+		case kind == sourceEntryKindDir:
+			da, err := s.parseDirAttr(fileInfo)
 			if err != nil {
 				return err
 			}
@@ -1110,6 +1367,9 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 			if s.Ignore(targetRelPath) {
 				return fs.SkipDir
 			}
+			if targetAttributes := s.targetAttributes(targetRelPath); targetAttributes != nil {
+				da = targetAttributes.modifyDirAttr(da)
+			}
 			sourceStateDir := s.newSourceStateDir(sourceAbsPath, sourceRelPath, da)
 			addSourceStateEntries(targetRelPath, sourceStateDir)
 			if da.External {
@@ -1130,8 +1390,8 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 				s.mutex.Unlock()
 			}
 			return nil
-		case fileInfo.Mode().IsRegular():
-			fa, err := parseFileAttr(sourceName.String(), s.encryption.EncryptedSuffix())
+		case kind == sourceEntryKindFile:
+			fa, err := s.parseFileAttr(fileInfo)
 			if err != nil {
 				return err
 			}
@@ -1143,6 +1403,9 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 			if s.Ignore(targetRelPath) {
 				return nil
 			}
+			if targetAttributes := s.targetAttributes(targetRelPath); targetAttributes != nil {
+				fa = targetAttributes.modifyFileAttr(fa)
+			}
 			var sourceStateEntry SourceStateEntry
 			targetRelPath, sourceStateEntry = s.newSourceStateFile(sourceAbsPath, sourceRelPath, fa, targetRelPath)
 			addSourceStateEntries(targetRelPath, sourceStateEntry)
@@ -1154,9 +1417,71 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 			}
 		}
 	}
-	if err := WalkSourceDir(s.system, s.sourceDirAbsPath, walkFunc); err != nil {
-		return err
+	var dirReader dirReader = s.system
+	if s.sourceStateCache != nil && !s.templateDataOnly {
+		if err := s.sourceStateCache.load(); err != nil {
+			return err
+		}
+		dirReader = s.sourceStateCache.dirReader(s.system)
+	}
+	layered := len(s.lowerSourceDirAbsPaths) != 0
+	if layered {
+		s.targetSourceDirAbsPaths = make(map[RelPath]AbsPath)
+	}
+	mergedSourceStateEntries := make(map[RelPath][]SourceStateEntry)
+	sourceDirExists := false
+	for _, sourceDirAbsPath = range s.SourceDirAbsPaths() {
+		switch fileInfo, err := s.system.Stat(sourceDirAbsPath); {
+		case errors.Is(err, fs.ErrNotExist):
+			continue
+		case err != nil:
+			return err
+		case !fileInfo.IsDir():
+			return fmt.Errorf("%s: not a directory", sourceDirAbsPath)
+		}
+		sourceDirExists = true
+
+		allSourceStateEntries = make(map[RelPath][]SourceStateEntry)
+		lowerExternals := s.externals
+		s.externals = make(map[RelPath][]*External)
+		if err := walkSourceDir(s.system, dirReader, sourceDirAbsPath, walkFunc); err != nil {
+			return err
+		}
+		if !layered {
+			mergedSourceStateEntries = allSourceStateEntries
+			continue
+		}
+
+		// Merge this source directory's externals and entries with those of
+		// the lower source directories.
+		for externalRelPath, externals := range s.externals {
+			if lowerExternals, ok := lowerExternals[externalRelPath]; ok {
+				s.addLayerConflict(externalRelPath, externals[0].sourceAbsPath, lowerExternals[0].sourceAbsPath)
+			}
+			s.targetSourceDirAbsPaths[externalRelPath] = sourceDirAbsPath
+		}
+		for externalRelPath, externals := range lowerExternals {
+			if _, ok := s.externals[externalRelPath]; !ok {
+				s.externals[externalRelPath] = externals
+			}
+		}
+		for targetRelPath, sourceStateEntries := range allSourceStateEntries {
+			if lowerSourceStateEntries, ok := mergedSourceStateEntries[targetRelPath]; ok &&
+				!equalSourceStateDirs(sourceStateEntries[0], lowerSourceStateEntries[0]) {
+				s.addLayerConflict(
+					targetRelPath,
+					sourceDirAbsPath.Join(sourceStateEntries[0].SourceRelPath().RelPath()),
+					s.targetSourceDirAbsPaths[targetRelPath].Join(lowerSourceStateEntries[0].SourceRelPath().RelPath()),
+				)
+			}
+			mergedSourceStateEntries[targetRelPath] = sourceStateEntries
+			s.targetSourceDirAbsPaths[targetRelPath] = sourceDirAbsPath
+		}
 	}
+	if !sourceDirExists {
+		return nil
+	}
+	allSourceStateEntries = mergedSourceStateEntries
 
 	if s.templateDataOnly {
 		return nil
@@ -1376,13 +1701,64 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 
 	// Populate s.Entries with the unique source entry for each target.
 	for targetRelPath, sourceEntries := range allSourceStateEntries {
+		if len(s.attributeRules) != 0 {
+			s.setMode(targetRelPath, sourceEntries[0])
+		}
+		if len(s.ownerRules) != 0 {
+			s.setOwner(targetRelPath, sourceEntries[0])
+		}
+		if len(s.xattrs) != 0 {
+			s.setXattrs(targetRelPath, sourceEntries[0])
+		}
 		s.root.Set(targetRelPath, sourceEntries[0])
 	}
 
+	if s.sourceStateCache != nil {
+		if err := s.sourceStateCache.save(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// TargetRelPaths returns all of s's target relative paths in order.
+// SelectTags returns the targets in targetRelPaths that are selected by
+// tagFilter, together with the directories in targetRelPaths that contain
+// them, in order.
+func (s *SourceState) SelectTags(targetRelPaths []RelPath, tagFilter *TagFilter) []RelPath {
+	targetRelPathsSet := chezmoiset.New(targetRelPaths...)
+	selectedTargetRelPaths := chezmoiset.New[RelPath]()
+	for _, targetRelPath := range targetRelPaths {
+		if !tagFilter.IncludeTags(s.Tags(targetRelPath)) {
+			continue
+		}
+		selectedTargetRelPaths.Add(targetRelPath)
+		for parentRelPath := targetRelPath.Dir(); parentRelPath != DotRelPath; parentRelPath = parentRelPath.Dir() {
+			if targetRelPathsSet.Contains(parentRelPath) {
+				selectedTargetRelPaths.Add(parentRelPath)
+			}
+		}
+	}
+	return slices.DeleteFunc(slices.Clone(targetRelPaths), func(targetRelPath RelPath) bool {
+		return !selectedTargetRelPaths.Contains(targetRelPath)
+	})
+}
+
+// Tags returns the tags of targetRelPath in order. A target has its own tags
+// and the tags of all of its parent directories.
+func (s *SourceState) Tags(targetRelPath RelPath) []string {
+	tags := chezmoiset.New[string]()
+	for relPath := targetRelPath; relPath != DotRelPath; relPath = relPath.Dir() {
+		if targetAttributes := matchAttributes(s.attributeRules, relPath); targetAttributes != nil {
+			tags.Add(targetAttributes.tags...)
+		}
+	}
+	return slices.Sorted(tags.Elements())
+}
+
+// TargetRelPaths returns all of s's target relative paths in order. Hard links
+// are ordered after the other entries with the same order so that the files
+// that they link to are written first.
 func (s *SourceState) TargetRelPaths() []RelPath {
 	entries := s.root.GetMap()
 	targetRelPaths := make([]RelPath, 0, len(entries))
@@ -1393,11 +1769,43 @@ func (s *SourceState) TargetRelPaths() []RelPath {
 		if compare := cmp.Compare(entries[a].Order(), entries[b].Order()); compare != 0 {
 			return compare
 		}
+		switch aHardlink, bHardlink := isHardlink(entries[a]), isHardlink(entries[b]); {
+		case !aHardlink && bHardlink:
+			return -1
+		case aHardlink && !bHardlink:
+			return 1
+		}
 		return CompareRelPaths(a, b)
 	})
 	return targetRelPaths
 }
 
+// LayerConflicts returns the targets that are defined in more than one source
+// directory, sorted by target.
+func (s *SourceState) LayerConflicts() []*LayerConflict {
+	layerConflicts := slices.Collect(maps.Values(s.layerConflicts))
+	slices.SortFunc(layerConflicts, func(a, b *LayerConflict) int {
+		return CompareRelPaths(a.TargetRelPath, b.TargetRelPath)
+	})
+	return layerConflicts
+}
+
+// SourceDirAbsPaths returns s's source directories, lowest layer first.
+func (s *SourceState) SourceDirAbsPaths() []AbsPath {
+	return append(slices.Clone(s.lowerSourceDirAbsPaths), s.sourceDirAbsPath)
+}
+
+// TargetSourceDirAbsPath returns the source directory that contains the source
+// state entry for targetRelPath.
+func (s *SourceState) TargetSourceDirAbsPath(targetRelPath RelPath) AbsPath {
+	for relPath := targetRelPath; relPath != DotRelPath && !relPath.IsEmpty(); relPath = relPath.Dir() {
+		if sourceDirAbsPath, ok := s.targetSourceDirAbsPaths[relPath]; ok {
+			return sourceDirAbsPath
+		}
+	}
+	return s.sourceDirAbsPath
+}
+
 // TemplateData returns a copy of s's template data.
 func (s *SourceState) TemplateData() map[string]any {
 	s.mutex.Lock()
@@ -1420,9 +1828,23 @@ func (s *SourceState) TemplateData() map[string]any {
 	return templateData.(map[string]any) //nolint:forcetypeassert,revive
 }
 
+// addLayerConflict records that the entry for targetRelPath at
+// shadowedSourceAbsPath is shadowed by the entry at sourceAbsPath.
+func (s *SourceState) addLayerConflict(targetRelPath RelPath, sourceAbsPath, shadowedSourceAbsPath AbsPath) {
+	layerConflict, ok := s.layerConflicts[targetRelPath]
+	if !ok {
+		layerConflict = &LayerConflict{
+			TargetRelPath: targetRelPath,
+		}
+		s.layerConflicts[targetRelPath] = layerConflict
+	}
+	layerConflict.SourceAbsPath = sourceAbsPath
+	layerConflict.ShadowedSourceAbsPaths = append(layerConflict.ShadowedSourceAbsPaths, shadowedSourceAbsPath)
+}
+
 // addExternal adds external source entries to s.
 func (s *SourceState) addExternal(sourceAbsPath, parentAbsPath AbsPath) error {
-	parentRelPath, err := parentAbsPath.TrimDirPrefix(s.sourceDirAbsPath)
+	parentRelPath, err := parentAbsPath.TrimDirPrefix(s.sourceDirAbsPathOf(parentAbsPath))
 	if err != nil {
 		return err
 	}
@@ -1508,6 +1930,131 @@ func (s *SourceState) addExternalDir(ctx context.Context, externalsDirAbsPath Ab
 	return concurrentWalkSourceDir(ctx, s.system, externalsDirAbsPath, walkFunc)
 }
 
+// addAttributeRules executes the template at sourceAbsPath, interprets the
+// result as a .chezmoiattributes file, and adds the rules found to s. Patterns
+// are relative to the directory containing sourceAbsPath.
+func (s *SourceState) addAttributeRules(sourceAbsPath AbsPath, sourceRelPath SourceRelPath) error {
+	data, err := s.executeTemplate(sourceAbsPath)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dir, err := sourceRelPath.Dir().TargetRelPath("")
+	if err != nil {
+		return err
+	}
+	lineNumber := 0
+	for line := range bytes.Lines(data) {
+		lineNumber++
+		relPattern, attributes, err := parseAttributesLine(line)
+		switch {
+		case err != nil:
+			return fmt.Errorf("%s:%d: %w", sourceAbsPath, lineNumber, err)
+		case relPattern == "":
+			continue
+		case len(attributes) == 0:
+			return fmt.Errorf("%s:%d: expected pattern and attributes", sourceAbsPath, lineNumber)
+		}
+		if _, err := NewUntrustedRelPath(relPattern); err != nil {
+			return fmt.Errorf("%s:%d: %w", sourceAbsPath, lineNumber, err)
+		}
+		pattern := dir.JoinString(relPattern).String()
+		if !doublestar.ValidatePattern(pattern) {
+			return fmt.Errorf("%s:%d: %s: invalid pattern", sourceAbsPath, lineNumber, pattern)
+		}
+		s.attributeRules = append(s.attributeRules, attributeRule{
+			pattern:    pattern,
+			attributes: attributes,
+		})
+	}
+	return nil
+}
+
+// addRecipientsRule executes the template at sourceAbsPath, interprets the
+// result as a .chezmoirecipients file, and adds the recipients found to s for
+// the directory containing sourceAbsPath.
+func (s *SourceState) addRecipientsRule(sourceAbsPath AbsPath, sourceRelPath SourceRelPath) error {
+	data, err := s.executeTemplate(sourceAbsPath)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dir, err := sourceRelPath.Dir().TargetRelPath("")
+	if err != nil {
+		return err
+	}
+	recipientsRule := recipientsRule{
+		dir: dir,
+	}
+	lineNumber := 0
+	for line := range bytes.Lines(data) {
+		lineNumber++
+		recipient, replace, err := parseRecipientsLine(line)
+		switch {
+		case err != nil:
+			return fmt.Errorf("%s:%d: %w", sourceAbsPath, lineNumber, err)
+		case replace:
+			recipientsRule.replace = true
+		case recipient != "":
+			recipientsRule.recipients = append(recipientsRule.recipients, recipient)
+		}
+	}
+	s.recipientsRules = append(s.recipientsRules, recipientsRule)
+	return nil
+}
+
+// addOwnerRules executes the template at sourceAbsPath, interprets the result
+// as a list of patterns with owners and groups, and adds them to s.
+func (s *SourceState) addOwnerRules(sourceAbsPath AbsPath, sourceRelPath SourceRelPath) error {
+	data, err := s.executeTemplate(sourceAbsPath)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dir, err := sourceRelPath.Dir().TargetRelPath("")
+	if err != nil {
+		return err
+	}
+	lineNumber := 0
+	for line := range bytes.Lines(data) {
+		lineNumber++
+		line = commentRx.ReplaceAll(line, nil)
+		fields := bytes.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: expected pattern and owner", sourceAbsPath, lineNumber)
+		}
+		if _, err := NewUntrustedRelPath(string(fields[0])); err != nil {
+			return fmt.Errorf("%s:%d: %w", sourceAbsPath, lineNumber, err)
+		}
+		pattern := dir.JoinString(string(fields[0])).String()
+		if !doublestar.ValidatePattern(pattern) {
+			return fmt.Errorf("%s:%d: %s: invalid pattern", sourceAbsPath, lineNumber, pattern)
+		}
+		owner, group, _ := strings.Cut(string(fields[1]), ":")
+		if owner == "" && group == "" {
+			return fmt.Errorf("%s:%d: expected owner or group", sourceAbsPath, lineNumber)
+		}
+		s.ownerRules = append(s.ownerRules, ownerRule{
+			pattern: pattern,
+			owner:   userName(owner),
+			group:   groupName(group),
+		})
+	}
+	return nil
+}
+
 // addPatterns executes the template at sourceAbsPath, interprets the result as
 // a list of patterns, and adds all patterns found to patternSet.
 func (s *SourceState) addPatterns(patternSet *PatternSet, sourceAbsPath AbsPath, sourceRelPath SourceRelPath) error {
@@ -1547,6 +2094,33 @@ func (s *SourceState) addPatterns(patternSet *PatternSet, sourceAbsPath AbsPath,
 	return nil
 }
 
+// addXattrs reads the extended attributes in sourceAbsPath and adds them to s.
+func (s *SourceState) addXattrs(sourceAbsPath AbsPath, sourceRelPath SourceRelPath) error {
+	data, err := s.system.ReadFile(sourceAbsPath)
+	if err != nil {
+		return err
+	}
+	xattrsByRelPath, err := parseXattrsFile(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dir, err := sourceRelPath.Dir().TargetRelPath("")
+	if err != nil {
+		return err
+	}
+	if s.xattrs == nil {
+		s.xattrs = make(map[RelPath]map[string][]byte)
+	}
+	for relPath, xattrs := range xattrsByRelPath {
+		s.xattrs[dir.Join(relPath)] = xattrs
+	}
+	return nil
+}
+
 // addTemplateData adds all template data in sourceAbsPath to s.
 func (s *SourceState) addTemplateData(sourceAbsPath AbsPath) error {
 	format, err := FormatFromAbsPath(sourceAbsPath)
@@ -1561,11 +2135,17 @@ func (s *SourceState) addTemplateData(sourceAbsPath AbsPath) error {
 	if err := format.Unmarshal(data, &templateData); err != nil {
 		return fmt.Errorf("%s: %w", sourceAbsPath, err)
 	}
+	if encryptedValueRx.Match(data) {
+		if _, err := decryptValueTree(s.encryption, templateData); err != nil {
+			return fmt.Errorf("%s: %w", sourceAbsPath, err)
+		}
+	}
 	s.mutex.Lock()
 	RecursiveMerge(s.userTemplateData, templateData)
-	// Clear the cached template data, as the change to the user template data
-	// means that the cached value is now invalid.
+	// Clear the cached template data and its hash, as the change to the user
+	// template data means that the cached values are now invalid.
 	s.templateData = nil
+	s.templateDataSHA256 = nil
 	s.mutex.Unlock()
 	return nil
 }
@@ -1640,6 +2220,7 @@ func (s *SourceState) addTemplatesDir(ctx context.Context, templatesDirAbsPath A
 			}
 			s.mutex.Lock()
 			s.templates[name] = tmpl
+			s.templateDataSHA256 = nil
 			s.mutex.Unlock()
 			return nil
 		case fileInfo.IsDir():
@@ -1656,14 +2237,71 @@ func (s *SourceState) addTemplatesDir(ctx context.Context, templatesDirAbsPath A
 
 // executeTemplate executes the template at path and returns the result.
 func (s *SourceState) executeTemplate(templateAbsPath AbsPath) ([]byte, error) {
-	data, err := s.system.ReadFile(templateAbsPath)
+	executeTemplateFunc := func() ([]byte, error) {
+		data, err := s.system.ReadFile(templateAbsPath)
+		if err != nil {
+			return nil, err
+		}
+		return s.ExecuteTemplateData(ExecuteTemplateDataOptions{
+			NameRelPath: templateAbsPath.MustTrimDirPrefix(s.sourceDirAbsPathOf(templateAbsPath)),
+			Data:        data,
+		})
+	}
+
+	if s.sourceStateCache == nil || s.templateDataOnly {
+		return executeTemplateFunc()
+	}
+	fileInfo, err := s.system.Stat(templateAbsPath)
 	if err != nil {
 		return nil, err
 	}
-	return s.ExecuteTemplateData(ExecuteTemplateDataOptions{
-		NameRelPath: templateAbsPath.MustTrimDirPrefix(s.sourceDirAbsPath),
-		Data:        data,
-	})
+	templateDataSHA256, err := s.getTemplateDataSHA256()
+	if err != nil {
+		// The template data cannot be hashed, so do not cache the output.
+		return executeTemplateFunc()
+	}
+	return s.sourceStateCache.executeTemplate(templateAbsPath, fileInfo, templateDataSHA256, executeTemplateFunc)
+}
+
+// getTemplateDataSHA256 returns the hash of s's template data, template
+// options, and templates, computing it only if they have changed since it was
+// last computed.
+func (s *SourceState) getTemplateDataSHA256() ([]byte, error) {
+	s.mutex.Lock()
+	dataSHA256 := s.templateDataSHA256
+	templates := maps.Clone(s.templates)
+	s.mutex.Unlock()
+	if dataSHA256 != nil {
+		return dataSHA256, nil
+	}
+
+	dataSHA256, err := templateDataSHA256(s.TemplateData(), s.templateOptions, templates)
+	if err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	s.templateDataSHA256 = dataSHA256
+	s.mutex.Unlock()
+	return dataSHA256, nil
+}
+
+// parseDirAttr returns the DirAttr of the source directory with fileInfo,
+// using the source state cache if available.
+func (s *SourceState) parseDirAttr(fileInfo fs.FileInfo) (DirAttr, error) {
+	if s.sourceStateCache == nil {
+		return parseDirAttr(fileInfo.Name())
+	}
+	return s.sourceStateCache.parseDirAttr(fileInfo)
+}
+
+// parseFileAttr returns the FileAttr of the source file with fileInfo, using
+// the source state cache if available.
+func (s *SourceState) parseFileAttr(fileInfo fs.FileInfo) (FileAttr, error) {
+	encryptedSuffix := EncryptedSuffixOf(s.encryption, fileInfo.Name())
+	if s.sourceStateCache == nil {
+		return parseFileAttr(fileInfo.Name(), encryptedSuffix)
+	}
+	return s.sourceStateCache.parseFileAttr(fileInfo, encryptedSuffix)
 }
 
 // getExternalData reads the external data for externalRelPath from
@@ -1978,6 +2616,43 @@ func (s *SourceState) newFileTargetStateEntryFunc(
 	}
 }
 
+// newHardlinkTargetStateEntryFunc returns a targetStateEntryFunc that returns a
+// hard link to the target named by the contents of the source file.
+func (s *SourceState) newHardlinkTargetStateEntryFunc(
+	sourceRelPath SourceRelPath,
+	fileAttr FileAttr,
+	targetRelPath RelPath,
+	contentsFunc ContentsFunc,
+) TargetStateEntryFunc {
+	return func(destSystem System, destAbsPath AbsPath) (TargetStateEntry, error) {
+		linknameFunc := sync.OnceValues(func() (RelPath, error) {
+			linknameBytes, err := s.readContentsAndExecuteTemplate(contentsFunc, fileAttr, sourceRelPath, destAbsPath)
+			if err != nil {
+				return EmptyRelPath, err
+			}
+			linknameStr := string(bytes.TrimSpace(linknameBytes))
+			if linknameStr == "" {
+				return EmptyRelPath, nil
+			}
+			linkname, err := NewUntrustedRelPath(path.Clean(filepath.ToSlash(linknameStr)))
+			if err != nil {
+				return EmptyRelPath, fmt.Errorf("%s: %w", sourceRelPath, err)
+			}
+			if linkname == targetRelPath {
+				return EmptyRelPath, fmt.Errorf("%s: hard link to itself", sourceRelPath)
+			}
+			return linkname, nil
+		})
+		return &TargetStateHardlink{
+			linknameFunc:  linknameFunc,
+			targetRelPath: targetRelPath,
+			sourceAttr: SourceAttr{
+				Template: fileAttr.Template,
+			},
+		}, nil
+	}
+}
+
 // newModifyTargetStateEntryFunc returns a targetStateEntryFunc that returns a
 // file with the contents modified by running the sourceLazyContents script.
 func (s *SourceState) newModifyTargetStateEntryFunc(
@@ -2149,17 +2824,31 @@ func (s *SourceState) newSourceStateFile(
 	fileAttr FileAttr,
 	targetRelPath RelPath,
 ) (RelPath, *SourceStateFile) {
+	var encryption Encryption
+	var encryptionErr error
+	if fileAttr.Encrypted {
+		encryption, encryptionErr = s.encryptionOf(absPath.Base(), targetRelPath)
+	}
 	contentsFunc := sync.OnceValues(func() ([]byte, error) {
-		contents, err := s.system.ReadFile(s.sourceDirAbsPath.Join(sourceRelPath.RelPath()))
+		if encryptionErr != nil {
+			return nil, encryptionErr
+		}
+		contents, err := s.system.ReadFile(absPath)
 		if err != nil {
 			return nil, err
 		}
 		if fileAttr.Encrypted {
-			contents, err = s.encryption.Decrypt(contents)
+			contents, err = encryption.Decrypt(contents)
 			if err != nil {
 				return nil, err
 			}
 		}
+		if fileAttr.EncryptedValues {
+			contents, err = DecryptValues(s.encryption, contents)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", absPath, err)
+			}
+		}
 		return contents, nil
 	})
 
@@ -2169,6 +2858,8 @@ func (s *SourceState) newSourceStateFile(
 		targetStateEntryFunc = s.newCreateTargetStateEntryFunc(sourceRelPath, fileAttr, contentsFunc)
 	case SourceFileTypeFile:
 		targetStateEntryFunc = s.newFileTargetStateEntryFunc(sourceRelPath, fileAttr, contentsFunc)
+	case SourceFileTypeHardlink:
+		targetStateEntryFunc = s.newHardlinkTargetStateEntryFunc(sourceRelPath, fileAttr, targetRelPath, contentsFunc)
 	case SourceFileTypeModify:
 		// If the target has an extension, determine if it indicates an
 		// interpreter to use.
@@ -2210,6 +2901,7 @@ func (s *SourceState) newSourceStateFile(
 		attr:                 fileAttr,
 		contentsFunc:         contentsFunc,
 		contentsSHA256Func:   lazySHA256(contentsFunc),
+		encryption:           encryption,
 		targetStateEntryFunc: targetStateEntryFunc,
 	}
 }
@@ -2220,6 +2912,7 @@ func (s *SourceState) newSourceStateFileEntryFromFile(
 	actualStateFile *ActualStateFile,
 	fileInfo fs.FileInfo,
 	parentSourceRelPath SourceRelPath,
+	targetRelPath RelPath,
 	options *AddOptions,
 ) (*SourceStateFile, error) {
 	fileAttr := FileAttr{
@@ -2263,21 +2956,37 @@ func (s *SourceState) newSourceStateFileEntryFromFile(
 	if len(contents) == 0 {
 		fileAttr.Empty = true
 	}
+	if targetAttributes := s.targetAttributes(targetRelPath); targetAttributes != nil &&
+		targetAttributes.bools[encryptedValuesAttribute] {
+		fileAttr.EncryptedValues = true
+		contents, err = s.encryptValues(targetRelPath, contents, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var encryption Encryption
+	encryptedSuffix := s.encryption.EncryptedSuffix()
 	if options.Encrypt {
-		contents, err = s.encryption.Encrypt(contents)
+		encryption, err = s.addedEncryption(options, targetRelPath)
+		if err != nil {
+			return nil, err
+		}
+		contents, err = encryption.Encrypt(contents)
 		if err != nil {
 			return nil, err
 		}
+		encryptedSuffix = encryption.EncryptedSuffix()
 	}
 	contentsFunc := eagerNoErr(contents)
 	contentsSHA256Func := lazySHA256(contentsFunc)
-	sourceRelPath := parentSourceRelPath.Join(NewSourceRelPath(fileAttr.SourceName(s.encryption.EncryptedSuffix())))
+	sourceRelPath := parentSourceRelPath.Join(NewSourceRelPath(fileAttr.SourceName(encryptedSuffix)))
 	return &SourceStateFile{
 		attr:               fileAttr,
 		origin:             actualStateFile,
 		sourceRelPath:      sourceRelPath,
 		contentsFunc:       contentsFunc,
 		contentsSHA256Func: contentsSHA256Func,
+		encryption:         encryption,
 		targetStateEntry: &TargetStateFile{
 			contentsFunc:       contentsFunc,
 			contentsSHA256Func: contentsSHA256Func,
@@ -2621,7 +3330,7 @@ func (s *SourceState) readExternalArchiveData(
 	}
 	urlPath := externalURL.Path
 	if external.Encrypted {
-		urlPath = strings.TrimSuffix(urlPath, s.encryption.EncryptedSuffix())
+		urlPath = strings.TrimSuffix(urlPath, EncryptedSuffixOf(s.encryption, urlPath))
 	}
 
 	format := external.Format
@@ -2892,6 +3601,7 @@ func (s *SourceState) readScriptsDir(ctx context.Context, scriptsDirAbsPath AbsP
 		allSourceStateEntries[relPath] = append(allSourceStateEntries[relPath], sourceStateEntry)
 		allSourceStateEntriesMu.Unlock()
 	}
+	sourceDirAbsPath := s.sourceDirAbsPathOf(scriptsDirAbsPath)
 	walkFunc := func(ctx context.Context, sourceAbsPath AbsPath, fileInfo fs.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -2915,7 +3625,7 @@ func (s *SourceState) readScriptsDir(ctx context.Context, scriptsDirAbsPath AbsP
 		}
 
 		sourceRelPath := SourceRelPath{
-			relPath: sourceAbsPath.MustTrimDirPrefix(s.sourceDirAbsPath),
+			relPath: sourceAbsPath.MustTrimDirPrefix(sourceDirAbsPath),
 			isDir:   fileInfo.IsDir(),
 		}
 		parentSourceRelPath, sourceName := sourceRelPath.Split()
@@ -2933,7 +3643,7 @@ func (s *SourceState) readScriptsDir(ctx context.Context, scriptsDirAbsPath AbsP
 		case fileInfo.IsDir():
 			return nil
 		case fileInfo.Mode().IsRegular():
-			fa, err := parseFileAttr(sourceName.String(), s.encryption.EncryptedSuffix())
+			fa, err := parseFileAttr(sourceName.String(), EncryptedSuffixOf(s.encryption, sourceName.String()))
 			if err != nil {
 				return err
 			}
@@ -2986,6 +3696,286 @@ func (s *SourceState) readVersionFile(sourceAbsPath AbsPath) error {
 	return nil
 }
 
+// setMode sets the permissions of the target state entry of sourceStateEntry
+// if the mode attribute is set for targetRelPath.
+func (s *SourceState) setMode(targetRelPath RelPath, sourceStateEntry SourceStateEntry) {
+	targetAttributes := matchAttributes(s.attributeRules, targetRelPath)
+	if targetAttributes == nil || !targetAttributes.hasMode {
+		return
+	}
+	updateTargetStateEntry(sourceStateEntry, func(targetStateEntry TargetStateEntry) {
+		switch targetStateEntry := targetStateEntry.(type) {
+		case *TargetStateDir:
+			targetStateEntry.perm = targetAttributes.mode
+		case *TargetStateFile:
+			targetStateEntry.perm = targetAttributes.mode
+		}
+	})
+}
+
+// setOwner sets the owner and group of the target state entry of
+// sourceStateEntry from the owner rules that match targetRelPath. Later rules
+// take precedence over earlier rules.
+func (s *SourceState) setOwner(targetRelPath RelPath, sourceStateEntry SourceStateEntry) {
+	var owner, group string
+	for _, ownerRule := range s.ownerRules {
+		if ok, _ := doublestar.Match(ownerRule.pattern, targetRelPath.String()); !ok {
+			continue
+		}
+		if ownerRule.owner != "" {
+			owner = ownerRule.owner
+		}
+		if ownerRule.group != "" {
+			group = ownerRule.group
+		}
+	}
+	if owner == "" && group == "" {
+		return
+	}
+	updateTargetStateEntry(sourceStateEntry, func(targetStateEntry TargetStateEntry) {
+		switch targetStateEntry := targetStateEntry.(type) {
+		case *TargetStateDir:
+			targetStateEntry.owner = owner
+			targetStateEntry.group = group
+		case *TargetStateFile:
+			targetStateEntry.owner = owner
+			targetStateEntry.group = group
+		}
+	})
+}
+
+// setXattrs sets the extended attributes of the target state entry of
+// sourceStateEntry, if any are declared for targetRelPath.
+func (s *SourceState) setXattrs(targetRelPath RelPath, sourceStateEntry SourceStateEntry) {
+	xattrs, ok := s.xattrs[targetRelPath]
+	if !ok {
+		return
+	}
+	updateTargetStateEntry(sourceStateEntry, func(targetStateEntry TargetStateEntry) {
+		switch targetStateEntry := targetStateEntry.(type) {
+		case *TargetStateDir:
+			targetStateEntry.xattrs = xattrs
+		case *TargetStateFile:
+			targetStateEntry.xattrs = xattrs
+		}
+	})
+}
+
+// WriteAttributes updates the .chezmoiattributes files with the boolean
+// attributes in attributesByTargetRelPath. True attributes are set and false
+// attributes are unset. Each target's attributes are written to the
+// .chezmoiattributes file in the root of the source directory that contains
+// it.
+func (s *SourceState) WriteAttributes(sourceSystem System, attributesByTargetRelPath map[RelPath]map[string]bool) error {
+	attributesBySourceDirAbsPath := make(map[AbsPath]map[RelPath]map[string]bool)
+	for targetRelPath, attributes := range attributesByTargetRelPath {
+		for name := range attributes {
+			if !boolAttributes.Contains(name) {
+				return fmt.Errorf("%s: unknown attribute", name)
+			}
+		}
+		sourceDirAbsPath := s.TargetSourceDirAbsPath(targetRelPath)
+		if attributesBySourceDirAbsPath[sourceDirAbsPath] == nil {
+			attributesBySourceDirAbsPath[sourceDirAbsPath] = make(map[RelPath]map[string]bool)
+		}
+		attributesBySourceDirAbsPath[sourceDirAbsPath][targetRelPath] = attributes
+	}
+	for sourceDirAbsPath, attributesByTargetRelPath := range attributesBySourceDirAbsPath {
+		if err := s.writeAttributes(sourceSystem, sourceDirAbsPath, attributesByTargetRelPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAttributes updates the .chezmoiattributes file in the root of
+// sourceDirAbsPath with attributesByTargetRelPath.
+func (s *SourceState) writeAttributes(
+	sourceSystem System,
+	sourceDirAbsPath AbsPath,
+	attributesByTargetRelPath map[RelPath]map[string]bool,
+) error {
+	attributesAbsPath := sourceDirAbsPath.JoinString(attributesName)
+	data, err := sourceSystem.ReadFile(attributesAbsPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, targetRelPath := range slices.SortedFunc(maps.Keys(attributesByTargetRelPath), CompareRelPaths) {
+		attributes := attributesByTargetRelPath[targetRelPath]
+		if len(attributes) == 0 {
+			continue
+		}
+		data, err = updateAttributesFile(data, attributesPattern(targetRelPath), attributes)
+		if err != nil {
+			return fmt.Errorf("%s:%w", attributesAbsPath, err)
+		}
+	}
+	return sourceSystem.WriteFile(attributesAbsPath, data, 0o666&^s.umask)
+}
+
+// writeXattrs updates the .chezmoixattrs file in the root of the source
+// directory with xattrsByTargetRelPath. Targets with no extended attributes are
+// removed from the file.
+func (s *SourceState) writeXattrs(sourceSystem System, xattrsByTargetRelPath map[RelPath]map[string][]byte) error {
+	xattrsAbsPath := s.sourceDirAbsPath.JoinString(xattrsName)
+	xattrsFileXattrs := make(map[RelPath]map[string][]byte)
+	switch data, err := sourceSystem.ReadFile(xattrsAbsPath); {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if xattrsFileXattrs, err = parseXattrsFile(data); err != nil {
+			return fmt.Errorf("%s: %w", xattrsAbsPath, err)
+		}
+	}
+	for targetRelPath, xattrs := range xattrsByTargetRelPath {
+		if len(xattrs) == 0 {
+			delete(xattrsFileXattrs, targetRelPath)
+		} else {
+			xattrsFileXattrs[targetRelPath] = xattrs
+		}
+	}
+	data := formatXattrsFile(xattrsFileXattrs)
+	if len(data) == 0 {
+		if err := sourceSystem.Remove(xattrsAbsPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return sourceSystem.WriteFile(xattrsAbsPath, data, 0o666&^s.umask)
+}
+
+// targetAttributes returns the attributes of targetRelPath from the attribute
+// rules read so far, or nil if no rules match.
+func (s *SourceState) targetAttributes(targetRelPath RelPath) *targetAttributes {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return matchAttributes(s.attributeRules, targetRelPath)
+}
+
+// encryptionOf returns the encryption of the encrypted file with source name
+// sourceName and target targetRelPath. The encryption is the encryption named
+// by the target's encryption attribute, if any, otherwise the encryption with
+// sourceName's encrypted suffix, with the recipients of the target's
+// .chezmoirecipients files.
+func (s *SourceState) encryptionOf(sourceName string, targetRelPath RelPath) (Encryption, error) {
+	var name string
+	if targetAttributes := s.targetAttributes(targetRelPath); targetAttributes != nil {
+		name = targetAttributes.encryption
+	}
+	if name == "" {
+		if multiEncryption, ok := s.encryption.(*MultiEncryption); ok {
+			return s.withTargetRecipients(multiEncryption.ForSourceName(sourceName), targetRelPath), nil
+		}
+		return s.withTargetRecipients(s.encryption, targetRelPath), nil
+	}
+	if encryption, ok := s.encryptions[name]; ok {
+		return s.withTargetRecipients(encryption, targetRelPath), nil
+	}
+	return nil, fmt.Errorf("%s: %s: encryption not configured", targetRelPath, name)
+}
+
+// addedEncryption returns the encryption of the target at targetRelPath when it
+// is added with options.
+func (s *SourceState) addedEncryption(options *AddOptions, targetRelPath RelPath) (Encryption, error) {
+	if options.Encryption == nil {
+		return s.encryptionOf("", targetRelPath)
+	}
+	return s.withTargetRecipients(options.Encryption, targetRelPath), nil
+}
+
+// encryptValues returns contents, the contents of the target targetRelPath,
+// with its values encrypted. Values that are unchanged from the existing source
+// state entry keep their existing ciphertexts.
+func (s *SourceState) encryptValues(targetRelPath RelPath, contents []byte, options *AddOptions) ([]byte, error) {
+	if options.Template {
+		return nil, fmt.Errorf("%s: cannot encrypt values of templates", targetRelPath)
+	}
+	format, err := formatFromExtension(targetRelPath.Ext())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", targetRelPath, err)
+	}
+	encryption, err := s.addedEncryption(options, targetRelPath)
+	if err != nil {
+		return nil, err
+	}
+	var oldContents []byte
+	if oldSourceStateFile, ok := s.Get(targetRelPath).(*SourceStateFile); ok &&
+		oldSourceStateFile.attr.EncryptedValues && !oldSourceStateFile.attr.Encrypted {
+		oldSourceAbsPath := s.TargetSourceDirAbsPath(targetRelPath).Join(oldSourceStateFile.sourceRelPath.RelPath())
+		if oldContents, err = s.system.ReadFile(oldSourceAbsPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	encryptedContents, err := EncryptValues(encryption, format, contents, oldContents)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", targetRelPath, err)
+	}
+	return encryptedContents, nil
+}
+
+// sourceDirAbsPathOf returns the innermost source directory that contains
+// absPath.
+func (s *SourceState) sourceDirAbsPathOf(absPath AbsPath) AbsPath {
+	result := s.sourceDirAbsPath
+	for _, lowerSourceDirAbsPath := range s.lowerSourceDirAbsPaths {
+		if absPath.HasDirPrefix(lowerSourceDirAbsPath) &&
+			(!absPath.HasDirPrefix(result) || lowerSourceDirAbsPath.Len() > result.Len()) {
+			result = lowerSourceDirAbsPath
+		}
+	}
+	return result
+}
+
+// moveAttributesFromSourceName removes the attributes that can be recorded in a
+// .chezmoiattributes file from the source name of sourceStateEntry, a new entry
+// being added at targetRelPath, and returns them. Attributes that are not set
+// are returned as false if the existing attribute rules would set them.
+func (s *SourceState) moveAttributesFromSourceName(
+	sourceStateEntry SourceStateEntry,
+	parentSourceRelPath SourceRelPath,
+	targetRelPath RelPath,
+) map[string]bool {
+	var attributes map[string]bool
+	switch sourceStateEntry := sourceStateEntry.(type) {
+	case *SourceStateDir:
+		attributes = map[string]bool{
+			exactAttribute:   sourceStateEntry.attr.Exact,
+			privateAttribute: sourceStateEntry.attr.Private,
+		}
+		sourceStateEntry.attr.Exact = false
+		sourceStateEntry.attr.Private = false
+		sourceStateEntry.sourceRelPath = parentSourceRelPath.Join(NewSourceRelDirPath(sourceStateEntry.attr.SourceName()))
+	case *SourceStateFile:
+		attributes = map[string]bool{
+			createAttribute:     sourceStateEntry.attr.Type == SourceFileTypeCreate,
+			encryptedAttribute:  sourceStateEntry.attr.Encrypted,
+			executableAttribute: sourceStateEntry.attr.Executable,
+			privateAttribute:    sourceStateEntry.attr.Private,
+			templateAttribute:   sourceStateEntry.attr.Template,
+		}
+		if sourceStateEntry.attr.Type == SourceFileTypeCreate {
+			sourceStateEntry.attr.Type = SourceFileTypeFile
+		}
+		sourceStateEntry.attr.Encrypted = false
+		sourceStateEntry.attr.Executable = false
+		sourceStateEntry.attr.Private = false
+		sourceStateEntry.attr.Template = false
+		sourceName := sourceStateEntry.attr.SourceName(s.encryption.EncryptedSuffix())
+		sourceStateEntry.sourceRelPath = parentSourceRelPath.Join(NewSourceRelPath(sourceName))
+	default:
+		return nil
+	}
+
+	targetAttributes := matchAttributes(s.attributeRules, targetRelPath)
+	for name, value := range attributes {
+		if !value && (targetAttributes == nil || !targetAttributes.bools[name]) {
+			delete(attributes, name)
+		}
+	}
+	return attributes
+}
+
 // sourceStateEntry returns a new SourceStateEntry based on actualStateEntry.
 func (s *SourceState) sourceStateEntry(
 	actualStateEntry ActualStateEntry,
@@ -3001,7 +3991,7 @@ func (s *SourceState) sourceStateEntry(
 	case *ActualStateDir:
 		return s.newSourceStateDirEntry(actualStateEntry, fileInfo, parentSourceRelPath, targetRelPath, options), nil
 	case *ActualStateFile:
-		return s.newSourceStateFileEntryFromFile(actualStateEntry, fileInfo, parentSourceRelPath, options)
+		return s.newSourceStateFileEntryFromFile(actualStateEntry, fileInfo, parentSourceRelPath, targetRelPath, options)
 	case *ActualStateSymlink:
 		return s.newSourceStateFileEntryFromSymlink(actualStateEntry, fileInfo, parentSourceRelPath, options)
 	default:
@@ -3072,8 +4062,44 @@ func canonicalSourceStateEntry(sourceStateEntries []SourceStateEntry) (SourceSta
 	}
 }
 
+// equalSourceStateDirs returns true if sourceStateEntry1 and sourceStateEntry2
+// are both directories with the same attributes.
+func equalSourceStateDirs(sourceStateEntry1, sourceStateEntry2 SourceStateEntry) bool {
+	sourceStateDir1, ok1 := sourceStateEntry1.(*SourceStateDir)
+	sourceStateDir2, ok2 := sourceStateEntry2.(*SourceStateDir)
+	return ok1 && ok2 && sourceStateDir1.attr == sourceStateDir2.attr
+}
+
 // isAppleDoubleFile returns true if the file looks like and has the
 // expected signature of an AppleDouble file.
 func isAppleDoubleFile(name string, contents []byte) bool {
 	return strings.HasPrefix(path.Base(name), appleDoubleNamePrefix) && bytes.HasPrefix(contents, appleDoubleContentsPrefix)
 }
+
+// isHardlink returns true if sourceStateEntry is a hard link.
+func isHardlink(sourceStateEntry SourceStateEntry) bool {
+	sourceStateFile, ok := sourceStateEntry.(*SourceStateFile)
+	return ok && sourceStateFile.attr.Type == SourceFileTypeHardlink
+}
+
+// updateTargetStateEntry arranges for f to be called with the target state
+// entry of sourceStateEntry.
+func updateTargetStateEntry(sourceStateEntry SourceStateEntry, f func(TargetStateEntry)) {
+	switch sourceStateEntry := sourceStateEntry.(type) {
+	case *SourceStateDir:
+		f(sourceStateEntry.targetStateEntry)
+	case *SourceStateFile:
+		targetStateEntryFunc := sourceStateEntry.targetStateEntryFunc
+		if targetStateEntryFunc == nil {
+			f(sourceStateEntry.targetStateEntry)
+			return
+		}
+		sourceStateEntry.targetStateEntryFunc = func(destSystem System, destDirAbsPath AbsPath) (TargetStateEntry, error) {
+			targetStateEntry, err := targetStateEntryFunc(destSystem, destDirAbsPath)
+			if err == nil {
+				f(targetStateEntry)
+			}
+			return targetStateEntry, err
+		}
+	}
+}
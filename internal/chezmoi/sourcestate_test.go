@@ -7,9 +7,12 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 	"text/template"
 	"time"
@@ -860,6 +863,290 @@ func TestSourceStateApplyAll(t *testing.T) {
 	}
 }
 
+func TestSourceStateApplyOwners(t *testing.T) {
+	uid := strconv.Itoa(os.Getuid())
+	for _, tc := range []struct {
+		name           string
+		root           any
+		expectedChowns []chownCall
+	}{
+		{
+			name: "file_owner_unix",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoiowners": ".file 12345\n",
+					"dot_file":       "# contents of .file\n",
+				},
+			},
+			expectedChowns: []chownCall{
+				{name: NewAbsPath("/home/user/.file"), uid: 12345, gid: -1},
+			},
+		},
+		{
+			name: "file_group_unix",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoiowners": ".file :23456 # comment\n",
+					"dot_file":       "# contents of .file\n",
+				},
+			},
+			expectedChowns: []chownCall{
+				{name: NewAbsPath("/home/user/.file"), uid: -1, gid: 23456},
+			},
+		},
+		{
+			name: "dir_unix",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoiowners.tmpl": `{{ ".dir" }} 12345:23456` + "\n",
+					"dot_dir/file":        "# contents of .dir/file\n",
+				},
+			},
+			expectedChowns: []chownCall{
+				{name: NewAbsPath("/home/user/.dir"), uid: 12345, gid: 23456},
+			},
+		},
+		{
+			name: "override_unix",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoiowners": "** 12345\n",
+					"dot_dir": map[string]any{
+						".chezmoiowners": "* :23456\n",
+						"file":           "# contents of .dir/file\n",
+					},
+				},
+			},
+			expectedChowns: []chownCall{
+				{name: NewAbsPath("/home/user/.dir"), uid: 12345, gid: -1},
+				{name: NewAbsPath("/home/user/.dir/file"), uid: 12345, gid: 23456},
+			},
+		},
+		{
+			name: "unchanged_unix",
+			root: map[string]any{
+				"/home/user": map[string]any{
+					".file": "# contents of .file\n",
+					".local/share/chezmoi": map[string]any{
+						".chezmoiowners": ".file " + uid + "\n",
+						"dot_file":       "# contents of .file\n",
+					},
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chezmoitest.SkipUnlessGOOS(t, tc.name)
+			chezmoitest.WithTestFS(t, tc.root, func(fileSystem vfs.FS) {
+				ctx := t.Context()
+				system := &chownRecordingSystem{
+					RealSystem: NewRealSystem(fileSystem),
+				}
+				s := NewSourceState(
+					WithBaseSystem(system),
+					WithDestDir(NewAbsPath("/home/user")),
+					WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+					WithSystem(system),
+				)
+				assert.NoError(t, s.Read(ctx, nil))
+				assert.NoError(t, s.applyAll(system, system, NewMockPersistentState(), NewAbsPath("/home/user"), ApplyOptions{
+					Filter: NewEntryTypeFilter(EntryTypesAll, EntryTypesNone),
+					Umask:  chezmoitest.Umask,
+				}))
+				assert.Equal(t, tc.expectedChowns, system.chowns)
+			})
+		})
+	}
+}
+
+func TestSourceStateApplyXattrs(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		root           any
+		xattrs         map[AbsPath]map[string][]byte
+		expectedXattrs map[AbsPath]map[string][]byte
+	}{
+		{
+			name: "new_file",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoixattrs": chezmoitest.JoinLines(
+						"# file: .file",
+						`user.key="value"`,
+					),
+					"dot_file": "# contents of .file\n",
+				},
+			},
+			expectedXattrs: map[AbsPath]map[string][]byte{
+				NewAbsPath("/home/user/.file"): {
+					"user.key": []byte("value"),
+				},
+			},
+		},
+		{
+			name: "existing_file",
+			root: map[string]any{
+				"/home/user": map[string]any{
+					".file": "# contents of .file\n",
+					".local/share/chezmoi": map[string]any{
+						".chezmoixattrs": chezmoitest.JoinLines(
+							"# file: .file",
+							`user.key="value"`,
+						),
+						"dot_file": "# contents of .file\n",
+					},
+				},
+			},
+			xattrs: map[AbsPath]map[string][]byte{
+				NewAbsPath("/home/user/.file"): {
+					"security.selinux": []byte("label"),
+					"user.key":         []byte("old value"),
+					"user.other":       []byte("other value"),
+				},
+			},
+			expectedXattrs: map[AbsPath]map[string][]byte{
+				NewAbsPath("/home/user/.file"): {
+					"security.selinux": []byte("label"),
+					"user.key":         []byte("value"),
+				},
+			},
+		},
+		{
+			name: "dir",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi/dot_dir": map[string]any{
+					".chezmoixattrs": chezmoitest.JoinLines(
+						"# file: subdir",
+						"system.posix_acl_default=0sAgAAAA==",
+					),
+					"subdir/file": "# contents of .dir/subdir/file\n",
+				},
+			},
+			expectedXattrs: map[AbsPath]map[string][]byte{
+				NewAbsPath("/home/user/.dir/subdir"): {
+					"system.posix_acl_default": {2, 0, 0, 0},
+				},
+			},
+		},
+		{
+			name: "unmanaged",
+			root: map[string]any{
+				"/home/user": map[string]any{
+					".file": "# contents of .file\n",
+					".local/share/chezmoi": map[string]any{
+						"dot_file": "# contents of .file\n",
+					},
+				},
+			},
+			xattrs: map[AbsPath]map[string][]byte{
+				NewAbsPath("/home/user/.file"): {
+					"user.key": []byte("value"),
+				},
+			},
+			expectedXattrs: map[AbsPath]map[string][]byte{
+				NewAbsPath("/home/user/.file"): {
+					"user.key": []byte("value"),
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chezmoitest.WithTestFS(t, tc.root, func(fileSystem vfs.FS) {
+				ctx := t.Context()
+				system := newXattrsSystem(NewRealSystem(fileSystem), tc.xattrs)
+				s := NewSourceState(
+					WithBaseSystem(system),
+					WithDestDir(NewAbsPath("/home/user")),
+					WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+					WithSystem(system),
+				)
+				assert.NoError(t, s.Read(ctx, nil))
+				assert.NoError(t, s.applyAll(system, system, NewMockPersistentState(), NewAbsPath("/home/user"), ApplyOptions{
+					Filter: NewEntryTypeFilter(EntryTypesAll, EntryTypesNone),
+					Umask:  chezmoitest.Umask,
+				}))
+				assert.Equal(t, tc.expectedXattrs, system.xattrs)
+
+				// Check that the target and actual states are now equivalent.
+				for targetAbsPath := range tc.expectedXattrs {
+					targetRelPath := targetAbsPath.MustTrimDirPrefix(NewAbsPath("/home/user"))
+					targetStateEntry, err := s.root.Get(targetRelPath).TargetStateEntry(system, NewAbsPath("/home/user"))
+					assert.NoError(t, err)
+					targetEntryState, err := targetStateEntry.EntryState(chezmoitest.Umask)
+					assert.NoError(t, err)
+					actualStateEntry, err := NewActualStateEntry(system, targetAbsPath, nil, nil)
+					assert.NoError(t, err)
+					actualEntryState, err := actualStateEntry.EntryState()
+					assert.NoError(t, err)
+					assert.True(t, targetEntryState.Equivalent(actualEntryState))
+				}
+			})
+		})
+	}
+}
+
+func TestSourceStateAddXattrs(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user": map[string]any{
+			".dir/file": "# contents of .dir/file\n",
+			".file":     "# contents of .file\n",
+			".local/share/chezmoi": map[string]any{
+				".chezmoixattrs": chezmoitest.JoinLines(
+					"# file: .file",
+					`user.key="old value"`,
+					"",
+					"# file: .other",
+					`user.key="other value"`,
+				),
+			},
+		},
+	}, func(fileSystem vfs.FS) {
+		ctx := t.Context()
+		system := newXattrsSystem(NewRealSystem(fileSystem), map[AbsPath]map[string][]byte{
+			NewAbsPath("/home/user/.dir"): {
+				"system.posix_acl_default": {2, 0, 0, 0},
+			},
+			NewAbsPath("/home/user/.file"): {
+				"user.key": []byte("value"),
+			},
+		})
+		s := NewSourceState(
+			WithBaseSystem(system),
+			WithDestDir(NewAbsPath("/home/user")),
+			WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+			WithSystem(system),
+		)
+		assert.NoError(t, s.Read(ctx, nil))
+
+		destAbsPathInfos := make(map[AbsPath]fs.FileInfo)
+		for _, destAbsPath := range []AbsPath{
+			NewAbsPath("/home/user/.dir/file"),
+			NewAbsPath("/home/user/.file"),
+		} {
+			assert.NoError(t, s.AddDestAbsPathInfos(destAbsPathInfos, system, destAbsPath, nil))
+		}
+		assert.NoError(t, s.Add(system, NewMockPersistentState(), system, destAbsPathInfos, &AddOptions{
+			Filter: NewEntryTypeFilter(EntryTypesAll, EntryTypesNone),
+			Xattrs: true,
+		}))
+
+		vfst.RunTests(t, fileSystem, "",
+			vfst.TestPath("/home/user/.local/share/chezmoi/.chezmoixattrs",
+				vfst.TestContentsString(chezmoitest.JoinLines(
+					"# file: .dir",
+					"system.posix_acl_default=0sAgAAAA==",
+					"",
+					"# file: .file",
+					`user.key="value"`,
+					"",
+					"# file: .other",
+					`user.key="other value"`,
+				)),
+			),
+		)
+	})
+}
+
 func TestSourceStateExecuteTemplateData(t *testing.T) {
 	for _, tc := range []struct {
 		name        string
@@ -1738,6 +2025,159 @@ func TestSourceStateReadExternal(t *testing.T) {
 	}
 }
 
+func TestSourceStateReadLayers(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user/.local/share/chezmoi": map[string]any{
+			".chezmoidata.yaml": "name: personal\n",
+			".chezmoiignore":    ".ignored\n",
+			".chezmoitemplates": map[string]any{
+				"header": "# personal header",
+			},
+			"dot_config": map[string]any{
+				"personal": "# contents of .config/personal\n",
+			},
+			"dot_file": "# personal .file\n",
+		},
+		"/srv/team/dotfiles": map[string]any{
+			".chezmoidata.yaml": "name: team\nteam: true\n",
+			".chezmoitemplates": map[string]any{
+				"header": "# team header",
+			},
+			"dot_config": map[string]any{
+				"team": "# contents of .config/team\n",
+			},
+			"dot_file":          "# team .file\n",
+			"dot_ignored":       "# contents of .ignored\n",
+			"dot_template.tmpl": `{{ template "header" }} {{ .name }} {{ .team }}` + "\n",
+		},
+	}, func(fileSystem vfs.FS) {
+		ctx := t.Context()
+		system := NewRealSystem(fileSystem)
+		s := NewSourceState(
+			WithBaseSystem(system),
+			WithDestDir(NewAbsPath("/home/user")),
+			WithLowerSourceDirs([]AbsPath{NewAbsPath("/srv/team/dotfiles")}),
+			WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+			WithSystem(system),
+		)
+		assert.NoError(t, s.Read(ctx, nil))
+		assert.Equal(t, []RelPath{
+			NewRelPath(".config"),
+			NewRelPath(".config/personal"),
+			NewRelPath(".config/team"),
+			NewRelPath(".file"),
+			NewRelPath(".template"),
+		}, s.TargetRelPaths())
+
+		for targetRelPath, expectedSourceDirAbsPath := range map[RelPath]AbsPath{
+			NewRelPath(".config"):          NewAbsPath("/home/user/.local/share/chezmoi"),
+			NewRelPath(".config/personal"): NewAbsPath("/home/user/.local/share/chezmoi"),
+			NewRelPath(".config/team"):     NewAbsPath("/srv/team/dotfiles"),
+			NewRelPath(".file"):            NewAbsPath("/home/user/.local/share/chezmoi"),
+			NewRelPath(".template"):        NewAbsPath("/srv/team/dotfiles"),
+		} {
+			assert.Equal(t, expectedSourceDirAbsPath, s.TargetSourceDirAbsPath(targetRelPath))
+		}
+
+		assert.Equal(t, []*LayerConflict{
+			{
+				TargetRelPath: NewRelPath(".file"),
+				SourceAbsPath: NewAbsPath("/home/user/.local/share/chezmoi/dot_file"),
+				ShadowedSourceAbsPaths: []AbsPath{
+					NewAbsPath("/srv/team/dotfiles/dot_file"),
+				},
+			},
+		}, s.LayerConflicts())
+
+		assert.NoError(t, s.applyAll(system, system, NewMockPersistentState(), NewAbsPath("/home/user"), ApplyOptions{
+			Filter: NewEntryTypeFilter(EntryTypesAll, EntryTypesNone),
+			Umask:  chezmoitest.Umask,
+		}))
+		vfst.RunTests(t, fileSystem, "",
+			vfst.TestPath("/home/user/.config/team",
+				vfst.TestContentsString("# contents of .config/team\n"),
+			),
+			vfst.TestPath("/home/user/.file",
+				vfst.TestContentsString("# personal .file\n"),
+			),
+			vfst.TestPath("/home/user/.ignored",
+				vfst.TestDoesNotExist(),
+			),
+			vfst.TestPath("/home/user/.template",
+				vfst.TestContentsString("# personal header personal true\n"),
+			),
+		)
+	})
+}
+
+func TestSourceStateEvaluate(t *testing.T) {
+	sourceDir := make(map[string]any)
+	for i := range 100 {
+		sourceDir[fmt.Sprintf("dot_file%d.tmpl", i)] = fmt.Sprintf("{{ printf \"# contents of .file%%d\" %d }}\n", i)
+	}
+
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user/.local/share/chezmoi": sourceDir,
+	}, func(fileSystem vfs.FS) {
+		ctx := t.Context()
+		system := NewRealSystem(fileSystem)
+		s := NewSourceState(
+			WithBaseSystem(system),
+			WithDestDir(NewAbsPath("/home/user")),
+			WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+			WithSystem(system),
+		)
+		assert.NoError(t, s.Read(ctx, nil))
+
+		s.Evaluate(system, s.TargetRelPaths(), EvaluateOptions{
+			Filter:      NewEntryTypeFilter(EntryTypesAll, EntryTypesNone),
+			Parallelism: 8,
+		})
+		err := s.applyAll(system, system, NewMockPersistentState(), NewAbsPath("/home/user"), ApplyOptions{
+			Filter: NewEntryTypeFilter(EntryTypesAll, EntryTypesNone),
+			Umask:  chezmoitest.Umask,
+		})
+		assert.NoError(t, err)
+
+		tests := make([]any, 0, 100)
+		for i := range 100 {
+			tests = append(tests, vfst.TestPath(fmt.Sprintf("/home/user/.file%d", i),
+				vfst.TestModeIsRegular(),
+				vfst.TestContentsString(fmt.Sprintf("# contents of .file%d\n", i)),
+			))
+		}
+		vfst.RunTests(t, fileSystem, "", tests...)
+	})
+}
+
+func TestSourceStateEvaluationBatches(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user/.local/share/chezmoi": map[string]any{
+			"dot_file1":          "",
+			"dot_file2":          "",
+			"run_before_1before": "",
+			"run_before_2before": "",
+			"run_1":              "",
+			"run_after_1after":   "",
+		},
+	}, func(fileSystem vfs.FS) {
+		ctx := t.Context()
+		system := NewRealSystem(fileSystem)
+		s := NewSourceState(
+			WithBaseSystem(system),
+			WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+			WithSystem(system),
+		)
+		assert.NoError(t, s.Read(ctx, nil))
+		assert.Equal(t, [][]RelPath{
+			{NewRelPath("1before")},
+			{NewRelPath("2before")},
+			{NewRelPath(".file1"), NewRelPath(".file2"), NewRelPath("1")},
+			{NewRelPath("1after")},
+		}, s.EvaluationBatches(s.TargetRelPaths()))
+	})
+}
+
 func TestSourceStateReadScriptsConcurrent(t *testing.T) {
 	for _, tc := range []struct {
 		name string
@@ -2323,3 +2763,59 @@ func manyScripts(amount int) map[string]any {
 	}
 	return scripts
 }
+
+// A chownCall records a call to System.Chown.
+type chownCall struct {
+	name AbsPath
+	uid  int
+	gid  int
+}
+
+// A chownRecordingSystem is a RealSystem that records calls to Chown instead
+// of changing the owner and group.
+type chownRecordingSystem struct {
+	*RealSystem
+	chowns []chownCall
+}
+
+func (s *chownRecordingSystem) Chown(name AbsPath, uid, gid int) error {
+	s.chowns = append(s.chowns, chownCall{name: name, uid: uid, gid: gid})
+	return nil
+}
+
+// An xattrsSystem is a RealSystem that stores extended attributes in memory.
+type xattrsSystem struct {
+	*RealSystem
+	xattrs map[AbsPath]map[string][]byte
+}
+
+func newXattrsSystem(realSystem *RealSystem, xattrs map[AbsPath]map[string][]byte) *xattrsSystem {
+	if xattrs == nil {
+		xattrs = make(map[AbsPath]map[string][]byte)
+	}
+	return &xattrsSystem{
+		RealSystem: realSystem,
+		xattrs:     xattrs,
+	}
+}
+
+func (s *xattrsSystem) Lgetxattrs(name AbsPath) (map[string][]byte, error) {
+	if _, err := s.Lstat(name); err != nil {
+		return nil, err
+	}
+	return maps.Clone(s.xattrs[name]), nil
+}
+
+func (s *xattrsSystem) Lsetxattrs(name AbsPath, xattrs map[string][]byte) error {
+	if s.xattrs[name] == nil {
+		s.xattrs[name] = make(map[string][]byte)
+	}
+	for attr, value := range xattrs {
+		if value == nil {
+			delete(s.xattrs[name], attr)
+		} else {
+			s.xattrs[name][attr] = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+package chezmoi
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// sourceStateCacheVersion is the version of the source state cache format. It
+// should be incremented whenever the format changes.
+const sourceStateCacheVersion = 2
+
+// A SourceStateCache is a persistent cache of the results of reading a source
+// directory. It caches the entries of each directory and the attributes parsed
+// from their names, keyed by the directory's modification time, size, and
+// inode, and the output of each template special file, keyed by the template
+// file's modification time, size, and inode and by a hash of the template data,
+// so that unchanged parts of the source directory do not need to be re-read.
+type SourceStateCache struct {
+	system   System
+	absPath  AbsPath
+	mutex    sync.Mutex
+	cached   sourceStateCacheData
+	current  sourceStateCacheData
+	modified bool
+}
+
+// sourceStateCacheData is the data in a SourceStateCache.
+type sourceStateCacheData struct {
+	Version   int                                  `json:"version"`
+	Dirs      map[string]*sourceStateCacheDir      `json:"dirs"`
+	Templates map[string]*sourceStateCacheTemplate `json:"templates"`
+}
+
+// A sourceStateCacheFileKey identifies a version of a file.
+type sourceStateCacheFileKey struct {
+	ModTime int64  `json:"modTime"`
+	Size    int64  `json:"size"`
+	Inode   uint64 `json:"inode"`
+}
+
+// A sourceStateCacheDir is a cached directory.
+type sourceStateCacheDir struct {
+	Key     sourceStateCacheFileKey     `json:"key"`
+	Entries []*sourceStateCacheDirEntry `json:"entries"`
+}
+
+// A sourceStateCacheDirEntry is a cached directory entry. It implements
+// [io/fs.DirEntry] and [io/fs.FileInfo], but only records the entry's name and
+// type, and the attributes parsed from its name.
+type sourceStateCacheDirEntry struct {
+	EntryName       string      `json:"name"`
+	EntryType       fs.FileMode `json:"type"`
+	DirAttr         *DirAttr    `json:"dirAttr,omitempty"`
+	FileAttr        *FileAttr   `json:"fileAttr,omitempty"`
+	EncryptedSuffix string      `json:"encryptedSuffix,omitempty"`
+}
+
+// A sourceStateCacheTemplate is the cached output of a template.
+type sourceStateCacheTemplate struct {
+	Key                sourceStateCacheFileKey `json:"key"`
+	TemplateDataSHA256 HexBytes                `json:"templateDataSHA256"`
+	Data               []byte                  `json:"data"`
+}
+
+// A sourceStateCacheDirReader reads directories from a System using a
+// SourceStateCache.
+type sourceStateCacheDirReader struct {
+	sourceStateCache *SourceStateCache
+	system           System
+}
+
+// NewSourceStateCache returns a new SourceStateCache persisted to absPath in
+// system.
+func NewSourceStateCache(system System, absPath AbsPath) *SourceStateCache {
+	return &SourceStateCache{
+		system:  system,
+		absPath: absPath,
+	}
+}
+
+// dirReader returns a dirReader that reads directories from system using c.
+func (c *SourceStateCache) dirReader(system System) dirReader {
+	return sourceStateCacheDirReader{
+		sourceStateCache: c,
+		system:           system,
+	}
+}
+
+// executeTemplate returns the cached output of the template at absPath with
+// fs.FileInfo fileInfo and template data hash templateDataSHA256, calling
+// executeTemplateFunc and caching its output if needed.
+func (c *SourceStateCache) executeTemplate(
+	absPath AbsPath,
+	fileInfo fs.FileInfo,
+	templateDataSHA256 []byte,
+	executeTemplateFunc func() ([]byte, error),
+) ([]byte, error) {
+	key := newSourceStateCacheFileKey(fileInfo)
+
+	c.mutex.Lock()
+	cachedTemplate, ok := c.cached.Templates[absPath.String()]
+	if ok && cachedTemplate.Key == key && slices.Equal(cachedTemplate.TemplateDataSHA256, templateDataSHA256) {
+		c.current.Templates[absPath.String()] = cachedTemplate
+		c.mutex.Unlock()
+		return cachedTemplate.Data, nil
+	}
+	c.mutex.Unlock()
+
+	data, err := executeTemplateFunc()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	c.current.Templates[absPath.String()] = &sourceStateCacheTemplate{
+		Key:                key,
+		TemplateDataSHA256: templateDataSHA256,
+		Data:               data,
+	}
+	c.modified = true
+	c.mutex.Unlock()
+	return data, nil
+}
+
+// parseDirAttr returns the DirAttr parsed from fileInfo's name, using the
+// cached value if fileInfo is a cached directory entry.
+func (c *SourceStateCache) parseDirAttr(fileInfo fs.FileInfo) (DirAttr, error) {
+	entry, ok := fileInfo.(*sourceStateCacheDirEntry)
+	if !ok {
+		return parseDirAttr(fileInfo.Name())
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if entry.DirAttr != nil {
+		return *entry.DirAttr, nil
+	}
+	dirAttr, err := parseDirAttr(entry.EntryName)
+	if err != nil {
+		return DirAttr{}, err
+	}
+	entry.DirAttr = &dirAttr
+	c.modified = true
+	return dirAttr, nil
+}
+
+// parseFileAttr returns the FileAttr parsed from fileInfo's name with
+// encryptedSuffix, using the cached value if fileInfo is a cached directory
+// entry.
+func (c *SourceStateCache) parseFileAttr(fileInfo fs.FileInfo, encryptedSuffix string) (FileAttr, error) {
+	entry, ok := fileInfo.(*sourceStateCacheDirEntry)
+	if !ok {
+		return parseFileAttr(fileInfo.Name(), encryptedSuffix)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if entry.FileAttr != nil && entry.EncryptedSuffix == encryptedSuffix {
+		return *entry.FileAttr, nil
+	}
+	fileAttr, err := parseFileAttr(entry.EntryName, encryptedSuffix)
+	if err != nil {
+		return FileAttr{}, err
+	}
+	entry.FileAttr = &fileAttr
+	entry.EncryptedSuffix = encryptedSuffix
+	c.modified = true
+	return fileAttr, nil
+}
+
+// load loads c from its file. A missing, invalid, or out of date cache file is
+// treated as an empty cache.
+func (c *SourceStateCache) load() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.cached = sourceStateCacheData{}
+	c.current = sourceStateCacheData{
+		Version:   sourceStateCacheVersion,
+		Dirs:      make(map[string]*sourceStateCacheDir),
+		Templates: make(map[string]*sourceStateCacheTemplate),
+	}
+	c.modified = false
+
+	data, err := c.system.ReadFile(c.absPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	}
+	var cached sourceStateCacheData
+	if err := json.Unmarshal(data, &cached); err != nil || cached.Version != sourceStateCacheVersion {
+		return nil //nolint:nilerr
+	}
+	c.cached = cached
+	return nil
+}
+
+// save saves c to its file if it has been modified. Entries that were not used
+// since c was loaded are removed.
+func (c *SourceStateCache) save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.modified &&
+		len(c.current.Dirs) == len(c.cached.Dirs) &&
+		len(c.current.Templates) == len(c.cached.Templates) {
+		return nil
+	}
+
+	data, err := json.Marshal(&c.current)
+	if err != nil {
+		return err
+	}
+	if err := MkdirAll(c.system, c.absPath.Dir(), 0o700); err != nil {
+		return err
+	}
+	if err := c.system.WriteFile(c.absPath, data, 0o600); err != nil {
+		return err
+	}
+	c.cached = c.current
+	c.modified = false
+	return nil
+}
+
+// ReadDir implements dirReader.ReadDir.
+func (r sourceStateCacheDirReader) ReadDir(name AbsPath) ([]fs.DirEntry, error) {
+	c := r.sourceStateCache
+
+	fileInfo, err := r.system.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	key := newSourceStateCacheFileKey(fileInfo)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cachedDir, ok := c.cached.Dirs[name.String()]
+	if !ok || cachedDir.Key != key {
+		dirEntries, err := r.system.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		cachedDir = &sourceStateCacheDir{
+			Key:     key,
+			Entries: make([]*sourceStateCacheDirEntry, 0, len(dirEntries)),
+		}
+		for _, dirEntry := range dirEntries {
+			cachedDir.Entries = append(cachedDir.Entries, &sourceStateCacheDirEntry{
+				EntryName: dirEntry.Name(),
+				EntryType: dirEntry.Type(),
+			})
+		}
+		c.modified = true
+	}
+	c.current.Dirs[name.String()] = cachedDir
+
+	// Return the cached entries, even if the directory was read, so that the
+	// attributes parsed from their names are cached.
+	dirEntries := make([]fs.DirEntry, 0, len(cachedDir.Entries))
+	for _, entry := range cachedDir.Entries {
+		dirEntries = append(dirEntries, entry)
+	}
+	return dirEntries, nil
+}
+
+// Info implements io/fs.DirEntry.Info.
+func (e *sourceStateCacheDirEntry) Info() (fs.FileInfo, error) {
+	return e, nil
+}
+
+// IsDir implements io/fs.DirEntry.IsDir and io/fs.FileInfo.IsDir.
+func (e *sourceStateCacheDirEntry) IsDir() bool {
+	return e.EntryType.IsDir()
+}
+
+// ModTime implements io/fs.FileInfo.ModTime.
+func (e *sourceStateCacheDirEntry) ModTime() time.Time {
+	return time.Time{}
+}
+
+// Mode implements io/fs.FileInfo.Mode.
+func (e *sourceStateCacheDirEntry) Mode() fs.FileMode {
+	return e.EntryType
+}
+
+// Name implements io/fs.DirEntry.Name and io/fs.FileInfo.Name.
+func (e *sourceStateCacheDirEntry) Name() string {
+	return e.EntryName
+}
+
+// Size implements io/fs.FileInfo.Size.
+func (e *sourceStateCacheDirEntry) Size() int64 {
+	return 0
+}
+
+// Sys implements io/fs.FileInfo.Sys.
+func (e *sourceStateCacheDirEntry) Sys() any {
+	return nil
+}
+
+// Type implements io/fs.DirEntry.Type.
+func (e *sourceStateCacheDirEntry) Type() fs.FileMode {
+	return e.EntryType
+}
+
+// newSourceStateCacheFileKey returns the key for fileInfo.
+func newSourceStateCacheFileKey(fileInfo fs.FileInfo) sourceStateCacheFileKey {
+	return sourceStateCacheFileKey{
+		ModTime: fileInfo.ModTime().UnixNano(),
+		Size:    fileInfo.Size(),
+		Inode:   fileInode(fileInfo),
+	}
+}
+
+// templateDataSHA256 returns the SHA256 of templateData, templateOptions, and
+// templates.
+func templateDataSHA256(
+	templateData map[string]any,
+	templateOptions []string,
+	templates map[string]*Template,
+) ([]byte, error) {
+	hash := sha256.New()
+	encoder := json.NewEncoder(hash)
+	if err := encoder.Encode(templateData); err != nil {
+		return nil, err
+	}
+	if err := encoder.Encode(templateOptions); err != nil {
+		return nil, err
+	}
+	for _, name := range slices.Sorted(maps.Keys(templates)) {
+		if err := encoder.Encode(name); err != nil {
+			return nil, err
+		}
+		if tree := templates[name].template.Tree; tree != nil && tree.Root != nil {
+			if err := encoder.Encode(tree.Root.String()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return hash.Sum(nil), nil
+}
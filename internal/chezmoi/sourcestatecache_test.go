@@ -0,0 +1,101 @@
+package chezmoi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v5"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoitest"
+)
+
+func TestSourceStateCache(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user/.local/share/chezmoi": map[string]any{
+			".chezmoiignore.tmpl": "{{ count }}{{ .ignore }}\n",
+			"dot_file1":           "# contents of .file1\n",
+			"dot_file2":           "# contents of .file2\n",
+		},
+	}, func(fileSystem vfs.FS) {
+		ctx := t.Context()
+		system := NewRealSystem(fileSystem)
+		sourceStateCache := NewSourceStateCache(system, NewAbsPath("/home/user/.cache/chezmoi/source.json"))
+
+		count := 0
+		templateFuncs := map[string]any{
+			"count": func() string {
+				count++
+				return ""
+			},
+		}
+
+		read := func(ignore string) []RelPath {
+			t.Helper()
+			s := NewSourceState(
+				WithBaseSystem(system),
+				WithDestDir(NewAbsPath("/home/user")),
+				WithPriorityTemplateData(map[string]any{
+					"ignore": ignore,
+				}),
+				WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+				WithSourceStateCache(sourceStateCache),
+				WithSystem(system),
+				WithTemplateFuncs(templateFuncs),
+			)
+			assert.NoError(t, s.Read(ctx, nil))
+			return s.TargetRelPaths()
+		}
+
+		// The first read populates the cache.
+		assert.Equal(t, []RelPath{NewRelPath(".file1")}, read(".file2"))
+		assert.Equal(t, 1, count)
+		_, err := system.Stat(NewAbsPath("/home/user/.cache/chezmoi/source.json"))
+		assert.NoError(t, err)
+
+		// The second read uses the cached template output.
+		assert.Equal(t, []RelPath{NewRelPath(".file1")}, read(".file2"))
+		assert.Equal(t, 1, count)
+
+		// Changing the template data invalidates the cached template output.
+		assert.Equal(t, []RelPath{NewRelPath(".file2")}, read(".file1"))
+		assert.Equal(t, 2, count)
+
+		// Changing the template invalidates the cached template output.
+		assert.NoError(t, system.WriteFile(
+			NewAbsPath("/home/user/.local/share/chezmoi/.chezmoiignore.tmpl"),
+			[]byte("{{ count }}.file1\n.file2\n"),
+			0o666,
+		))
+		assert.Equal(t, []RelPath{}, read(".file1"))
+		assert.Equal(t, 3, count)
+
+		// Adding a file invalidates the cached directory entries.
+		assert.NoError(t, system.WriteFile(
+			NewAbsPath("/home/user/.local/share/chezmoi/dot_file3"),
+			[]byte("# contents of .file3\n"),
+			0o666,
+		))
+		assert.Equal(t, []RelPath{NewRelPath(".file3")}, read(".file1"))
+		assert.Equal(t, 3, count)
+
+		// The attributes parsed from source file names are cached.
+		data, err := system.ReadFile(NewAbsPath("/home/user/.cache/chezmoi/source.json"))
+		assert.NoError(t, err)
+		var sourceStateCacheData sourceStateCacheData
+		assert.NoError(t, json.Unmarshal(data, &sourceStateCacheData))
+		cachedDir := sourceStateCacheData.Dirs["/home/user/.local/share/chezmoi"]
+		assert.NotZero(t, cachedDir)
+		fileAttrs := make(map[string]FileAttr)
+		for _, entry := range cachedDir.Entries {
+			if entry.FileAttr != nil {
+				fileAttrs[entry.EntryName] = *entry.FileAttr
+			}
+		}
+		assert.Equal(t, map[string]FileAttr{
+			"dot_file1": {TargetName: ".file1", Type: SourceFileTypeFile},
+			"dot_file2": {TargetName: ".file2", Type: SourceFileTypeFile},
+			"dot_file3": {TargetName: ".file3", Type: SourceFileTypeFile},
+		}, fileAttrs)
+	})
+}
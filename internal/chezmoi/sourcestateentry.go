@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"log/slog"
 	"os/exec"
+	"sync"
 
 	"chezmoi.io/chezmoi/v2/internal/chezmoilog"
 )
@@ -55,14 +56,16 @@ type SourceStateDir struct {
 
 // A SourceStateFile represents the state of a file in the source state.
 type SourceStateFile struct {
-	attr                 FileAttr
-	contentsFunc         ContentsFunc
-	contentsSHA256Func   ContentsSHA256Func
-	origin               SourceStateOrigin
-	sourceRelPath        SourceRelPath
-	targetStateEntryFunc TargetStateEntryFunc
-	targetStateEntry     TargetStateEntry
-	targetStateEntryErr  error
+	attr                  FileAttr
+	contentsFunc          ContentsFunc
+	contentsSHA256Func    ContentsSHA256Func
+	encryption            Encryption
+	origin                SourceStateOrigin
+	sourceRelPath         SourceRelPath
+	targetStateEntryMutex sync.Mutex
+	targetStateEntryFunc  TargetStateEntryFunc
+	targetStateEntry      TargetStateEntry
+	targetStateEntryErr   error
 }
 
 // A SourceStateImplicitDir represents the state of a directory that is implicit
@@ -180,6 +183,11 @@ func (s *SourceStateFile) ContentsSHA256() ([32]byte, error) {
 	return s.contentsSHA256Func()
 }
 
+// Encryption returns the encryption of s, or nil if s is not encrypted.
+func (s *SourceStateFile) Encryption() Encryption {
+	return s.encryption
+}
+
 // Evaluate evaluates s and returns any error.
 func (s *SourceStateFile) Evaluate() error {
 	if _, err := s.Contents(); err != nil {
@@ -227,6 +235,8 @@ func (s *SourceStateFile) SourceRelPath() SourceRelPath {
 
 // TargetStateEntry returns s's target state entry.
 func (s *SourceStateFile) TargetStateEntry(destSystem System, destDirAbsPath AbsPath) (TargetStateEntry, error) {
+	s.targetStateEntryMutex.Lock()
+	defer s.targetStateEntryMutex.Unlock()
 	if s.targetStateEntryFunc != nil {
 		s.targetStateEntry, s.targetStateEntryErr = s.targetStateEntryFunc(destSystem, destDirAbsPath)
 		s.targetStateEntryFunc = nil
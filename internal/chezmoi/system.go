@@ -20,13 +20,21 @@ type RunScriptOptions struct {
 	SourceRelPath SourceRelPath
 }
 
+// A dirReader reads directories.
+type dirReader interface {
+	ReadDir(name AbsPath) ([]fs.DirEntry, error)
+}
+
 // A System reads from and writes to a filesystem, runs scripts, and persists
 // state.
 type System interface { //nolint:interfacebloat
 	Chmod(name AbsPath, mode fs.FileMode) error
+	Chown(name AbsPath, uid, gid int) error
 	Chtimes(name AbsPath, atime, mtime time.Time) error
 	Glob(pattern string) ([]string, error)
+	Lgetxattrs(name AbsPath) (map[string][]byte, error)
 	Link(oldName, newName AbsPath) error
+	Lsetxattrs(name AbsPath, xattrs map[string][]byte) error
 	Lstat(filename AbsPath) (fs.FileInfo, error)
 	Mkdir(name AbsPath, perm fs.FileMode) error
 	RawPath(absPath AbsPath) (AbsPath, error)
@@ -47,14 +55,15 @@ type System interface { //nolint:interfacebloat
 // A emptySystemMixin simulates an empty system.
 type emptySystemMixin struct{}
 
-func (emptySystemMixin) Glob(pattern string) ([]string, error)       { return nil, nil }
-func (emptySystemMixin) Lstat(name AbsPath) (fs.FileInfo, error)     { return nil, fs.ErrNotExist }
-func (emptySystemMixin) RawPath(path AbsPath) (AbsPath, error)       { return path, nil }
-func (emptySystemMixin) ReadDir(name AbsPath) ([]fs.DirEntry, error) { return nil, fs.ErrNotExist }
-func (emptySystemMixin) ReadFile(name AbsPath) ([]byte, error)       { return nil, fs.ErrNotExist }
-func (emptySystemMixin) Readlink(name AbsPath) (string, error)       { return "", fs.ErrNotExist }
-func (emptySystemMixin) Stat(name AbsPath) (fs.FileInfo, error)      { return nil, fs.ErrNotExist }
-func (emptySystemMixin) UnderlyingFS() vfs.FS                        { return nil }
+func (emptySystemMixin) Glob(pattern string) ([]string, error)              { return nil, nil }
+func (emptySystemMixin) Lgetxattrs(name AbsPath) (map[string][]byte, error) { return nil, nil }
+func (emptySystemMixin) Lstat(name AbsPath) (fs.FileInfo, error)            { return nil, fs.ErrNotExist }
+func (emptySystemMixin) RawPath(path AbsPath) (AbsPath, error)              { return path, nil }
+func (emptySystemMixin) ReadDir(name AbsPath) ([]fs.DirEntry, error)        { return nil, fs.ErrNotExist }
+func (emptySystemMixin) ReadFile(name AbsPath) ([]byte, error)              { return nil, fs.ErrNotExist }
+func (emptySystemMixin) Readlink(name AbsPath) (string, error)              { return "", fs.ErrNotExist }
+func (emptySystemMixin) Stat(name AbsPath) (fs.FileInfo, error)             { return nil, fs.ErrNotExist }
+func (emptySystemMixin) UnderlyingFS() vfs.FS                               { return nil }
 
 // A noUpdateSystemMixin panics on any update.
 type noUpdateSystemMixin struct{}
@@ -63,6 +72,10 @@ func (noUpdateSystemMixin) Chmod(name AbsPath, perm fs.FileMode) error {
 	panic("update to no update system")
 }
 
+func (noUpdateSystemMixin) Chown(name AbsPath, uid, gid int) error {
+	panic("update to no update system")
+}
+
 func (noUpdateSystemMixin) Chtimes(name AbsPath, atime, mtime time.Time) error {
 	panic("update to no update system")
 }
@@ -71,6 +84,10 @@ func (noUpdateSystemMixin) Link(oldName, newName AbsPath) error {
 	panic("update to no update system")
 }
 
+func (noUpdateSystemMixin) Lsetxattrs(name AbsPath, xattrs map[string][]byte) error {
+	panic("update to no update system")
+}
+
 func (noUpdateSystemMixin) Mkdir(name AbsPath, perm fs.FileMode) error {
 	panic("update to no update system")
 }
@@ -175,11 +192,16 @@ type ConcurrentWalkSourceDirFunc func(ctx context.Context, absPath AbsPath, file
 // before all other entries. All other entries are visited in alphabetical
 // order.
 func WalkSourceDir(system System, sourceDirAbsPath AbsPath, walkFunc WalkFunc) error {
+	return walkSourceDir(system, system, sourceDirAbsPath, walkFunc)
+}
+
+// walkSourceDir is like WalkSourceDir but reads directories with dirReader.
+func walkSourceDir(system System, dirReader dirReader, sourceDirAbsPath AbsPath, walkFunc WalkFunc) error {
 	fileInfo, err := system.Stat(sourceDirAbsPath)
 	if err != nil {
 		err = walkFunc(sourceDirAbsPath, nil, err)
 	} else {
-		err = walkSourceDirHelper(system, sourceDirAbsPath, fileInfo, walkFunc)
+		err = walkSourceDirHelper(dirReader, sourceDirAbsPath, fileInfo, walkFunc)
 		if errors.Is(err, fs.SkipDir) {
 			err = nil
 		}
@@ -199,7 +221,7 @@ var sourceDirEntryOrder = map[string]int{
 }
 
 // walkSourceDirHelper is a helper function for WalkSourceDir.
-func walkSourceDirHelper(system System, name AbsPath, fileInfo fs.FileInfo, walkFunc WalkFunc) error {
+func walkSourceDirHelper(dirReader dirReader, name AbsPath, fileInfo fs.FileInfo, walkFunc WalkFunc) error {
 	switch err := walkFunc(name, fileInfo, nil); {
 	case fileInfo.IsDir() && errors.Is(err, fs.SkipDir):
 		return nil
@@ -209,7 +231,7 @@ func walkSourceDirHelper(system System, name AbsPath, fileInfo fs.FileInfo, walk
 		return nil
 	}
 
-	dirEntries, err := system.ReadDir(name)
+	dirEntries, err := dirReader.ReadDir(name)
 	if err != nil {
 		err = walkFunc(name, fileInfo, err)
 		if err != nil {
@@ -226,7 +248,7 @@ func walkSourceDirHelper(system System, name AbsPath, fileInfo fs.FileInfo, walk
 				return err
 			}
 		}
-		if err := walkSourceDirHelper(system, name.JoinString(dirEntry.Name()), fileInfo, walkFunc); err != nil {
+		if err := walkSourceDirHelper(dirReader, name.JoinString(dirEntry.Name()), fileInfo, walkFunc); err != nil {
 			if !errors.Is(err, fs.SkipDir) {
 				return err
 			}
@@ -0,0 +1,99 @@
+package chezmoi
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoiset"
+)
+
+// A TagFilter selects targets by their tags. A target is selected if it has
+// none of the excluded tags and, if any tags are included, at least one of the
+// included tags.
+type TagFilter struct {
+	include chezmoiset.Set[string]
+	exclude chezmoiset.Set[string]
+}
+
+// NewTagFilter returns a new TagFilter that selects all targets.
+func NewTagFilter() *TagFilter {
+	return &TagFilter{
+		include: chezmoiset.New[string](),
+		exclude: chezmoiset.New[string](),
+	}
+}
+
+// IncludeTags returns if a target with tags is selected.
+func (f *TagFilter) IncludeTags(tags []string) bool {
+	if f == nil {
+		return true
+	}
+	included := f.include.IsEmpty()
+	for _, tag := range tags {
+		if f.exclude.Contains(tag) {
+			return false
+		}
+		if f.include.Contains(tag) {
+			included = true
+		}
+	}
+	return included
+}
+
+// IncludedTags returns the included tags in order.
+func (f *TagFilter) IncludedTags() []string {
+	tags := []string{}
+	if f != nil {
+		tags = slices.AppendSeq(tags, f.include.Elements())
+		slices.Sort(tags)
+	}
+	return tags
+}
+
+// IsEmpty returns if f selects all targets.
+func (f *TagFilter) IsEmpty() bool {
+	return f == nil || f.include.IsEmpty() && f.exclude.IsEmpty()
+}
+
+// Set implements github.com/spf13/pflag.Value.Set.
+func (f *TagFilter) Set(str string) error {
+	return f.SetSlice(strings.Split(str, ","))
+}
+
+// SetSlice adds the tags in ss to f. Tags prefixed with ! are excluded, all
+// other tags are included.
+func (f *TagFilter) SetSlice(ss []string) error {
+	for _, element := range ss {
+		if element == "" {
+			continue
+		}
+		tag, exclude := strings.CutPrefix(element, "!")
+		if !tagRx.MatchString(tag) {
+			return fmt.Errorf("%q: invalid tag", tag)
+		}
+		if exclude {
+			f.exclude.Add(tag)
+		} else {
+			f.include.Add(tag)
+		}
+	}
+	return nil
+}
+
+// String implements github.com/spf13/pflag.Value.String.
+func (f *TagFilter) String() string {
+	if f == nil {
+		return ""
+	}
+	elements := slices.Sorted(f.include.Elements())
+	for _, tag := range slices.Sorted(f.exclude.Elements()) {
+		elements = append(elements, "!"+tag)
+	}
+	return strings.Join(elements, ",")
+}
+
+// Type implements github.com/spf13/pflag.Value.Type.
+func (f *TagFilter) Type() string {
+	return "tags"
+}
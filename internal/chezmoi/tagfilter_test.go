@@ -0,0 +1,93 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestTagFilter(t *testing.T) {
+	for _, tc := range []struct {
+		s                    string
+		expectedString       string
+		expectedIncludedTags []string
+		expectedIncludes     map[string]bool
+		expectedErr          string
+	}{
+		{
+			s:                    "",
+			expectedIncludedTags: []string{},
+			expectedIncludes: map[string]bool{
+				"":         true,
+				"work":     true,
+				"gui,work": true,
+			},
+		},
+		{
+			s:                    "work",
+			expectedString:       "work",
+			expectedIncludedTags: []string{"work"},
+			expectedIncludes: map[string]bool{
+				"":         false,
+				"gui":      false,
+				"work":     true,
+				"gui,work": true,
+			},
+		},
+		{
+			s:                    "!gui",
+			expectedString:       "!gui",
+			expectedIncludedTags: []string{},
+			expectedIncludes: map[string]bool{
+				"":         true,
+				"gui":      false,
+				"work":     true,
+				"gui,work": false,
+			},
+		},
+		{
+			s:                    "work,home,!gui",
+			expectedString:       "home,work,!gui",
+			expectedIncludedTags: []string{"home", "work"},
+			expectedIncludes: map[string]bool{
+				"":         false,
+				"home":     true,
+				"work":     true,
+				"gui,work": false,
+			},
+		},
+		{
+			s:           "work,!",
+			expectedErr: `"": invalid tag`,
+		},
+		{
+			s:           "-work",
+			expectedErr: `"-work": invalid tag`,
+		},
+	} {
+		t.Run(tc.s, func(t *testing.T) {
+			tagFilter := NewTagFilter()
+			err := tagFilter.Set(tc.s)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedString, tagFilter.String())
+			assert.Equal(t, tc.expectedIncludedTags, tagFilter.IncludedTags())
+			assert.Equal(t, tc.s == "", tagFilter.IsEmpty())
+			for tags, expected := range tc.expectedIncludes {
+				var tagsSlice []string
+				if tags != "" {
+					tagsSlice = splitTags(tags)
+				}
+				assert.Equal(t, expected, tagFilter.IncludeTags(tagsSlice), tags)
+			}
+		})
+	}
+}
+
+func splitTags(s string) []string {
+	tags, _ := parseTagsAttribute(s)
+	return tags
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os/exec"
@@ -36,6 +37,9 @@ type TargetStateModifyDirWithCmd struct {
 // A TargetStateDir represents the state of a directory in the target state.
 type TargetStateDir struct {
 	perm       fs.FileMode
+	owner      string
+	group      string
+	xattrs     map[string][]byte
 	sourceAttr SourceAttr
 }
 
@@ -50,9 +54,21 @@ type TargetStateFile struct {
 	empty              bool
 	overwrite          bool
 	perm               fs.FileMode
+	owner              string
+	group              string
+	xattrs             map[string][]byte
 	sourceAttr         SourceAttr
 }
 
+// A TargetStateHardlink represents the state of a hard link in the target
+// state. Its linkname is the path of the file that it links to, relative to the
+// target directory.
+type TargetStateHardlink struct {
+	linknameFunc  func() (RelPath, error)
+	targetRelPath RelPath
+	sourceAttr    SourceAttr
+}
+
 // A TargetStateRemove represents the absence of an entry in the target state.
 type TargetStateRemove struct{}
 
@@ -164,22 +180,41 @@ func (t *TargetStateDir) Apply(
 	actualStateEntry ActualStateEntry,
 ) (bool, error) {
 	if actualStateDir, ok := actualStateEntry.(*ActualStateDir); ok {
-		if runtime.GOOS == "windows" || actualStateDir.perm == t.perm {
-			return false, nil
+		changed := false
+		if runtime.GOOS != "windows" && actualStateDir.perm != t.perm {
+			if err := system.Chmod(actualStateDir.Path(), t.perm); err != nil {
+				return false, err
+			}
+			changed = true
 		}
-		return true, system.Chmod(actualStateDir.Path(), t.perm)
+		chowned, err := chown(system, actualStateDir.Path(), t.owner, t.group, actualStateDir.owner, actualStateDir.group)
+		if err != nil {
+			return changed || chowned, err
+		}
+		xattrsSet, err := setXattrs(system, actualStateDir.Path(), t.xattrs, actualStateDir.Xattrs)
+		return changed || chowned || xattrsSet, err
 	}
 	if err := actualStateEntry.Remove(system); err != nil {
 		return false, err
 	}
-	return true, system.Mkdir(actualStateEntry.Path(), t.perm)
+	if err := system.Mkdir(actualStateEntry.Path(), t.perm); err != nil {
+		return true, err
+	}
+	if _, err := chown(system, actualStateEntry.Path(), t.owner, t.group, "", ""); err != nil {
+		return true, err
+	}
+	_, err := setXattrs(system, actualStateEntry.Path(), t.xattrs, nil)
+	return true, err
 }
 
 // EntryState returns t's entry state.
 func (t *TargetStateDir) EntryState(umask fs.FileMode) (*EntryState, error) {
 	return &EntryState{
-		Type: EntryStateTypeDir,
-		Mode: fs.ModeDir | t.perm&^umask,
+		Type:   EntryStateTypeDir,
+		Mode:   fs.ModeDir | t.perm&^umask,
+		Owner:  t.owner,
+		Group:  t.group,
+		Xattrs: xattrsHexBytes(t.xattrs),
 	}, nil
 }
 
@@ -228,15 +263,33 @@ func (t *TargetStateFile) Apply(
 			return false, err
 		}
 		if actualContentsSHA256 == contentsSHA256 {
-			if runtime.GOOS == "windows" || actualStateFile.perm == t.perm {
-				return false, nil
+			changed := false
+			if runtime.GOOS != "windows" && actualStateFile.perm != t.perm {
+				if err := system.Chmod(actualStateFile.Path(), t.perm); err != nil {
+					return false, err
+				}
+				changed = true
+			}
+			chowned, err := chown(system, actualStateFile.Path(), t.owner, t.group, actualStateFile.owner, actualStateFile.group)
+			if err != nil {
+				return changed || chowned, err
 			}
-			return true, system.Chmod(actualStateFile.Path(), t.perm)
+			xattrsSet, err := setXattrs(system, actualStateFile.Path(), t.xattrs, actualStateFile.Xattrs)
+			return changed || chowned || xattrsSet, err
 		}
 	} else if err := actualStateEntry.Remove(system); err != nil {
 		return false, err
 	}
-	return true, system.WriteFile(actualStateEntry.Path(), contents, t.perm)
+	if err := system.WriteFile(actualStateEntry.Path(), contents, t.perm); err != nil {
+		return true, err
+	}
+	// Writing a file may replace it, so always set its owner, group, and
+	// extended attributes.
+	if _, err := chown(system, actualStateEntry.Path(), t.owner, t.group, "", ""); err != nil {
+		return true, err
+	}
+	_, err = setXattrs(system, actualStateEntry.Path(), t.xattrs, nil)
+	return true, err
 }
 
 // Contents returns t's contents.
@@ -268,6 +321,9 @@ func (t *TargetStateFile) EntryState(umask fs.FileMode) (*EntryState, error) {
 		Type:           EntryStateTypeFile,
 		Mode:           t.perm &^ umask,
 		ContentsSHA256: HexBytes(contentsSHA256[:]),
+		Owner:          t.owner,
+		Group:          t.group,
+		Xattrs:         xattrsHexBytes(t.xattrs),
 		contents:       contents,
 		overwrite:      t.overwrite,
 	}, nil
@@ -299,6 +355,107 @@ func (t *TargetStateFile) SourceAttr() SourceAttr {
 	return t.sourceAttr
 }
 
+// Apply updates actualStateEntry to match t.
+func (t *TargetStateHardlink) Apply(
+	system System,
+	persistentState PersistentState,
+	actualStateEntry ActualStateEntry,
+) (bool, error) {
+	linkname, err := t.Linkname()
+	if err != nil {
+		return false, err
+	}
+	if linkname.IsEmpty() {
+		if _, ok := actualStateEntry.(*ActualStateAbsent); ok {
+			return false, nil
+		}
+		return true, system.RemoveAll(actualStateEntry.Path())
+	}
+	if actualStateHardlink, ok := actualStateEntry.(*ActualStateHardlink); ok && actualStateHardlink.linkname == linkname {
+		return false, nil
+	}
+	oldAbsPath := t.oldAbsPath(actualStateEntry.Path(), linkname)
+	if err := actualStateEntry.Remove(system); err != nil {
+		return false, err
+	}
+	return true, system.Link(oldAbsPath, actualStateEntry.Path())
+}
+
+// EntryState returns t's entry state.
+func (t *TargetStateHardlink) EntryState(umask fs.FileMode) (*EntryState, error) {
+	linkname, err := t.Linkname()
+	if err != nil {
+		return nil, err
+	}
+	if linkname.IsEmpty() {
+		return &EntryState{
+			Type: EntryStateTypeRemove,
+		}, nil
+	}
+	return hardlinkEntryState(linkname), nil
+}
+
+// Evaluate evaluates t.
+func (t *TargetStateHardlink) Evaluate() error {
+	_, err := t.Linkname()
+	return err
+}
+
+// Linkname returns the path of the file that t links to, relative to the
+// target directory.
+func (t *TargetStateHardlink) Linkname() (RelPath, error) {
+	return t.linknameFunc()
+}
+
+// SkipApply implements TargetStateEntry.SkipApply.
+func (t *TargetStateHardlink) SkipApply(persistentState PersistentState, targetAbsPath AbsPath) (bool, error) {
+	return false, nil
+}
+
+// SourceAttr implements TargetStateEntry.SourceAttr.
+func (t *TargetStateHardlink) SourceAttr() SourceAttr {
+	return t.sourceAttr
+}
+
+// actualStateEntry returns actualStateEntry as an *ActualStateHardlink if it is
+// a file that is already a hard link to the file that t links to, and
+// actualStateEntry unchanged otherwise.
+func (t *TargetStateHardlink) actualStateEntry(system System, actualStateEntry ActualStateEntry) (ActualStateEntry, error) {
+	if _, ok := actualStateEntry.(*ActualStateFile); !ok {
+		return actualStateEntry, nil
+	}
+	linkname, err := t.Linkname()
+	if err != nil || linkname.IsEmpty() {
+		return actualStateEntry, err
+	}
+	fileInfo, err := system.Lstat(actualStateEntry.Path())
+	if err != nil {
+		return nil, err
+	}
+	switch oldFileInfo, err := system.Lstat(t.oldAbsPath(actualStateEntry.Path(), linkname)); {
+	case errors.Is(err, fs.ErrNotExist):
+		return actualStateEntry, nil
+	case err != nil:
+		return nil, err
+	case !sameFile(fileInfo, oldFileInfo):
+		return actualStateEntry, nil
+	}
+	return &ActualStateHardlink{
+		absPath:  actualStateEntry.Path(),
+		linkname: linkname,
+	}, nil
+}
+
+// oldAbsPath returns the absolute path of the file that the hard link at
+// absPath links to.
+func (t *TargetStateHardlink) oldAbsPath(absPath AbsPath, linkname RelPath) AbsPath {
+	targetDirAbsPath := absPath
+	for range t.targetRelPath.SplitAll() {
+		targetDirAbsPath = targetDirAbsPath.Dir()
+	}
+	return targetDirAbsPath.Join(linkname)
+}
+
 // Apply updates actualStateEntry to match t.
 func (t *TargetStateRemove) Apply(
 	system System,
@@ -537,3 +694,65 @@ func (t *TargetStateSymlink) SkipApply(persistentState PersistentState, targetAb
 func (t *TargetStateSymlink) SourceAttr() SourceAttr {
 	return t.sourceAttr
 }
+
+// chown sets the owner and group of absPath in system to owner and group, if
+// they are set and differ from actualOwner and actualGroup. It returns true if
+// it changed the owner or group.
+func chown(system System, absPath AbsPath, owner, group, actualOwner, actualGroup string) (bool, error) {
+	if runtime.GOOS == "windows" {
+		return false, nil
+	}
+	uid, gid := -1, -1
+	if owner != "" && owner != actualOwner {
+		var err error
+		if uid, err = lookupUID(owner); err != nil {
+			return false, fmt.Errorf("%s: %w", absPath, err)
+		}
+	}
+	if group != "" && group != actualGroup {
+		var err error
+		if gid, err = lookupGID(group); err != nil {
+			return false, fmt.Errorf("%s: %w", absPath, err)
+		}
+	}
+	if uid == -1 && gid == -1 {
+		return false, nil
+	}
+	return true, system.Chown(absPath, uid, gid)
+}
+
+// setXattrs sets the extended attributes of absPath in system to xattrs, if
+// xattrs is not nil. actualXattrsFunc, if not nil, returns the actual extended
+// attributes of absPath. It returns true if it changed any extended attributes.
+func setXattrs(
+	system System,
+	absPath AbsPath,
+	xattrs map[string][]byte,
+	actualXattrsFunc func() (map[string][]byte, error),
+) (bool, error) {
+	if xattrs == nil {
+		return false, nil
+	}
+	var actualXattrs map[string][]byte
+	if actualXattrsFunc != nil {
+		var err error
+		if actualXattrs, err = actualXattrsFunc(); err != nil {
+			return false, err
+		}
+	}
+	changes := xattrsChanges(xattrs, actualXattrs)
+	if len(changes) == 0 {
+		return false, nil
+	}
+	return true, system.Lsetxattrs(absPath, changes)
+}
+
+// hardlinkEntryState returns the entry state of a hard link to linkname.
+func hardlinkEntryState(linkname RelPath) *EntryState {
+	linknameSHA256 := sha256.Sum256([]byte(linkname.String()))
+	return &EntryState{
+		Type:           EntryStateTypeHardlink,
+		ContentsSHA256: linknameSHA256[:],
+		contents:       []byte(linkname.String()),
+	}
+}
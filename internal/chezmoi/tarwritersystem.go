@@ -5,6 +5,8 @@ import (
 	"io"
 	"io/fs"
 	"os/exec"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoiset"
 )
 
 // A TarWriterSystem is a System that writes to a tar archive.
@@ -14,6 +16,7 @@ type TarWriterSystem struct {
 
 	tarWriter      *tar.Writer
 	headerTemplate tar.Header
+	files          chezmoiset.Set[AbsPath]
 }
 
 // NewTarWriterSystem returns a new TarWriterSystem that writes a tar file to w.
@@ -21,14 +24,47 @@ func NewTarWriterSystem(w io.Writer, headerTemplate tar.Header) *TarWriterSystem
 	return &TarWriterSystem{
 		tarWriter:      tar.NewWriter(w),
 		headerTemplate: headerTemplate,
+		files:          chezmoiset.New[AbsPath](),
 	}
 }
 
+// Chown implements System.Chown. Ownership is not recorded in archives.
+func (s *TarWriterSystem) Chown(name AbsPath, uid, gid int) error {
+	return nil
+}
+
 // Close closes m.
 func (s *TarWriterSystem) Close() error {
 	return s.tarWriter.Close()
 }
 
+// Link implements System.Link. oldName must already have been written to the
+// archive.
+func (s *TarWriterSystem) Link(oldName, newName AbsPath) error {
+	if !s.files.Contains(oldName) {
+		return &fs.PathError{
+			Op:   "link",
+			Path: oldName.String(),
+			Err:  fs.ErrNotExist,
+		}
+	}
+	header := s.headerTemplate
+	header.Typeflag = tar.TypeLink
+	header.Name = newName.String()
+	header.Linkname = oldName.String()
+	if err := s.tarWriter.WriteHeader(&header); err != nil {
+		return err
+	}
+	s.files.Add(newName)
+	return nil
+}
+
+// Lsetxattrs implements System.Lsetxattrs. Extended attributes are not
+// recorded in archives.
+func (s *TarWriterSystem) Lsetxattrs(name AbsPath, xattrs map[string][]byte) error {
+	return nil
+}
+
 // Mkdir implements System.Mkdir.
 func (s *TarWriterSystem) Mkdir(name AbsPath, perm fs.FileMode) error {
 	header := s.headerTemplate
@@ -58,8 +94,11 @@ func (s *TarWriterSystem) WriteFile(filename AbsPath, data []byte, perm fs.FileM
 	if err := s.tarWriter.WriteHeader(&header); err != nil {
 		return err
 	}
-	_, err := s.tarWriter.Write(data)
-	return err
+	if _, err := s.tarWriter.Write(data); err != nil {
+		return err
+	}
+	s.files.Add(filename)
+	return nil
 }
 
 // WriteSymlink implements System.WriteSymlink.
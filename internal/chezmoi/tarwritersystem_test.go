@@ -29,8 +29,9 @@ func TestTarWriterSystem(t *testing.T) {
 			"dot_dir": map[string]any{
 				"file": "# contents of .dir/file\n",
 			},
-			"run_script":      "# contents of script\n",
-			"symlink_symlink": ".dir/subdir/file\n",
+			"hardlink_hardlink": ".dir/file\n",
+			"run_script":        "# contents of script\n",
+			"symlink_symlink":   ".dir/subdir/file\n",
 		},
 	}, func(fileSystem vfs.FS) {
 		ctx := t.Context()
@@ -88,6 +89,11 @@ func TestTarWriterSystem(t *testing.T) {
 				expectedName:     "symlink",
 				expectedLinkname: ".dir/subdir/file",
 			},
+			{
+				expectedTypeflag: tar.TypeLink,
+				expectedName:     "hardlink",
+				expectedLinkname: ".dir/file",
+			},
 		} {
 			t.Run(tc.expectedName, func(t *testing.T) {
 				header, err := r.Next()
@@ -0,0 +1,141 @@
+package chezmoi
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoiset"
+)
+
+// TemplateDeps are the dependencies of a template, including the dependencies
+// of the templates in .chezmoitemplates that it includes.
+type TemplateDeps struct {
+	DataKeys  []string
+	Templates []string
+	Funcs     []string
+}
+
+// Uses returns if d depends on dep. If dep starts with a dot then it is a
+// template data key, and d depends on dep if d depends on dep, on a key
+// containing dep, or on a key contained by dep. Otherwise, dep is the name of
+// a template or a template function.
+func (d *TemplateDeps) Uses(dep string) bool {
+	if !strings.HasPrefix(dep, ".") {
+		return slices.Contains(d.Templates, dep) || slices.Contains(d.Funcs, dep)
+	}
+	for _, dataKey := range d.DataKeys {
+		switch {
+		case dataKey == dep:
+			return true
+		case strings.HasPrefix(dataKey, dep+"."):
+			return true
+		case strings.HasPrefix(dep, dataKey+"."):
+			return true
+		}
+	}
+	return false
+}
+
+// A templateDepsCollector collects the dependencies of templates.
+type templateDepsCollector struct {
+	s         *SourceState
+	dataKeys  chezmoiset.Set[string]
+	templates chezmoiset.Set[string]
+	funcs     chezmoiset.Set[string]
+	visited   chezmoiset.Set[string]
+}
+
+// TemplateDeps returns the dependencies of the template for targetRelPath. It
+// returns nil if targetRelPath is not a template.
+func (s *SourceState) TemplateDeps(targetRelPath RelPath) (*TemplateDeps, error) {
+	sourceStateFile, ok := s.Get(targetRelPath).(*SourceStateFile)
+	if !ok || !sourceStateFile.Attr().Template {
+		return nil, nil
+	}
+	contents, err := sourceStateFile.Contents()
+	if err != nil {
+		return nil, err
+	}
+	if sourceStateFile.Attr().Type == SourceFileTypeModify {
+		contents = modifyTemplateRx.ReplaceAll(contents, nil)
+	}
+	tmpl, err := ParseTemplate(sourceStateFile.SourceRelPath().String(), contents, TemplateOptions{
+		Funcs:   s.templateFuncs,
+		Options: slices.Clone(s.templateOptions),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &templateDepsCollector{
+		s:         s,
+		dataKeys:  chezmoiset.New[string](),
+		templates: chezmoiset.New[string](),
+		funcs:     chezmoiset.New[string](),
+		visited:   chezmoiset.New[string](),
+	}
+	c.collect(tmpl.template, tmpl.name, true)
+
+	return &TemplateDeps{
+		DataKeys:  slices.Sorted(c.dataKeys.Elements()),
+		Templates: slices.Sorted(c.templates.Elements()),
+		Funcs:     slices.Sorted(c.funcs.Elements()),
+	}, nil
+}
+
+// collect collects the dependencies of the template named name in tmpl. If
+// dotIsData is true then the template is executed with the template data.
+func (c *templateDepsCollector) collect(tmpl *template.Template, name string, dotIsData bool) {
+	key := name + "\x00" + strconv.FormatBool(dotIsData)
+	if c.visited.Contains(key) {
+		return
+	}
+	c.visited.Add(key)
+
+	t := tmpl.Lookup(name)
+	if t == nil {
+		return
+	}
+	w := &templateWalker{
+		tree: t.Tree,
+		dataFunc: func(node parse.Node, ident []string, guarded bool) {
+			c.dataKeys.Add("." + strings.Join(ident, "."))
+		},
+		funcFunc: func(cmd *parse.CommandNode, name string, dotIsData bool) {
+			c.funcs.Add(name)
+			if name != "includeTemplate" || len(cmd.Args) < 2 {
+				return
+			}
+			templateName, ok := cmd.Args[1].(*parse.StringNode)
+			if !ok {
+				return
+			}
+			includedDotIsData := false
+			if len(cmd.Args) == 3 {
+				_, isDot := cmd.Args[2].(*parse.DotNode)
+				includedDotIsData = isDot && dotIsData
+			}
+			c.collectTemplate(templateName.Text, includedDotIsData)
+		},
+		templateFunc: func(node *parse.TemplateNode, dotIsData bool) {
+			if tmpl.Lookup(node.Name) != nil {
+				c.collect(tmpl, node.Name, dotIsData)
+				return
+			}
+			c.collectTemplate(node.Name, dotIsData)
+		},
+	}
+	w.walk(dotIsData)
+}
+
+// collectTemplate collects the dependencies of the template named name in
+// .chezmoitemplates.
+func (c *templateDepsCollector) collectTemplate(name string, dotIsData bool) {
+	c.templates.Add(name)
+	if t, ok := c.s.templates[name]; ok {
+		c.collect(t.template, t.name, dotIsData)
+	}
+}
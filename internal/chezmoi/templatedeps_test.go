@@ -0,0 +1,116 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/twpayne/go-vfs/v5"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoitest"
+)
+
+func TestSourceStateTemplateDeps(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		root          any
+		targetRelPath RelPath
+		expected      *TemplateDeps
+	}{
+		{
+			name: "not_template",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					"dot_file": "{{ .name }}",
+				},
+			},
+			targetRelPath: NewRelPath(".file"),
+		},
+		{
+			name: "data",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					"dot_file.tmpl": chezmoitest.JoinLines(
+						`{{ .name }}{{ $.chezmoi.os }}`,
+						`{{ if .optional }}{{ .optional.key | quote }}{{ end }}`,
+						`{{ range .list }}{{ .ignored }}{{ end }}`,
+					),
+				},
+			},
+			targetRelPath: NewRelPath(".file"),
+			expected: &TemplateDeps{
+				DataKeys:  []string{".chezmoi.os", ".list", ".name", ".optional", ".optional.key"},
+				Templates: []string{},
+				Funcs:     []string{"quote"},
+			},
+		},
+		{
+			name: "templates",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoitemplates": map[string]any{
+						"nested":  `{{ .nested }}`,
+						"partial": `{{ .partial }}{{ template "nested" . }}`,
+						"unused":  `{{ .unused }}`,
+					},
+					"dot_file.tmpl": chezmoitest.JoinLines(
+						`{{ define "local" }}{{ .local }}{{ end }}`,
+						`{{ template "local" . }}{{ template "partial" . }}`,
+						`{{ includeTemplate "nested" .value }}`,
+					),
+				},
+			},
+			targetRelPath: NewRelPath(".file"),
+			expected: &TemplateDeps{
+				DataKeys:  []string{".local", ".nested", ".partial", ".value"},
+				Templates: []string{"nested", "partial"},
+				Funcs:     []string{"includeTemplate"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chezmoitest.WithTestFS(t, tc.root, func(fileSystem vfs.FS) {
+				ctx := t.Context()
+				system := NewRealSystem(fileSystem)
+				s := NewSourceState(
+					WithBaseSystem(system),
+					WithDestDir(NewAbsPath("/home/user")),
+					WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+					WithSystem(system),
+					WithTemplateFuncs(map[string]any{
+						"includeTemplate": func(string, ...any) string { return "" },
+						"quote":           func(any) string { return "" },
+					}),
+				)
+				assert.NoError(t, s.Read(ctx, nil))
+				actual, err := s.TemplateDeps(tc.targetRelPath)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, actual)
+			})
+		})
+	}
+}
+
+func TestTemplateDepsUses(t *testing.T) {
+	templateDeps := &TemplateDeps{
+		DataKeys:  []string{".chezmoi.os", ".email"},
+		Templates: []string{"partial"},
+		Funcs:     []string{"onepasswordRead"},
+	}
+	for _, tc := range []struct {
+		dep      string
+		expected bool
+	}{
+		{dep: ".email", expected: true},
+		{dep: ".email.domain", expected: true},
+		{dep: ".chezmoi", expected: true},
+		{dep: ".chezmoi.arch", expected: false},
+		{dep: ".name", expected: false},
+		{dep: "partial", expected: true},
+		{dep: "onepasswordRead", expected: true},
+		{dep: "email", expected: false},
+	} {
+		t.Run(tc.dep, func(t *testing.T) {
+			assert.Equal(t, tc.expected, templateDeps.Uses(tc.dep))
+		})
+	}
+}
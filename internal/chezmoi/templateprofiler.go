@@ -0,0 +1,105 @@
+package chezmoi
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// A TemplateProfileKind is the kind of a template profile entry.
+type TemplateProfileKind string
+
+// Template profile kinds.
+const (
+	TemplateProfileKindFunction TemplateProfileKind = "function"
+	TemplateProfileKindInclude  TemplateProfileKind = "include"
+	TemplateProfileKindTemplate TemplateProfileKind = "template"
+)
+
+// A TemplateProfileEntry records the time spent in a template, an included
+// file or template, or a template function.
+type TemplateProfileEntry struct {
+	Kind  TemplateProfileKind `json:"kind"  yaml:"kind"`
+	Name  string              `json:"name"  yaml:"name"`
+	Count int                 `json:"count" yaml:"count"`
+	Total time.Duration       `json:"total" yaml:"total"`
+	Max   time.Duration       `json:"max"   yaml:"max"`
+}
+
+type templateProfileKey struct {
+	kind TemplateProfileKind
+	name string
+}
+
+// A TemplateProfiler records the wall time spent executing templates. The zero
+// value is not usable, but a nil *TemplateProfiler records nothing.
+type TemplateProfiler struct {
+	mutex   sync.Mutex
+	entries map[templateProfileKey]*TemplateProfileEntry
+	now     func() time.Time
+}
+
+// NewTemplateProfiler returns a new TemplateProfiler that uses now to get the
+// current time.
+func NewTemplateProfiler(now func() time.Time) *TemplateProfiler {
+	return &TemplateProfiler{
+		entries: make(map[templateProfileKey]*TemplateProfileEntry),
+		now:     now,
+	}
+}
+
+// Start starts timing name of kind and returns a function that stops timing
+// it.
+func (p *TemplateProfiler) Start(kind TemplateProfileKind, name string) func() {
+	if p == nil {
+		return func() {}
+	}
+	start := p.now()
+	return func() {
+		p.Record(kind, name, p.now().Sub(start))
+	}
+}
+
+// Record records that name of kind took duration.
+func (p *TemplateProfiler) Record(kind TemplateProfileKind, name string, duration time.Duration) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	key := templateProfileKey{
+		kind: kind,
+		name: name,
+	}
+	entry, ok := p.entries[key]
+	if !ok {
+		entry = &TemplateProfileEntry{
+			Kind: kind,
+			Name: name,
+		}
+		p.entries[key] = entry
+	}
+	entry.Count++
+	entry.Total += duration
+	entry.Max = max(entry.Max, duration)
+}
+
+// Entries returns all entries, slowest first.
+func (p *TemplateProfiler) Entries() []*TemplateProfileEntry {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	entries := make([]*TemplateProfileEntry, 0, len(p.entries))
+	for _, entry := range p.entries {
+		entryCopy := *entry
+		entries = append(entries, &entryCopy)
+	}
+	slices.SortFunc(entries, func(a, b *TemplateProfileEntry) int {
+		return cmp.Or(
+			-cmp.Compare(a.Total, b.Total),
+			cmp.Compare(a.Kind, b.Kind),
+			cmp.Compare(a.Name, b.Name),
+		)
+	})
+	return entries
+}
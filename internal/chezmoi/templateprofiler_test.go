@@ -0,0 +1,52 @@
+package chezmoi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestTemplateProfiler(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := NewTemplateProfiler(func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	})
+
+	stopTemplate := p.Start(TemplateProfileKindTemplate, "dot_file.tmpl")
+	p.Record(TemplateProfileKindFunction, "output git", 3*time.Millisecond)
+	p.Record(TemplateProfileKindFunction, "output git", 5*time.Millisecond)
+	p.Record(TemplateProfileKindInclude, "includeTemplate header", 2*time.Millisecond)
+	stopTemplate()
+
+	assert.Equal(t, []*TemplateProfileEntry{
+		{
+			Kind:  TemplateProfileKindFunction,
+			Name:  "output git",
+			Count: 2,
+			Total: 8 * time.Millisecond,
+			Max:   5 * time.Millisecond,
+		},
+		{
+			Kind:  TemplateProfileKindInclude,
+			Name:  "includeTemplate header",
+			Count: 1,
+			Total: 2 * time.Millisecond,
+			Max:   2 * time.Millisecond,
+		},
+		{
+			Kind:  TemplateProfileKindTemplate,
+			Name:  "dot_file.tmpl",
+			Count: 1,
+			Total: time.Millisecond,
+			Max:   time.Millisecond,
+		},
+	}, p.Entries())
+}
+
+func TestNilTemplateProfiler(t *testing.T) {
+	var p *TemplateProfiler
+	p.Start(TemplateProfileKindTemplate, "dot_file.tmpl")()
+	p.Record(TemplateProfileKindFunction, "output", time.Second)
+}
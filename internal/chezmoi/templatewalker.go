@@ -0,0 +1,158 @@
+package chezmoi
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"text/template/parse"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoiset"
+)
+
+// guardTemplateFuncs are template functions whose arguments are allowed to
+// reference undefined template data.
+var guardTemplateFuncs = chezmoiset.New(
+	"coalesce",
+	"default",
+	"dig",
+	"empty",
+	"hasKey",
+	"kindIs",
+	"typeIs",
+)
+
+// A templateWalker walks a template parse tree and calls its functions for each
+// reference to template data, a template, or a template function.
+//
+// References to template data are guarded if the enclosing pipeline is the
+// condition of an if, range, or with action, or passes the data to a function
+// that checks for its existence, or if the top-level key is referenced in the
+// condition of an enclosing if or with action.
+type templateWalker struct {
+	tree         *parse.Tree
+	rootIsData   bool
+	dataFunc     func(node parse.Node, ident []string, guarded bool)
+	funcFunc     func(cmd *parse.CommandNode, name string, dotIsData bool)
+	templateFunc func(node *parse.TemplateNode, dotIsData bool)
+}
+
+// walk walks w.tree. dotIsData is true if dot is the template data, and also
+// sets whether $ is the template data.
+func (w *templateWalker) walk(dotIsData bool) {
+	if w.tree == nil || w.tree.Root == nil {
+		return
+	}
+	w.rootIsData = dotIsData
+	w.walkNode(w.tree.Root, dotIsData, chezmoiset.New[string]())
+}
+
+// line returns the line number of node.
+func (w *templateWalker) line(node parse.Node) int {
+	location, _ := w.tree.ErrorContext(node)
+	fields := strings.Split(location, ":")
+	if len(fields) < 3 {
+		return 0
+	}
+	line, _ := strconv.Atoi(fields[len(fields)-2])
+	return line
+}
+
+// walkNode walks node. guards contains the top-level template data keys that
+// are referenced by the condition of an enclosing if or with action.
+func (w *templateWalker) walkNode(node parse.Node, dotIsData bool, guards chezmoiset.Set[string]) {
+	switch node := node.(type) {
+	case *parse.ActionNode:
+		w.walkPipe(node.Pipe, dotIsData, false, guards)
+	case *parse.IfNode:
+		w.walkBranch(&node.BranchNode, dotIsData, dotIsData, guards)
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			w.walkNode(child, dotIsData, guards)
+		}
+	case *parse.RangeNode:
+		w.walkBranch(&node.BranchNode, dotIsData, false, guards)
+	case *parse.TemplateNode:
+		templateDotIsData := false
+		if node.Pipe != nil {
+			w.walkPipe(node.Pipe, dotIsData, false, guards)
+			if len(node.Pipe.Cmds) == 1 && len(node.Pipe.Cmds[0].Args) == 1 {
+				_, isDot := node.Pipe.Cmds[0].Args[0].(*parse.DotNode)
+				templateDotIsData = isDot && dotIsData
+			}
+		}
+		if w.templateFunc != nil {
+			w.templateFunc(node, templateDotIsData)
+		}
+	case *parse.WithNode:
+		w.walkBranch(&node.BranchNode, dotIsData, false, guards)
+	}
+}
+
+// walkBranch walks an if, range, or with action. listDotIsData is true if dot
+// is the template data in the action's list.
+func (w *templateWalker) walkBranch(node *parse.BranchNode, dotIsData, listDotIsData bool, guards chezmoiset.Set[string]) {
+	w.walkPipe(node.Pipe, dotIsData, true, guards)
+	branchGuards := chezmoiset.New(slices.Collect(guards.Elements())...)
+	for _, cmd := range node.Pipe.Cmds {
+		for _, arg := range cmd.Args {
+			switch arg := arg.(type) {
+			case *parse.FieldNode:
+				branchGuards.Add(arg.Ident[0])
+			case *parse.StringNode:
+				branchGuards.Add(arg.Text)
+			case *parse.VariableNode:
+				if len(arg.Ident) > 1 && arg.Ident[0] == "$" {
+					branchGuards.Add(arg.Ident[1])
+				}
+			}
+		}
+	}
+	w.walkNode(node.List, listDotIsData, branchGuards)
+	w.walkNode(node.ElseList, dotIsData, branchGuards)
+}
+
+// walkPipe walks a pipeline.
+func (w *templateWalker) walkPipe(pipe *parse.PipeNode, dotIsData, guarded bool, guards chezmoiset.Set[string]) {
+	if pipe == nil {
+		return
+	}
+	for _, cmd := range pipe.Cmds {
+		if identifier, ok := cmd.Args[0].(*parse.IdentifierNode); ok && guardTemplateFuncs.Contains(identifier.Ident) {
+			guarded = true
+		}
+	}
+	for _, cmd := range pipe.Cmds {
+		w.walkCommand(cmd, dotIsData, guarded, guards)
+	}
+}
+
+// walkCommand walks a command.
+func (w *templateWalker) walkCommand(cmd *parse.CommandNode, dotIsData, guarded bool, guards chezmoiset.Set[string]) {
+	if identifier, ok := cmd.Args[0].(*parse.IdentifierNode); ok && w.funcFunc != nil {
+		w.funcFunc(cmd, identifier.Ident, dotIsData)
+	}
+	for _, arg := range cmd.Args {
+		w.walkArg(arg, dotIsData, guarded, guards)
+	}
+}
+
+// walkArg walks an argument of a command.
+func (w *templateWalker) walkArg(arg parse.Node, dotIsData, guarded bool, guards chezmoiset.Set[string]) {
+	switch arg := arg.(type) {
+	case *parse.ChainNode:
+		w.walkArg(arg.Node, dotIsData, guarded, guards)
+	case *parse.FieldNode:
+		if dotIsData && w.dataFunc != nil {
+			w.dataFunc(arg, arg.Ident, guarded || guards.Contains(arg.Ident[0]))
+		}
+	case *parse.PipeNode:
+		w.walkPipe(arg, dotIsData, guarded, guards)
+	case *parse.VariableNode:
+		if w.rootIsData && len(arg.Ident) > 1 && arg.Ident[0] == "$" && w.dataFunc != nil {
+			w.dataFunc(arg, arg.Ident[1:], guarded || guards.Contains(arg.Ident[1]))
+		}
+	}
+}
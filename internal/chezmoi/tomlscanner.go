@@ -0,0 +1,302 @@
+package chezmoi
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+var errInvalidTOML = errors.New("invalid TOML")
+
+// A tomlScanner finds the spans of the scalar values in a TOML document. It
+// only handles documents that are valid TOML.
+type tomlScanner struct {
+	data   []byte
+	offset int
+	spans  []valueSpan
+}
+
+// tomlValueSpans returns the spans of all scalar values in the TOML data.
+func tomlValueSpans(data []byte) ([]valueSpan, error) {
+	var value map[string]any
+	if err := FormatTOML.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+
+	s := &tomlScanner{
+		data: data,
+	}
+
+	// Track the number of elements in each array of tables so that values in
+	// different elements have different paths.
+	var tablePath string
+	arrayTableLengths := make(map[string]int)
+	setTablePath := func(keys []string, arrayTable bool) {
+		tablePath = ""
+		for i, key := range keys {
+			tablePath += "/" + key
+			if arrayTable && i == len(keys)-1 {
+				arrayTableLengths[tablePath]++
+			}
+			if length, ok := arrayTableLengths[tablePath]; ok {
+				tablePath += "/" + strconv.Itoa(length-1)
+			}
+		}
+	}
+
+	for {
+		s.skipBlankLinesAndComments()
+		switch {
+		case s.offset == len(s.data):
+			return s.spans, nil
+		case s.hasPrefix("[["):
+			s.offset += 2
+			keys, err := s.scanKey()
+			if err != nil {
+				return nil, err
+			}
+			if err := s.expect("]]"); err != nil {
+				return nil, err
+			}
+			setTablePath(keys, true)
+		case s.hasPrefix("["):
+			s.offset++
+			keys, err := s.scanKey()
+			if err != nil {
+				return nil, err
+			}
+			if err := s.expect("]"); err != nil {
+				return nil, err
+			}
+			setTablePath(keys, false)
+		default:
+			if err := s.scanKeyValue(tablePath); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// expect skips whitespace and then s.
+func (s *tomlScanner) expect(str string) error {
+	s.skipWhitespace()
+	if !s.hasPrefix(str) {
+		return errInvalidTOML
+	}
+	s.offset += len(str)
+	return nil
+}
+
+// hasPrefix returns if the unscanned data starts with prefix.
+func (s *tomlScanner) hasPrefix(prefix string) bool {
+	return bytes.HasPrefix(s.data[s.offset:], []byte(prefix))
+}
+
+// peek returns the next unscanned byte, or zero if all data has been scanned.
+func (s *tomlScanner) peek() byte {
+	if s.offset == len(s.data) {
+		return 0
+	}
+	return s.data[s.offset]
+}
+
+// scanKey scans a possibly dotted key and returns its parts.
+func (s *tomlScanner) scanKey() ([]string, error) {
+	var keys []string
+	for {
+		s.skipWhitespace()
+		start := s.offset
+		var key string
+		switch s.peek() {
+		case '"':
+			if err := s.scanString('"', true); err != nil {
+				return nil, err
+			}
+			var err error
+			if key, err = strconv.Unquote(string(s.data[start:s.offset])); err != nil {
+				key = string(s.data[start:s.offset])
+			}
+		case '\'':
+			if err := s.scanString('\'', false); err != nil {
+				return nil, err
+			}
+			key = string(s.data[start+1 : s.offset-1])
+		default:
+			for s.offset < len(s.data) && isTOMLBareKeyChar(s.data[s.offset]) {
+				s.offset++
+			}
+			if s.offset == start {
+				return nil, errInvalidTOML
+			}
+			key = string(s.data[start:s.offset])
+		}
+		keys = append(keys, key)
+		s.skipWhitespace()
+		if s.peek() != '.' {
+			return keys, nil
+		}
+		s.offset++
+	}
+}
+
+// scanKeyValue scans a key/value pair in the table with path.
+func (s *tomlScanner) scanKeyValue(path string) error {
+	keys, err := s.scanKey()
+	if err != nil {
+		return err
+	}
+	if err := s.expect("="); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		path += "/" + key
+	}
+	s.skipWhitespace()
+	return s.scanValue(path)
+}
+
+// scanMultilineString scans a multi-line string delimited by three quotes. If
+// escapes is true then backslash escapes are interpreted.
+func (s *tomlScanner) scanMultilineString(quote byte, escapes bool) error {
+	delimiter := string([]byte{quote, quote, quote})
+	s.offset += len(delimiter)
+	for s.offset < len(s.data) {
+		switch {
+		case escapes && s.data[s.offset] == '\\':
+			s.offset += 2
+		case s.hasPrefix(delimiter):
+			s.offset += len(delimiter)
+			// Up to two quotes can precede the closing delimiter.
+			for range 2 {
+				if s.peek() == quote {
+					s.offset++
+				}
+			}
+			return nil
+		default:
+			s.offset++
+		}
+	}
+	return errInvalidTOML
+}
+
+// scanString scans a single-line string delimited by quote. If escapes is true
+// then backslash escapes are interpreted.
+func (s *tomlScanner) scanString(quote byte, escapes bool) error {
+	s.offset++
+	for s.offset < len(s.data) {
+		switch s.data[s.offset] {
+		case '\\':
+			if escapes {
+				s.offset++
+			}
+			s.offset++
+		case quote:
+			s.offset++
+			return nil
+		default:
+			s.offset++
+		}
+	}
+	return errInvalidTOML
+}
+
+// scanValue scans the value with path.
+func (s *tomlScanner) scanValue(path string) error {
+	start := s.offset
+	switch {
+	case s.hasPrefix(`"""`):
+		if err := s.scanMultilineString('"', true); err != nil {
+			return err
+		}
+	case s.hasPrefix(`'''`):
+		if err := s.scanMultilineString('\'', false); err != nil {
+			return err
+		}
+	case s.peek() == '"':
+		if err := s.scanString('"', true); err != nil {
+			return err
+		}
+	case s.peek() == '\'':
+		if err := s.scanString('\'', false); err != nil {
+			return err
+		}
+	case s.peek() == '[':
+		s.offset++
+		for i := 0; ; i++ {
+			s.skipBlankLinesAndComments()
+			if s.peek() == ']' {
+				s.offset++
+				return nil
+			}
+			if err := s.scanValue(path + "/" + strconv.Itoa(i)); err != nil {
+				return err
+			}
+			s.skipBlankLinesAndComments()
+			if s.peek() == ',' {
+				s.offset++
+			}
+		}
+	case s.peek() == '{':
+		s.offset++
+		for {
+			s.skipBlankLinesAndComments()
+			if s.peek() == '}' {
+				s.offset++
+				return nil
+			}
+			if err := s.scanKeyValue(path); err != nil {
+				return err
+			}
+			s.skipBlankLinesAndComments()
+			if s.peek() == ',' {
+				s.offset++
+			}
+		}
+	default:
+		// Booleans, numbers, and dates and times, which can contain spaces.
+		for s.offset < len(s.data) && bytes.IndexByte([]byte(",]}#\r\n"), s.data[s.offset]) == -1 {
+			s.offset++
+		}
+		for s.offset > start && (s.data[s.offset-1] == ' ' || s.data[s.offset-1] == '\t') {
+			s.offset--
+		}
+		if s.offset == start {
+			return errInvalidTOML
+		}
+	}
+	s.spans = append(s.spans, valueSpan{
+		path:  path,
+		start: start,
+		end:   s.offset,
+	})
+	return nil
+}
+
+// skipBlankLinesAndComments skips whitespace, newlines, and comments.
+func (s *tomlScanner) skipBlankLinesAndComments() {
+	for s.offset < len(s.data) {
+		switch s.data[s.offset] {
+		case ' ', '\t', '\r', '\n':
+			s.offset++
+		case '#':
+			for s.offset < len(s.data) && s.data[s.offset] != '\n' {
+				s.offset++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// skipWhitespace skips spaces and tabs.
+func (s *tomlScanner) skipWhitespace() {
+	for s.offset < len(s.data) && (s.data[s.offset] == ' ' || s.data[s.offset] == '\t') {
+		s.offset++
+	}
+}
+
+// isTOMLBareKeyChar returns if c can appear in a bare TOML key.
+func isTOMLBareKeyChar(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '_' || c == '-'
+}
@@ -0,0 +1,188 @@
+package chezmoi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Extended attribute names and prefixes.
+const (
+	posixACLAccessXattr  = "system.posix_acl_access"
+	posixACLDefaultXattr = "system.posix_acl_default"
+	securityXattrPrefix  = "security."
+	userXattrPrefix      = "user."
+)
+
+// xattrsFileHeaderPrefix is the prefix of the line that introduces the
+// extended attributes of a target in a .chezmoixattrs file.
+const xattrsFileHeaderPrefix = "# file: "
+
+// isManagedXattr returns true if the extended attribute name is managed by
+// chezmoi. chezmoi manages attributes in the user and security namespaces and
+// POSIX ACLs.
+func isManagedXattr(name string) bool {
+	switch {
+	case strings.HasPrefix(name, userXattrPrefix):
+		return true
+	case strings.HasPrefix(name, securityXattrPrefix):
+		return true
+	case name == posixACLAccessXattr || name == posixACLDefaultXattr:
+		return true
+	default:
+		return false
+	}
+}
+
+// xattrsEqual returns true if xattrs1 and xattrs2 are equal. Attributes in the
+// security namespace are only compared if they are present in both, as they
+// can only be set where permitted.
+func xattrsEqual(xattrs1, xattrs2 map[string]HexBytes) bool {
+	for name, value1 := range xattrs1 {
+		value2, ok := xattrs2[name]
+		switch {
+		case !ok && strings.HasPrefix(name, securityXattrPrefix):
+		case !ok:
+			return false
+		case !bytes.Equal(value1, value2):
+			return false
+		}
+	}
+	for name := range xattrs2 {
+		if _, ok := xattrs1[name]; !ok && !strings.HasPrefix(name, securityXattrPrefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// xattrsHexBytes returns xattrs with values converted to HexBytes.
+func xattrsHexBytes(xattrs map[string][]byte) map[string]HexBytes {
+	if xattrs == nil {
+		return nil
+	}
+	result := make(map[string]HexBytes, len(xattrs))
+	for name, value := range xattrs {
+		result[name] = value
+	}
+	return result
+}
+
+// xattrsChanges returns the changes needed to change actualXattrs to xattrs,
+// with nil values for attributes that should be removed. Attributes in the
+// security namespace are never removed.
+func xattrsChanges(xattrs, actualXattrs map[string][]byte) map[string][]byte {
+	changes := make(map[string][]byte)
+	for name, value := range xattrs {
+		if actualValue, ok := actualXattrs[name]; !ok || !bytes.Equal(actualValue, value) {
+			changes[name] = value
+		}
+	}
+	for name := range actualXattrs {
+		if _, ok := xattrs[name]; !ok && !strings.HasPrefix(name, securityXattrPrefix) {
+			changes[name] = nil
+		}
+	}
+	return changes
+}
+
+// parseXattrsFile parses the contents of a .chezmoixattrs file. The format is
+// the same as the output of getfattr --dump: each target is introduced by a
+// line "# file: name" followed by lines "attr=value". Values are quoted
+// strings, or hex or base64 encoded with a 0x or 0s prefix respectively.
+func parseXattrsFile(data []byte) (map[RelPath]map[string][]byte, error) {
+	result := make(map[RelPath]map[string][]byte)
+	var xattrs map[string][]byte
+	lineNumber := 0
+	for line := range bytes.Lines(data) {
+		lineNumber++
+		line = bytes.TrimSpace(line)
+		switch {
+		case len(line) == 0:
+			continue
+		case bytes.HasPrefix(line, []byte(xattrsFileHeaderPrefix)):
+			name := string(line[len(xattrsFileHeaderPrefix):])
+			if _, err := NewUntrustedRelPath(name); err != nil {
+				return nil, fmt.Errorf("%d: %w", lineNumber, err)
+			}
+			xattrs = make(map[string][]byte)
+			result[NewRelPath(name)] = xattrs
+			continue
+		case line[0] == '#':
+			continue
+		case xattrs == nil:
+			return nil, fmt.Errorf("%d: attribute before file", lineNumber)
+		}
+		name, encodedValue, ok := bytes.Cut(line, []byte{'='})
+		if !ok {
+			return nil, fmt.Errorf("%d: expected attr=value", lineNumber)
+		}
+		if !isManagedXattr(string(name)) {
+			return nil, fmt.Errorf("%d: %s: unsupported attribute", lineNumber, name)
+		}
+		value, err := decodeXattrValue(string(encodedValue))
+		if err != nil {
+			return nil, fmt.Errorf("%d: %s: %w", lineNumber, name, err)
+		}
+		xattrs[string(name)] = value
+	}
+	return result, nil
+}
+
+// formatXattrsFile returns the contents of a .chezmoixattrs file containing
+// xattrsByRelPath. Targets without extended attributes are omitted.
+func formatXattrsFile(xattrsByRelPath map[RelPath]map[string][]byte) []byte {
+	var buffer bytes.Buffer
+	for _, relPath := range slices.SortedFunc(maps.Keys(xattrsByRelPath), CompareRelPaths) {
+		xattrs := xattrsByRelPath[relPath]
+		if len(xattrs) == 0 {
+			continue
+		}
+		if buffer.Len() != 0 {
+			buffer.WriteByte('\n')
+		}
+		buffer.WriteString(xattrsFileHeaderPrefix + relPath.String() + "\n")
+		for _, name := range slices.Sorted(maps.Keys(xattrs)) {
+			buffer.WriteString(name + "=" + encodeXattrValue(xattrs[name]) + "\n")
+		}
+	}
+	return buffer.Bytes()
+}
+
+// decodeXattrValue decodes an extended attribute value encoded by
+// encodeXattrValue or getfattr.
+func decodeXattrValue(s string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		value, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, value...), nil
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		return hex.DecodeString(s[2:])
+	case strings.HasPrefix(s, "0s") || strings.HasPrefix(s, "0S"):
+		return base64.StdEncoding.DecodeString(s[2:])
+	default:
+		return nil, errors.New("invalid value")
+	}
+}
+
+// encodeXattrValue encodes value as a quoted string if it is printable text,
+// or as base64 otherwise.
+func encodeXattrValue(value []byte) string {
+	if utf8.Valid(value) && !bytes.ContainsFunc(value, func(r rune) bool {
+		return !unicode.IsPrint(r)
+	}) {
+		return strconv.Quote(string(value))
+	}
+	return "0s" + base64.StdEncoding.EncodeToString(value)
+}
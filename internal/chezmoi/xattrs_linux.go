@@ -0,0 +1,93 @@
+package chezmoi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// lgetxattrs returns the managed extended attributes of name, without
+// following symlinks.
+func lgetxattrs(name string) (map[string][]byte, error) {
+	size, err := unix.Llistxattr(name, nil)
+	switch {
+	case errors.Is(err, unix.ENOTSUP):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	xattrs := make(map[string][]byte)
+	if size == 0 {
+		return xattrs, nil
+	}
+	buffer := make([]byte, size)
+	size, err = unix.Llistxattr(name, buffer)
+	if err != nil {
+		return nil, err
+	}
+	for attr := range bytes.SplitSeq(bytes.TrimSuffix(buffer[:size], []byte{0}), []byte{0}) {
+		attrName := string(attr)
+		if !isManagedXattr(attrName) {
+			continue
+		}
+		value, err := lgetxattr(name, attrName)
+		switch {
+		case errors.Is(err, unix.ENODATA):
+			continue
+		case errors.Is(err, unix.EPERM) && strings.HasPrefix(attrName, securityXattrPrefix):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		xattrs[attrName] = value
+	}
+	return xattrs, nil
+}
+
+// lgetxattr returns the value of the extended attribute attr of name, without
+// following symlinks.
+func lgetxattr(name, attr string) ([]byte, error) {
+	for {
+		size, err := unix.Lgetxattr(name, attr, nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, size)
+		switch size, err := unix.Lgetxattr(name, attr, value); {
+		case errors.Is(err, unix.ERANGE):
+			// The value grew between the two calls, so try again.
+			continue
+		case err != nil:
+			return nil, err
+		default:
+			return value[:size], nil
+		}
+	}
+}
+
+// lsetxattrs sets the extended attributes of name to xattrs, without following
+// symlinks. Attributes with nil values are removed. Errors setting attributes
+// in the security namespace are ignored if the operation is not permitted.
+func lsetxattrs(name string, xattrs map[string][]byte) error {
+	for attr, value := range xattrs {
+		var err error
+		if value == nil {
+			if err = unix.Lremovexattr(name, attr); errors.Is(err, unix.ENODATA) {
+				err = nil
+			}
+		} else {
+			err = unix.Lsetxattr(name, attr, value, 0)
+		}
+		switch {
+		case err == nil:
+		case strings.HasPrefix(attr, securityXattrPrefix) && (errors.Is(err, unix.EPERM) || errors.Is(err, unix.ENOTSUP)):
+		default:
+			return &fs.PathError{Op: "setxattr", Path: name, Err: fmt.Errorf("%s: %w", attr, err)}
+		}
+	}
+	return nil
+}
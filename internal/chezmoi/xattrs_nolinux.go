@@ -0,0 +1,13 @@
+//go:build !linux
+
+package chezmoi
+
+// lgetxattrs returns nil as extended attributes are only managed on Linux.
+func lgetxattrs(name string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+// lsetxattrs does nothing as extended attributes are only managed on Linux.
+func lsetxattrs(name string, xattrs map[string][]byte) error {
+	return nil
+}
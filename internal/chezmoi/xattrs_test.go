@@ -0,0 +1,173 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoitest"
+)
+
+func TestParseXattrsFile(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		data          string
+		expected      map[RelPath]map[string][]byte
+		expectedErr   string
+		skipRoundTrip bool
+	}{
+		{
+			name:     "empty",
+			expected: map[RelPath]map[string][]byte{},
+		},
+		{
+			name: "encodings",
+			data: chezmoitest.JoinLines(
+				"# file: .dir/file",
+				`user.base64=0sAAEC`,
+				`user.hex=0x000102`,
+				`user.text="value"`,
+				"",
+				"# file: .file",
+				`system.posix_acl_access=0sAgAAAA==`,
+			),
+			expected: map[RelPath]map[string][]byte{
+				NewRelPath(".dir/file"): {
+					"user.base64": {0, 1, 2},
+					"user.hex":    {0, 1, 2},
+					"user.text":   []byte("value"),
+				},
+				NewRelPath(".file"): {
+					"system.posix_acl_access": {2, 0, 0, 0},
+				},
+			},
+			skipRoundTrip: true,
+		},
+		{
+			name: "round_trip",
+			data: chezmoitest.JoinLines(
+				"# file: .dir",
+				`security.selinux="unconfined_u:object_r:user_home_t:s0"`,
+				`user.empty=""`,
+				"",
+				"# file: .file",
+				`user.binary=0sAAEC`,
+			),
+			expected: map[RelPath]map[string][]byte{
+				NewRelPath(".dir"): {
+					"security.selinux": []byte("unconfined_u:object_r:user_home_t:s0"),
+					"user.empty":       {},
+				},
+				NewRelPath(".file"): {
+					"user.binary": {0, 1, 2},
+				},
+			},
+		},
+		{
+			name: "attribute_before_file",
+			data: chezmoitest.JoinLines(
+				`user.text="value"`,
+			),
+			expectedErr: "1: attribute before file",
+		},
+		{
+			name: "unsupported_attribute",
+			data: chezmoitest.JoinLines(
+				"# file: .file",
+				`trusted.text="value"`,
+			),
+			expectedErr: "2: trusted.text: unsupported attribute",
+		},
+		{
+			name: "invalid_value",
+			data: chezmoitest.JoinLines(
+				"# file: .file",
+				`user.text=value`,
+			),
+			expectedErr: "2: user.text: invalid value",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := parseXattrsFile([]byte(tc.data))
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+			if !tc.skipRoundTrip {
+				assert.Equal(t, tc.data, string(formatXattrsFile(actual)))
+			}
+		})
+	}
+}
+
+func TestXattrsChanges(t *testing.T) {
+	assert.Equal(t, map[string][]byte{
+		"user.changed": []byte("new"),
+		"user.new":     []byte("new"),
+		"user.removed": nil,
+	}, xattrsChanges(map[string][]byte{
+		"user.changed":   []byte("new"),
+		"user.new":       []byte("new"),
+		"user.unchanged": []byte("value"),
+	}, map[string][]byte{
+		"security.selinux": []byte("value"),
+		"user.changed":     []byte("old"),
+		"user.removed":     []byte("old"),
+		"user.unchanged":   []byte("value"),
+	}))
+}
+
+func TestXattrsEqual(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		xattrs1  map[string]HexBytes
+		xattrs2  map[string]HexBytes
+		expected bool
+	}{
+		{
+			name:     "empty",
+			expected: true,
+		},
+		{
+			name:     "equal",
+			xattrs1:  map[string]HexBytes{"user.a": {1}},
+			xattrs2:  map[string]HexBytes{"user.a": {1}},
+			expected: true,
+		},
+		{
+			name:    "different_value",
+			xattrs1: map[string]HexBytes{"user.a": {1}},
+			xattrs2: map[string]HexBytes{"user.a": {2}},
+		},
+		{
+			name:    "missing",
+			xattrs1: map[string]HexBytes{"user.a": {1}},
+		},
+		{
+			name:    "extra",
+			xattrs2: map[string]HexBytes{"user.a": {1}},
+		},
+		{
+			name:     "security_missing",
+			xattrs1:  map[string]HexBytes{"security.selinux": {1}},
+			expected: true,
+		},
+		{
+			name:     "security_extra",
+			xattrs2:  map[string]HexBytes{"security.selinux": {1}},
+			expected: true,
+		},
+		{
+			name:    "security_different_value",
+			xattrs1: map[string]HexBytes{"security.selinux": {1}},
+			xattrs2: map[string]HexBytes{"security.selinux": {2}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, xattrsEqual(tc.xattrs1, tc.xattrs2))
+			assert.Equal(t, tc.expected, xattrsEqual(tc.xattrs2, tc.xattrs1))
+		})
+	}
+}
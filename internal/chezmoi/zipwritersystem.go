@@ -16,6 +16,13 @@ type ZIPWriterSystem struct {
 
 	zipWriter *zip.Writer
 	modified  time.Time
+	files     map[AbsPath]zipWriterSystemFile
+}
+
+// A zipWriterSystemFile is a file written to a ZIP archive.
+type zipWriterSystemFile struct {
+	data []byte
+	perm fs.FileMode
 }
 
 // NewZIPWriterSystem returns a new ZIPWriterSystem that writes a ZIP archive to
@@ -24,14 +31,41 @@ func NewZIPWriterSystem(w io.Writer, modified time.Time) *ZIPWriterSystem {
 	return &ZIPWriterSystem{
 		zipWriter: zip.NewWriter(w),
 		modified:  modified,
+		files:     make(map[AbsPath]zipWriterSystemFile),
 	}
 }
 
+// Chown implements System.Chown. Ownership is not recorded in archives.
+func (s *ZIPWriterSystem) Chown(name AbsPath, uid, gid int) error {
+	return nil
+}
+
 // Close closes m.
 func (s *ZIPWriterSystem) Close() error {
 	return s.zipWriter.Close()
 }
 
+// Link implements System.Link. ZIP archives do not support hard links, so
+// newName is written as a copy of oldName, which must already have been written
+// to the archive.
+func (s *ZIPWriterSystem) Link(oldName, newName AbsPath) error {
+	file, ok := s.files[oldName]
+	if !ok {
+		return &fs.PathError{
+			Op:   "link",
+			Path: oldName.String(),
+			Err:  fs.ErrNotExist,
+		}
+	}
+	return s.WriteFile(newName, file.data, file.perm)
+}
+
+// Lsetxattrs implements System.Lsetxattrs. Extended attributes are not
+// recorded in archives.
+func (s *ZIPWriterSystem) Lsetxattrs(name AbsPath, xattrs map[string][]byte) error {
+	return nil
+}
+
 // Mkdir implements System.Mkdir.
 func (s *ZIPWriterSystem) Mkdir(name AbsPath, perm fs.FileMode) error {
 	fileHeader := zip.FileHeader{
@@ -66,8 +100,14 @@ func (s *ZIPWriterSystem) WriteFile(filename AbsPath, data []byte, perm fs.FileM
 	if err != nil {
 		return err
 	}
-	_, err = fileWriter.Write(data)
-	return err
+	if _, err := fileWriter.Write(data); err != nil {
+		return err
+	}
+	s.files[filename] = zipWriterSystemFile{
+		data: data,
+		perm: perm,
+	}
+	return nil
 }
 
 // WriteSymlink implements System.WriteSymlink.
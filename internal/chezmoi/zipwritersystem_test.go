@@ -30,8 +30,9 @@ func TestZIPWriterSystem(t *testing.T) {
 			"dot_dir": map[string]any{
 				"file": "# contents of .dir/file\n",
 			},
-			"run_script":      "# contents of script\n",
-			"symlink_symlink": ".dir/subdir/file\n",
+			"hardlink_hardlink": ".dir/file\n",
+			"run_script":        "# contents of script\n",
+			"symlink_symlink":   ".dir/subdir/file\n",
 		},
 	}, func(fileSystem vfs.FS) {
 		ctx := t.Context()
@@ -88,6 +89,12 @@ func TestZIPWriterSystem(t *testing.T) {
 				mode:     fs.ModeSymlink,
 				contents: []byte(".dir/subdir/file"),
 			},
+			{
+				name:     "hardlink",
+				method:   zip.Deflate,
+				mode:     0o666 &^ chezmoitest.Umask,
+				contents: []byte("# contents of .dir/file\n"),
+			},
 		}
 		assert.Equal(t, len(expectedFiles), len(r.File))
 		for i, expectedFile := range expectedFiles {
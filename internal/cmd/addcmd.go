@@ -27,11 +27,14 @@ var severityValues = []string{
 }
 
 type addCmdConfig struct {
+	AttributesFile   bool        `json:"attributesFile"   mapstructure:"attributesFile"   yaml:"attributesFile"`
 	Encrypt          bool        `json:"encrypt"          mapstructure:"encrypt"          yaml:"encrypt"`
 	Secrets          *choiceFlag `json:"secrets"          mapstructure:"secrets"          yaml:"secrets"`
 	TemplateSymlinks bool        `json:"templateSymlinks" mapstructure:"templateSymlinks" yaml:"templateSymlinks"`
+	Xattrs           bool        `json:"xattrs"           mapstructure:"xattrs"           yaml:"xattrs"`
 	autoTemplate     bool
 	create           bool
+	encryption       *choiceFlag
 	exact            bool
 	filter           *chezmoi.EntryTypeFilter
 	follow           bool
@@ -60,10 +63,14 @@ func (c *Config) newAddCmd() *cobra.Command {
 		),
 	}
 
+	addCmd.Flags().
+		BoolVar(&c.Add.AttributesFile, "attributes-file", c.Add.AttributesFile, "Record attributes in .chezmoiattributes")
 	addCmd.Flags().
 		BoolVarP(&c.Add.autoTemplate, "autotemplate", "a", c.Add.autoTemplate, "Generate the template when adding files as templates")
 	addCmd.Flags().BoolVar(&c.Add.create, "create", c.Add.create, "Add files that should exist, irrespective of their contents")
 	addCmd.Flags().BoolVar(&c.Add.Encrypt, "encrypt", c.Add.Encrypt, "Encrypt files")
+	addCmd.Flags().Var(c.Add.encryption, "encryption", "Encryption for encrypted files")
+	must(addCmd.RegisterFlagCompletionFunc("encryption", c.Add.encryption.FlagCompletionFunc()))
 	addCmd.Flags().BoolVar(&c.Add.exact, "exact", c.Add.exact, "Add directories exactly")
 	addCmd.Flags().VarP(c.Add.filter.Exclude, "exclude", "x", "Exclude entry types")
 	addCmd.Flags().BoolVarP(&c.Add.follow, "follow", "f", c.Add.follow, "Add symlink targets instead of symlinks")
@@ -77,6 +84,7 @@ func (c *Config) newAddCmd() *cobra.Command {
 	addCmd.Flags().BoolVarP(&c.Add.template, "template", "T", c.Add.template, "Add files as templates")
 	addCmd.Flags().
 		BoolVar(&c.Add.TemplateSymlinks, "template-symlinks", c.Add.TemplateSymlinks, "Add symlinks with target in source or home dirs as templates")
+	addCmd.Flags().BoolVar(&c.Add.Xattrs, "xattrs", c.Add.Xattrs, "Add extended attributes and ACLs")
 
 	return addCmd
 }
@@ -200,6 +208,18 @@ func (c *Config) runAddCmd(cmd *cobra.Command, args []string, sourceState *chezm
 		return fmt.Errorf("%s: invalid severity", severity)
 	}
 
+	var encryption chezmoi.Encryption
+	if c.Add.encryption.String() != "" {
+		if !c.Add.Encrypt {
+			return errors.New("--encryption requires --encrypt")
+		}
+		var err error
+		encryption, err = c.encryptionNamed(c.Add.encryption.String())
+		if err != nil {
+			return err
+		}
+	}
+
 	onNotExist := onNotExistError
 	if c.Add.new {
 		onNotExist = onNotExistAdd
@@ -262,10 +282,12 @@ func (c *Config) runAddCmd(cmd *cobra.Command, args []string, sourceState *chezm
 		c.destSystem,
 		destAbsPathInfos,
 		&chezmoi.AddOptions{
+			AttributesFile:      c.Add.AttributesFile,
 			AutoTemplate:        c.Add.autoTemplate,
 			Create:              c.Add.create,
 			Encrypt:             c.Add.Encrypt,
 			EncryptedSuffix:     c.encryption.EncryptedSuffix(),
+			Encryption:          encryption,
 			Exact:               c.Add.exact,
 			ExactTargetRelPaths: exactTargetRelPaths,
 			Errorf:              c.errorf,
@@ -284,6 +306,7 @@ func (c *Config) runAddCmd(cmd *cobra.Command, args []string, sourceState *chezm
 			ReplaceFunc:      c.defaultReplaceFunc,
 			Template:         c.Add.template,
 			TemplateSymlinks: c.Add.TemplateSymlinks,
+			Xattrs:           c.Add.Xattrs,
 		},
 	)
 }
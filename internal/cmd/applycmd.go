@@ -1,6 +1,10 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+
 	"github.com/spf13/cobra"
 
 	"chezmoi.io/chezmoi/v2/internal/chezmoi"
@@ -10,7 +14,9 @@ type applyCmdConfig struct {
 	filter     *chezmoi.EntryTypeFilter
 	init       bool
 	parentDirs bool
+	plan       chezmoi.AbsPath
 	recursive  bool
+	rollback   bool
 }
 
 func (c *Config) newApplyCmd() *cobra.Command {
@@ -33,19 +39,104 @@ func (c *Config) newApplyCmd() *cobra.Command {
 	applyCmd.Flags().VarP(c.apply.filter.Include, "include", "i", "Include entry types")
 	applyCmd.Flags().BoolVar(&c.apply.init, "init", c.apply.init, "Recreate config file from template")
 	applyCmd.Flags().BoolVarP(&c.apply.parentDirs, "parent-dirs", "P", c.apply.parentDirs, "Apply all parent directories")
+	applyCmd.Flags().Var(&c.apply.plan, "plan", "Apply the changes in plan file")
+	applyCmd.Flags().Var(c.profileTemplates, "profile-templates", "Print the time spent executing templates")
+	applyCmd.Flags().Lookup("profile-templates").NoOptDefVal = profileTemplatesFormatText
+	must(applyCmd.RegisterFlagCompletionFunc("profile-templates", c.profileTemplates.FlagCompletionFunc()))
 	applyCmd.Flags().BoolVarP(&c.apply.recursive, "recursive", "r", c.apply.recursive, "Recurse into subdirectories")
+	applyCmd.Flags().BoolVar(&c.apply.rollback, "rollback", c.apply.rollback, "Roll back changes on failure")
+	applyCmd.Flags().Var(c.tagFilter, "tags", "Only include targets with tags")
 
 	return applyCmd
 }
 
 func (c *Config) runApplyCmd(cmd *cobra.Command, args []string) error {
+	if !c.apply.plan.IsEmpty() {
+		return c.applyPlan(cmd, args)
+	}
 	return c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, args, applyArgsOptions{
-		cmd:          cmd,
-		filter:       c.apply.filter,
-		init:         c.apply.init,
-		parentDirs:   c.apply.parentDirs,
-		recursive:    c.apply.recursive,
-		umask:        c.Umask,
-		preApplyFunc: c.defaultPreApplyFunc,
+		cmd:           cmd,
+		backup:        true,
+		filter:        c.apply.filter,
+		init:          c.apply.init,
+		parentDirs:    c.apply.parentDirs,
+		recordHistory: true,
+		recursive:     c.apply.recursive,
+		rollback:      c.apply.rollback,
+		umask:         c.Umask,
+		preApplyFunc:  c.defaultPreApplyFunc,
+	})
+}
+
+// applyPlan applies the changes in the plan file c.apply.plan. It refuses to
+// make any changes if the source state or the actual state of any target in
+// the plan has changed since the plan was made.
+func (c *Config) applyPlan(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("--plan cannot be used with targets")
+	}
+
+	plan, err := readPlan(c.baseSystem, c.apply.plan)
+	if err != nil {
+		return err
+	}
+	if plan.DestDir != c.DestDirAbsPath {
+		return fmt.Errorf("%s: plan is for a different destination directory", plan.DestDir)
+	}
+	if len(plan.Targets) == 0 {
+		return nil
+	}
+
+	sourceState, err := c.getSourceState(cmd.Context(), cmd)
+	if err != nil {
+		return err
+	}
+
+	// Check that applying each target would make exactly the planned change,
+	// without making any changes. The check uses a copy of the persistent state
+	// so that it cannot record any state.
+	dryRunSystem := chezmoi.NewDryRunSystem(c.destSystem)
+	dryRunPersistentState := chezmoi.NewMockPersistentState()
+	if err := c.persistentState.CopyTo(dryRunPersistentState); err != nil {
+		return err
+	}
+	targetRelPaths := make([]chezmoi.RelPath, 0, len(plan.Targets))
+	for _, planTarget := range plan.Targets {
+		checked := false
+		preApplyFunc := func(
+			targetRelPath chezmoi.RelPath,
+			targetEntryState, lastWrittenEntryState, actualEntryState *chezmoi.EntryState,
+		) error {
+			switch {
+			case !planTarget.New.Equivalent(targetEntryState):
+				return errors.New("source state has changed since plan was made")
+			case !planTarget.Old.Equivalent(actualEntryState):
+				return errors.New("actual state has changed since plan was made")
+			}
+			checked = true
+			return fs.SkipDir
+		}
+		switch err := sourceState.Apply(dryRunSystem, c.destSystem, dryRunPersistentState, c.DestDirAbsPath, planTarget.Path, chezmoi.ApplyOptions{
+			Filter:       chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
+			PreApplyFunc: preApplyFunc,
+			Umask:        c.Umask,
+		}); {
+		case err != nil && !errors.Is(err, fs.SkipDir):
+			return fmt.Errorf("%s: %w", planTarget.Path, err)
+		case !checked:
+			return fmt.Errorf("%s: source state has changed since plan was made", planTarget.Path)
+		}
+		targetRelPaths = append(targetRelPaths, planTarget.Path)
+	}
+
+	return c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, nil, applyArgsOptions{
+		cmd:            cmd,
+		backup:         true,
+		filter:         chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
+		recordHistory:  true,
+		rollback:       c.apply.rollback,
+		targetRelPaths: targetRelPaths,
+		umask:          c.Umask,
+		preApplyFunc:   c.defaultPreApplyFunc,
 	})
 }
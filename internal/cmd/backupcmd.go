@@ -0,0 +1,464 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoi"
+	"chezmoi.io/chezmoi/v2/internal/chezmoierrors"
+)
+
+// backupNameFormat is the format of backup names. Backup names sort in the
+// order in which the backups were made.
+const backupNameFormat = "20060102T150405.000000000Z"
+
+const backupCompressedExt = ".tar.gz"
+
+var backupManifestRelPath = chezmoi.NewRelPath(chezmoi.BackupManifestName)
+
+type backupCmdConfig struct {
+	Compress bool            `json:"compress" mapstructure:"compress" yaml:"compress"`
+	Dir      chezmoi.AbsPath `json:"dir"      mapstructure:"dir"      yaml:"dir"`
+	Keep     int             `json:"keep"     mapstructure:"keep"     yaml:"keep"`
+	prune    backupPruneCmdConfig
+	restore  backupRestoreCmdConfig
+}
+
+type backupPruneCmdConfig struct {
+	keep int
+}
+
+type backupRestoreCmdConfig struct {
+	backup string
+}
+
+// A backupEntry is an entry in a backup.
+type backupEntry struct {
+	relPath  chezmoi.RelPath
+	mode     fs.FileMode
+	contents []byte
+	linkname string
+	uid      *int
+	gid      *int
+	xattrs   map[string]chezmoi.HexBytes
+}
+
+func (c *Config) newBackupCmd() *cobra.Command {
+	backupCmd := &cobra.Command{
+		GroupID: groupIDAdvanced,
+		Use:     "backup",
+		Args:    cobra.NoArgs,
+		Short:   "Manage backups of overwritten targets",
+		Long:    mustLongHelp("backup"),
+		Example: example("backup"),
+		Annotations: newAnnotations(
+			persistentStateModeNone,
+		),
+	}
+
+	backupListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List backups",
+		Args:  cobra.NoArgs,
+		RunE:  c.runBackupListCmd,
+		Annotations: newAnnotations(
+			persistentStateModeNone,
+		),
+	}
+	backupCmd.AddCommand(backupListCmd)
+
+	backupPruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove old backups",
+		Args:  cobra.NoArgs,
+		RunE:  c.runBackupPruneCmd,
+		Annotations: newAnnotations(
+			persistentStateModeNone,
+		),
+	}
+	backupPruneCmd.Flags().IntVar(&c.Backup.prune.keep, "keep", c.Backup.prune.keep, "Number of backups to keep")
+	backupCmd.AddCommand(backupPruneCmd)
+
+	backupRestoreCmd := &cobra.Command{
+		Use:               "restore [target]...",
+		Short:             "Restore targets from a backup",
+		ValidArgsFunction: c.targetValidArgs,
+		RunE:              c.runBackupRestoreCmd,
+		Annotations: newAnnotations(
+			modifiesDestinationDirectory,
+			persistentStateModeNone,
+		),
+	}
+	backupRestoreCmd.Flags().StringVar(&c.Backup.restore.backup, "backup", c.Backup.restore.backup, "Backup to restore from")
+	backupCmd.AddCommand(backupRestoreCmd)
+
+	return backupCmd
+}
+
+func (c *Config) runBackupListCmd(cmd *cobra.Command, args []string) error {
+	backupNames, err := c.backupNames()
+	if err != nil {
+		return err
+	}
+	var builder strings.Builder
+	for _, backupName := range backupNames {
+		builder.WriteString(backupName)
+		builder.WriteByte('\n')
+	}
+	return c.writeOutputString(builder.String(), 0o666)
+}
+
+func (c *Config) runBackupPruneCmd(cmd *cobra.Command, args []string) error {
+	keep := c.Backup.Keep
+	if cmd.Flags().Changed("keep") {
+		keep = c.Backup.prune.keep
+	}
+	if keep <= 0 && !cmd.Flags().Changed("keep") {
+		return errors.New("backup.keep not set, use --keep to specify the number of backups to keep")
+	}
+	return c.pruneBackups(keep)
+}
+
+func (c *Config) runBackupRestoreCmd(cmd *cobra.Command, args []string) (err error) {
+	backupNames, err := c.backupNames()
+	if err != nil {
+		return err
+	}
+	backupName := c.Backup.restore.backup
+	switch {
+	case backupName != "":
+		if !slices.Contains(backupNames, backupName) {
+			return fmt.Errorf("%s: backup not found", backupName)
+		}
+	case len(backupNames) == 0:
+		return errors.New("no backups")
+	default:
+		backupName = backupNames[len(backupNames)-1]
+	}
+
+	backupEntries, err := c.readBackup(backupName)
+	if err != nil {
+		return err
+	}
+
+	targetRelPaths := make([]chezmoi.RelPath, 0, len(args))
+	for _, arg := range args {
+		destAbsPath, err := chezmoi.NewAbsPathFromExtPath(arg, c.homeDirAbsPath)
+		if err != nil {
+			return err
+		}
+		targetRelPath, err := c.targetRelPath(destAbsPath)
+		if err != nil {
+			return err
+		}
+		targetRelPaths = append(targetRelPaths, targetRelPath)
+	}
+
+	// Back up the targets that are about to be overwritten, so that the
+	// restore itself can be undone.
+	destSystem := c.destSystem
+	if !c.Backup.Dir.IsEmpty() && !c.dryRun {
+		var backupSystem *chezmoi.BackupSystem
+		var finishBackup func() error
+		backupSystem, finishBackup, err = c.newBackupSystem(destSystem, c.DestDirAbsPath)
+		if err != nil {
+			return err
+		}
+		defer chezmoierrors.CombineFunc(&err, finishBackup)
+		destSystem = backupSystem
+	}
+
+	var restoredBackupEntries []*backupEntry
+	for _, backupEntry := range backupEntries {
+		if len(targetRelPaths) > 0 && !slices.ContainsFunc(targetRelPaths, func(targetRelPath chezmoi.RelPath) bool {
+			return backupEntry.relPath == targetRelPath || backupEntry.relPath.HasDirPrefix(targetRelPath)
+		}) {
+			continue
+		}
+		if err := c.restoreBackupEntry(destSystem, backupEntry); err != nil {
+			return err
+		}
+		restoredBackupEntries = append(restoredBackupEntries, backupEntry)
+	}
+	if len(restoredBackupEntries) == 0 && len(targetRelPaths) > 0 {
+		return fmt.Errorf("%s: targets not found in backup", backupName)
+	}
+
+	// Restore the ownership and extended attributes of entries, and the
+	// permissions of directories, after their children have been restored, so
+	// that restoring read-only directories does not prevent their children
+	// from being restored.
+	for _, backupEntry := range slices.Backward(restoredBackupEntries) {
+		destAbsPath := c.DestDirAbsPath.Join(backupEntry.relPath)
+		if err := chezmoi.RestoreOwnershipAndXattrs(
+			destSystem,
+			destAbsPath,
+			backupEntry.uid,
+			backupEntry.gid,
+			backupEntry.xattrs,
+		); err != nil {
+			return err
+		}
+		if backupEntry.mode.IsDir() {
+			if err := destSystem.Chmod(destAbsPath, backupEntry.mode.Perm()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// backupNames returns the names of all backups, oldest first.
+func (c *Config) backupNames() ([]string, error) {
+	if c.Backup.Dir.IsEmpty() {
+		return nil, errors.New("backup.dir not set")
+	}
+	dirEntries, err := c.baseSystem.ReadDir(c.Backup.Dir)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	var backupNames []string
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if !dirEntry.IsDir() {
+			var ok bool
+			if name, ok = strings.CutSuffix(name, backupCompressedExt); !ok {
+				continue
+			}
+		}
+		if _, err := time.Parse(backupNameFormat, name); err != nil {
+			continue
+		}
+		backupNames = append(backupNames, name)
+	}
+	slices.Sort(backupNames)
+	return backupNames, nil
+}
+
+// newBackupSystem returns a new chezmoi.BackupSystem that wraps system and
+// backs up entries in dirAbsPath to a new backup, and a function that must be
+// called to finish the backup.
+func (c *Config) newBackupSystem(
+	system chezmoi.System,
+	dirAbsPath chezmoi.AbsPath,
+) (*chezmoi.BackupSystem, func() error, error) {
+	if err := chezmoi.MkdirAll(c.baseSystem, c.Backup.Dir, 0o700); err != nil {
+		return nil, nil, err
+	}
+	backupName := time.Now().UTC().Format(backupNameFormat)
+
+	if !c.Backup.Compress {
+		backupSystem := chezmoi.NewBackupSystem(system, dirAbsPath, c.baseSystem, c.Backup.Dir.JoinString(backupName))
+		finishBackup := func() error {
+			if err := backupSystem.Finish(); err != nil {
+				return err
+			}
+			if !backupSystem.BackedUp() || c.Backup.Keep <= 0 {
+				return nil
+			}
+			return c.pruneBackups(c.Backup.Keep)
+		}
+		return backupSystem, finishBackup, nil
+	}
+
+	buffer := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(buffer)
+	tarWriterSystem := chezmoi.NewTarWriterSystem(gzipWriter, tarHeaderTemplate())
+	backupSystem := chezmoi.NewBackupSystem(system, dirAbsPath, tarWriterSystem, chezmoi.DotAbsPath)
+	finishBackup := func() error {
+		if !backupSystem.BackedUp() {
+			return nil
+		}
+		if err := backupSystem.Finish(); err != nil {
+			return err
+		}
+		if err := tarWriterSystem.Close(); err != nil {
+			return err
+		}
+		if err := gzipWriter.Close(); err != nil {
+			return err
+		}
+		backupAbsPath := c.Backup.Dir.JoinString(backupName + backupCompressedExt)
+		if err := c.baseSystem.WriteFile(backupAbsPath, buffer.Bytes(), 0o600); err != nil {
+			return err
+		}
+		if c.Backup.Keep <= 0 {
+			return nil
+		}
+		return c.pruneBackups(c.Backup.Keep)
+	}
+	return backupSystem, finishBackup, nil
+}
+
+// pruneBackups removes all but the keep most recent backups.
+func (c *Config) pruneBackups(keep int) error {
+	backupNames, err := c.backupNames()
+	if err != nil {
+		return err
+	}
+	if len(backupNames) <= keep {
+		return nil
+	}
+	for _, backupName := range backupNames[:len(backupNames)-keep] {
+		backupAbsPath := c.Backup.Dir.JoinString(backupName)
+		if _, err := c.baseSystem.Lstat(backupAbsPath); errors.Is(err, fs.ErrNotExist) {
+			backupAbsPath = backupAbsPath.Append(backupCompressedExt)
+		}
+		if c.dryRun {
+			continue
+		}
+		if err := c.baseSystem.RemoveAll(backupAbsPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBackup returns the entries in the backup backupName, parents first.
+// Directories that were only created to contain backed up entries are not
+// returned.
+func (c *Config) readBackup(backupName string) ([]*backupEntry, error) {
+	var backupEntries []*backupEntry
+	var manifestData []byte
+
+	backupAbsPath := c.Backup.Dir.JoinString(backupName)
+	switch fileInfo, err := c.baseSystem.Lstat(backupAbsPath); {
+	case err == nil && fileInfo.IsDir():
+		if err := chezmoi.Walk(c.baseSystem, backupAbsPath, func(absPath chezmoi.AbsPath, fileInfo fs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if absPath == backupAbsPath {
+				return nil
+			}
+			backupEntry := &backupEntry{
+				relPath: absPath.MustTrimDirPrefix(backupAbsPath),
+				mode:    fileInfo.Mode(),
+			}
+			if backupEntry.relPath == backupManifestRelPath {
+				manifestData, err = c.baseSystem.ReadFile(absPath)
+				return err
+			}
+			switch fileInfo.Mode().Type() {
+			case 0:
+				if backupEntry.contents, err = c.baseSystem.ReadFile(absPath); err != nil {
+					return err
+				}
+			case fs.ModeSymlink:
+				if backupEntry.linkname, err = c.baseSystem.Readlink(absPath); err != nil {
+					return err
+				}
+			}
+			backupEntries = append(backupEntries, backupEntry)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	case err == nil || errors.Is(err, fs.ErrNotExist):
+		data, err := c.baseSystem.ReadFile(backupAbsPath.Append(backupCompressedExt))
+		if err != nil {
+			return nil, err
+		}
+		if err := chezmoi.WalkArchive(data, chezmoi.ArchiveFormatTarGz, func(name chezmoi.RelPath, fileInfo fs.FileInfo, r io.Reader, linkname string) error {
+			backupEntry := &backupEntry{
+				relPath:  name,
+				mode:     fileInfo.Mode(),
+				linkname: linkname,
+			}
+			if name == backupManifestRelPath {
+				var err error
+				manifestData, err = io.ReadAll(r)
+				return err
+			}
+			if fileInfo.Mode().Type() == 0 {
+				var err error
+				if backupEntry.contents, err = io.ReadAll(r); err != nil {
+					return err
+				}
+			}
+			backupEntries = append(backupEntries, backupEntry)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		slices.SortFunc(backupEntries, func(a, b *backupEntry) int {
+			return chezmoi.CompareRelPaths(a.relPath, b.relPath)
+		})
+	default:
+		return nil, err
+	}
+
+	var manifest chezmoi.BackupManifest
+	if manifestData != nil {
+		if err := chezmoi.FormatJSON.Unmarshal(manifestData, &manifest); err != nil {
+			return nil, fmt.Errorf("%s: %w", backupName, err)
+		}
+	}
+	// Older backups do not record ownership or extended attributes, in which
+	// case they are left unchanged.
+	recordsMetadata := manifest.Owners != nil || manifest.Xattrs != nil
+	return slices.DeleteFunc(backupEntries, func(backupEntry *backupEntry) bool {
+		if owner, ok := manifest.Owners[backupEntry.relPath]; ok {
+			backupEntry.uid = &owner.UID
+			backupEntry.gid = &owner.GID
+		}
+		if recordsMetadata {
+			backupEntry.xattrs = manifest.Xattrs[backupEntry.relPath]
+			if backupEntry.xattrs == nil {
+				backupEntry.xattrs = make(map[string]chezmoi.HexBytes)
+			}
+		}
+		if !backupEntry.mode.IsDir() {
+			return false
+		}
+		perm, ok := manifest.DirPerms[backupEntry.relPath]
+		backupEntry.mode = fs.ModeDir | perm
+		return !ok
+	}), nil
+}
+
+// restoreBackupEntry restores backupEntry to the destination directory in
+// system. Missing parent directories are created. The permissions of restored
+// directories are not set.
+func (c *Config) restoreBackupEntry(system chezmoi.System, backupEntry *backupEntry) error {
+	destAbsPath := c.DestDirAbsPath.Join(backupEntry.relPath)
+	if err := chezmoi.MkdirAll(system, destAbsPath.Dir(), fs.ModePerm); err != nil {
+		return err
+	}
+	if backupEntry.mode.IsDir() {
+		switch fileInfo, err := system.Lstat(destAbsPath); {
+		case err == nil && fileInfo.IsDir():
+			return nil
+		case err == nil:
+			if err := system.RemoveAll(destAbsPath); err != nil {
+				return err
+			}
+		case !errors.Is(err, fs.ErrNotExist):
+			return err
+		}
+		return system.Mkdir(destAbsPath, 0o700)
+	}
+	if err := system.RemoveAll(destAbsPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	switch backupEntry.mode.Type() {
+	case 0:
+		return system.WriteFile(destAbsPath, backupEntry.contents, backupEntry.mode.Perm())
+	case fs.ModeSymlink:
+		return system.WriteSymlink(backupEntry.linkname, destAbsPath)
+	default:
+		return fmt.Errorf("%s: unsupported file type %s", backupEntry.relPath, backupEntry.mode.Type())
+	}
+}
@@ -48,6 +48,13 @@ func (c *Config) runCatCmd(cmd *cobra.Command, args []string, sourceState *chezm
 				return fmt.Errorf("%s: %w", targetRelPath, err)
 			}
 			builder.Write(contents)
+		case *chezmoi.TargetStateHardlink:
+			linkname, err := targetStateEntry.Linkname()
+			if err != nil {
+				return fmt.Errorf("%s: %w", targetRelPath, err)
+			}
+			builder.WriteString(linkname.String())
+			builder.WriteByte('\n')
 		case *chezmoi.TargetStateScript:
 			contents, err := targetStateEntry.Contents()
 			if err != nil {
@@ -62,7 +69,7 @@ func (c *Config) runCatCmd(cmd *cobra.Command, args []string, sourceState *chezm
 			builder.WriteString(linkname)
 			builder.WriteByte('\n')
 		default:
-			return fmt.Errorf("%s: not a file, script, or symlink", targetRelPath)
+			return fmt.Errorf("%s: not a file, hard link, script, or symlink", targetRelPath)
 		}
 	}
 	return c.writeOutputString(builder.String(), 0o666)
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"slices"
 	"strings"
@@ -10,8 +11,13 @@ import (
 	"chezmoi.io/chezmoi/v2/internal/chezmoi"
 )
 
+var errUnsupportedAttributesFileModifier = errors.New(
+	"only create, encrypted, exact, executable, private, and template can be recorded in .chezmoiattributes",
+)
+
 type chattrCmdConfig struct {
-	recursive bool
+	attributesFile bool
+	recursive      bool
 }
 
 type boolModifier int
@@ -48,6 +54,8 @@ const (
 	sourceFileTypeModifierLeaveUnchanged sourceFileTypeModifier = iota
 	sourceFileTypeModifierSetCreate
 	sourceFileTypeModifierClearCreate
+	sourceFileTypeModifierSetHardlink
+	sourceFileTypeModifierClearHardlink
 	sourceFileTypeModifierSetModify
 	sourceFileTypeModifierClearModify
 	sourceFileTypeModifierSetRemove
@@ -90,6 +98,8 @@ func (c *Config) newChattrCmd() *cobra.Command {
 		),
 	}
 
+	chattrCmd.Flags().
+		BoolVar(&c.chattr.attributesFile, "attributes-file", c.chattr.attributesFile, "Record attributes in .chezmoiattributes")
 	chattrCmd.Flags().BoolVarP(&c.chattr.recursive, "recursive", "r", c.chattr.recursive, "Recurse into subdirectories")
 
 	return chattrCmd
@@ -109,6 +119,7 @@ func (c *Config) chattrCmdValidArgs(cmd *cobra.Command, args []string, toComplet
 			"exact",
 			"executable",
 			"external",
+			"hardlink",
 			"modify",
 			"once",
 			"onchange",
@@ -160,6 +171,10 @@ func (c *Config) runChattrCmd(cmd *cobra.Command, args []string, sourceState *ch
 		return err
 	}
 
+	if c.chattr.attributesFile {
+		return c.chattrAttributesFile(sourceState, m, targetRelPaths)
+	}
+
 	// Visit targets in reverse so we update children before their parent
 	// directories.
 	encryptedSuffix := sourceState.Encryption().EncryptedSuffix()
@@ -169,12 +184,13 @@ func (c *Config) runChattrCmd(cmd *cobra.Command, args []string, sourceState *ch
 		parentSourceRelPath, fileSourceRelPath := sourceRelPath.Split()
 		parentRelPath := parentSourceRelPath.RelPath()
 		fileRelPath := fileSourceRelPath.RelPath()
+		sourceDirAbsPath := sourceState.TargetSourceDirAbsPath(targetRelPath)
 		switch sourceStateEntry := sourceStateEntry.(type) {
 		case *chezmoi.SourceStateDir:
 			relPath := m.modifyDirAttr(sourceStateEntry.Attr()).SourceName()
 			if newBaseNameRelPath := chezmoi.NewRelPath(relPath); newBaseNameRelPath != fileRelPath {
-				oldSourceAbsPath := c.SourceDirAbsPath.Join(parentRelPath, fileRelPath)
-				newSourceAbsPath := c.SourceDirAbsPath.Join(parentRelPath, newBaseNameRelPath)
+				oldSourceAbsPath := sourceDirAbsPath.Join(parentRelPath, fileRelPath)
+				newSourceAbsPath := sourceDirAbsPath.Join(parentRelPath, newBaseNameRelPath)
 				if err := c.sourceSystem.Rename(oldSourceAbsPath, newSourceAbsPath); err != nil {
 					return err
 				}
@@ -182,8 +198,8 @@ func (c *Config) runChattrCmd(cmd *cobra.Command, args []string, sourceState *ch
 		case *chezmoi.SourceStateFile:
 			newAttr := m.modifyFileAttr(sourceStateEntry.Attr())
 			newBaseNameRelPath := chezmoi.NewRelPath(newAttr.SourceName(encryptedSuffix))
-			oldSourceAbsPath := c.SourceDirAbsPath.Join(parentRelPath, fileRelPath)
-			newSourceAbsPath := c.SourceDirAbsPath.Join(parentRelPath, newBaseNameRelPath)
+			oldSourceAbsPath := sourceDirAbsPath.Join(parentRelPath, fileRelPath)
+			newSourceAbsPath := sourceDirAbsPath.Join(parentRelPath, newBaseNameRelPath)
 			switch encryptedBefore, encryptedAfter := sourceStateEntry.Attr().Encrypted, newAttr.Encrypted; {
 			case encryptedBefore && !encryptedAfter:
 				// Write the plaintext and then remove the ciphertext.
@@ -225,6 +241,60 @@ func (c *Config) runChattrCmd(cmd *cobra.Command, args []string, sourceState *ch
 	return nil
 }
 
+// chattrAttributesFile changes the attributes of targetRelPaths by recording
+// them in .chezmoiattributes instead of renaming their source entries.
+func (c *Config) chattrAttributesFile(
+	sourceState *chezmoi.SourceState,
+	m *modifier,
+	targetRelPaths []chezmoi.RelPath,
+) error {
+	attributes, err := m.attributes()
+	if err != nil {
+		return err
+	}
+
+	attributesByTargetRelPath := make(map[chezmoi.RelPath]map[string]bool)
+	for _, targetRelPath := range targetRelPaths {
+		var names []string
+		switch sourceStateEntry := sourceState.MustEntry(targetRelPath).(type) {
+		case *chezmoi.SourceStateDir:
+			names = []string{"exact", "private"}
+		case *chezmoi.SourceStateFile:
+			names = []string{"create", "encrypted", "executable", "private", "template"}
+
+			// Encrypt or decrypt the contents in place.
+			encrypted, ok := attributes["encrypted"]
+			if !ok || encrypted == sourceStateEntry.Attr().Encrypted {
+				break
+			}
+			contents, err := sourceStateEntry.Contents()
+			if err != nil {
+				return err
+			}
+			if encrypted {
+				if contents, err = sourceState.Encryption().Encrypt(contents); err != nil {
+					return err
+				}
+			}
+			sourceAbsPath := sourceState.TargetSourceDirAbsPath(targetRelPath).Join(sourceStateEntry.SourceRelPath().RelPath())
+			if err := c.sourceSystem.WriteFile(sourceAbsPath, contents, 0o666&^c.Umask); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+		targetAttributes := make(map[string]bool)
+		for _, name := range names {
+			if value, ok := attributes[name]; ok {
+				targetAttributes[name] = value
+			}
+		}
+		attributesByTargetRelPath[targetRelPath] = targetAttributes
+	}
+
+	return sourceState.WriteAttributes(c.sourceSystem, attributesByTargetRelPath)
+}
+
 // modify returns the modified value of b.
 func (m boolModifier) modify(b bool) bool {
 	switch m {
@@ -306,6 +376,13 @@ func (m sourceFileTypeModifier) modify(sourceFileType chezmoi.SourceFileTargetTy
 			return chezmoi.SourceFileTypeFile
 		}
 		return sourceFileType
+	case sourceFileTypeModifierSetHardlink:
+		return chezmoi.SourceFileTypeHardlink
+	case sourceFileTypeModifierClearHardlink:
+		if sourceFileType == chezmoi.SourceFileTypeHardlink {
+			return chezmoi.SourceFileTypeFile
+		}
+		return sourceFileType
 	case sourceFileTypeModifierSetModify:
 		return chezmoi.SourceFileTypeModify
 	case sourceFileTypeModifierClearModify:
@@ -392,6 +469,13 @@ func parseModifier(s string) (*modifier, error) {
 			m.executable = bm
 		case "external":
 			m.external = bm
+		case "hardlink":
+			switch bm {
+			case boolModifierClear:
+				m.sourceFileType = sourceFileTypeModifierClearHardlink
+			case boolModifierSet:
+				m.sourceFileType = sourceFileTypeModifierSetHardlink
+			}
 		case "modify":
 			switch bm {
 			case boolModifierClear:
@@ -449,6 +533,41 @@ func parseModifier(s string) (*modifier, error) {
 	return m, nil
 }
 
+// attributes returns the attributes set by m that can be recorded in
+// .chezmoiattributes.
+func (m *modifier) attributes() (map[string]bool, error) {
+	if m.condition != conditionModifierLeaveUnchanged ||
+		m.empty != boolModifierLeaveUnchanged ||
+		m.external != boolModifierLeaveUnchanged ||
+		m.order != orderModifierLeaveUnchanged ||
+		m.readOnly != boolModifierLeaveUnchanged ||
+		m.remove != boolModifierLeaveUnchanged {
+		return nil, errUnsupportedAttributesFileModifier
+	}
+	attributes := make(map[string]bool)
+	switch m.sourceFileType {
+	case sourceFileTypeModifierLeaveUnchanged:
+	case sourceFileTypeModifierSetCreate:
+		attributes["create"] = true
+	case sourceFileTypeModifierClearCreate:
+		attributes["create"] = false
+	default:
+		return nil, errUnsupportedAttributesFileModifier
+	}
+	for name, bm := range map[string]boolModifier{
+		"encrypted":  m.encrypted,
+		"exact":      m.exact,
+		"executable": m.executable,
+		"private":    m.private,
+		"template":   m.template,
+	} {
+		if bm != boolModifierLeaveUnchanged {
+			attributes[name] = bm == boolModifierSet
+		}
+	}
+	return attributes, nil
+}
+
 // modifyDirAttr returns the modified value of dirAttr.
 func (m *modifier) modifyDirAttr(dirAttr chezmoi.DirAttr) chezmoi.DirAttr {
 	return chezmoi.DirAttr{
@@ -495,6 +614,12 @@ func (m *modifier) modifyFileAttr(fileAttr chezmoi.FileAttr) chezmoi.FileAttr {
 			ReadOnly:   m.readOnly.modify(fileAttr.ReadOnly),
 			Template:   m.template.modify(fileAttr.Template),
 		}
+	case chezmoi.SourceFileTypeHardlink:
+		return chezmoi.FileAttr{
+			TargetName: fileAttr.TargetName,
+			Type:       chezmoi.SourceFileTypeHardlink,
+			Template:   m.template.modify(fileAttr.Template),
+		}
 	case chezmoi.SourceFileTypeScript:
 		return chezmoi.FileAttr{
 			TargetName: fileAttr.TargetName,
@@ -6,6 +6,7 @@ import (
 	"cmp"
 	"context"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -25,6 +26,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -97,6 +99,10 @@ type doPurgeOptions struct {
 	workingTree     bool
 }
 
+type auditConfig struct {
+	File chezmoi.AbsPath `json:"file" mapstructure:"file" yaml:"file"`
+}
+
 type commandConfig struct {
 	Command string   `json:"command" mapstructure:"command" yaml:"command"`
 	Script  string   `json:"script"  mapstructure:"script"  yaml:"script"`
@@ -119,6 +125,7 @@ type warningsConfig struct {
 // ConfigFile contains all data settable in the config file.
 type ConfigFile struct {
 	// Global configuration.
+	Audit                  auditConfig                    `json:"audit"           mapstructure:"audit"           yaml:"audit"`
 	CacheDirAbsPath        chezmoi.AbsPath                `json:"cacheDir"        mapstructure:"cacheDir"        yaml:"cacheDir"`
 	Color                  autoBool                       `json:"color"           mapstructure:"color"           yaml:"color"`
 	Data                   map[string]any                 `json:"data"            mapstructure:"data"            yaml:"data"`
@@ -132,6 +139,7 @@ type ConfigFile struct {
 	LessInteractive        bool                           `json:"lessInteractive" mapstructure:"lessInteractive" yaml:"lessInteractive"`
 	Mode                   chezmoi.Mode                   `json:"mode"            mapstructure:"mode"            yaml:"mode"`
 	Pager                  string                         `json:"pager"           mapstructure:"pager"           yaml:"pager"`
+	Parallelism            int                            `json:"parallelism"     mapstructure:"parallelism"     yaml:"parallelism"`
 	PagerArgs              []string                       `json:"pagerArgs"       mapstructure:"pagerArgs"       yaml:"pagerArgs"`
 	PersistentStateAbsPath chezmoi.AbsPath                `json:"persistentState" mapstructure:"persistentState" yaml:"persistentState"`
 	PINEntry               pinEntryConfig                 `json:"pinentry"        mapstructure:"pinentry"        yaml:"pinentry"`
@@ -139,13 +147,18 @@ type ConfigFile struct {
 	Safe                   bool                           `json:"safe"            mapstructure:"safe"            yaml:"safe"`
 	ScriptEnv              map[string]string              `json:"scriptEnv"       mapstructure:"scriptEnv"       yaml:"scriptEnv"`
 	ScriptTempDir          chezmoi.AbsPath                `json:"scriptTempDir"   mapstructure:"scriptTempDir"   yaml:"scriptTempDir"`
+	SecretCache            secretCacheConfig              `json:"secretCache"     mapstructure:"secretCache"     yaml:"secretCache"`
+	SecretsFixture         chezmoi.AbsPath                `json:"secretsFixture"  mapstructure:"secretsFixture"  yaml:"secretsFixture"`
+	SourceCache            bool                           `json:"sourceCache"     mapstructure:"sourceCache"     yaml:"sourceCache"`
 	SourceDirAbsPath       chezmoi.AbsPath                `json:"sourceDir"       mapstructure:"sourceDir"       yaml:"sourceDir"`
+	Tags                   []string                       `json:"tags"            mapstructure:"tags"            yaml:"tags"`
 	TempDir                chezmoi.AbsPath                `json:"tempDir"         mapstructure:"tempDir"         yaml:"tempDir"`
 	Template               templateConfig                 `json:"template"        mapstructure:"template"        yaml:"template"`
 	TextConv               textConv                       `json:"textConv"        mapstructure:"textConv"        yaml:"textConv"`
 	Umask                  fs.FileMode                    `json:"umask"           mapstructure:"umask"           yaml:"umask"`
 	UseBuiltinAge          autoBool                       `json:"useBuiltinAge"   mapstructure:"useBuiltinAge"   yaml:"useBuiltinAge"`
 	UseBuiltinGit          autoBool                       `json:"useBuiltinGit"   mapstructure:"useBuiltinGit"   yaml:"useBuiltinGit"`
+	UseBuiltinGPG          autoBool                       `json:"useBuiltinGPG"   mapstructure:"useBuiltinGPG"   yaml:"useBuiltinGPG"`
 	Verbose                bool                           `json:"verbose"         mapstructure:"verbose"         yaml:"verbose"`
 	Warnings               warningsConfig                 `json:"warnings"        mapstructure:"warnings"        yaml:"warnings"`
 	WorkingTreeAbsPath     chezmoi.AbsPath                `json:"workingTree"     mapstructure:"workingTree"     yaml:"workingTree"`
@@ -171,22 +184,29 @@ type ConfigFile struct {
 	Vault             vaultConfig             `json:"vault"             mapstructure:"vault"             yaml:"vault"`
 
 	// Encryption configurations.
-	Encryption string                `json:"encryption" mapstructure:"encryption" yaml:"encryption"`
-	Age        chezmoi.AgeEncryption `json:"age"        mapstructure:"age"        yaml:"age"`
-	GPG        chezmoi.GPGEncryption `json:"gpg"        mapstructure:"gpg"        yaml:"gpg"`
+	Encryption  string                `json:"encryption"  mapstructure:"encryption"  yaml:"encryption"`
+	Encryptions []string              `json:"encryptions" mapstructure:"encryptions" yaml:"encryptions"`
+	Age         chezmoi.AgeEncryption `json:"age"         mapstructure:"age"         yaml:"age"`
+	GPG         chezmoi.GPGEncryption `json:"gpg"         mapstructure:"gpg"         yaml:"gpg"`
 
 	// Command configurations.
 	Add        addCmdConfig        `json:"add"        mapstructure:"add"        yaml:"add"`
+	Backup     backupCmdConfig     `json:"backup"     mapstructure:"backup"     yaml:"backup"`
 	CD         cdCmdConfig         `json:"cd"         mapstructure:"cd"         yaml:"cd"`
 	Completion completionCmdConfig `json:"completion" mapstructure:"completion" yaml:"completion"`
 	Docker     dockerCmdConfig     `json:"docker"     mapstructure:"docker"     yaml:"docker"`
 	Diff       diffCmdConfig       `json:"diff"       mapstructure:"diff"       yaml:"diff"`
 	Edit       editCmdConfig       `json:"edit"       mapstructure:"edit"       yaml:"edit"`
 	Git        gitCmdConfig        `json:"git"        mapstructure:"git"        yaml:"git"`
+	History    historyCmdConfig    `json:"history"    mapstructure:"history"    yaml:"history"`
 	Merge      mergeCmdConfig      `json:"merge"      mapstructure:"merge"      yaml:"merge"`
 	Status     statusCmdConfig     `json:"status"     mapstructure:"status"     yaml:"status"`
 	Update     updateCmdConfig     `json:"update"     mapstructure:"update"     yaml:"update"`
 	Verify     verifyCmdConfig     `json:"verify"     mapstructure:"verify"     yaml:"verify"`
+
+	// Source directories layered below sourceDir, lowest first, set when
+	// sourceDir is a list.
+	lowerSourceDirAbsPaths []chezmoi.AbsPath `json:"-" mapstructure:"-" yaml:"-"`
 }
 
 // A Config represents a configuration.
@@ -213,8 +233,9 @@ type Config struct {
 	useBuiltinDiff   bool
 
 	// Password manager data.
-	gitHub  gitHubData
-	keyring keyringData
+	gitHub      gitHubData
+	keyring     keyringData
+	promptMutex sync.Mutex
 
 	// Command configurations, not settable in the config file.
 	age             ageCmdConfig
@@ -223,22 +244,31 @@ type Config struct {
 	archive         archiveCmdConfig
 	chattr          chattrCmdConfig
 	data            dataCmdConfig
+	decrypt         decryptCmdConfig
+	deps            depsCmdConfig
 	destroy         destroyCmdConfig
 	doctor          doctorCmdConfig
 	dump            dumpCmdConfig
 	dumpConfig      dumpConfigCmdConfig
+	encrypt         encryptCmdConfig
 	executeTemplate executeTemplateCmdConfig
 	generate        generateCmdConfig
 	ignored         ignoredCmdConfig
 	_import         importCmdConfig
 	init            initCmdConfig
+	lint            lintCmdConfig
 	managed         managedCmdConfig
 	mergeAll        mergeAllCmdConfig
+	plan            planCmdConfig
+	shadowed        shadowedCmdConfig
 	ssh             sshCmdConfig
 	purge           purgeCmdConfig
 	reAdd           reAddCmdConfig
+	rekey           rekeyCmdConfig
+	render          renderCmdConfig
 	secret          secretCmdConfig
 	state           stateCmdConfig
+	undo            undoCmdConfig
 	unmanaged       unmanagedCmdConfig
 	upgrade         upgradeCmdConfig
 
@@ -246,6 +276,9 @@ type Config struct {
 	interactiveTemplateFuncs interactiveTemplateFuncsConfig
 	overrideData             string
 	overrideDataFileAbsPath  chezmoi.AbsPath
+	profileTemplates         *choiceFlag
+	tagFilter                *chezmoi.TagFilter
+	templateProfiler         *chezmoi.TemplateProfiler
 
 	// Version information.
 	version     semver.Version
@@ -269,6 +302,7 @@ type Config struct {
 	commandDirAbsPath      chezmoi.AbsPath
 	homeDirAbsPath         chezmoi.AbsPath
 	encryption             chezmoi.Encryption
+	encryptions            map[string]chezmoi.Encryption
 	sourceDirAbsPath       chezmoi.AbsPath
 	sourceDirAbsPathErr    error
 	sourceState            *chezmoi.SourceState
@@ -283,6 +317,10 @@ type Config struct {
 	bufioReader       *bufio.Reader
 	diffPagerCmdStdin io.WriteCloser
 	diffPagerCmd      *exec.Cmd
+	auditLogWriter    io.WriteCloser
+	auditSystem       *chezmoi.AuditSystem
+	auditSealSHA256   []byte
+	secretCache       *secretCache
 
 	tempDirs map[string]chezmoi.AbsPath
 
@@ -322,6 +360,7 @@ type templateData struct {
 	pathSeparator     string
 	rawHomeDir        string
 	sourceDir         string
+	tags              []string
 	uid               string
 	username          string
 	version           map[string]any
@@ -353,6 +392,76 @@ var (
 
 	whitespaceRx = regexp.MustCompile(`\s+`)
 
+	// serialTemplateFuncProviders maps template functions that query password
+	// managers and remote services to their providers. Calls to functions with
+	// the same provider are serialized as they share caches and may prompt the
+	// user.
+	serialTemplateFuncProviders = map[string]string{
+		"awsSecretsManager":           "awsSecretsManager",
+		"awsSecretsManagerRaw":        "awsSecretsManager",
+		"azureKeyVault":               "azureKeyVault",
+		"bitwarden":                   "bitwarden",
+		"bitwardenAttachment":         "bitwarden",
+		"bitwardenAttachmentByRef":    "bitwarden",
+		"bitwardenFields":             "bitwarden",
+		"bitwardenSecrets":            "bitwardenSecrets",
+		"dashlaneNote":                "dashlane",
+		"dashlanePassword":            "dashlane",
+		"decrypt":                     "encryption",
+		"doppler":                     "doppler",
+		"dopplerProjectJson":          "doppler",
+		"ejsonDecrypt":                "ejson",
+		"ejsonDecryptWithKey":         "ejson",
+		"encrypt":                     "encryption",
+		"getRedirectedURL":            "getRedirectedURL",
+		"gitHubKeys":                  "gitHub",
+		"gitHubLatestRelease":         "gitHub",
+		"gitHubLatestReleaseAssetURL": "gitHub",
+		"gitHubLatestTag":             "gitHub",
+		"gitHubRelease":               "gitHub",
+		"gitHubReleaseAssetURL":       "gitHub",
+		"gitHubReleases":              "gitHub",
+		"gitHubTags":                  "gitHub",
+		"gopass":                      "gopass",
+		"gopassCat":                   "gopass",
+		"gopassRaw":                   "gopass",
+		"ioreg":                       "ioreg",
+		"keepassxc":                   "keepassxc",
+		"keepassxcAttachment":         "keepassxc",
+		"keepassxcAttribute":          "keepassxc",
+		"keeper":                      "keeper",
+		"keeperDataFields":            "keeper",
+		"keeperFindPassword":          "keeper",
+		"keyring":                     "keyring",
+		"lastpass":                    "lastpass",
+		"lastpassRaw":                 "lastpass",
+		"onepassword":                 "onepassword",
+		"onepasswordDetailsFields":    "onepassword",
+		"onepasswordDocument":         "onepassword",
+		"onepasswordItemFields":       "onepassword",
+		"onepasswordRead":             "onepassword",
+		"pass":                        "pass",
+		"passFields":                  "pass",
+		"passRaw":                     "pass",
+		"passhole":                    "passhole",
+		"protonPass":                  "protonPass",
+		"protonPassJSON":              "protonPass",
+		"rbw":                         "rbw",
+		"rbwFields":                   "rbw",
+		"secret":                      "secret",
+		"secretJSON":                  "secret",
+		"vault":                       "vault",
+	}
+
+	// secretTemplateFuncs are the template functions that return secrets from
+	// password managers.
+	secretTemplateFuncs = newSecretTemplateFuncs(serialTemplateFuncProviders, chezmoiset.New(
+		"encryption",
+		"getRedirectedURL",
+		"gitHub",
+		"ioreg",
+	))
+
 	commonFlagCompletionFuncs = map[string]func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective){
 		"exclude": chezmoi.EntryTypeSetFlagCompletionFunc,
 		"include": chezmoi.EntryTypeSetFlagCompletionFunc,
@@ -389,6 +498,7 @@ func newConfig(options ...configOption) (*Config, error) {
 		apply: applyCmdConfig{
 			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
 			recursive: true,
+			rollback:  true,
 		},
 		archive: archiveCmdConfig{
 			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
@@ -398,6 +508,9 @@ func newConfig(options ...configOption) (*Config, error) {
 		data: dataCmdConfig{
 			format: newChoiceFlag("", writeDataFormatValues),
 		},
+		deps: depsCmdConfig{
+			format: newChoiceFlag("", writeDataFormatValues),
+		},
 		dump: dumpCmdConfig{
 			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
 			format:    newChoiceFlag("", writeDataFormatValues),
@@ -406,6 +519,10 @@ func newConfig(options ...configOption) (*Config, error) {
 		dumpConfig: dumpConfigCmdConfig{
 			format: newChoiceFlag("", writeDataFormatValues),
 		},
+		encrypt: encryptCmdConfig{
+			encryption: newChoiceFlag("", encryptionValues),
+			format:     newChoiceFlag("", readDataFormatValues),
+		},
 		executeTemplate: executeTemplateCmdConfig{
 			stdinIsATTY: true,
 		},
@@ -425,6 +542,9 @@ func newConfig(options ...configOption) (*Config, error) {
 			guessRepoURL:      true,
 			recurseSubmodules: true,
 		},
+		lint: lintCmdConfig{
+			format: newChoiceFlag("", lintFormatValues),
+		},
 		managed: managedCmdConfig{
 			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
 			format:    newChoiceFlag(formatJSON, writeDataFormatValues),
@@ -433,10 +553,24 @@ func newConfig(options ...configOption) (*Config, error) {
 		mergeAll: mergeAllCmdConfig{
 			recursive: true,
 		},
+		plan: planCmdConfig{
+			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
+			recursive: true,
+		},
 		reAdd: reAddCmdConfig{
 			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
 			recursive: true,
 		},
+		rekey: rekeyCmdConfig{
+			encryption: newChoiceFlag("", encryptionValues),
+			recursive:  true,
+		},
+		render: renderCmdConfig{
+			filter: chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
+		},
+		shadowed: shadowedCmdConfig{
+			format: newChoiceFlag("", writeDataFormatValues),
+		},
 		ssh: sshCmdConfig{
 			shell: true,
 		},
@@ -456,6 +590,10 @@ func newConfig(options ...configOption) (*Config, error) {
 			pathStyle: newChoiceFlag(pathStyleRelative, targetPathStyleValues),
 		},
 
+		// Common configuration.
+		profileTemplates: newChoiceFlag("", profileTemplatesFormatValues),
+		tagFilter:        chezmoi.NewTagFilter(),
+
 		// Configuration.
 		fileSystem: vfs.OSFS,
 		bds:        bds,
@@ -597,6 +735,19 @@ func newConfig(options ...configOption) (*Config, error) {
 		c.addTemplateFunc(key, value)
 	}
 
+	// Template functions that query password managers and remote services cache
+	// their results and may prompt the user, so serialize calls to each
+	// provider to allow templates to be executed concurrently.
+	providerMutexes := make(map[string]*sync.Mutex)
+	for key, provider := range serialTemplateFuncProviders {
+		providerMutex, ok := providerMutexes[provider]
+		if !ok {
+			providerMutex = &sync.Mutex{}
+			providerMutexes[provider] = providerMutex
+		}
+		c.templateFuncs[key] = serializeTemplateFunc(providerMutex, c.templateFuncs[key])
+	}
+
 	for _, option := range options {
 		if err := option(c); err != nil {
 			return nil, err
@@ -650,26 +801,32 @@ func (c *Config) addTemplateFunc(key string, value any) {
 }
 
 type applyArgsOptions struct {
-	cmd          *cobra.Command
-	filter       *chezmoi.EntryTypeFilter
-	init         bool
-	parentDirs   bool
-	recursive    bool
-	umask        fs.FileMode
-	preApplyFunc chezmoi.PreApplyFunc
+	cmd            *cobra.Command
+	backup         bool
+	filter         *chezmoi.EntryTypeFilter
+	init           bool
+	parentDirs     bool
+	recordHistory  bool
+	recursive      bool
+	rollback       bool
+	targetRelPaths []chezmoi.RelPath
+	umask          fs.FileMode
+	preApplyFunc   chezmoi.PreApplyFunc
 }
 
 // applyArgs is the core of all commands that make changes to a target system.
 // It checks config file freshness, reads the source state, and then applies the
 // source state for each target entry in args. If args is empty then the source
-// state is applied to all target entries.
+// state is applied to all target entries, unless options.targetRelPaths is
+// non-nil, in which case the source state is applied to exactly those targets,
+// in order.
 func (c *Config) applyArgs(
 	ctx context.Context,
 	targetSystem chezmoi.System,
 	targetDirAbsPath chezmoi.AbsPath,
 	args []string,
 	options applyArgsOptions,
-) error {
+) (err error) {
 	if options.init {
 		if err := c.createAndReloadConfigFile(options.cmd); err != nil {
 			return err
@@ -726,6 +883,8 @@ func (c *Config) applyArgs(
 
 	var targetRelPaths []chezmoi.RelPath
 	switch {
+	case options.targetRelPaths != nil:
+		targetRelPaths = options.targetRelPaths
 	case len(args) == 0:
 		targetRelPaths = sourceState.TargetRelPaths()
 	case c.sourcePath:
@@ -742,6 +901,10 @@ func (c *Config) applyArgs(
 		}
 	}
 
+	if !c.tagFilter.IsEmpty() {
+		targetRelPaths = sourceState.SelectTags(targetRelPaths, c.tagFilter)
+	}
+
 	if options.parentDirs {
 		targetRelPaths = prependParentRelPaths(targetRelPaths)
 	}
@@ -752,18 +915,86 @@ func (c *Config) applyArgs(
 		Umask:        options.umask,
 	}
 
+	// If rollback is enabled and we are not keeping going after errors, or if
+	// we are recording history, then record the previous state of every target
+	// so that it can be restored if the apply fails or is later undone.
+	rollback := options.rollback && !c.keepGoing
+	recordHistory := options.recordHistory && !c.dryRun
+	var journalSystem *chezmoi.JournalSystem
+	var entryStateSnapshot map[string][]byte
+	if rollback || recordHistory {
+		journalSystem = chezmoi.NewJournalSystem(targetSystem, chezmoi.JournalSystemOptions{
+			SkipUnsupported: !rollback,
+			WarnFunc:        c.errorf,
+		})
+		targetSystem = journalSystem
+		entryStateSnapshot = make(map[string][]byte)
+		if err := c.persistentState.ForEach(chezmoi.EntryStateBucket, func(k, v []byte) error {
+			entryStateSnapshot[string(k)] = slices.Clone(v)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	// If backups are enabled, then copy every target to the backup directory
+	// before it is overwritten or removed.
+	if options.backup && !c.Backup.Dir.IsEmpty() && !c.dryRun {
+		var backupSystem *chezmoi.BackupSystem
+		var finishBackup func() error
+		backupSystem, finishBackup, err = c.newBackupSystem(targetSystem, targetDirAbsPath)
+		if err != nil {
+			return err
+		}
+		defer chezmoierrors.CombineFunc(&err, finishBackup)
+		targetSystem = backupSystem
+	}
+
+	// If rollback is disabled, then the targets changed before the error are
+	// left as they are, so record them in the history so that they can be
+	// undone.
+	rollbackOnErr := func(err error) error {
+		if !rollback {
+			if recordHistory {
+				if recordErr := c.recordApplyHistory(journalSystem, entryStateSnapshot); recordErr != nil {
+					return fmt.Errorf("%w (recording history failed: %w)", err, recordErr)
+				}
+			}
+			return err
+		}
+		if rollbackErr := c.rollbackApply(journalSystem, entryStateSnapshot); rollbackErr != nil {
+			return fmt.Errorf("%w (rollback failed: %w)", err, rollbackErr)
+		}
+		return err
+	}
+
+	// If parallelism is enabled, then evaluate targets concurrently in batches
+	// before applying them. Targets are still applied in order, so writes,
+	// scripts, and prompts happen in the same order as without parallelism.
+	evaluationBatches := [][]chezmoi.RelPath{targetRelPaths}
+	if c.Parallelism > 1 {
+		evaluationBatches = sourceState.EvaluationBatches(targetRelPaths)
+	}
+
 	keptGoingAfterErr := false
-	for _, targetRelPath := range targetRelPaths {
-		switch err := sourceState.Apply(targetSystem, c.destSystem, c.persistentState, targetDirAbsPath, targetRelPath, applyOptions); {
-		case errors.Is(err, fs.SkipDir):
-			continue
-		case err != nil:
-			err = fmt.Errorf("%s: %w", targetRelPath, err)
-			if !c.keepGoing {
-				return err
+	for _, evaluationBatch := range evaluationBatches {
+		if c.Parallelism > 1 {
+			sourceState.Evaluate(c.destSystem, evaluationBatch, chezmoi.EvaluateOptions{
+				Filter:      options.filter,
+				Parallelism: c.Parallelism,
+			})
+		}
+		for _, targetRelPath := range evaluationBatch {
+			switch err := sourceState.Apply(targetSystem, c.destSystem, c.persistentState, targetDirAbsPath, targetRelPath, applyOptions); {
+			case errors.Is(err, fs.SkipDir):
+				continue
+			case err != nil:
+				err = fmt.Errorf("%s: %w", targetRelPath, err)
+				if !c.keepGoing {
+					return rollbackOnErr(err)
+				}
+				c.errorf("%v\n", err)
+				keptGoingAfterErr = true
 			}
-			c.errorf("%v\n", err)
-			keptGoingAfterErr = true
 		}
 	}
 
@@ -772,7 +1003,13 @@ func (c *Config) applyArgs(
 		c.errorf("%v\n", err)
 		keptGoingAfterErr = true
 	case err != nil:
-		return err
+		return rollbackOnErr(err)
+	}
+
+	if recordHistory {
+		if err := c.recordApplyHistory(journalSystem, entryStateSnapshot); err != nil {
+			return err
+		}
 	}
 
 	if keptGoingAfterErr {
@@ -1037,6 +1274,31 @@ func (c *Config) decodeConfigFile(configFileAbsPath chezmoi.AbsPath, configFile
 
 // decodeConfigMap decodes configMap into configFile.
 func (c *Config) decodeConfigMap(configMap map[string]any, configFile *ConfigFile) error {
+	// sourceDir can be a list of source directories, lowest layer first. The
+	// last is the source directory and the others are layered below it.
+	configFile.lowerSourceDirAbsPaths = nil
+	for key, value := range configMap {
+		sourceDirs, ok := value.([]any)
+		if !ok || !strings.EqualFold(key, "sourceDir") {
+			continue
+		}
+		if len(sourceDirs) == 0 {
+			return errors.New("sourceDir: empty list")
+		}
+		for _, sourceDir := range sourceDirs[:len(sourceDirs)-1] {
+			sourceDirStr, ok := sourceDir.(string)
+			if !ok {
+				return fmt.Errorf("sourceDir: expected a string, got a %T", sourceDir)
+			}
+			var lowerSourceDirAbsPath chezmoi.AbsPath
+			if err := lowerSourceDirAbsPath.Set(sourceDirStr); err != nil {
+				return err
+			}
+			configFile.lowerSourceDirAbsPaths = append(configFile.lowerSourceDirAbsPaths, lowerSourceDirAbsPath)
+		}
+		configMap[key] = sourceDirs[len(sourceDirs)-1]
+	}
+
 	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
 		DecodeHook: mapstructure.ComposeDecodeHookFunc(
 			mapstructure.StringToTimeDurationHookFunc(),
@@ -1492,6 +1754,24 @@ func (c *Config) finalize() {
 		}
 	}
 
+	if c.auditLogWriter != nil {
+		if err := c.auditLogWriter.Close(); err != nil {
+			c.errorf("error: failed to close audit log: %v\n", err)
+		}
+	}
+
+	if c.auditSystem != nil {
+		if err := c.sealAuditLog(); err != nil {
+			c.errorf("error: failed to seal audit log: %v\n", err)
+		}
+	}
+
+	if c.secretCache != nil {
+		if err := c.saveSecretCache(); err != nil {
+			c.errorf("error: failed to save secret cache: %v\n", err)
+		}
+	}
+
 	// Wait for any diff pager process to terminate.
 	if c.diffPagerCmd != nil {
 		if err := c.diffPagerCmdStdin.Close(); err != nil {
@@ -1715,20 +1995,22 @@ func (c *Config) getSourceDirAbsPath(options *getSourceDirAbsPathOptions) (chezm
 		}
 	}
 
-	switch data, err := c.sourceSystem.ReadFile(c.SourceDirAbsPath.JoinString(chezmoi.RootName)); {
-	case errors.Is(err, fs.ErrNotExist):
-		c.sourceDirAbsPath = c.SourceDirAbsPath
-	case err != nil:
-		c.sourceDirAbsPathErr = err
-	default:
-		rootRelPath, err := chezmoi.NewUntrustedRelPath(string(bytes.TrimSpace(data)))
+	c.sourceDirAbsPath, c.sourceDirAbsPathErr = c.sourceRootAbsPath(c.SourceDirAbsPath)
+	return c.sourceDirAbsPath, c.sourceDirAbsPathErr
+}
+
+// getLowerSourceDirAbsPaths returns the source directories layered below the
+// source directory, using .chezmoiroot in each if it exists.
+func (c *Config) getLowerSourceDirAbsPaths() ([]chezmoi.AbsPath, error) {
+	lowerSourceDirAbsPaths := make([]chezmoi.AbsPath, 0, len(c.lowerSourceDirAbsPaths))
+	for _, lowerSourceDirAbsPath := range c.lowerSourceDirAbsPaths {
+		sourceRootAbsPath, err := c.sourceRootAbsPath(lowerSourceDirAbsPath)
 		if err != nil {
-			return chezmoi.EmptyAbsPath, fmt.Errorf("%s: %w", chezmoi.RootName, err)
+			return nil, err
 		}
-		c.sourceDirAbsPath = c.SourceDirAbsPath.Join(rootRelPath)
+		lowerSourceDirAbsPaths = append(lowerSourceDirAbsPaths, sourceRootAbsPath)
 	}
-
-	return c.sourceDirAbsPath, c.sourceDirAbsPathErr
+	return lowerSourceDirAbsPaths, nil
 }
 
 func (c *Config) getSourceState(ctx context.Context, cmd *cobra.Command) (*chezmoi.SourceState, error) {
@@ -1781,6 +2063,7 @@ func (c *Config) getTemplateDataMap(cmd *cobra.Command) map[string]any {
 			"pathSeparator":     templateData.pathSeparator,
 			"rawHomeDir":        templateData.rawHomeDir,
 			"sourceDir":         templateData.sourceDir,
+			"tags":              templateData.tags,
 			"uid":               templateData.uid,
 			"username":          templateData.username,
 			"version":           templateData.version,
@@ -1845,7 +2128,8 @@ func (c *Config) gitCommitMessage(cmd *cobra.Command, status *chezmoigit.Status)
 		"promptMultichoice": c.promptMultichoiceInteractiveTemplateFunc,
 		"promptString":      c.promptStringInteractiveTemplateFunc,
 		"targetRelPath": func(source string) string {
-			return mustValue(chezmoi.NewSourceRelPath(source).TargetRelPath(c.encryption.EncryptedSuffix())).String()
+			encryptedSuffix := chezmoi.EncryptedSuffixOf(c.encryption, path.Base(source))
+			return mustValue(chezmoi.NewSourceRelPath(source).TargetRelPath(encryptedSuffix)).String()
 		},
 	})
 	var name string
@@ -1917,6 +2201,89 @@ func (c *Config) marshal(dataFormat string, data any) error {
 	return c.writeOutput(marshaledData, 0o666)
 }
 
+// auditSealAbsPath returns the path of the file containing the SHA256 of the
+// last record in the audit log.
+func (c *Config) auditSealAbsPath() chezmoi.AbsPath {
+	return chezmoi.NewAbsPath(c.Audit.File.String() + ".sha256")
+}
+
+// newAuditSystem returns a new chezmoi.AuditSystem that wraps system and
+// appends a record of every change to the audit log. It warns if the last
+// record in the audit log does not match the seal written after the last
+// change, which indicates that the log has been truncated or modified.
+func (c *Config) newAuditSystem(cmd *cobra.Command, system chezmoi.System) (*chezmoi.AuditSystem, error) {
+	var prevSHA256 []byte
+	switch data, err := c.baseSystem.ReadFile(c.Audit.File); {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		prevSHA256 = chezmoi.LastAuditRecordSHA256(data)
+	}
+
+	switch data, err := c.baseSystem.ReadFile(c.auditSealAbsPath()); {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		sealSHA256, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.auditSealAbsPath(), err)
+		}
+		if !bytes.Equal(sealSHA256, prevSHA256) {
+			c.errorf("warning: %s: audit log truncated or modified since it was sealed\n", c.Audit.File)
+			// Chain new records to the sealed record so that the gap remains
+			// evident.
+			prevSHA256 = sealSHA256
+		}
+		c.auditSealSHA256 = sealSHA256
+	}
+
+	auditLogWriter := newLazyWriter(func() (io.WriteCloser, error) {
+		if err := chezmoi.MkdirAll(c.baseSystem, c.Audit.File.Dir(), 0o700); err != nil {
+			return nil, err
+		}
+		return os.OpenFile(c.Audit.File.String(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	})
+	c.auditLogWriter = auditLogWriter
+
+	c.auditSystem = chezmoi.NewAuditSystem(system, auditLogWriter, chezmoi.AuditSystemOptions{
+		Command:    cmd.CommandPath(),
+		PrevSHA256: prevSHA256,
+		SourceAbsPathFunc: func(targetAbsPath chezmoi.AbsPath) chezmoi.AbsPath {
+			if c.sourceState == nil {
+				return chezmoi.EmptyAbsPath
+			}
+			targetRelPath, err := targetAbsPath.TrimDirPrefix(c.DestDirAbsPath)
+			if err != nil {
+				return chezmoi.EmptyAbsPath
+			}
+			sourceStateEntry := c.sourceState.Get(targetRelPath)
+			if sourceStateEntry == nil || sourceStateEntry.SourceRelPath().IsEmpty() {
+				return chezmoi.EmptyAbsPath
+			}
+			return c.sourceState.TargetSourceDirAbsPath(targetRelPath).Join(sourceStateEntry.SourceRelPath().RelPath())
+		},
+	})
+	return c.auditSystem, nil
+}
+
+// sealAuditLog writes the SHA256 of the last record in the audit log to the
+// audit log's seal, if it has changed.
+func (c *Config) sealAuditLog() error {
+	lastSHA256 := c.auditSystem.LastSHA256()
+	if lastSHA256 == nil || bytes.Equal(lastSHA256, c.auditSealSHA256) {
+		return nil
+	}
+	data := []byte(hex.EncodeToString(lastSHA256) + "\n")
+	return c.baseSystem.WriteFile(c.auditSealAbsPath(), data, 0o600)
+}
+
+// newBlobStore returns a new blob store in the cache directory.
+func (c *Config) newBlobStore() *chezmoi.BlobStore {
+	return chezmoi.NewBlobStore(c.baseSystem, c.CacheDirAbsPath.JoinString("blobs"))
+}
+
 // newBuiltinDifSystem returns a new builtin diff system.
 func (c *Config) newBuiltinDiffSystem(s chezmoi.System, w io.Writer, dirAbsPath chezmoi.AbsPath) *chezmoi.GitDiffSystem {
 	options := &chezmoi.GitDiffSystemOptions{
@@ -1981,12 +2348,15 @@ func (c *Config) newRootCmd() (*cobra.Command, error) {
 		"Prompt for changed or pre-existing targets",
 	)
 	persistentFlags.Var(&c.Mode, "mode", "Mode")
+	persistentFlags.IntVar(&c.Parallelism, "parallelism", c.Parallelism, "Evaluate at most N targets concurrently")
 	persistentFlags.Var(&c.PersistentStateAbsPath, "persistent-state", "Set persistent state file")
 	persistentFlags.Var(&c.Progress, "progress", "Display progress bars")
 	persistentFlags.BoolVar(&c.Safe, "safe", c.Safe, "Safely replace files and symlinks")
+	persistentFlags.Var(&c.SecretsFixture, "secrets-fixture", "Read password manager secrets from file")
 	persistentFlags.VarP(&c.SourceDirAbsPath, "source", "S", "Set source directory")
 	persistentFlags.Var(&c.UseBuiltinAge, "use-builtin-age", "Use builtin age")
 	persistentFlags.Var(&c.UseBuiltinGit, "use-builtin-git", "Use builtin git")
+	persistentFlags.Var(&c.UseBuiltinGPG, "use-builtin-gpg", "Use builtin OpenPGP")
 	persistentFlags.BoolVarP(&c.Verbose, "verbose", "v", c.Verbose, "Make output more verbose")
 	persistentFlags.VarP(&c.WorkingTreeAbsPath, "working-tree", "W", "Set working tree directory")
 
@@ -2013,6 +2383,7 @@ func (c *Config) newRootCmd() (*cobra.Command, error) {
 		rootCmd.MarkPersistentFlagDirname("destination"),
 		rootCmd.MarkPersistentFlagFilename("output"),
 		persistentFlags.MarkHidden("safe"),
+		rootCmd.MarkPersistentFlagFilename("secrets-fixture"),
 		rootCmd.MarkPersistentFlagDirname("source"),
 		rootCmd.RegisterFlagCompletionFunc("color", autoBoolFlagCompletionFunc),
 		rootCmd.RegisterFlagCompletionFunc("config-format", c.configFormat.FlagCompletionFunc()),
@@ -2033,6 +2404,7 @@ func (c *Config) newRootCmd() (*cobra.Command, error) {
 		c.newAgeKeygenCmd(),
 		c.newApplyCmd(),
 		c.newArchiveCmd(),
+		c.newBackupCmd(),
 		c.newCatCmd(),
 		c.newCatConfigCmd(),
 		c.newCDCmd(),
@@ -2040,6 +2412,7 @@ func (c *Config) newRootCmd() (*cobra.Command, error) {
 		c.newCompletionCmd(),
 		c.newDataCmd(),
 		c.newDecryptCommand(),
+		c.newDepsCmd(),
 		c.newDestroyCmd(),
 		c.newDiffCmd(),
 		c.newDockerCmd(),
@@ -2055,24 +2428,32 @@ func (c *Config) newRootCmd() (*cobra.Command, error) {
 		c.newForgetCmd(),
 		c.newGenerateCmd(),
 		c.newGitCmd(),
+		c.newHistoryCmd(),
 		c.newIgnoredCmd(),
 		c.newImportCmd(),
 		c.newInitCmd(),
 		c.newInternalTestCmd(),
 		c.newLicenseCmd(),
+		c.newLintCmd(),
 		c.newMackupCmd(),
 		c.newManagedCmd(),
 		c.newMergeCmd(),
 		c.newMergeAllCmd(),
+		c.newPlanCmd(),
 		c.newPurgeCmd(),
 		c.newReAddCmd(),
+		c.newRekeyCmd(),
 		c.newRemoveCmd(),
+		c.newRenderCmd(),
 		c.newSSHCmd(),
 		c.newSecretCmd(),
+		c.newShadowedCmd(),
 		c.newSourcePathCmd(),
 		c.newStateCmd(),
 		c.newStatusCmd(),
 		c.newTargetPathCmd(),
+		c.newTestCmd(),
+		c.newUndoCmd(),
 		c.newUnmanagedCmd(),
 		c.newUpdateCmd(),
 		c.newUpgradeCmd(),
@@ -2099,6 +2480,44 @@ func (c *Config) newRootCmd() (*cobra.Command, error) {
 	return rootCmd, nil
 }
 
+// dumpTargetState reads a new SourceState with options and applies the targets
+// returned by targetRelPathsFunc to an empty in-memory destination, with a mock
+// persistent state.
+func (c *Config) dumpTargetState(
+	cmd *cobra.Command,
+	filter *chezmoi.EntryTypeFilter,
+	targetRelPathsFunc func(*chezmoi.SourceState) ([]chezmoi.RelPath, error),
+	options ...chezmoi.SourceStateOption,
+) (*chezmoi.DumpSystem, error) {
+	sourceState, err := c.newSourceState(cmd.Context(), cmd, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	targetRelPaths, err := targetRelPathsFunc(sourceState)
+	if err != nil {
+		return nil, err
+	}
+
+	dumpSystem := chezmoi.NewDumpSystem()
+	persistentState := chezmoi.NewMockPersistentState()
+	applyOptions := chezmoi.ApplyOptions{
+		Filter: filter,
+		Umask:  c.Umask,
+	}
+	for _, targetRelPath := range targetRelPaths {
+		switch err := sourceState.Apply(
+			dumpSystem, dumpSystem, persistentState, chezmoi.EmptyAbsPath, targetRelPath, applyOptions,
+		); {
+		case errors.Is(err, fs.SkipDir):
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("%s: %w", targetRelPath, err)
+		}
+	}
+	return dumpSystem, nil
+}
+
 // newSourceState returns a new SourceState with options.
 func (c *Config) newSourceState(
 	ctx context.Context,
@@ -2120,6 +2539,10 @@ func (c *Config) newSourceState(
 	if err != nil {
 		return nil, err
 	}
+	lowerSourceDirAbsPaths, err := c.getLowerSourceDirAbsPaths()
+	if err != nil {
+		return nil, err
+	}
 
 	if err := c.runHookPre(readSourceStateHookName); err != nil {
 		return nil, err
@@ -2145,6 +2568,19 @@ func (c *Config) newSourceState(
 		chezmoi.RecursiveMerge(priorityTemplateData, overrideData)
 	}
 
+	if c.SourceCache {
+		sourceDirs := c.SourceDirAbsPath.String()
+		for _, lowerSourceDirAbsPath := range lowerSourceDirAbsPaths {
+			sourceDirs += "\x00" + lowerSourceDirAbsPath.String()
+		}
+		sourceDirSHA256 := sha256.Sum256([]byte(sourceDirs))
+		sourceStateCacheAbsPath := c.CacheDirAbsPath.JoinString(
+			"source",
+			hex.EncodeToString(sourceDirSHA256[:])+".json",
+		)
+		options = append(options, chezmoi.WithSourceStateCache(chezmoi.NewSourceStateCache(c.baseSystem, sourceStateCacheAbsPath)))
+	}
+
 	sourceState := chezmoi.NewSourceState(append([]chezmoi.SourceStateOption{
 		chezmoi.WithBaseSystem(c.baseSystem),
 		chezmoi.WithCacheDir(c.CacheDirAbsPath),
@@ -2153,9 +2589,11 @@ func (c *Config) newSourceState(
 		}),
 		chezmoi.WithDestDir(c.DestDirAbsPath),
 		chezmoi.WithEncryption(c.encryption),
+		chezmoi.WithEncryptions(c.encryptions),
 		chezmoi.WithHTTPClient(httpClient),
 		chezmoi.WithInterpreters(c.Interpreters),
 		chezmoi.WithLogger(sourceStateLogger),
+		chezmoi.WithLowerSourceDirs(lowerSourceDirAbsPaths),
 		chezmoi.WithMode(c.Mode),
 		chezmoi.WithPriorityTemplateData(priorityTemplateData),
 		chezmoi.WithScriptTempDir(c.ScriptTempDir),
@@ -2163,6 +2601,7 @@ func (c *Config) newSourceState(
 		chezmoi.WithSystem(c.sourceSystem),
 		chezmoi.WithTemplateFuncs(c.templateFuncs),
 		chezmoi.WithTemplateOptions(c.Template.Options),
+		chezmoi.WithTemplateProfiler(c.templateProfiler),
 		chezmoi.WithUmask(c.Umask),
 		chezmoi.WithVersion(c.version),
 		chezmoi.WithWarnFunc(c.errorf),
@@ -2295,6 +2734,7 @@ func (c *Config) newTemplateData(cmd *cobra.Command) *templateData {
 		pathSeparator:     string(os.PathSeparator),
 		rawHomeDir:        rawHomeDir,
 		sourceDir:         sourceDirAbsPath.String(),
+		tags:              c.tagFilter.IncludedTags(),
 		uid:               uid,
 		username:          username,
 		version: map[string]any{
@@ -2325,6 +2765,12 @@ func (c *Config) pageDiffOutput(output string) error {
 func (c *Config) persistentPostRunRootE(cmd *cobra.Command, args []string) error {
 	annotations := getAnnotations(cmd)
 
+	if c.templateProfiler != nil {
+		if err := c.writeTemplateProfile(); err != nil {
+			return err
+		}
+	}
+
 	// Verify modified config.
 	if annotations.hasTag(modifiesConfigFile) {
 		configFileAbsPath, err := c.getConfigFileAbsPath()
@@ -2400,6 +2846,7 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 	// spf13/pflag does not round trip them correctly.
 	changedFlags := make(map[pflag.Value]string)
 	brokenFlagTypes := map[string]bool{
+		"stringSlice":    true,
 		"stringToInt":    true,
 		"stringToInt64":  true,
 		"stringToString": true,
@@ -2436,6 +2883,20 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 		return errors.New("the --force and --interactive flags are mutually exclusive")
 	}
 
+	// Use the tags from the config file if no tags were given on the command
+	// line.
+	if c.tagFilter.IsEmpty() {
+		if err := c.tagFilter.SetSlice(c.Tags); err != nil {
+			return fmt.Errorf("invalid config: tags: %w", err)
+		}
+	}
+
+	// Record the time spent executing templates if requested.
+	if c.profileTemplates.String() != "" {
+		c.templateProfiler = chezmoi.NewTemplateProfiler(time.Now)
+		c.profileTemplateFuncs()
+	}
+
 	// Configure the logger.
 	var handler slog.Handler
 	if c.debug {
@@ -2532,6 +2993,13 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 	if !annotations.hasTag(modifiesSourceDirectory) {
 		c.sourceSystem = chezmoi.NewReadOnlySystem(c.sourceSystem)
 	}
+	if annotations.hasTag(modifiesDestinationDirectory) && !c.Audit.File.IsEmpty() && !c.dryRun {
+		auditSystem, err := c.newAuditSystem(cmd, c.destSystem)
+		if err != nil {
+			return err
+		}
+		c.destSystem = auditSystem
+	}
 	if c.dryRun || annotations.hasTag(dryRun) {
 		c.sourceSystem = chezmoi.NewDryRunSystem(c.sourceSystem)
 		c.destSystem = chezmoi.NewDryRunSystem(c.destSystem)
@@ -2567,6 +3035,17 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 		return err
 	}
 
+	// Replace password manager template functions with lookups in the secrets
+	// fixture if set, otherwise cache their results if requested.
+	switch {
+	case !c.SecretsFixture.IsEmpty():
+		if err := c.useSecretsFixture(); err != nil {
+			return err
+		}
+	case c.SecretCache.Enabled:
+		c.cacheSecretTemplateFuncs()
+	}
+
 	// Create the config directory if needed.
 	if annotations.hasTag(requiresConfigDirectory) {
 		configFileAbsPath, err := c.getConfigFileAbsPath()
@@ -2736,12 +3215,96 @@ func (c *Config) readConfig(configFileAbsPath chezmoi.AbsPath) error {
 	}
 }
 
+// recordApplyHistory records the previous state of all targets modified
+// through journalSystem, and their previous entry states in
+// entryStateSnapshot, in the apply history.
+func (c *Config) recordApplyHistory(journalSystem *chezmoi.JournalSystem, entryStateSnapshot map[string][]byte) error {
+	journal := journalSystem.Journal()
+	if len(journal) == 0 {
+		return nil
+	}
+
+	blobStore := c.newBlobStore()
+	for _, entry := range journal {
+		if err := entry.Save(blobStore); err != nil {
+			return err
+		}
+	}
+
+	applyRecord := chezmoi.NewApplyRecord(time.Now())
+	applyRecord.Journal = journal
+	setPrevEntryState := func(key string) error {
+		value, ok := entryStateSnapshot[key]
+		if !ok {
+			applyRecord.EntryStates[chezmoi.NewAbsPath(key)] = nil
+			return nil
+		}
+		var entryState chezmoi.EntryState
+		if err := chezmoi.FormatJSON.Unmarshal(value, &entryState); err != nil {
+			return err
+		}
+		applyRecord.EntryStates[chezmoi.NewAbsPath(key)] = &entryState
+		return nil
+	}
+	entryStates := make(map[string]struct{})
+	if err := c.persistentState.ForEach(chezmoi.EntryStateBucket, func(k, v []byte) error {
+		entryStates[string(k)] = struct{}{}
+		if bytes.Equal(v, entryStateSnapshot[string(k)]) {
+			return nil
+		}
+		return setPrevEntryState(string(k))
+	}); err != nil {
+		return err
+	}
+	for key := range entryStateSnapshot {
+		if _, ok := entryStates[key]; !ok {
+			if err := setPrevEntryState(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := chezmoi.PersistentStateSet(c.persistentState, chezmoi.ApplyHistoryBucket, []byte(applyRecord.ID), applyRecord); err != nil {
+		return err
+	}
+
+	return c.pruneApplyHistory()
+}
+
 // resetSourceState clears the cached source state, if any.
 func (c *Config) resetSourceState() {
 	c.sourceState = nil
 	c.sourceStateErr = nil
 }
 
+// rollbackApply restores all targets modified through journalSystem and
+// restores the entry state bucket to entryStateSnapshot.
+func (c *Config) rollbackApply(journalSystem *chezmoi.JournalSystem, entryStateSnapshot map[string][]byte) error {
+	if err := journalSystem.Rollback(); err != nil {
+		return err
+	}
+	var keys [][]byte
+	if err := c.persistentState.ForEach(chezmoi.EntryStateBucket, func(k, v []byte) error {
+		if _, ok := entryStateSnapshot[string(k)]; !ok {
+			keys = append(keys, slices.Clone(k))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := c.persistentState.Delete(chezmoi.EntryStateBucket, key); err != nil {
+			return err
+		}
+	}
+	for key, value := range entryStateSnapshot {
+		if err := c.persistentState.Set(chezmoi.EntryStateBucket, []byte(key), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // run runs name with args in dir.
 func (c *Config) run(dir chezmoi.AbsPath, name string, args []string) error {
 	cmd := exec.Command(name, args...)
@@ -2854,6 +3417,36 @@ func (c *Config) runInstallInitShellSh(
 	return c.run(chezmoi.EmptyAbsPath, command, allArgs)
 }
 
+// newSecretTemplateFuncs returns the template functions in
+// templateFuncProviders whose providers are not in nonSecretProviders.
+func newSecretTemplateFuncs(
+	templateFuncProviders map[string]string,
+	nonSecretProviders chezmoiset.Set[string],
+) chezmoiset.Set[string] {
+	secretTemplateFuncs := chezmoiset.New[string]()
+	for name, provider := range templateFuncProviders {
+		if !nonSecretProviders.Contains(provider) {
+			secretTemplateFuncs.Add(name)
+		}
+	}
+	return secretTemplateFuncs
+}
+
+// serializeTemplateFunc returns a template function that calls templateFunc
+// while holding mutex.
+func serializeTemplateFunc(mutex *sync.Mutex, templateFunc any) any {
+	templateFuncValue := reflect.ValueOf(templateFunc)
+	templateFuncType := templateFuncValue.Type()
+	return reflect.MakeFunc(templateFuncType, func(args []reflect.Value) []reflect.Value {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if templateFuncType.IsVariadic() {
+			return templateFuncValue.CallSlice(args)
+		}
+		return templateFuncValue.Call(args)
+	}).Interface()
+}
+
 // setEncryption configures c's encryption.
 func (c *Config) setEncryption() error {
 	// Override the age recipients for encryption if --age-recipient or
@@ -2873,31 +3466,40 @@ func (c *Config) setEncryption() error {
 		c.Age.RecipientsFiles = nil
 	}
 
+	// Age and gpg are configured if any non-default configuration is set.
+	ageConfig := c.Age
+	ageConfig.UseBuiltin = defaultAgeEncryptionConfig.UseBuiltin
+	ageConfigured := !reflect.DeepEqual(ageConfig, defaultAgeEncryptionConfig)
+	gpgConfig := c.GPG
+	gpgConfig.UseBuiltin = defaultGPGEncryptionConfig.UseBuiltin
+	gpgConfig.Passphrase = defaultGPGEncryptionConfig.Passphrase
+	gpgConfigured := !reflect.DeepEqual(gpgConfig, defaultGPGEncryptionConfig)
+
+	var defaultEncryptionName string
+	detected := false
 	switch c.Encryption {
-	case "age":
-		c.Age.UseBuiltin = c.UseBuiltinAge.Value(c.useBuiltinAgeAutoFunc)
-		c.encryption = &c.Age
-	case "gpg":
-		c.encryption = &c.GPG
+	case "age", "gpg":
+		defaultEncryptionName = c.Encryption
 	case "transparent":
 		c.encryption = chezmoi.TransparentEncryption{}
 	case "":
 		// Detect encryption if any non-default configuration is set, preferring
 		// gpg for backwards compatibility.
 		switch {
-		case !reflect.DeepEqual(c.GPG, defaultGPGEncryptionConfig):
+		case gpgConfigured:
 			c.errorf(
 				"warning: 'encryption' not set, using gpg configuration. " +
 					"Check if 'encryption' is correctly set as the top-level key.\n",
 			)
-			c.encryption = &c.GPG
-		case !reflect.DeepEqual(c.Age, defaultAgeEncryptionConfig):
+			defaultEncryptionName = "gpg"
+			detected = true
+		case ageConfigured:
 			c.errorf(
 				"warning: 'encryption' not set, using age configuration. " +
 					"Check if 'encryption' is correctly set as the top-level key.\n",
 			)
-			c.Age.UseBuiltin = c.UseBuiltinAge.Value(c.useBuiltinAgeAutoFunc)
-			c.encryption = &c.Age
+			defaultEncryptionName = "age"
+			detected = true
 		default:
 			c.encryption = chezmoi.NoEncryption{}
 		}
@@ -2905,14 +3507,77 @@ func (c *Config) setEncryption() error {
 		return fmt.Errorf("%s: unknown encryption", c.Encryption)
 	}
 
+	var encryptionLogger *slog.Logger
+	if c.debug {
+		encryptionLogger = c.logger.With(slog.String(logComponentKey, logComponentValueEncryption))
+	}
+
+	// In addition to the default encryption, use the encryptions listed in
+	// encryptions, so that files encrypted with any of them can be used. This
+	// requires encryption to be set explicitly.
+	encryptionNames := chezmoiset.New[string]()
+	for _, name := range c.Encryptions {
+		switch {
+		case !slices.Contains(encryptionValues, name) || name == "":
+			return fmt.Errorf("encryptions: %s: unknown encryption", name)
+		case defaultEncryptionName == "" || detected:
+			return errors.New("encryptions: encryption must be set to age or gpg")
+		}
+		encryptionNames.Add(name)
+	}
+	if defaultEncryptionName == "" {
+		if c.debug {
+			c.encryption = chezmoi.NewDebugEncryption(c.encryption, encryptionLogger)
+		}
+		return nil
+	}
+	encryptionNames.Add(defaultEncryptionName)
+	c.encryptions = make(map[string]chezmoi.Encryption)
+	if encryptionNames.Contains("age") {
+		c.Age.UseBuiltin = c.UseBuiltinAge.Value(c.useBuiltinAgeAutoFunc)
+		c.encryptions["age"] = &c.Age
+	}
+	if encryptionNames.Contains("gpg") {
+		c.GPG.UseBuiltin = c.UseBuiltinGPG.Value(c.useBuiltinGPGAutoFunc)
+		c.GPG.Passphrase = sync.OnceValues(func() (string, error) {
+			return c.readPassword("Enter passphrase: ", "passphrase")
+		})
+		c.encryptions["gpg"] = &c.GPG
+	}
 	if c.debug {
-		encryptionLogger := c.logger.With(slog.String(logComponentKey, logComponentValueEncryption))
-		c.encryption = chezmoi.NewDebugEncryption(c.encryption, encryptionLogger)
+		for name, encryption := range c.encryptions {
+			c.encryptions[name] = chezmoi.NewDebugEncryption(encryption, encryptionLogger)
+		}
+	}
+	if len(c.encryptions) == 1 {
+		c.encryption = c.encryptions[defaultEncryptionName]
+	} else {
+		c.encryption = chezmoi.NewMultiEncryption(defaultEncryptionName, c.encryptions)
 	}
 
 	return nil
 }
 
+// encryptionValues are the names of the encryptions that can be chosen
+// explicitly.
+var encryptionValues = []string{
+	"",
+	"age",
+	"gpg",
+}
+
+// encryptionNamed returns the encryption named name, or the default encryption
+// if name is empty.
+func (c *Config) encryptionNamed(name string) (chezmoi.Encryption, error) {
+	if name == "" {
+		return c.encryption, nil
+	}
+	if encryption, ok := c.encryptions[name]; ok {
+		return encryption, nil
+	}
+	return nil, fmt.Errorf("%s: encryption not configured", name)
+}
+
 // setEnvironmentVariables sets all environment variables defined in c.
 func (c *Config) setEnvironmentVariables() error {
 	var env map[string]string
@@ -2935,6 +3600,23 @@ func (c *Config) setEnvironmentVariables() error {
 	return nil
 }
 
+// sourceRootAbsPath returns the root of the source state in sourceDirAbsPath,
+// using .chezmoiroot if it exists.
+func (c *Config) sourceRootAbsPath(sourceDirAbsPath chezmoi.AbsPath) (chezmoi.AbsPath, error) {
+	switch data, err := c.sourceSystem.ReadFile(sourceDirAbsPath.JoinString(chezmoi.RootName)); {
+	case errors.Is(err, fs.ErrNotExist):
+		return sourceDirAbsPath, nil
+	case err != nil:
+		return chezmoi.EmptyAbsPath, err
+	default:
+		rootRelPath, err := chezmoi.NewUntrustedRelPath(string(bytes.TrimSpace(data)))
+		if err != nil {
+			return chezmoi.EmptyAbsPath, fmt.Errorf("%s: %w", chezmoi.RootName, err)
+		}
+		return sourceDirAbsPath.Join(rootRelPath), nil
+	}
+}
+
 // sourceAbsPaths returns the source absolute paths for each target path in
 // args.
 func (c *Config) sourceAbsPaths(sourceState *chezmoi.SourceState, args []string) ([]chezmoi.AbsPath, error) {
@@ -2946,7 +3628,8 @@ func (c *Config) sourceAbsPaths(sourceState *chezmoi.SourceState, args []string)
 	}
 	sourceAbsPaths := make([]chezmoi.AbsPath, 0, len(targetRelPaths))
 	for _, targetRelPath := range targetRelPaths {
-		sourceAbsPath := c.SourceDirAbsPath.Join(sourceState.MustEntry(targetRelPath).SourceRelPath().RelPath())
+		sourceDirAbsPath := sourceState.TargetSourceDirAbsPath(targetRelPath)
+		sourceAbsPath := sourceDirAbsPath.Join(sourceState.MustEntry(targetRelPath).SourceRelPath().RelPath())
 		sourceAbsPaths = append(sourceAbsPaths, sourceAbsPath)
 	}
 	return sourceAbsPaths, nil
@@ -3034,11 +3717,12 @@ func (c *Config) targetRelPaths(
 // args.
 func (c *Config) targetRelPathsBySourcePath(sourceState *chezmoi.SourceState, args []string) ([]chezmoi.RelPath, error) {
 	targetRelPaths := make([]chezmoi.RelPath, len(args))
-	targetRelPathsBySourceRelPath := make(map[chezmoi.RelPath]chezmoi.RelPath)
+	targetRelPathsBySourceAbsPath := make(map[chezmoi.AbsPath]chezmoi.RelPath)
 	_ = sourceState.ForEach(
 		func(targetRelPath chezmoi.RelPath, sourceStateEntry chezmoi.SourceStateEntry) error {
-			sourceRelPath := sourceStateEntry.SourceRelPath().RelPath()
-			targetRelPathsBySourceRelPath[sourceRelPath] = targetRelPath
+			sourceDirAbsPath := sourceState.TargetSourceDirAbsPath(targetRelPath)
+			sourceAbsPath := sourceDirAbsPath.Join(sourceStateEntry.SourceRelPath().RelPath())
+			targetRelPathsBySourceAbsPath[sourceAbsPath] = targetRelPath
 			return nil
 		},
 	)
@@ -3047,11 +3731,11 @@ func (c *Config) targetRelPathsBySourcePath(sourceState *chezmoi.SourceState, ar
 		if err != nil {
 			return nil, err
 		}
-		sourceRelPath, err := argAbsPath.TrimDirPrefix(c.SourceDirAbsPath)
-		if err != nil {
+		if !slices.ContainsFunc(sourceState.SourceDirAbsPaths(), argAbsPath.HasDirPrefix) {
+			_, err := argAbsPath.TrimDirPrefix(c.SourceDirAbsPath)
 			return nil, err
 		}
-		targetRelPath, ok := targetRelPathsBySourceRelPath[sourceRelPath]
+		targetRelPath, ok := targetRelPathsBySourceAbsPath[argAbsPath]
 		if !ok {
 			return nil, fmt.Errorf("%s: not in source state", arg)
 		}
@@ -3139,6 +3823,14 @@ func (c *Config) useBuiltinGitAutoFunc() bool {
 	return true
 }
 
+// useBuiltinGPGAutoFunc detects whether the builtin OpenPGP should be used.
+func (c *Config) useBuiltinGPGAutoFunc() bool {
+	if _, err := chezmoi.LookPath(c.GPG.Command); err == nil {
+		return false
+	}
+	return true
+}
+
 // writeOutput writes data to the configured output.
 func (c *Config) writeOutput(data []byte, perm fs.FileMode) error {
 	if c.outputAbsPath.IsEmpty() || c.outputAbsPath == chezmoi.NewAbsPath("-") {
@@ -3202,13 +3894,17 @@ func newConfigFile(bds *xdg.BaseDirectorySpecification) ConfigFile {
 		Interpreters: DefaultInterpreters,
 		Mode:         chezmoi.ModeFile,
 		Pager:        os.Getenv("PAGER"),
+		Parallelism:  1,
 		Progress: autoBool{
 			auto: true,
 		},
 		PINEntry: pinEntryConfig{
 			Options: pinEntryDefaultOptions,
 		},
-		Safe:    true,
+		Safe: true,
+		SecretCache: secretCacheConfig{
+			TTL: 24 * time.Hour,
+		},
 		TempDir: chezmoi.NewAbsPath(os.TempDir()),
 		Template: templateConfig{
 			Options: chezmoi.DefaultTemplateOptions,
@@ -3220,6 +3916,9 @@ func newConfigFile(bds *xdg.BaseDirectorySpecification) ConfigFile {
 		UseBuiltinGit: autoBool{
 			auto: true,
 		},
+		UseBuiltinGPG: autoBool{
+			auto: true,
+		},
 		Warnings: warningsConfig{
 			ConfigFileTemplateHasChanged: true,
 		},
@@ -3282,9 +3981,10 @@ func newConfigFile(bds *xdg.BaseDirectorySpecification) ConfigFile {
 
 		// Command configurations.
 		Add: addCmdConfig{
-			Secrets:   newChoiceFlag("warning", severityValues),
-			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
-			recursive: true,
+			Secrets:    newChoiceFlag("warning", severityValues),
+			encryption: newChoiceFlag("", encryptionValues),
+			filter:     chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
+			recursive:  true,
 		},
 		Diff: diffCmdConfig{
 			Exclude:        chezmoi.NewEntryTypeSet(chezmoi.EntryTypesNone),
@@ -3311,12 +4011,16 @@ func newConfigFile(bds *xdg.BaseDirectorySpecification) ConfigFile {
 		GitHub: gitHubConfig{
 			RefreshPeriod: 1 * time.Minute,
 		},
+		History: historyCmdConfig{
+			Keep:   10,
+			format: newChoiceFlag("", writeDataFormatValues),
+		},
 		Merge: mergeCmdConfig{
 			Command: "vimdiff",
 		},
 		Status: statusCmdConfig{
 			Exclude:   chezmoi.NewEntryTypeSet(chezmoi.EntryTypesNone),
-			PathStyle: newChoiceFlag(pathStyleRelative, targetPathStyleValues),
+			PathStyle: newChoiceFlag(pathStyleRelative, sourceOrTargetSinglePathStyleValues),
 			include:   chezmoi.NewEntryTypeSet(chezmoi.EntryTypesAll),
 			recursive: true,
 		},
@@ -10,7 +10,10 @@ import (
 	"runtime"
 	"slices"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/assert/v2"
 	"github.com/twpayne/go-vfs/v5"
@@ -49,6 +52,56 @@ func TestAddTemplateFuncPanic(t *testing.T) {
 	})
 }
 
+func TestSerializeTemplateFunc(t *testing.T) {
+	var mutex sync.Mutex
+
+	calls := 0
+	incrementFunc := serializeTemplateFunc(&mutex, func(n int) int {
+		calls += n
+		return calls
+	}).(func(int) int) //nolint:forcetypeassert
+	var waitGroup sync.WaitGroup
+	for range 100 {
+		waitGroup.Go(func() {
+			incrementFunc(1)
+		})
+	}
+	waitGroup.Wait()
+	assert.Equal(t, 100, calls)
+
+	joinFunc := serializeTemplateFunc(&mutex, func(sep string, elems ...string) string {
+		return strings.Join(elems, sep)
+	}).(func(string, ...string) string) //nolint:forcetypeassert
+	assert.Equal(t, "a,b", joinFunc(",", "a", "b"))
+
+	panicFunc := serializeTemplateFunc(&mutex, func() string {
+		panic("panic")
+	}).(func() string) //nolint:forcetypeassert
+	assert.Panics(t, func() {
+		panicFunc()
+	})
+	assert.Equal(t, 101, incrementFunc(1))
+
+	// Functions serialized with different mutexes can run concurrently.
+	var otherMutex sync.Mutex
+	done := make(chan struct{})
+	waitFunc := serializeTemplateFunc(&mutex, func() string {
+		<-done
+		return "waited"
+	}).(func() string) //nolint:forcetypeassert
+	closeFunc := serializeTemplateFunc(&otherMutex, func() string {
+		close(done)
+		return "closed"
+	}).(func() string) //nolint:forcetypeassert
+	var waitResult string
+	waitGroup.Go(func() {
+		waitResult = waitFunc()
+	})
+	assert.Equal(t, "closed", closeFunc())
+	waitGroup.Wait()
+	assert.Equal(t, "waited", waitResult)
+}
+
 func TestConfigFileFormatRoundTrip(t *testing.T) {
 	for _, format := range []chezmoi.Format{
 		chezmoi.FormatJSON,
@@ -67,12 +120,16 @@ func TestConfigFileFormatRoundTrip(t *testing.T) {
 					Options: []string{},
 				},
 				ScriptEnv: map[string]string{},
+				SecretCache: secretCacheConfig{
+					TTLs: map[string]time.Duration{},
+				},
 				Template: templateConfig{
 					Options: []string{},
 				},
 				TextConv:      []*textConvElement{},
 				UseBuiltinAge: autoBool{value: false},
 				UseBuiltinGit: autoBool{value: true},
+				UseBuiltinGPG: autoBool{value: false},
 				Dashlane: dashlaneConfig{
 					Args: []string{},
 				},
@@ -100,6 +157,7 @@ func TestConfigFileFormatRoundTrip(t *testing.T) {
 				},
 				GPG: chezmoi.GPGEncryption{
 					Args:       []string{},
+					Keyrings:   []chezmoi.AbsPath{},
 					Recipients: []string{},
 				},
 				Add: addCmdConfig{
@@ -2,8 +2,14 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoi"
 )
 
+type decryptCmdConfig struct {
+	values bool
+}
+
 func (c *Config) newDecryptCommand() *cobra.Command {
 	decryptCmd := &cobra.Command{
 		GroupID: groupIDEncryption,
@@ -17,9 +23,16 @@ func (c *Config) newDecryptCommand() *cobra.Command {
 		),
 	}
 
+	decryptCmd.Flags().BoolVar(&c.decrypt.values, "values", c.decrypt.values, "Decrypt only the encrypted values in the input")
+
 	return decryptCmd
 }
 
 func (c *Config) runDecryptCmd(cmd *cobra.Command, args []string) error {
+	if c.decrypt.values {
+		return c.filterInput(args, func(data []byte) ([]byte, error) {
+			return chezmoi.DecryptValues(c.encryption, data)
+		})
+	}
 	return c.filterInput(args, c.encryption.Decrypt)
 }
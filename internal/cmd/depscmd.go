@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoi"
+)
+
+type depsCmdConfig struct {
+	format           *choiceFlag
+	nulPathSeparator bool
+	uses             []string
+}
+
+func (c *Config) newDepsCmd() *cobra.Command {
+	depsCmd := &cobra.Command{
+		GroupID:           groupIDTemplate,
+		Use:               "deps [target]...",
+		Short:             "Print the dependencies of templates",
+		Long:              mustLongHelp("deps"),
+		Example:           example("deps"),
+		Args:              cobra.ArbitraryArgs,
+		ValidArgsFunction: c.targetValidArgs,
+		RunE:              c.makeRunEWithSourceState(c.runDepsCmd),
+		Annotations: newAnnotations(
+			persistentStateModeReadMockWrite,
+		),
+	}
+
+	depsCmd.Flags().VarP(c.deps.format, "format", "f", "Output format")
+	must(depsCmd.RegisterFlagCompletionFunc("format", c.deps.format.FlagCompletionFunc()))
+	depsCmd.Flags().
+		BoolVarP(&c.deps.nulPathSeparator, "nul-path-separator", "0", c.deps.nulPathSeparator, "Use the NUL character as a path separator")
+	depsCmd.Flags().StringSliceVar(&c.deps.uses, "uses", c.deps.uses, "Print targets that depend on a data key, template, or function")
+
+	return depsCmd
+}
+
+func (c *Config) runDepsCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
+	var targetRelPaths []chezmoi.RelPath
+	if len(args) == 0 {
+		targetRelPaths = sourceState.TargetRelPaths()
+	} else {
+		var err error
+		targetRelPaths, err = c.targetRelPaths(sourceState, args, targetRelPathsOptions{
+			recursive: true,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	type depsEntry struct {
+		Data      []string `json:"data,omitempty"      yaml:"data,omitempty"`
+		Templates []string `json:"templates,omitempty" yaml:"templates,omitempty"`
+		Functions []string `json:"functions,omitempty" yaml:"functions,omitempty"`
+		Secrets   []string `json:"secrets,omitempty"   yaml:"secrets,omitempty"`
+	}
+	depsEntries := make(map[string]*depsEntry)
+	var usesTargetRelPaths []string
+	for _, targetRelPath := range targetRelPaths {
+		templateDeps, err := sourceState.TemplateDeps(targetRelPath)
+		if err != nil {
+			return err
+		}
+		if templateDeps == nil {
+			continue
+		}
+
+		if len(c.deps.uses) != 0 {
+			if slices.ContainsFunc(c.deps.uses, templateDeps.Uses) {
+				usesTargetRelPaths = append(usesTargetRelPaths, targetRelPath.String())
+			}
+			continue
+		}
+
+		var secrets []string
+		for _, funcName := range templateDeps.Funcs {
+			if secretTemplateFuncs.Contains(funcName) {
+				secrets = append(secrets, funcName)
+			}
+		}
+		depsEntries[targetRelPath.String()] = &depsEntry{
+			Data:      templateDeps.DataKeys,
+			Templates: templateDeps.Templates,
+			Functions: templateDeps.Funcs,
+			Secrets:   secrets,
+		}
+	}
+
+	if len(c.deps.uses) != 0 {
+		return c.writePaths(usesTargetRelPaths, writePathsOptions{
+			nulPathSeparator: c.deps.nulPathSeparator,
+		})
+	}
+	return c.marshal(cmp.Or(c.deps.format.String(), c.Format.String()), depsEntries)
+}
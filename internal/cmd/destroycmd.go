@@ -69,7 +69,7 @@ func (c *Config) runDestroyCmd(cmd *cobra.Command, args []string, sourceState *c
 		if _, ok := sourceStateEntry.(*chezmoi.SourceStateRemove); !ok {
 			relPath := sourceStateEntry.SourceRelPath().RelPath()
 			if !relPath.IsEmpty() {
-				sourceAbsPath = c.SourceDirAbsPath.Join(relPath)
+				sourceAbsPath = sourceState.TargetSourceDirAbsPath(targetRelPath).Join(relPath)
 			}
 		}
 		if !c.force {
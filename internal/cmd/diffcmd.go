@@ -43,9 +43,13 @@ func (c *Config) newDiffCmd() *cobra.Command {
 	diffCmd.Flags().StringVar(&c.Diff.Pager, "pager", c.Diff.Pager, "Set pager")
 	diffCmd.Flags().
 		BoolVarP(&c.Diff.parentDirs, "parent-dirs", "P", c.apply.parentDirs, "Print the diff of all parent directories")
+	diffCmd.Flags().Var(c.profileTemplates, "profile-templates", "Print the time spent executing templates")
+	diffCmd.Flags().Lookup("profile-templates").NoOptDefVal = profileTemplatesFormatText
+	must(diffCmd.RegisterFlagCompletionFunc("profile-templates", c.profileTemplates.FlagCompletionFunc()))
 	diffCmd.Flags().BoolVarP(&c.Diff.recursive, "recursive", "r", c.Diff.recursive, "Recurse into subdirectories")
 	diffCmd.Flags().BoolVar(&c.Diff.Reverse, "reverse", c.Diff.Reverse, "Reverse the direction of the diff")
 	diffCmd.Flags().BoolVar(&c.Diff.ScriptContents, "script-contents", c.Diff.ScriptContents, "Show script contents")
+	diffCmd.Flags().Var(c.tagFilter, "tags", "Only include targets with tags")
 
 	return diffCmd
 }
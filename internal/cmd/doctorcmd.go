@@ -132,6 +132,13 @@ type osArchCheck struct{}
 // A omittedCheck is a check that is omitted.
 type omittedCheck struct{}
 
+// A recipientsCheck checks that encrypted files are encrypted to the recipients
+// from their .chezmoirecipients files.
+type recipientsCheck struct {
+	cmd     *cobra.Command
+	dirname chezmoi.AbsPath
+}
+
 // A suspiciousEntriesCheck checks that a source directory does not contain any
 // suspicious files.
 type suspiciousEntriesCheck struct {
@@ -220,6 +227,10 @@ func (c *Config) runDoctorCmd(cmd *cobra.Command, args []string) error {
 				c.GPG.Suffix,
 			},
 		},
+		&recipientsCheck{
+			cmd:     cmd,
+			dirname: c.SourceDirAbsPath,
+		},
 		&dirCheck{
 			name:    "working-tree",
 			dirname: c.WorkingTreeAbsPath,
@@ -761,6 +772,58 @@ func (omittedCheck) Run(config *Config) (checkResult, string) {
 	return checkResultOmitted, ""
 }
 
+func (c *recipientsCheck) Name() string {
+	return "recipients"
+}
+
+func (c *recipientsCheck) Run(config *Config) (checkResult, string) {
+	// Only read the source state if there are .chezmoirecipients files, as
+	// reading the source state can fail for many reasons unrelated to
+	// recipients.
+	hasRecipientsFiles := false
+	walkFunc := func(absPath chezmoi.AbsPath, fileInfo fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if name := absPath.Base(); name == chezmoi.RecipientsName || name == chezmoi.RecipientsName+chezmoi.TemplateSuffix {
+			hasRecipientsFiles = true
+			return fs.SkipAll
+		}
+		return nil
+	}
+	switch err := chezmoi.WalkSourceDir(config.baseSystem, c.dirname, walkFunc); {
+	case errors.Is(err, fs.ErrNotExist):
+		return checkResultOmitted, ""
+	case err != nil && !errors.Is(err, fs.SkipAll):
+		return checkResultError, err.Error()
+	case !hasRecipientsFiles:
+		return checkResultOmitted, ""
+	}
+
+	sourceState, err := config.getSourceState(c.cmd.Context(), c.cmd)
+	if err != nil {
+		return checkResultFailed, err.Error()
+	}
+	mismatches, err := sourceState.RecipientsMismatches()
+	if err != nil {
+		return checkResultError, err.Error()
+	}
+	if len(mismatches) > 0 {
+		mismatchStrs := make([]string, 0, len(mismatches))
+		for _, mismatch := range mismatches {
+			if len(mismatch.Missing) != 0 {
+				mismatchStrs = append(mismatchStrs, fmt.Sprintf("%s (not encrypted to %s)",
+					mismatch.TargetRelPath, englishList(mismatch.Missing)))
+				continue
+			}
+			mismatchStrs = append(mismatchStrs, fmt.Sprintf("%s (%d recipients, expected %d)",
+				mismatch.TargetRelPath, mismatch.Actual, mismatch.Expected))
+		}
+		return checkResultWarning, "re-add --re-encrypt required for " + englishList(mismatchStrs)
+	}
+	return checkResultOK, "all encrypted files match their recipients"
+}
+
 func (c *suspiciousEntriesCheck) Name() string {
 	return "suspicious-entries"
 }
@@ -60,12 +60,14 @@ func (c *Config) runEditCmd(cmd *cobra.Command, args []string) error {
 		}
 		if c.Edit.Apply {
 			if err := c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, noArgs, applyArgsOptions{
-				cmd:          cmd,
-				filter:       c.Edit.filter,
-				init:         c.Edit.init,
-				recursive:    true,
-				umask:        c.Umask,
-				preApplyFunc: c.defaultPreApplyFunc,
+				cmd:           cmd,
+				backup:        true,
+				filter:        c.Edit.filter,
+				init:          c.Edit.init,
+				recordHistory: true,
+				recursive:     true,
+				umask:         c.Umask,
+				preApplyFunc:  c.defaultPreApplyFunc,
 			}); err != nil {
 				return err
 			}
@@ -89,6 +91,7 @@ func (c *Config) runEditCmd(cmd *cobra.Command, args []string) error {
 	type transparentlyDecryptedFile struct {
 		sourceAbsPath    chezmoi.AbsPath
 		decryptedAbsPath chezmoi.AbsPath
+		encryption       chezmoi.Encryption
 		preEditPlaintext []byte
 	}
 	var transparentlyDecryptedFiles []transparentlyDecryptedFile
@@ -96,6 +99,11 @@ TARGET_REL_PATH:
 	for _, targetRelPath := range targetRelPaths {
 		sourceStateEntry := sourceState.MustEntry(targetRelPath)
 		sourceRelPath := sourceStateEntry.SourceRelPath()
+		sourceDirAbsPath := sourceState.TargetSourceDirAbsPath(targetRelPath)
+		if sourceDirAbsPath != c.SourceDirAbsPath {
+			c.errorf("warning: %s: managed in lower source directory %s\n", targetRelPath, sourceDirAbsPath)
+		}
+		sourceAbsPath := sourceDirAbsPath.Join(sourceRelPath.RelPath())
 		switch sourceStateFile, ok := sourceStateEntry.(*chezmoi.SourceStateFile); {
 		case ok && sourceStateFile.Attr().Encrypted:
 			// FIXME in the case that the file is an encrypted template then we
@@ -108,7 +116,7 @@ TARGET_REL_PATH:
 				return err
 			}
 			// FIXME use RawContents and DecryptFile
-			decryptedRelPath, err := sourceRelPath.TargetRelPath(c.encryption.EncryptedSuffix())
+			decryptedRelPath, err := sourceRelPath.TargetRelPath(sourceStateFile.Encryption().EncryptedSuffix())
 			if err != nil {
 				return err
 			}
@@ -124,8 +132,9 @@ TARGET_REL_PATH:
 				return err
 			}
 			transparentlyDecryptedFile := transparentlyDecryptedFile{
-				sourceAbsPath:    c.SourceDirAbsPath.Join(sourceRelPath.RelPath()),
+				sourceAbsPath:    sourceAbsPath,
 				decryptedAbsPath: decryptedAbsPath,
+				encryption:       sourceStateFile.Encryption(),
 				preEditPlaintext: contents,
 			}
 			transparentlyDecryptedFiles = append(transparentlyDecryptedFiles, transparentlyDecryptedFile)
@@ -160,7 +169,7 @@ TARGET_REL_PATH:
 			if err := os.MkdirAll(hardlinkAbsPath.Dir().String(), 0o700); err != nil {
 				return err
 			}
-			if err := c.baseSystem.Link(c.SourceDirAbsPath.Join(sourceRelPath.RelPath()), hardlinkAbsPath); err == nil {
+			if err := c.baseSystem.Link(sourceAbsPath, hardlinkAbsPath); err == nil {
 				editorArgs = append(editorArgs, hardlinkAbsPath.String())
 				continue TARGET_REL_PATH
 			}
@@ -169,7 +178,6 @@ TARGET_REL_PATH:
 			// source file in the source state.
 			fallthrough
 		default:
-			sourceAbsPath := c.SourceDirAbsPath.Join(sourceRelPath.RelPath())
 			editorArgs = append(editorArgs, sourceAbsPath.String())
 		}
 	}
@@ -183,7 +191,7 @@ TARGET_REL_PATH:
 			if bytes.Equal(postEditPlaintext, transparentlyDecryptedFile.preEditPlaintext) {
 				return nil
 			}
-			contents, err := c.encryption.EncryptFile(transparentlyDecryptedFile.decryptedAbsPath)
+			contents, err := transparentlyDecryptedFile.encryption.EncryptFile(transparentlyDecryptedFile.decryptedAbsPath)
 			if err != nil {
 				return err
 			}
@@ -201,12 +209,14 @@ TARGET_REL_PATH:
 			c.resetSourceState()
 
 			if err := c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, args, applyArgsOptions{
-				cmd:          cmd,
-				filter:       c.Edit.filter,
-				init:         c.Edit.init,
-				recursive:    true,
-				umask:        c.Umask,
-				preApplyFunc: c.defaultPreApplyFunc,
+				cmd:           cmd,
+				backup:        true,
+				filter:        c.Edit.filter,
+				init:          c.Edit.init,
+				recordHistory: true,
+				recursive:     true,
+				umask:         c.Umask,
+				preApplyFunc:  c.defaultPreApplyFunc,
 			}); err != nil {
 				return err
 			}
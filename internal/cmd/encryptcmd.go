@@ -1,9 +1,19 @@
 package cmd
 
 import (
+	"errors"
+
 	"github.com/spf13/cobra"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoi"
 )
 
+type encryptCmdConfig struct {
+	encryption *choiceFlag
+	format     *choiceFlag
+	values     bool
+}
+
 func (c *Config) newEncryptCmd() *cobra.Command {
 	encryptCmd := &cobra.Command{
 		GroupID: groupIDEncryption,
@@ -17,9 +27,47 @@ func (c *Config) newEncryptCmd() *cobra.Command {
 		),
 	}
 
+	encryptCmd.Flags().Var(c.encrypt.encryption, "encryption", "Encryption to use")
+	must(encryptCmd.RegisterFlagCompletionFunc("encryption", c.encrypt.encryption.FlagCompletionFunc()))
+	encryptCmd.Flags().VarP(c.encrypt.format, "format", "f", "Format of structured data")
+	must(encryptCmd.RegisterFlagCompletionFunc("format", c.encrypt.format.FlagCompletionFunc()))
+	encryptCmd.Flags().BoolVar(&c.encrypt.values, "values", c.encrypt.values, "Encrypt only the values of structured data")
+
 	return encryptCmd
 }
 
 func (c *Config) runEncryptCmd(cmd *cobra.Command, args []string) error {
-	return c.filterInput(args, c.encryption.Encrypt)
+	encryption, err := c.encryptionNamed(c.encrypt.encryption.String())
+	if err != nil {
+		return err
+	}
+	if !c.encrypt.values {
+		return c.filterInput(args, encryption.Encrypt)
+	}
+
+	encryptValuesFunc := func(format chezmoi.Format) func([]byte) ([]byte, error) {
+		return func(plaintext []byte) ([]byte, error) {
+			return chezmoi.EncryptValues(encryption, format, plaintext, nil)
+		}
+	}
+	format, ok := chezmoi.FormatsByName[c.encrypt.format.String()]
+	if len(args) == 0 {
+		if !ok {
+			return errors.New("--values requires --format when reading from standard input")
+		}
+		return c.filterInput(nil, encryptValuesFunc(format))
+	}
+	for _, arg := range args {
+		argFormat := format
+		if !ok {
+			argFormat, err = chezmoi.FormatFromAbsPath(chezmoi.NewAbsPath(arg))
+			if err != nil {
+				return err
+			}
+		}
+		if err := c.filterInput([]string{arg}, encryptValuesFunc(argFormat)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
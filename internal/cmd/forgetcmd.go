@@ -58,7 +58,7 @@ func (c *Config) runForgetCmd(cmd *cobra.Command, args []string, sourceState *ch
 			continue
 		}
 
-		sourceAbsPath := c.SourceDirAbsPath.Join(relPath)
+		sourceAbsPath := sourceState.TargetSourceDirAbsPath(targetRelPath).Join(relPath)
 		if !c.force {
 			choice, err := c.promptChoice(fmt.Sprintf("Remove %s", sourceAbsPath), choicesYesNoAllQuit)
 			if err != nil {
@@ -26,9 +26,11 @@ var helps = map[string]*help{
 			"  chezmoi add ~/.vim --recursive\n" +
 			"  chezmoi add ~/.oh-my-zsh --exact --recursive",
 		longFlags: chezmoiset.New(
+			"attributes-file",
 			"autotemplate",
 			"create",
 			"encrypt",
+			"encryption",
 			"exact",
 			"exclude",
 			"follow",
@@ -41,6 +43,7 @@ var helps = map[string]*help{
 			"secrets",
 			"template",
 			"template-symlinks",
+			"xattrs",
 		),
 		shortFlags: chezmoiset.New(
 			"T",
@@ -84,14 +87,21 @@ var helps = map[string]*help{
 		example: "" +
 			"  chezmoi apply\n" +
 			"  chezmoi apply --dry-run --verbose\n" +
-			"  chezmoi apply ~/.bashrc",
+			"  chezmoi apply ~/.bashrc\n" +
+			"  chezmoi apply --plan plan.json\n" +
+			"  chezmoi apply --tags work,!gui\n" +
+			"  chezmoi apply --profile-templates",
 		longFlags: chezmoiset.New(
 			"exclude",
 			"include",
 			"init",
 			"parent-dirs",
+			"plan",
+			"profile-templates",
 			"recursive",
+			"rollback",
 			"source-path",
+			"tags",
 		),
 		shortFlags: chezmoiset.New(
 			"P",
@@ -126,6 +136,25 @@ var helps = map[string]*help{
 			"z",
 		),
 	},
+	"backup": {
+		longHelp: "" +
+			"  Manage backups of targets overwritten or removed by chezmoi.\n" +
+			"\n" +
+			"  If backup.dir is set in the config file, then every chezmoi apply, chezmoi\n" +
+			"  init --apply, chezmoi update, and chezmoi edit --apply copies each target\n" +
+			"  that\n" +
+			"  it is about to overwrite, remove, or change the permissions, ownership, or\n" +
+			"  extended attributes of into a new timestamped directory in backup.dir.\n" +
+			"  Directories whose metadata changes are backed up without their contents. If\n" +
+			"  backup.compress is true then each backup is instead stored as a gzipped tar\n" +
+			"  archive. If backup.keep is greater than zero then only the most recent\n" +
+			"  backup.keep backups are kept.",
+		example: "" +
+			"  chezmoi backup list\n" +
+			"  chezmoi backup restore ~/.bashrc\n" +
+			"  chezmoi backup restore --backup 20250102T030405.000000000Z\n" +
+			"  chezmoi backup prune --keep 10",
+	},
 	"cat": {
 		longHelp: "" +
 			"  Write the target contents of targets to stdout. targets must be files,\n" +
@@ -191,6 +220,7 @@ var helps = map[string]*help{
 			"   Type modifier\n" +
 			"  --------------------------------------------------------------------------\n" +
 			"   create\n" +
+			"   hardlink\n" +
 			"   modify\n" +
 			"   script\n" +
 			"   symlink\n" +
@@ -207,8 +237,10 @@ var helps = map[string]*help{
 			"  chezmoi chattr noempty ~/.profile\n" +
 			"  chezmoi chattr private,template ~/.netrc\n" +
 			"  chezmoi chattr -- -x ~/.zshrc\n" +
-			"  chezmoi chattr +create,+private ~/.kube/config",
+			"  chezmoi chattr +create,+private ~/.kube/config\n" +
+			"  chezmoi chattr --attributes-file +private,+template ~/.netrc",
 		longFlags: chezmoiset.New(
+			"attributes-file",
 			"recursive",
 		),
 		shortFlags: chezmoiset.New(
@@ -241,6 +273,34 @@ var helps = map[string]*help{
 			"  Decrypt files using chezmoi's configured encryption. If no files are given,\n" +
 			"  decrypt the standard input. The decrypted result is written to the standard\n" +
 			"  output or a file if the --output flag is set.",
+		longFlags: chezmoiset.New(
+			"values",
+		),
+	},
+	"deps": {
+		longHelp: "" +
+			"  Print the dependencies of the templates for targets. When no targets are\n" +
+			"  supplied, print the dependencies of all templates.\n" +
+			"\n" +
+			"  For each template, chezmoi reports the template data keys, the templates in\n" +
+			"  .chezmoitemplates, the template functions, and the password manager template\n" +
+			"  functions that it uses, including those used by the templates that it\n" +
+			"  includes. Template data keys are only reported where the template data is\n" +
+			"  dot or $.",
+		example: "" +
+			"  chezmoi deps\n" +
+			"  chezmoi deps ~/.gitconfig\n" +
+			"  chezmoi deps --uses=.email\n" +
+			"  chezmoi deps --uses=onepasswordRead",
+		longFlags: chezmoiset.New(
+			"format",
+			"nul-path-separator",
+			"uses",
+		),
+		shortFlags: chezmoiset.New(
+			"0",
+			"f",
+		),
 	},
 	"destroy": {
 		longHelp: "" +
@@ -278,9 +338,11 @@ var helps = map[string]*help{
 			"init",
 			"pager",
 			"parent-dirs",
+			"profile-templates",
 			"recursive",
 			"reverse",
 			"script-contents",
+			"tags",
 		),
 		shortFlags: chezmoiset.New(
 			"P",
@@ -400,6 +462,18 @@ var helps = map[string]*help{
 			"  Encrypt files using chezmoi's configured encryption. If no files are given,\n" +
 			"  encrypt the standard input. The encrypted result is written to the standard\n" +
 			"  output or a file if the --output flag is set.",
+		example: "" +
+			"  chezmoi encrypt --output=secrets.age secrets\n" +
+			"  chezmoi encrypt --values secrets.yaml > .chezmoidata.yaml\n" +
+			"  echo '{\"apiToken\": \"secret\"}' | chezmoi encrypt --values --format=json",
+		longFlags: chezmoiset.New(
+			"encryption",
+			"format",
+			"values",
+		),
+		shortFlags: chezmoiset.New(
+			"f",
+		),
 	},
 	"execute-template": {
 		longHelp: "" +
@@ -469,6 +543,26 @@ var helps = map[string]*help{
 			"  Print the help associated with command, or general help if no command is\n" +
 			"  given.",
 	},
+	"history": {
+		longHelp: "" +
+			"  List past applies that can be undone with chezmoi undo, oldest first, with\n" +
+			"  their IDs, times, and the number of targets that they modified.\n" +
+			"\n" +
+			"  Every chezmoi apply, chezmoi init --apply, chezmoi update, and chezmoi edit --\n" +
+			"  apply that modifies the destination directory records the previous state of\n" +
+			"  each target that it modifies. Previous file contents are stored in the cache\n" +
+			"  directory and are only readable by the owner. The history.keep most recent\n" +
+			"  applies are kept, by default 10. Set history.keep to 0 to keep all applies.",
+		example: "" +
+			"  chezmoi history\n" +
+			"  chezmoi history --format=json",
+		longFlags: chezmoiset.New(
+			"format",
+		),
+		shortFlags: chezmoiset.New(
+			"f",
+		),
+	},
 	"ignored": {
 		longHelp: "" +
 			"  Print the list of entries ignored by chezmoi.",
@@ -600,6 +694,55 @@ var helps = map[string]*help{
 		example: "" +
 			"  chezmoi license",
 	},
+	"lint": {
+		longHelp: "" +
+			"  Check the source directory for problems without reading externals or writing\n" +
+			"  to the destination directory. chezmoi exits with code 0 (success) if no\n" +
+			"  errors are found, or 1 (failure) otherwise. Warnings do not cause a failure.\n" +
+			"\n" +
+			"  The following rules are checked:\n" +
+			"\n" +
+			"   Rule                 | Severity | Description\n" +
+			"  ----------------------|----------|----------------------------------------\n" +
+			"   attributes           | warning  | Source name attributes that are not in\n" +
+			"                        |          | the correct position, or that have no\n" +
+			"                        |          | effect\n" +
+			"   duplicate-target     | error    | Targets defined by both an external\n" +
+			"                        |          | and the source state, or by more than\n" +
+			"                        |          | one external\n" +
+			"   invalid-special-file | error    | Special files, like .chezmoiignore and\n" +
+			"                        |          | .chezmoiexternal.$FORMAT, that cannot\n" +
+			"                        |          | be read\n" +
+			"   missing-template     | error    | template actions, include, and\n" +
+			"                        |          | includeTemplate that reference\n" +
+			"                        |          | templates or files that do not exist\n" +
+			"   remove-managed       | error    | .chezmoiremove patterns that match\n" +
+			"                        |          | managed targets\n" +
+			"   script-interpreter   | warning  | Scripts without a shebang and without\n" +
+			"                        |          | a configured interpreter for their\n" +
+			"                        |          | extension\n" +
+			"   template-parse       | error    | Templates that cannot be parsed\n" +
+			"   undefined-data       | warning  | Template data keys that are not\n" +
+			"                        |          | defined on this machine\n" +
+			"   unreachable          | warning  | Entries that are ignored by a pattern\n" +
+			"                        |          | in .chezmoiignore that does not depend\n" +
+			"                        |          | on the template data\n" +
+			"\n" +
+			"  Source names that cannot be parsed are reported as attributes errors.\n" +
+			"  Template data keys are not reported if they are checked by an enclosing if\n" +
+			"  or with action, or if they are passed to default, hasKey, or a similar\n" +
+			"  function. Entries whose source name is the same as their target name, like\n" +
+			"  README.md, are not reported as unreachable.",
+		example: "" +
+			"  chezmoi lint\n" +
+			"  chezmoi lint --format=sarif > chezmoi.sarif",
+		longFlags: chezmoiset.New(
+			"format",
+		),
+		shortFlags: chezmoiset.New(
+			"f",
+		),
+	},
 	"list": {
 		longHelp: "" +
 			"  list is an alias for managed.",
@@ -612,7 +755,11 @@ var helps = map[string]*help{
 		longHelp: "" +
 			"  List all managed entries in the destination directory under all paths in\n" +
 			"  alphabetical order. When no paths are supplied, list all managed entries in\n" +
-			"  the destination directory in alphabetical order.",
+			"  the destination directory in alphabetical order.\n" +
+			"\n" +
+			"  With --path-style=all, the output also includes the tags of each entry\n" +
+			"  assigned\n" +
+			"  by .chezmoiattributes.",
 		example: "" +
 			"  chezmoi managed\n" +
 			"  chezmoi managed --include=files\n" +
@@ -673,6 +820,35 @@ var helps = map[string]*help{
 			"r",
 		),
 	},
+	"plan": {
+		longHelp: "" +
+			"  Write the changes that chezmoi apply would make to target... as a plan in\n" +
+			"  JSON format, without making any changes. If no targets are specified, the\n" +
+			"  changes to all targets are planned. Use the global --output flag to write\n" +
+			"  the\n" +
+			"  plan to a file, which can later be applied with chezmoi apply --plan.\n" +
+			"\n" +
+			"  For each target that would be changed, the plan records the operation\n" +
+			"  (create, modify, remove, or run for scripts), the actual state of the target\n" +
+			"  before the change, and the target state, including their types, modes, and\n" +
+			"  the SHA256 sums of their contents.",
+		example: "" +
+			"  chezmoi plan -o plan.json\n" +
+			"  chezmoi apply --plan plan.json",
+		longFlags: chezmoiset.New(
+			"exclude",
+			"include",
+			"init",
+			"parent-dirs",
+			"recursive",
+		),
+		shortFlags: chezmoiset.New(
+			"P",
+			"i",
+			"r",
+			"x",
+		),
+	},
 	"podman": {
 		longHelp: "" +
 			"  podman is an alias for docker.",
@@ -716,11 +892,70 @@ var helps = map[string]*help{
 			"x",
 		),
 	},
+	"rekey": {
+		longHelp: "" +
+			"  Re-encrypt encrypted files in the source state, for example after changing\n" +
+			"  recipients, rotating keys, or switching from gpg to age. Each encrypted file\n" +
+			"  is decrypted with the current identities and re-encrypted to its current\n" +
+			"  recipients, including those from .chezmoirecipients and the --age-recipient\n" +
+			"  and --\n" +
+			"  age-recipient-file flags. Directories are recursed into by default.\n" +
+			"\n" +
+			"  If no targets are specified then all encrypted files are rekeyed, including\n" +
+			"  files with the encryptedvalues attribute and encrypted externals with\n" +
+			"  file:// URLs. Only the encrypted values in files with encrypted values are\n" +
+			"  changed. If one or more targets are given then only those targets are\n" +
+			"  rekeyed.\n" +
+			"\n" +
+			"  No files are changed unless every file can be decrypted and re-encrypted.\n" +
+			"  Files that cannot be rekeyed are reported. With --keep-going, the remaining\n" +
+			"  files are rekeyed anyway. The re-encrypted files are first written to\n" +
+			"  temporary files next to the originals and then renamed over them. If any\n" +
+			"  file cannot be replaced then the original files are restored.",
+		example: "" +
+			"  chezmoi rekey\n" +
+			"  chezmoi rekey --age-recipient=age1... --commit\n" +
+			"  chezmoi rekey --encryption=age ~/.ssh",
+		longFlags: chezmoiset.New(
+			"commit",
+			"encryption",
+			"recursive",
+		),
+		shortFlags: chezmoiset.New(
+			"r",
+		),
+	},
 	"remove": {
 		longHelp: "" +
 			"  The remove command has been removed. Use the forget command or the destroy\n" +
 			"  command instead.",
 	},
+	"render": {
+		longHelp: "" +
+			"  Render the target state of targets, or of all targets if no targets are\n" +
+			"  given, once for each row of a matrix.\n" +
+			"\n" +
+			"  The matrix file maps row names to template data. For each row, chezmoi reads\n" +
+			"  the source state with the row's template data overriding the template data,\n" +
+			"  in the same way as --override-data-file, and renders the target state to an\n" +
+			"  empty in-memory destination. Scripts are rendered but not run.",
+		example: "" +
+			"  chezmoi render --matrix=matrix.yaml --out=rendered\n" +
+			"  chezmoi render --matrix=matrix.yaml --diff=work-laptop,home-desktop\n" +
+			"  chezmoi render --matrix=matrix.yaml --diff=work-laptop,home-desktop ~/.\n" +
+			"gitconfig",
+		longFlags: chezmoiset.New(
+			"diff",
+			"exclude",
+			"include",
+			"matrix",
+			"out",
+		),
+		shortFlags: chezmoiset.New(
+			"i",
+			"x",
+		),
+	},
 	"rm": {
 		longHelp: "" +
 			"  The rm command has been removed. Use the forget command or the destroy\n" +
@@ -728,12 +963,32 @@ var helps = map[string]*help{
 	},
 	"secret": {
 		longHelp: "" +
-			"  Verify chezmoi's integration with the system's keyring.",
+			"  Verify chezmoi's integration with the system's keyring and manage the secret\n" +
+			"  cache.",
 		example: "" +
+			"  chezmoi secret cache clear\n" +
 			"  chezmoi secret keyring set --service=service --user=user --value=password\n" +
 			"  chezmoi secret keyring get --service=service --user=user\n" +
 			"  chezmoi secret keyring delete --service=service --user=user",
 	},
+	"shadowed": {
+		longHelp: "" +
+			"  List the targets that are defined in more than one source directory when\n" +
+			"  sourceDir is a list of source directories, with the source entry that is\n" +
+			"  used and the source entries in lower layers that it shadows.\n" +
+			"\n" +
+			"  Directories that have the same attributes in more than one source directory\n" +
+			"  are not listed.",
+		example: "" +
+			"  chezmoi shadowed\n" +
+			"  chezmoi shadowed --format=json",
+		longFlags: chezmoiset.New(
+			"format",
+		),
+		shortFlags: chezmoiset.New(
+			"f",
+		),
+	},
 	"source-path": {
 		longHelp: "" +
 			"  Print the path to each target's source state. If no targets are specified\n" +
@@ -789,14 +1044,18 @@ var helps = map[string]*help{
 			"   M            | Modified    | Entry was modified | Entry will be modified\n" +
 			"   R            | Run         | Not applicable     | Script will be run",
 		example: "" +
-			"  chezmoi status",
+			"  chezmoi status\n" +
+			"  chezmoi status --tags server\n" +
+			"  chezmoi status --profile-templates=json",
 		longFlags: chezmoiset.New(
 			"exclude",
 			"include",
 			"init",
 			"parent-dirs",
 			"path-style",
+			"profile-templates",
 			"recursive",
+			"tags",
 		),
 		shortFlags: chezmoiset.New(
 			"P",
@@ -814,6 +1073,41 @@ var helps = map[string]*help{
 			"  chezmoi target-path\n" +
 			"  chezmoi target-path ~/.local/share/chezmoi/dot_zshrc",
 	},
+	"test": {
+		longHelp: "" +
+			"  Run the template tests in the .chezmoitests/ directory in the source\n" +
+			"  directory. If no names are given then all tests are run.\n" +
+			"\n" +
+			"  For each test, chezmoi reads the source state with the test's template data\n" +
+			"  and mocked password manager template functions, applies the test's targets\n" +
+			"  to an empty in-memory destination, and compares the results with the\n" +
+			"  expected\n" +
+			"  contents. chezmoi prints the diff for each target that differs and exits\n" +
+			"  with status 1 if any test fails. With --verbose, tests that pass are also\n" +
+			"  printed.",
+		example: "" +
+			"  chezmoi test\n" +
+			"  chezmoi test darwin linux",
+	},
+	"undo": {
+		longHelp: "" +
+			"  Restore the targets modified by an apply to their state before the apply,\n" +
+			"  and remove the apply from the history. By default, the most recent apply is\n" +
+			"  undone.\n" +
+			"\n" +
+			"  If a target has been modified since chezmoi last wrote it, or if a target\n" +
+			"  was also modified by a later apply, then chezmoi undo will refuse to undo\n" +
+			"  the apply unless --force is set.\n" +
+			"\n" +
+			"  Scripts that were run by the apply are not undone.",
+		example: "" +
+			"  chezmoi undo\n" +
+			"  chezmoi undo --dry-run --verbose\n" +
+			"  chezmoi undo --apply-id 20250102T030405.000000000Z",
+		longFlags: chezmoiset.New(
+			"apply-id",
+		),
+	},
 	"unmanage": {
 		longHelp: "" +
 			"  unmanage is an alias for forget for symmetry with manage.",
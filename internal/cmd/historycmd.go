@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoi"
+	"chezmoi.io/chezmoi/v2/internal/chezmoiset"
+)
+
+type historyCmdConfig struct {
+	Keep   int `json:"keep" mapstructure:"keep" yaml:"keep"`
+	format *choiceFlag
+}
+
+type applyRecordSummary struct {
+	ID      string    `json:"id"      yaml:"id"`
+	Time    time.Time `json:"time"    yaml:"time"`
+	Targets int       `json:"targets" yaml:"targets"`
+}
+
+func (c *Config) newHistoryCmd() *cobra.Command {
+	historyCmd := &cobra.Command{
+		GroupID:           groupIDAdvanced,
+		Use:               "history",
+		Short:             "List past applies that can be undone",
+		Long:              mustLongHelp("history"),
+		Example:           example("history"),
+		Args:              cobra.NoArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE:              c.runHistoryCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+		),
+	}
+
+	historyCmd.Flags().VarP(c.History.format, "format", "f", "Output format")
+	must(historyCmd.RegisterFlagCompletionFunc("format", c.History.format.FlagCompletionFunc()))
+
+	return historyCmd
+}
+
+func (c *Config) runHistoryCmd(cmd *cobra.Command, args []string) error {
+	applyRecords, err := c.getApplyRecords()
+	if err != nil {
+		return err
+	}
+
+	applyRecordSummaries := make([]*applyRecordSummary, len(applyRecords))
+	for i, applyRecord := range applyRecords {
+		applyRecordSummaries[i] = &applyRecordSummary{
+			ID:      applyRecord.ID,
+			Time:    applyRecord.Time,
+			Targets: len(applyRecord.TargetAbsPaths()),
+		}
+	}
+
+	if format := c.History.format.String(); format != "" {
+		return c.marshal(format, applyRecordSummaries)
+	}
+
+	var builder strings.Builder
+	tabWriter := tabwriter.NewWriter(&builder, 3, 0, 3, ' ', 0)
+	fmt.Fprint(tabWriter, "ID\tTIME\tTARGETS\n")
+	for _, applyRecordSummary := range applyRecordSummaries {
+		fmt.Fprintf(tabWriter, "%s\t%s\t%d\n",
+			applyRecordSummary.ID,
+			applyRecordSummary.Time.Local().Format(time.RFC3339),
+			applyRecordSummary.Targets,
+		)
+	}
+	if err := tabWriter.Flush(); err != nil {
+		return err
+	}
+	return c.writeOutputString(builder.String(), 0o666)
+}
+
+// getApplyRecords returns all apply records in the persistent state, oldest
+// first.
+func (c *Config) getApplyRecords() ([]*chezmoi.ApplyRecord, error) {
+	var applyRecords []*chezmoi.ApplyRecord
+	if err := c.persistentState.ForEach(chezmoi.ApplyHistoryBucket, func(k, v []byte) error {
+		var applyRecord chezmoi.ApplyRecord
+		if err := chezmoi.FormatJSON.Unmarshal(v, &applyRecord); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		applyRecords = append(applyRecords, &applyRecord)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(applyRecords, func(a, b *chezmoi.ApplyRecord) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return applyRecords, nil
+}
+
+// pruneApplyHistory removes all but the c.History.Keep most recent applies from
+// the apply history and removes the blobs that are no longer referenced.
+func (c *Config) pruneApplyHistory() error {
+	if c.History.Keep <= 0 {
+		return nil
+	}
+	applyRecords, err := c.getApplyRecords()
+	if err != nil {
+		return err
+	}
+	if len(applyRecords) <= c.History.Keep {
+		return nil
+	}
+	for _, applyRecord := range applyRecords[:len(applyRecords)-c.History.Keep] {
+		if err := c.persistentState.Delete(chezmoi.ApplyHistoryBucket, []byte(applyRecord.ID)); err != nil {
+			return err
+		}
+	}
+	return c.removeUnreferencedBlobs(applyRecords[len(applyRecords)-c.History.Keep:])
+}
+
+// removeUnreferencedBlobs removes all blobs that are not referenced by
+// applyRecords.
+func (c *Config) removeUnreferencedBlobs(applyRecords []*chezmoi.ApplyRecord) error {
+	referenced := chezmoiset.New[string]()
+	for _, applyRecord := range applyRecords {
+		referenced.AddSet(applyRecord.ContentsSHA256s())
+	}
+	return c.newBlobStore().RemoveUnreferenced(referenced)
+}
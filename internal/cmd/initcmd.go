@@ -238,11 +238,13 @@ func (c *Config) runInitCmd(cmd *cobra.Command, args []string) error {
 			return err
 		}
 		if err := c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, noArgs, applyArgsOptions{
-			cmd:          cmd,
-			filter:       c.init.filter,
-			recursive:    false,
-			umask:        c.Umask,
-			preApplyFunc: c.defaultPreApplyFunc,
+			cmd:           cmd,
+			backup:        true,
+			filter:        c.init.filter,
+			recordHistory: true,
+			recursive:     false,
+			umask:         c.Umask,
+			preApplyFunc:  c.defaultPreApplyFunc,
 		}); err != nil {
 			return err
 		}
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoi"
+)
+
+const formatSARIF = "sarif"
+
+var lintFormatValues = []string{
+	formatUnknown,
+	formatJSON,
+	formatSARIF,
+	formatYAML,
+}
+
+type lintCmdConfig struct {
+	format *choiceFlag
+}
+
+// A sarifLog is a SARIF log, as described in
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult                    `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Version        string      `json:"version,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+func (c *Config) newLintCmd() *cobra.Command {
+	lintCmd := &cobra.Command{
+		GroupID:           groupIDAdvanced,
+		Use:               "lint",
+		Short:             "Check the source directory for problems",
+		Long:              mustLongHelp("lint"),
+		Example:           example("lint"),
+		Args:              cobra.NoArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE:              c.runLintCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+		),
+	}
+
+	lintCmd.Flags().VarP(c.lint.format, "format", "f", "Output format")
+	must(lintCmd.RegisterFlagCompletionFunc("format", c.lint.format.FlagCompletionFunc()))
+
+	return lintCmd
+}
+
+func (c *Config) runLintCmd(cmd *cobra.Command, args []string) error {
+	sourceState, err := c.newSourceState(cmd.Context(), cmd,
+		chezmoi.WithReadTemplates(false),
+		chezmoi.WithTemplateDataOnly(true),
+	)
+	if err != nil {
+		return err
+	}
+	lintIssues, err := sourceState.Lint(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	switch format := c.lint.format.String(); format {
+	case formatUnknown:
+		var builder strings.Builder
+		for _, lintIssue := range lintIssues {
+			location := lintIssue.SourceAbsPath.String()
+			if lintIssue.Line != 0 {
+				location += fmt.Sprintf(":%d", lintIssue.Line)
+			}
+			fmt.Fprintf(&builder, "%s: %s: %s (%s)\n", location, lintIssue.Severity, lintIssue.Message, lintIssue.Rule)
+		}
+		if err := c.writeOutputString(builder.String(), 0o666); err != nil {
+			return err
+		}
+	case formatSARIF:
+		data, err := json.MarshalIndent(c.newSARIFLog(lintIssues), "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := c.writeOutput(append(data, '\n'), 0o666); err != nil {
+			return err
+		}
+	default:
+		if lintIssues == nil {
+			lintIssues = []*chezmoi.LintIssue{}
+		}
+		if err := c.marshal(format, lintIssues); err != nil {
+			return err
+		}
+	}
+
+	for _, lintIssue := range lintIssues {
+		if lintIssue.Severity == chezmoi.LintSeverityError {
+			return chezmoi.ExitCodeError(1)
+		}
+	}
+	return nil
+}
+
+// newSARIFLog returns a SARIF log containing lintIssues. Locations in the
+// source directory are relative to the SRCROOT base URI.
+func (c *Config) newSARIFLog(lintIssues []*chezmoi.LintIssue) *sarifLog {
+	rules := make([]sarifRule, 0, len(chezmoi.LintRuleDescriptions))
+	for _, id := range slices.Sorted(maps.Keys(chezmoi.LintRuleDescriptions)) {
+		rules = append(rules, sarifRule{
+			ID: id,
+			ShortDescription: sarifMessage{
+				Text: chezmoi.LintRuleDescriptions[id],
+			},
+		})
+	}
+
+	results := make([]sarifResult, 0, len(lintIssues))
+	for _, lintIssue := range lintIssues {
+		var artifactLocation sarifArtifactLocation
+		if relPath, err := lintIssue.SourceAbsPath.TrimDirPrefix(c.SourceDirAbsPath); err == nil {
+			artifactLocation = sarifArtifactLocation{
+				URI:       relPath.String(),
+				URIBaseID: "SRCROOT",
+			}
+		} else {
+			artifactLocation = sarifArtifactLocation{
+				URI: fileURI(lintIssue.SourceAbsPath),
+			}
+		}
+		var region *sarifRegion
+		if lintIssue.Line != 0 {
+			region = &sarifRegion{
+				StartLine: lintIssue.Line,
+			}
+		}
+		results = append(results, sarifResult{
+			RuleID: lintIssue.Rule,
+			Level:  string(lintIssue.Severity),
+			Message: sarifMessage{
+				Text: lintIssue.Message,
+			},
+			Locations: []sarifLocation{
+				{
+					PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: artifactLocation,
+						Region:           region,
+					},
+				},
+			},
+		})
+	}
+
+	return &sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{
+			{
+				Tool: sarifTool{
+					Driver: sarifDriver{
+						Name:           "chezmoi",
+						InformationURI: "https://chezmoi.io/",
+						Version:        c.versionInfo.Version,
+						Rules:          rules,
+					},
+				},
+				OriginalURIBaseIDs: map[string]sarifArtifactLocation{
+					"SRCROOT": {
+						URI: fileURI(c.SourceDirAbsPath.WithTrailingSlash()),
+					},
+				},
+				Results: results,
+			},
+		},
+	}
+}
+
+// fileURI returns the file URI of absPath.
+func fileURI(absPath chezmoi.AbsPath) string {
+	path := absPath.ToSlash().String()
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
@@ -151,6 +151,7 @@ func TestScript(t *testing.T) {
 			"removeline":     cmdRemoveLine,
 			"rmdir":          cmdRmDir,
 			"rmfinalnewline": cmdRmFinalNewline,
+			"samefile":       cmdSameFile,
 			"sleep":          cmdSleep,
 			"unix2dos":       cmdUNIX2DOS,
 		},
@@ -838,6 +839,24 @@ func cmdRmFinalNewline(ts *testscript.TestScript, neg bool, args []string) {
 	}
 }
 
+// cmdSameFile succeeds if its two arguments are the same file, i.e. they are
+// hard links to each other.
+func cmdSameFile(ts *testscript.TestScript, neg bool, args []string) {
+	if len(args) != 2 {
+		ts.Fatalf("usage: samefile file1 file2")
+	}
+	fileInfo1, err := os.Stat(ts.MkAbs(args[0]))
+	ts.Check(err)
+	fileInfo2, err := os.Stat(ts.MkAbs(args[1]))
+	ts.Check(err)
+	switch sameFile := os.SameFile(fileInfo1, fileInfo2); {
+	case sameFile && neg:
+		ts.Fatalf("%s and %s are the same file", args[0], args[1])
+	case !sameFile && !neg:
+		ts.Fatalf("%s and %s are not the same file", args[0], args[1])
+	}
+}
+
 // cmdSleep sleeps.
 func cmdSleep(ts *testscript.TestScript, neg bool, args []string) {
 	if neg {
@@ -64,6 +64,7 @@ func (c *Config) runManagedCmd(cmd *cobra.Command, args []string, sourceState *c
 		Absolute       chezmoi.AbsPath       `json:"absolute"       yaml:"absolute"`
 		SourceAbsolute chezmoi.AbsPath       `json:"sourceAbsolute" yaml:"sourceAbsolute"`
 		SourceRelative chezmoi.SourceRelPath `json:"sourceRelative" yaml:"sourceRelative"`
+		Tags           []string              `json:"tags,omitempty" yaml:"tags,omitempty"`
 	}
 	var allEntryPaths []*entryPaths
 	_ = sourceState.ForEach(
@@ -97,8 +98,9 @@ func (c *Config) runManagedCmd(cmd *cobra.Command, args []string, sourceState *c
 			entryPaths := &entryPaths{
 				targetRelPath:  targetRelPath,
 				Absolute:       c.DestDirAbsPath.Join(targetRelPath),
-				SourceAbsolute: c.SourceDirAbsPath.Join(sourceStateEntry.SourceRelPath().RelPath()),
+				SourceAbsolute: sourceState.TargetSourceDirAbsPath(targetRelPath).Join(sourceStateEntry.SourceRelPath().RelPath()),
 				SourceRelative: sourceStateEntry.SourceRelPath(),
+				Tags:           sourceState.Tags(targetRelPath),
 			}
 			allEntryPaths = append(allEntryPaths, entryPaths)
 			return nil
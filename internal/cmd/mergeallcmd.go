@@ -61,7 +61,7 @@ func (c *Config) runMergeAllCmd(cmd *cobra.Command, args []string) error {
 
 	for _, targetRelPath := range targetRelPaths {
 		sourceStateEntry := sourceState.MustEntry(targetRelPath)
-		if err := c.doMerge(targetRelPath, sourceStateEntry); err != nil {
+		if err := c.doMerge(sourceState, targetRelPath, sourceStateEntry); err != nil {
 			return err
 		}
 	}
@@ -47,7 +47,7 @@ func (c *Config) runMergeCmd(cmd *cobra.Command, args []string, sourceState *che
 
 	for _, targetRelPath := range targetRelPaths {
 		sourceStateEntry := sourceState.MustEntry(targetRelPath)
-		if err := c.doMerge(targetRelPath, sourceStateEntry); err != nil {
+		if err := c.doMerge(sourceState, targetRelPath, sourceStateEntry); err != nil {
 			return err
 		}
 	}
@@ -58,13 +58,18 @@ func (c *Config) runMergeCmd(cmd *cobra.Command, args []string, sourceState *che
 // doMerge is the core merge functionality. It invokes the merge tool to do a
 // three-way merge between the destination, source, and target, including
 // transparently decrypting the file in the source state.
-func (c *Config) doMerge(targetRelPath chezmoi.RelPath, sourceStateEntry chezmoi.SourceStateEntry) (err error) {
-	sourceAbsPath := c.SourceDirAbsPath.Join(sourceStateEntry.SourceRelPath().RelPath())
+func (c *Config) doMerge(
+	sourceState *chezmoi.SourceState,
+	targetRelPath chezmoi.RelPath,
+	sourceStateEntry chezmoi.SourceStateEntry,
+) (err error) {
+	sourceAbsPath := sourceState.TargetSourceDirAbsPath(targetRelPath).Join(sourceStateEntry.SourceRelPath().RelPath())
 
 	// If the source state entry is an encrypted file, then decrypt it to a
 	// temporary directory and pass the plaintext to the merge command
 	// instead.
 	var plaintextAbsPath chezmoi.AbsPath
+	var encryption chezmoi.Encryption
 	if sourceStateFile, ok := sourceStateEntry.(*chezmoi.SourceStateFile); ok {
 		if sourceStateFile.Attr().Encrypted {
 			var plaintextTempDirAbsPath chezmoi.AbsPath
@@ -86,6 +91,7 @@ func (c *Config) doMerge(targetRelPath chezmoi.RelPath, sourceStateEntry chezmoi
 				return err
 			}
 			sourceAbsPath = plaintextAbsPath
+			encryption = sourceStateFile.Encryption()
 		}
 	}
 
@@ -184,11 +190,11 @@ func (c *Config) doMerge(targetRelPath chezmoi.RelPath, sourceStateEntry chezmoi
 	// plaintext.
 	if !plaintextAbsPath.IsEmpty() {
 		var encryptedContents []byte
-		if encryptedContents, err = c.encryption.EncryptFile(plaintextAbsPath); err != nil {
+		if encryptedContents, err = encryption.EncryptFile(plaintextAbsPath); err != nil {
 			return err
 		}
 		if err := c.baseSystem.WriteFile(
-			c.SourceDirAbsPath.Join(sourceStateEntry.SourceRelPath().RelPath()),
+			sourceState.TargetSourceDirAbsPath(targetRelPath).Join(sourceStateEntry.SourceRelPath().RelPath()),
 			encryptedContents,
 			0o644,
 		); err != nil {
@@ -16,6 +16,12 @@ var (
 		pathStyleSourceRelative,
 		pathStyleAll,
 	}
+	sourceOrTargetSinglePathStyleValues = []string{
+		pathStyleAbsolute,
+		pathStyleRelative,
+		pathStyleSourceAbsolute,
+		pathStyleSourceRelative,
+	}
 	targetPathStyleValues = []string{
 		pathStyleAbsolute,
 		pathStyleRelative,
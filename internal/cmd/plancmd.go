@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+
+	"github.com/spf13/cobra"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoi"
+)
+
+// planVersion is the version of the plan file format.
+const planVersion = 1
+
+// A planOperation is an operation in a plan.
+type planOperation string
+
+// Plan operations.
+const (
+	planOperationCreate planOperation = "create"
+	planOperationModify planOperation = "modify"
+	planOperationRemove planOperation = "remove"
+	planOperationRun    planOperation = "run"
+)
+
+type planCmdConfig struct {
+	filter     *chezmoi.EntryTypeFilter
+	init       bool
+	parentDirs bool
+	recursive  bool
+}
+
+// A plan is a saved set of changes to the destination directory.
+type plan struct {
+	Version int             `json:"version"`
+	DestDir chezmoi.AbsPath `json:"destDir"`
+	Targets []*planTarget   `json:"targets"`
+}
+
+// A planTarget is a planned change to a single target. Old is the actual state
+// of the target when the plan was made, or nil if the target did not exist,
+// and New is the target state.
+type planTarget struct {
+	Path      chezmoi.RelPath     `json:"path"`
+	Operation planOperation       `json:"operation"`
+	Old       *chezmoi.EntryState `json:"old,omitempty"`
+	New       *chezmoi.EntryState `json:"new"`
+}
+
+func (c *Config) newPlanCmd() *cobra.Command {
+	planCmd := &cobra.Command{
+		GroupID:           groupIDDaily,
+		Use:               "plan [target]...",
+		Short:             "Write the changes that apply would make to a plan file",
+		Long:              mustLongHelp("plan"),
+		Example:           example("plan"),
+		ValidArgsFunction: c.targetValidArgs,
+		RunE:              c.runPlanCmd,
+		Annotations: newAnnotations(
+			dryRun,
+			persistentStateModeReadMockWrite,
+			requiresSourceDirectory,
+		),
+	}
+
+	planCmd.Flags().VarP(c.plan.filter.Exclude, "exclude", "x", "Exclude entry types")
+	planCmd.Flags().VarP(c.plan.filter.Include, "include", "i", "Include entry types")
+	planCmd.Flags().BoolVar(&c.plan.init, "init", c.plan.init, "Recreate config file from template")
+	planCmd.Flags().BoolVarP(&c.plan.parentDirs, "parent-dirs", "P", c.plan.parentDirs, "Plan all parent directories")
+	planCmd.Flags().BoolVarP(&c.plan.recursive, "recursive", "r", c.plan.recursive, "Recurse into subdirectories")
+
+	return planCmd
+}
+
+func (c *Config) runPlanCmd(cmd *cobra.Command, args []string) error {
+	plan, err := c.newPlan(cmd.Context(), args, applyArgsOptions{
+		cmd:        cmd,
+		filter:     c.plan.filter,
+		init:       c.plan.init,
+		parentDirs: c.plan.parentDirs,
+		recursive:  c.plan.recursive,
+		umask:      c.Umask,
+	})
+	if err != nil {
+		return err
+	}
+	data, err := chezmoi.FormatJSON.Marshal(plan)
+	if err != nil {
+		return err
+	}
+	return c.writeOutput(data, 0o666)
+}
+
+// newPlan returns the plan of changes that applying args would make, without
+// making any changes.
+func (c *Config) newPlan(ctx context.Context, args []string, options applyArgsOptions) (*plan, error) {
+	plan := &plan{
+		Version: planVersion,
+		DestDir: c.DestDirAbsPath,
+		Targets: []*planTarget{},
+	}
+	options.preApplyFunc = func(
+		targetRelPath chezmoi.RelPath,
+		targetEntryState, lastWrittenEntryState, actualEntryState *chezmoi.EntryState,
+	) error {
+		if planTarget := newPlanTarget(targetRelPath, targetEntryState, actualEntryState); planTarget != nil {
+			plan.Targets = append(plan.Targets, planTarget)
+		}
+		return fs.SkipDir
+	}
+	if err := c.applyArgs(ctx, chezmoi.NewDryRunSystem(c.destSystem), c.DestDirAbsPath, args, options); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// readPlan reads a plan from absPath in system.
+func readPlan(system chezmoi.System, absPath chezmoi.AbsPath) (*plan, error) {
+	data, err := system.ReadFile(absPath)
+	if err != nil {
+		return nil, err
+	}
+	var plan plan
+	if err := chezmoi.FormatJSON.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("%s: %w", absPath, err)
+	}
+	if plan.Version != planVersion {
+		return nil, fmt.Errorf("%s: unsupported plan version %d", absPath, plan.Version)
+	}
+	return &plan, nil
+}
+
+// newPlanTarget returns the planTarget that changes targetRelPath from
+// actualEntryState to targetEntryState, or nil if no change is needed.
+func newPlanTarget(targetRelPath chezmoi.RelPath, targetEntryState, actualEntryState *chezmoi.EntryState) *planTarget {
+	if actualEntryState != nil && actualEntryState.Type == chezmoi.EntryStateTypeRemove {
+		actualEntryState = nil
+	}
+	var operation planOperation
+	switch {
+	case targetEntryState.Type == chezmoi.EntryStateTypeScript:
+		operation = planOperationRun
+	case targetEntryState.Equivalent(actualEntryState):
+		return nil
+	case targetEntryState.Type == chezmoi.EntryStateTypeRemove:
+		operation = planOperationRemove
+	case actualEntryState == nil:
+		operation = planOperationCreate
+	default:
+		operation = planOperationModify
+	}
+	return &planTarget{
+		Path:      targetRelPath,
+		Operation: operation,
+		Old:       actualEntryState,
+		New:       targetEntryState,
+	}
+}
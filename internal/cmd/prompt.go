@@ -209,6 +209,10 @@ func (c *Config) readMultichoice(prompt string, choices []string, defaultValue *
 
 // readPassword reads a password.
 func (c *Config) readPassword(prompt, placeholder string) (string, error) {
+	// Template functions from different providers may be called concurrently,
+	// so only prompt for one password at a time.
+	c.promptMutex.Lock()
+	defer c.promptMutex.Unlock()
 	switch {
 	case c.noTTY:
 		return c.readLineRaw(prompt)
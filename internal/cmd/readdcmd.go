@@ -160,7 +160,8 @@ TARGET_REL_PATH:
 				case choice == "diff":
 					if err := c.diffFile(
 						targetRelPath,
-						c.SourceDirAbsPath.Join(sourceStateFile.SourceRelPath().RelPath()), targetContents, targetStateFile.Perm(c.Umask),
+						sourceState.TargetSourceDirAbsPath(targetRelPath).Join(sourceStateFile.SourceRelPath().RelPath()),
+						targetContents, targetStateFile.Perm(c.Umask),
 						destAbsPath, actualContents, actualStateFile.Perm(),
 					); err != nil {
 						return err
@@ -201,6 +202,7 @@ TARGET_REL_PATH:
 		if err := sourceState.Add(c.sourceSystem, c.persistentState, c.destSystem, destAbsPathInfos, &chezmoi.AddOptions{
 			Encrypt:         sourceStateFile.Attr().Encrypted,
 			EncryptedSuffix: c.encryption.EncryptedSuffix(),
+			Encryption:      sourceStateFile.Encryption(),
 			Errorf:          c.errorf,
 			Filter:          c.reAdd.filter,
 			PreAddFunc:      c.defaultPreAddFunc,
@@ -354,7 +356,7 @@ func (c *Config) processExactDirs(
 				}
 
 				// This file was deleted from target - remove it from source
-				sourceAbsPath := c.SourceDirAbsPath.Join(sourceEntry.SourceRelPath().RelPath())
+				sourceAbsPath := sourceState.TargetSourceDirAbsPath(entryRelPath).Join(sourceEntry.SourceRelPath().RelPath())
 				if err := c.sourceSystem.RemoveAll(sourceAbsPath); err != nil {
 					return err
 				}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoi"
+	"chezmoi.io/chezmoi/v2/internal/chezmoiset"
+)
+
+type rekeyCmdConfig struct {
+	commit     bool
+	encryption *choiceFlag
+	recursive  bool
+}
+
+func (c *Config) newRekeyCmd() *cobra.Command {
+	rekeyCmd := &cobra.Command{
+		GroupID:           groupIDEncryption,
+		Use:               "rekey [target...]",
+		Short:             "Re-encrypt encrypted files with new keys",
+		Long:              mustLongHelp("rekey"),
+		Example:           example("rekey"),
+		ValidArgsFunction: c.targetValidArgs,
+		Args:              cobra.ArbitraryArgs,
+		RunE:              c.makeRunEWithSourceState(c.runRekeyCmd),
+		Annotations: newAnnotations(
+			modifiesSourceDirectory,
+			persistentStateModeReadWrite,
+			requiresSourceDirectory,
+		),
+	}
+
+	rekeyCmd.Flags().BoolVar(&c.rekey.commit, "commit", c.rekey.commit, "Commit the re-encrypted files")
+	rekeyCmd.Flags().Var(c.rekey.encryption, "encryption", "Encryption to re-encrypt with")
+	must(rekeyCmd.RegisterFlagCompletionFunc("encryption", c.rekey.encryption.FlagCompletionFunc()))
+	rekeyCmd.Flags().BoolVarP(&c.rekey.recursive, "recursive", "r", c.rekey.recursive, "Recurse into subdirectories")
+
+	return rekeyCmd
+}
+
+func (c *Config) runRekeyCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
+	options := &chezmoi.RekeyOptions{
+		KeepGoing:      c.keepGoing,
+		TargetRelPaths: chezmoiset.New[chezmoi.RelPath](),
+	}
+	if encryptionName := c.rekey.encryption.String(); encryptionName != "" {
+		encryption, err := c.encryptionNamed(encryptionName)
+		if err != nil {
+			return err
+		}
+		options.Encryption = encryption
+	}
+	if len(args) != 0 {
+		targetRelPaths, err := c.targetRelPaths(sourceState, args, targetRelPathsOptions{
+			recursive: c.rekey.recursive,
+		})
+		if err != nil {
+			return err
+		}
+		options.TargetRelPaths.Add(targetRelPaths...)
+	}
+
+	changedAbsPaths, rekeyErr := sourceState.Rekey(c.sourceSystem, options)
+	if !c.rekey.commit || c.dryRun {
+		return rekeyErr
+	}
+	if err := c.gitCommitRekeyedFiles(changedAbsPaths); err != nil {
+		return err
+	}
+	return rekeyErr
+}
+
+// gitCommitRekeyedFiles commits the changes to the files in changedAbsPaths
+// that are in the working tree, leaving all other changes uncommitted.
+func (c *Config) gitCommitRekeyedFiles(changedAbsPaths []chezmoi.AbsPath) error {
+	var pathspecs []string
+	for _, changedAbsPath := range changedAbsPaths {
+		if changedAbsPath.HasDirPrefix(c.WorkingTreeAbsPath) {
+			pathspecs = append(pathspecs, changedAbsPath.String())
+		}
+	}
+	if len(pathspecs) == 0 {
+		return nil
+	}
+	if err := c.run(c.WorkingTreeAbsPath, c.Git.Command, append([]string{"add", "--all", "--"}, pathspecs...)); err != nil {
+		return err
+	}
+	return c.run(
+		c.WorkingTreeAbsPath,
+		c.Git.Command,
+		append([]string{"commit", "--message", "Rekey encrypted files", "--"}, pathspecs...),
+	)
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/spf13/cobra"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoi"
+)
+
+type renderCmdConfig struct {
+	diff   []string
+	filter *chezmoi.EntryTypeFilter
+	matrix chezmoi.AbsPath
+	out    chezmoi.AbsPath
+}
+
+func (c *Config) newRenderCmd() *cobra.Command {
+	renderCmd := &cobra.Command{
+		GroupID:           groupIDTemplate,
+		Use:               "render [target]...",
+		Short:             "Render the target state for each row of a matrix",
+		Long:              mustLongHelp("render"),
+		Example:           example("render"),
+		ValidArgsFunction: c.targetValidArgs,
+		RunE:              c.runRenderCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadMockWrite,
+			requiresSourceDirectory,
+		),
+	}
+
+	renderCmd.Flags().StringSliceVar(&c.render.diff, "diff", c.render.diff, "Print the differences between two rows")
+	renderCmd.Flags().VarP(c.render.filter.Exclude, "exclude", "x", "Exclude entry types")
+	renderCmd.Flags().VarP(c.render.filter.Include, "include", "i", "Include entry types")
+	renderCmd.Flags().Var(&c.render.matrix, "matrix", "Matrix file")
+	renderCmd.Flags().Var(&c.render.out, "out", "Output directory")
+	must(renderCmd.MarkFlagRequired("matrix"))
+
+	return renderCmd
+}
+
+func (c *Config) runRenderCmd(cmd *cobra.Command, args []string) error {
+	switch {
+	case c.render.diff == nil && c.render.out.IsEmpty():
+		return errors.New("one of --diff or --out must be specified")
+	case c.render.diff != nil && len(c.render.diff) != 2:
+		return errors.New("--diff requires exactly two rows")
+	}
+
+	data, err := c.baseSystem.ReadFile(c.render.matrix)
+	if err != nil {
+		return err
+	}
+	var matrix map[string]map[string]any
+	if err := chezmoi.UnmarshalFileData(c.render.matrix, data, &matrix); err != nil {
+		return fmt.Errorf("%s: %w", c.render.matrix, err)
+	}
+	for _, row := range c.render.diff {
+		if _, ok := matrix[row]; !ok {
+			return fmt.Errorf("%s: row not found in %s", row, c.render.matrix)
+		}
+	}
+	if !c.render.out.IsEmpty() {
+		for row := range matrix {
+			if !isValidRowName(row) {
+				return fmt.Errorf("%q: invalid row name in %s", row, c.render.matrix)
+			}
+		}
+	}
+
+	rows := make(map[string]*chezmoi.DumpSystem, len(matrix))
+	for _, row := range slices.Sorted(maps.Keys(matrix)) {
+		if c.render.out.IsEmpty() && !slices.Contains(c.render.diff, row) {
+			continue
+		}
+		dumpSystem, err := c.renderRow(cmd, args, matrix[row])
+		if err != nil {
+			return fmt.Errorf("%s: %w", row, err)
+		}
+		rows[row] = dumpSystem
+		if !c.render.out.IsEmpty() {
+			if err := c.writeRenderedRow(c.render.out.JoinString(row), dumpSystem); err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.render.diff != nil {
+		return c.diffRenderedRows(rows[c.render.diff[0]], rows[c.render.diff[1]])
+	}
+	return nil
+}
+
+// isValidRowName returns whether row can be used as the name of a directory
+// directly in the output directory.
+func isValidRowName(row string) bool {
+	return row != "." && !strings.ContainsAny(row, `/\`) && filepath.IsLocal(row)
+}
+
+// renderRow renders the target state for args with the template data
+// overridden by rowData to an empty in-memory destination.
+func (c *Config) renderRow(cmd *cobra.Command, args []string, rowData map[string]any) (*chezmoi.DumpSystem, error) {
+	return c.dumpTargetState(cmd, c.render.filter, func(sourceState *chezmoi.SourceState) ([]chezmoi.RelPath, error) {
+		if len(args) == 0 {
+			return sourceState.TargetRelPaths(), nil
+		}
+		return c.targetRelPaths(sourceState, args, targetRelPathsOptions{
+			recursive: true,
+		})
+	}, chezmoi.WithPriorityTemplateData(rowData))
+}
+
+// writeRenderedRow writes the entries in dumpSystem to dirAbsPath. Scripts are
+// written as executable files, as in chezmoi archive.
+func (c *Config) writeRenderedRow(dirAbsPath chezmoi.AbsPath, dumpSystem *chezmoi.DumpSystem) error {
+	switch _, err := c.baseSystem.Lstat(dirAbsPath); {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	case c.force:
+		if err := c.baseSystem.RemoveAll(dirAbsPath); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%s: already exists", dirAbsPath)
+	}
+
+	// Hard links are created after all other entries so that their targets
+	// exist.
+	var hardlinks []*chezmoi.DumpSystemHardlinkData
+	data := dumpSystem.Data()
+	for _, name := range slices.Sorted(maps.Keys(data)) {
+		absPath := dirAbsPath.JoinString(name)
+		if err := chezmoi.MkdirAll(c.baseSystem, absPath.Dir(), fs.ModePerm); err != nil {
+			return err
+		}
+		switch data := data[name].(type) {
+		case *chezmoi.DumpSystemDirData:
+			if err := chezmoi.MkdirAll(c.baseSystem, absPath, data.Perm); err != nil {
+				return err
+			}
+		case *chezmoi.DumpSystemFileData:
+			if err := c.baseSystem.WriteFile(absPath, []byte(data.Contents), data.Perm); err != nil {
+				return err
+			}
+		case *chezmoi.DumpSystemHardlinkData:
+			hardlinks = append(hardlinks, data)
+		case *chezmoi.DumpSystemScriptData:
+			if err := c.baseSystem.WriteFile(absPath, []byte(data.Contents), 0o700); err != nil {
+				return err
+			}
+		case *chezmoi.DumpSystemSymlinkData:
+			if err := c.baseSystem.WriteSymlink(data.Linkname, absPath); err != nil {
+				return err
+			}
+		}
+	}
+	for _, hardlink := range hardlinks {
+		oldAbsPath := dirAbsPath.JoinString(hardlink.Linkname.String())
+		newAbsPath := dirAbsPath.JoinString(hardlink.Name.String())
+		if err := c.baseSystem.Link(oldAbsPath, newAbsPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffRenderedRows prints the differences between the entries in
+// fromDumpSystem and toDumpSystem.
+func (c *Config) diffRenderedRows(fromDumpSystem, toDumpSystem *chezmoi.DumpSystem) error {
+	var builder strings.Builder
+	unifiedEncoder := diff.NewUnifiedEncoder(&builder, diff.DefaultContextLines)
+	if c.Color.Value(c.colorAutoFunc) {
+		unifiedEncoder.SetColor(diff.NewColorConfig())
+	}
+
+	fromData := fromDumpSystem.Data()
+	toData := toDumpSystem.Data()
+	names := slices.Sorted(maps.Keys(fromData))
+	for name := range toData {
+		if _, ok := fromData[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		fromContents, fromMode := renderedContentsAndMode(fromData[name])
+		toContents, toMode := renderedContentsAndMode(toData[name])
+		if fromMode == toMode && string(fromContents) == string(toContents) {
+			continue
+		}
+		if fromMode.IsDir() || toMode.IsDir() {
+			continue
+		}
+		diffPatch, err := chezmoi.DiffPatch(chezmoi.NewRelPath(name), fromContents, fromMode, toContents, toMode)
+		if err != nil {
+			return err
+		}
+		if err := unifiedEncoder.Encode(diffPatch); err != nil {
+			return err
+		}
+	}
+	return c.pageDiffOutput(builder.String())
+}
+
+// renderedContentsAndMode returns the contents and mode of the rendered entry
+// data.
+func renderedContentsAndMode(data any) ([]byte, fs.FileMode) {
+	switch data := data.(type) {
+	case *chezmoi.DumpSystemDirData:
+		return nil, fs.ModeDir | data.Perm
+	case *chezmoi.DumpSystemFileData:
+		return []byte(data.Contents), data.Perm
+	case *chezmoi.DumpSystemHardlinkData:
+		return []byte(data.Linkname.String()), 0o644
+	case *chezmoi.DumpSystemScriptData:
+		return []byte(data.Contents), 0o700
+	case *chezmoi.DumpSystemSymlinkData:
+		return []byte(data.Linkname), fs.ModeSymlink
+	default:
+		return nil, 0
+	}
+}
@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoi"
+)
+
+type secretCacheConfig struct {
+	Enabled bool                     `json:"enabled" mapstructure:"enabled" yaml:"enabled"`
+	TTL     time.Duration            `json:"ttl"     mapstructure:"ttl"     yaml:"ttl"`
+	TTLs    map[string]time.Duration `json:"ttls"    mapstructure:"ttls"    yaml:"ttls"`
+}
+
+// A secretCacheEntry is a cached result of a password manager template
+// function.
+type secretCacheEntry struct {
+	Name  string          `json:"name"`
+	Time  time.Time       `json:"time"`
+	Value json.RawMessage `json:"value"`
+}
+
+// secretCacheProviders are the password managers whose template functions can
+// be cached, named as in the config file. Each template function name starts
+// with its provider's name.
+var secretCacheProviders = []string{
+	"awsSecretsManager",
+	"azureKeyVault",
+	"bitwarden",
+	"bitwardenSecrets",
+	"dashlane",
+	"doppler",
+	"ejson",
+	"gopass",
+	"keepassxc",
+	"keeper",
+	"keyring",
+	"lastpass",
+	"onepassword",
+	"pass",
+	"passhole",
+	"protonPass",
+	"rbw",
+	"secret",
+	"vault",
+}
+
+// A secretCache is the in-memory contents of the secret cache. It is read and
+// decrypted at most once per run and written back, if modified, when chezmoi
+// exits.
+type secretCache struct {
+	sync.Mutex
+	entries  map[string]*secretCacheEntry
+	modified bool
+}
+
+// secretCacheDirAbsPath returns the directory containing the secret cache.
+func (c *Config) secretCacheDirAbsPath() chezmoi.AbsPath {
+	return c.CacheDirAbsPath.JoinString("secrets")
+}
+
+// secretCacheAbsPath returns the path of the encrypted secret cache.
+func (c *Config) secretCacheAbsPath() chezmoi.AbsPath {
+	return c.secretCacheDirAbsPath().JoinString("cache")
+}
+
+// cacheSecretTemplateFuncs wraps the password manager template functions so
+// that their results are cached, encrypted, in the cache directory.
+func (c *Config) cacheSecretTemplateFuncs() {
+	// Never write secrets to disk in plaintext.
+	if c.encryption == nil || c.encryption.EncryptedSuffix() == "" {
+		c.errorf("warning: secretCache: age or gpg encryption required, not caching secrets\n")
+		return
+	}
+	c.secretCache = &secretCache{}
+	for name := range secretTemplateFuncs {
+		if _, ok := c.templateFuncs[name]; !ok {
+			continue
+		}
+		if ttl := c.secretCacheTTL(name); ttl > 0 {
+			c.templateFuncs[name] = c.cacheSecretTemplateFunc(name, ttl)
+		}
+	}
+}
+
+// secretCacheTTL returns the time for which the results of the template
+// function name are cached.
+func (c *Config) secretCacheTTL(name string) time.Duration {
+	var provider string
+	for _, secretCacheProvider := range secretCacheProviders {
+		if strings.HasPrefix(name, secretCacheProvider) && len(secretCacheProvider) > len(provider) {
+			provider = secretCacheProvider
+		}
+	}
+	if ttl, ok := c.SecretCache.TTLs[provider]; ok {
+		return ttl
+	}
+	return c.SecretCache.TTL
+}
+
+// cacheSecretTemplateFunc returns the template function name wrapped so that
+// its results are read from and written to the secret cache. Cached results
+// are used until they are older than ttl, and are also used when secrets are
+// skipped. If the arguments cannot be used as a cache key then the template
+// function is called without the cache.
+func (c *Config) cacheSecretTemplateFunc(name string, ttl time.Duration) any {
+	templateFuncValue := reflect.ValueOf(c.templateFuncs[name])
+	templateFuncType := templateFuncValue.Type()
+	call := func(args []reflect.Value) []reflect.Value {
+		if templateFuncType.IsVariadic() {
+			return templateFuncValue.CallSlice(args)
+		}
+		return templateFuncValue.Call(args)
+	}
+	return reflect.MakeFunc(templateFuncType, func(args []reflect.Value) []reflect.Value {
+		key := []any{name}
+		for _, arg := range args {
+			key = append(key, arg.Interface())
+		}
+		keyJSON, err := json.Marshal(key)
+		switch {
+		case err != nil && templateFuncType.NumOut() == 2:
+			return []reflect.Value{
+				reflect.Zero(templateFuncType.Out(0)),
+				reflect.ValueOf(fmt.Errorf("%s: %w", name, err)),
+			}
+		case err != nil:
+			return call(args)
+		}
+		keySHA256 := sha256.Sum256(keyJSON)
+		cacheKey := hex.EncodeToString(keySHA256[:])
+
+		if results, ok := c.readSecretCache(cacheKey, ttl, templateFuncType); ok {
+			return results
+		}
+
+		results := call(args)
+		if len(results) == 2 && !results[1].IsNil() {
+			return results
+		}
+		if err := c.writeSecretCache(cacheKey, name, results[0].Interface()); err != nil {
+			c.errorf("warning: %s: %v\n", name, err)
+		}
+		return results
+	}).Interface()
+}
+
+// loadSecretCache reads and decrypts the secret cache, if it has not already
+// been read. c.secretCache must be locked. A missing or invalid secret cache is
+// treated as empty.
+func (c *Config) loadSecretCache() {
+	if c.secretCache.entries != nil {
+		return
+	}
+	c.secretCache.entries = make(map[string]*secretCacheEntry)
+	ciphertext, err := c.baseSystem.ReadFile(c.secretCacheAbsPath())
+	if err != nil {
+		return
+	}
+	plaintext, err := c.encryption.Decrypt(ciphertext)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(plaintext, &c.secretCache.entries); err != nil {
+		c.secretCache.entries = make(map[string]*secretCacheEntry)
+		c.secretCache.modified = true
+	}
+}
+
+// readSecretCache returns the results of a template function of type
+// templateFuncType for cacheKey, if they exist and are newer than ttl. Expired
+// and invalid entries are removed.
+func (c *Config) readSecretCache(cacheKey string, ttl time.Duration, templateFuncType reflect.Type) ([]reflect.Value, bool) {
+	c.secretCache.Lock()
+	defer c.secretCache.Unlock()
+	c.loadSecretCache()
+	entry, ok := c.secretCache.entries[cacheKey]
+	if !ok {
+		return nil, false
+	}
+	value := reflect.New(templateFuncType.Out(0))
+	if time.Since(entry.Time) > ttl || json.Unmarshal(entry.Value, value.Interface()) != nil {
+		delete(c.secretCache.entries, cacheKey)
+		c.secretCache.modified = true
+		return nil, false
+	}
+	results := []reflect.Value{value.Elem()}
+	if templateFuncType.NumOut() == 2 {
+		results = append(results, reflect.Zero(templateFuncType.Out(1)))
+	}
+	return results, true
+}
+
+// writeSecretCache sets the cached result of template function name for
+// cacheKey to value.
+func (c *Config) writeSecretCache(cacheKey, name string, value any) error {
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	c.secretCache.Lock()
+	defer c.secretCache.Unlock()
+	c.loadSecretCache()
+	c.secretCache.entries[cacheKey] = &secretCacheEntry{
+		Name:  name,
+		Time:  time.Now().UTC(),
+		Value: valueJSON,
+	}
+	c.secretCache.modified = true
+	return nil
+}
+
+// saveSecretCache encrypts and writes the secret cache, without expired
+// entries, if it was modified.
+func (c *Config) saveSecretCache() error {
+	c.secretCache.Lock()
+	defer c.secretCache.Unlock()
+	if !c.secretCache.modified {
+		return nil
+	}
+	for cacheKey, entry := range c.secretCache.entries {
+		if time.Since(entry.Time) > c.secretCacheTTL(entry.Name) {
+			delete(c.secretCache.entries, cacheKey)
+		}
+	}
+	plaintext, err := json.Marshal(c.secretCache.entries)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := c.encryption.Encrypt(plaintext)
+	if err != nil {
+		return err
+	}
+	if err := chezmoi.MkdirAll(c.baseSystem, c.secretCacheDirAbsPath(), 0o700); err != nil {
+		return err
+	}
+	if err := c.baseSystem.WriteFile(c.secretCacheAbsPath(), ciphertext, 0o600); err != nil {
+		return err
+	}
+	c.secretCache.modified = false
+	return nil
+}
+
+// clearSecretCache removes all entries from the secret cache.
+func (c *Config) clearSecretCache() error {
+	if err := c.baseSystem.RemoveAll(c.secretCacheDirAbsPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import "github.com/spf13/cobra"
+
+func (c *Config) newSecretCacheCmd() *cobra.Command {
+	secretCacheCmd := &cobra.Command{
+		Use:   "cache",
+		Args:  cobra.NoArgs,
+		Short: "Interact with the secret cache",
+		Annotations: newAnnotations(
+			persistentStateModeNone,
+		),
+	}
+
+	secretCacheClearCmd := &cobra.Command{
+		Use:   "clear",
+		Args:  cobra.NoArgs,
+		Short: "Remove all values from the secret cache",
+		RunE:  c.runSecretCacheClearCmdE,
+		Annotations: newAnnotations(
+			doesNotRequireValidConfig,
+			persistentStateModeNone,
+		),
+	}
+	secretCacheCmd.AddCommand(secretCacheClearCmd)
+
+	return secretCacheCmd
+}
+
+func (c *Config) runSecretCacheClearCmdE(cmd *cobra.Command, args []string) error {
+	return c.clearSecretCache()
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoi"
+)
+
+// useSecretsFixture replaces each password manager template function with a
+// lookup in the secrets fixture file.
+func (c *Config) useSecretsFixture() error {
+	data, err := c.baseSystem.ReadFile(c.SecretsFixture)
+	if err != nil {
+		return err
+	}
+	var secrets map[string]map[string]any
+	if err := chezmoi.UnmarshalFileData(c.SecretsFixture, data, &secrets); err != nil {
+		return fmt.Errorf("%s: %w", c.SecretsFixture, err)
+	}
+	for _, name := range slices.Sorted(maps.Keys(secrets)) {
+		if !secretTemplateFuncs.Contains(name) {
+			return fmt.Errorf("%s: %s: not a password manager template function", c.SecretsFixture, name)
+		}
+	}
+	c.templateFuncs = mockSecretTemplateFuncs(c.templateFuncs, secrets)
+	return nil
+}
+
+// mockSecretTemplateFuncs returns a copy of templateFuncs where each password
+// manager template function returns the value in secrets for its arguments.
+func mockSecretTemplateFuncs(templateFuncs template.FuncMap, secrets map[string]map[string]any) template.FuncMap {
+	mockTemplateFuncs := maps.Clone(templateFuncs)
+	for name := range secretTemplateFuncs {
+		if _, ok := mockTemplateFuncs[name]; !ok {
+			continue
+		}
+		mockTemplateFuncs[name] = func(args ...any) (any, error) {
+			key := secretKey(args)
+			value, ok := secrets[name][key]
+			if !ok {
+				return nil, fmt.Errorf("%s %s: no mocked value", name, key)
+			}
+			return value, nil
+		}
+	}
+	return mockTemplateFuncs
+}
+
+// secretKey returns the key for args.
+func secretKey(args []any) string {
+	argStrs := make([]string, len(args))
+	for i, arg := range args {
+		argStrs[i] = fmt.Sprint(arg)
+	}
+	return strings.Join(argStrs, " ")
+}
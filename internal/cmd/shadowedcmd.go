@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoi"
+)
+
+type shadowedCmdConfig struct {
+	format *choiceFlag
+}
+
+func (c *Config) newShadowedCmd() *cobra.Command {
+	shadowedCmd := &cobra.Command{
+		GroupID:           groupIDAdvanced,
+		Use:               "shadowed",
+		Short:             "List targets shadowed by a higher source directory layer",
+		Long:              mustLongHelp("shadowed"),
+		Example:           example("shadowed"),
+		Args:              cobra.NoArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE:              c.makeRunEWithSourceState(c.runShadowedCmd),
+		Annotations: newAnnotations(
+			persistentStateModeReadMockWrite,
+		),
+	}
+
+	shadowedCmd.Flags().VarP(c.shadowed.format, "format", "f", "Output format")
+	must(shadowedCmd.RegisterFlagCompletionFunc("format", c.shadowed.format.FlagCompletionFunc()))
+
+	return shadowedCmd
+}
+
+func (c *Config) runShadowedCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
+	layerConflicts := sourceState.LayerConflicts()
+
+	if format := c.shadowed.format.String(); format != "" {
+		return c.marshal(format, layerConflicts)
+	}
+
+	var builder strings.Builder
+	tabWriter := tabwriter.NewWriter(&builder, 3, 0, 3, ' ', 0)
+	fmt.Fprint(tabWriter, "TARGET\tSOURCE\tSHADOWED\n")
+	for _, layerConflict := range layerConflicts {
+		for _, shadowedSourceAbsPath := range layerConflict.ShadowedSourceAbsPaths {
+			fmt.Fprintf(tabWriter, "%s\t%s\t%s\n",
+				layerConflict.TargetRelPath,
+				layerConflict.SourceAbsPath,
+				shadowedSourceAbsPath,
+			)
+		}
+	}
+	if err := tabWriter.Flush(); err != nil {
+		return err
+	}
+	return c.writeOutputString(builder.String(), 0o666)
+}
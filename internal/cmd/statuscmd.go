@@ -44,7 +44,11 @@ func (c *Config) newStatusCmd() *cobra.Command {
 	statusCmd.Flags().BoolVar(&c.Status.init, "init", c.Status.init, "Recreate config file from template")
 	statusCmd.Flags().
 		BoolVarP(&c.Status.parentDirs, "parent-dirs", "P", c.Status.parentDirs, "Show status of all parent directories")
+	statusCmd.Flags().Var(c.profileTemplates, "profile-templates", "Print the time spent executing templates")
+	statusCmd.Flags().Lookup("profile-templates").NoOptDefVal = profileTemplatesFormatText
+	must(statusCmd.RegisterFlagCompletionFunc("profile-templates", c.profileTemplates.FlagCompletionFunc()))
 	statusCmd.Flags().BoolVarP(&c.Status.recursive, "recursive", "r", c.Status.recursive, "Recurse into subdirectories")
+	statusCmd.Flags().Var(c.tagFilter, "tags", "Only include targets with tags")
 
 	return statusCmd
 }
@@ -78,6 +82,11 @@ func (c *Config) runStatusCmd(cmd *cobra.Command, args []string) error {
 				path = c.DestDirAbsPath.Join(targetRelPath).String()
 			case pathStyleRelative:
 				path = targetRelPath.String()
+			case pathStyleSourceAbsolute:
+				sourceRelPath := c.sourceState.MustEntry(targetRelPath).SourceRelPath()
+				path = c.sourceState.TargetSourceDirAbsPath(targetRelPath).Join(sourceRelPath.RelPath()).String()
+			case pathStyleSourceRelative:
+				path = c.sourceState.MustEntry(targetRelPath).SourceRelPath().String()
 			default:
 				return fmt.Errorf("%s: invalid path style", pathStyle)
 			}
@@ -107,7 +116,8 @@ func statusRune(fromState, toState *chezmoi.EntryState) rune {
 	switch toState.Type {
 	case chezmoi.EntryStateTypeRemove:
 		return 'D'
-	case chezmoi.EntryStateTypeDir, chezmoi.EntryStateTypeFile, chezmoi.EntryStateTypeSymlink:
+	case chezmoi.EntryStateTypeDir, chezmoi.EntryStateTypeFile, chezmoi.EntryStateTypeHardlink,
+		chezmoi.EntryStateTypeSymlink:
 		switch fromState.Type {
 		case chezmoi.EntryStateTypeRemove:
 			return 'A'
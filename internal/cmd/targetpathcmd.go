@@ -52,7 +52,7 @@ func (c *Config) runTargetPathCmd(cmd *cobra.Command, args []string) error {
 			sourceRelPath = chezmoi.NewSourceRelPath(argRelPath.String())
 		}
 
-		targetRelPath, err := sourceRelPath.TargetRelPath(c.encryption.EncryptedSuffix())
+		targetRelPath, err := sourceRelPath.TargetRelPath(chezmoi.EncryptedSuffixOf(c.encryption, argRelPath.Base()))
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoi"
+)
+
+const profileTemplatesFormatText = "text"
+
+var profileTemplatesFormatValues = []string{
+	formatUnknown,
+	formatJSON,
+	profileTemplatesFormatText,
+}
+
+// profileTemplatesTextEntries is the maximum number of entries in a text
+// template profile.
+const profileTemplatesTextEntries = 20
+
+var (
+	// includeTemplateFuncs are template functions that include other files or
+	// templates.
+	includeTemplateFuncs = []string{
+		"include",
+		"includeTemplate",
+	}
+
+	// commandTemplateFuncs are template functions that run the command given
+	// in their first argument.
+	commandTemplateFuncs = []string{
+		"exec",
+		"output",
+		"outputList",
+	}
+)
+
+// profileTemplateFuncs wraps the template functions that include files or
+// templates, or that run external commands, so that the time spent in them is
+// recorded by c.templateProfiler.
+func (c *Config) profileTemplateFuncs() {
+	profile := func(kind chezmoi.TemplateProfileKind, names []string, withFirstArg bool) {
+		for _, name := range names {
+			if _, ok := c.templateFuncs[name]; ok {
+				c.templateFuncs[name] = c.profileTemplateFunc(kind, name, withFirstArg)
+			}
+		}
+	}
+	profile(chezmoi.TemplateProfileKindInclude, includeTemplateFuncs, true)
+	profile(chezmoi.TemplateProfileKindFunction, commandTemplateFuncs, true)
+	profile(chezmoi.TemplateProfileKindFunction, slices.Collect(maps.Keys(serialTemplateFuncProviders)), false)
+}
+
+// profileTemplateFunc returns the template function name wrapped so that the
+// time spent in it is recorded. If withFirstArg is true then the first
+// argument is included in the recorded name.
+func (c *Config) profileTemplateFunc(kind chezmoi.TemplateProfileKind, name string, withFirstArg bool) any {
+	templateFuncValue := reflect.ValueOf(c.templateFuncs[name])
+	templateFuncType := templateFuncValue.Type()
+	return reflect.MakeFunc(templateFuncType, func(args []reflect.Value) []reflect.Value {
+		profileName := name
+		if withFirstArg && len(args) > 0 {
+			profileName += " " + fmt.Sprint(args[0].Interface())
+		}
+		defer c.templateProfiler.Start(kind, profileName)()
+		if templateFuncType.IsVariadic() {
+			return templateFuncValue.CallSlice(args)
+		}
+		return templateFuncValue.Call(args)
+	}).Interface()
+}
+
+// writeTemplateProfile writes the template profile to the standard error.
+func (c *Config) writeTemplateProfile() error {
+	entries := c.templateProfiler.Entries()
+
+	if c.profileTemplates.String() == formatJSON {
+		if entries == nil {
+			entries = []*chezmoi.TemplateProfileEntry{}
+		}
+		data, err := chezmoi.FormatJSON.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		_, err = c.stderr.Write(data)
+		return err
+	}
+
+	if len(entries) > profileTemplatesTextEntries {
+		entries = entries[:profileTemplatesTextEntries]
+	}
+	var builder strings.Builder
+	tabWriter := tabwriter.NewWriter(&builder, 3, 0, 3, ' ', 0)
+	fmt.Fprintln(tabWriter, "TOTAL\tCOUNT\tMAX\tKIND\tNAME")
+	for _, entry := range entries {
+		fmt.Fprintf(tabWriter, "%s\t%d\t%s\t%s\t%s\n",
+			entry.Total.Round(time.Microsecond),
+			entry.Count,
+			entry.Max.Round(time.Microsecond),
+			entry.Kind,
+			entry.Name,
+		)
+	}
+	if err := tabWriter.Flush(); err != nil {
+		return err
+	}
+	_, err := c.stderr.Write([]byte(builder.String()))
+	return err
+}
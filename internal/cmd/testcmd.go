@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/spf13/cobra"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoi"
+)
+
+// A templateTest is a test case in the .chezmoitests directory.
+type templateTest struct {
+	name    string
+	Data    map[string]any            `json:"data"    toml:"data"    yaml:"data"`
+	Secrets map[string]map[string]any `json:"secrets" toml:"secrets" yaml:"secrets"`
+	Targets map[string]string         `json:"targets" toml:"targets" yaml:"targets"`
+}
+
+func (c *Config) newTestCmd() *cobra.Command {
+	testCmd := &cobra.Command{
+		GroupID:           groupIDTemplate,
+		Use:               "test [name]...",
+		Short:             "Run the template tests in the source directory",
+		Long:              mustLongHelp("test"),
+		Example:           example("test"),
+		Args:              cobra.ArbitraryArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE:              c.runTestCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadMockWrite,
+			requiresSourceDirectory,
+		),
+	}
+
+	return testCmd
+}
+
+func (c *Config) runTestCmd(cmd *cobra.Command, args []string) error {
+	sourceDirAbsPath, err := c.getSourceDirAbsPath(nil)
+	if err != nil {
+		return err
+	}
+	templateTests, err := c.readTemplateTests(sourceDirAbsPath.JoinString(chezmoi.TestsDirName))
+	if err != nil {
+		return err
+	}
+
+	if len(args) != 0 {
+		templateTestsByName := make(map[string]*templateTest, len(templateTests))
+		for _, templateTest := range templateTests {
+			templateTestsByName[templateTest.name] = templateTest
+		}
+		templateTests = templateTests[:0]
+		for _, arg := range args {
+			templateTest, ok := templateTestsByName[arg]
+			if !ok {
+				return fmt.Errorf("%s: test not found", arg)
+			}
+			templateTests = append(templateTests, templateTest)
+		}
+	}
+
+	var builder strings.Builder
+	failed := false
+	for _, templateTest := range templateTests {
+		diffs, err := c.runTemplateTest(cmd, templateTest)
+		switch {
+		case err != nil:
+			failed = true
+			fmt.Fprintf(&builder, "--- FAIL: %s\n    %v\n", templateTest.name, err)
+		case diffs != "":
+			failed = true
+			fmt.Fprintf(&builder, "--- FAIL: %s\n%s", templateTest.name, diffs)
+		case c.Verbose:
+			fmt.Fprintf(&builder, "--- PASS: %s\n", templateTest.name)
+		}
+	}
+	if err := c.writeOutputString(builder.String(), 0o666); err != nil {
+		return err
+	}
+
+	if failed {
+		return chezmoi.ExitCodeError(1)
+	}
+	return nil
+}
+
+// readTemplateTests reads the template tests in testsDirAbsPath. Each test is a
+// file in a data format. Files in the directory with the same name as the test
+// contain the expected contents of targets, in addition to the test's targets.
+func (c *Config) readTemplateTests(testsDirAbsPath chezmoi.AbsPath) ([]*templateTest, error) {
+	dirEntries, err := c.baseSystem.ReadDir(testsDirAbsPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	var templateTests []*templateTest
+	for _, dirEntry := range dirEntries {
+		extension := strings.TrimPrefix(path.Ext(dirEntry.Name()), ".")
+		if _, ok := chezmoi.FormatsByExtension[extension]; !ok || dirEntry.IsDir() {
+			continue
+		}
+
+		testAbsPath := testsDirAbsPath.JoinString(dirEntry.Name())
+		data, err := c.baseSystem.ReadFile(testAbsPath)
+		if err != nil {
+			return nil, err
+		}
+		templateTest := &templateTest{
+			name: strings.TrimSuffix(dirEntry.Name(), "."+extension),
+		}
+		if err := chezmoi.UnmarshalFileData(testAbsPath, data, templateTest); err != nil {
+			return nil, fmt.Errorf("%s: %w", testAbsPath, err)
+		}
+		if templateTest.Targets == nil {
+			templateTest.Targets = make(map[string]string)
+		}
+
+		goldenDirAbsPath := testsDirAbsPath.JoinString(templateTest.name)
+		if err := chezmoi.Walk(c.baseSystem, goldenDirAbsPath, func(absPath chezmoi.AbsPath, fileInfo fs.FileInfo, err error) error {
+			switch {
+			case errors.Is(err, fs.ErrNotExist) && absPath == goldenDirAbsPath:
+				return nil
+			case err != nil:
+				return err
+			case !fileInfo.Mode().IsRegular():
+				return nil
+			}
+			contents, err := c.baseSystem.ReadFile(absPath)
+			if err != nil {
+				return err
+			}
+			targetRelPath := absPath.MustTrimDirPrefix(goldenDirAbsPath)
+			if _, ok := templateTest.Targets[targetRelPath.String()]; ok {
+				return fmt.Errorf("%s: duplicate target", absPath)
+			}
+			templateTest.Targets[targetRelPath.String()] = string(contents)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+
+		templateTests = append(templateTests, templateTest)
+	}
+	return templateTests, nil
+}
+
+// runTemplateTest runs templateTest by applying its targets to an empty
+// in-memory destination and returns the diffs between the expected and actual
+// contents of the targets.
+func (c *Config) runTemplateTest(cmd *cobra.Command, templateTest *templateTest) (string, error) {
+	targets := slices.Sorted(maps.Keys(templateTest.Targets))
+	dumpSystem, err := c.dumpTargetState(cmd,
+		chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
+		func(sourceState *chezmoi.SourceState) ([]chezmoi.RelPath, error) {
+			targetRelPaths := make([]chezmoi.RelPath, 0, len(targets))
+			for _, target := range targets {
+				targetRelPath := chezmoi.NewRelPath(target)
+				if sourceState.Get(targetRelPath) == nil {
+					return nil, fmt.Errorf("%s: not managed", targetRelPath)
+				}
+				targetRelPaths = append(targetRelPaths, targetRelPath)
+			}
+			return targetRelPaths, nil
+		},
+		chezmoi.WithPriorityTemplateData(templateTest.Data),
+		chezmoi.WithTemplateFuncs(mockSecretTemplateFuncs(c.templateFuncs, templateTest.Secrets)),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	var builder strings.Builder
+	unifiedEncoder := diff.NewUnifiedEncoder(&builder, diff.DefaultContextLines)
+	if c.Color.Value(c.colorAutoFunc) {
+		unifiedEncoder.SetColor(diff.NewColorConfig())
+	}
+
+	data := dumpSystem.Data()
+	for _, target := range targets {
+		var actualContents string
+		switch data := data[target].(type) {
+		case *chezmoi.DumpSystemFileData:
+			actualContents = data.Contents
+		case *chezmoi.DumpSystemScriptData:
+			actualContents = data.Contents
+		case *chezmoi.DumpSystemSymlinkData:
+			actualContents = data.Linkname
+		}
+		expectedContents := templateTest.Targets[target]
+		if actualContents == expectedContents {
+			continue
+		}
+
+		diffPatch, err := chezmoi.DiffPatch(
+			chezmoi.NewRelPath(target),
+			[]byte(expectedContents), 0o644,
+			[]byte(actualContents), 0o644,
+		)
+		if err != nil {
+			return "", err
+		}
+		if err := unifiedEncoder.Encode(diffPatch); err != nil {
+			return "", err
+		}
+	}
+	return builder.String(), nil
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoi"
+	"chezmoi.io/chezmoi/v2/internal/chezmoiset"
+)
+
+type undoCmdConfig struct {
+	applyID string
+}
+
+func (c *Config) newUndoCmd() *cobra.Command {
+	undoCmd := &cobra.Command{
+		GroupID:           groupIDAdvanced,
+		Use:               "undo",
+		Short:             "Undo an apply",
+		Long:              mustLongHelp("undo"),
+		Example:           example("undo"),
+		Args:              cobra.NoArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE:              c.runUndoCmd,
+		Annotations: newAnnotations(
+			modifiesDestinationDirectory,
+			persistentStateModeReadWrite,
+		),
+	}
+
+	undoCmd.Flags().StringVar(&c.undo.applyID, "apply-id", c.undo.applyID, "Undo the apply with the given ID")
+
+	return undoCmd
+}
+
+func (c *Config) runUndoCmd(cmd *cobra.Command, args []string) error {
+	applyRecords, err := c.getApplyRecords()
+	if err != nil {
+		return err
+	}
+
+	var index int
+	switch {
+	case c.undo.applyID != "":
+		index = slices.IndexFunc(applyRecords, func(applyRecord *chezmoi.ApplyRecord) bool {
+			return applyRecord.ID == c.undo.applyID
+		})
+		if index == -1 {
+			return fmt.Errorf("%s: apply not found", c.undo.applyID)
+		}
+	case len(applyRecords) == 0:
+		return errors.New("no applies to undo")
+	default:
+		index = len(applyRecords) - 1
+	}
+	applyRecord := applyRecords[index]
+
+	// Refuse to undo changes to targets that have been modified by later
+	// applies, or that have been modified since chezmoi last wrote them, unless
+	// --force is set.
+	if !c.force {
+		targetAbsPaths := chezmoiset.New(applyRecord.TargetAbsPaths()...)
+		for _, laterApplyRecord := range applyRecords[index+1:] {
+			for _, targetAbsPath := range laterApplyRecord.TargetAbsPaths() {
+				if targetAbsPaths.Contains(targetAbsPath) {
+					return fmt.Errorf(
+						"%s: modified by later apply %s, use --force to undo anyway",
+						targetAbsPath,
+						laterApplyRecord.ID,
+					)
+				}
+			}
+		}
+
+		for _, targetAbsPath := range applyRecord.TargetAbsPaths() {
+			var lastWrittenEntryState chezmoi.EntryState
+			switch ok, err := chezmoi.PersistentStateGet(c.persistentState, chezmoi.EntryStateBucket, targetAbsPath.Bytes(), &lastWrittenEntryState); {
+			case err != nil:
+				return err
+			case !ok:
+				continue
+			}
+			actualStateEntry, err := chezmoi.NewActualStateEntry(c.destSystem, targetAbsPath, nil, nil)
+			if err != nil {
+				return err
+			}
+			actualEntryState, err := actualStateEntry.EntryState()
+			if err != nil {
+				return err
+			}
+			if !actualEntryState.Equivalent(&lastWrittenEntryState) {
+				return fmt.Errorf("%s: has changed since chezmoi last wrote it, use --force to undo anyway", targetAbsPath)
+			}
+		}
+	}
+
+	blobStore := c.newBlobStore()
+	for _, entry := range applyRecord.Journal {
+		if err := entry.Load(blobStore); err != nil {
+			return err
+		}
+	}
+	if err := chezmoi.RestoreJournal(c.destSystem, applyRecord.Journal); err != nil {
+		return err
+	}
+
+	for absPath, entryState := range applyRecord.EntryStates {
+		if entryState == nil {
+			if err := c.persistentState.Delete(chezmoi.EntryStateBucket, absPath.Bytes()); err != nil {
+				return err
+			}
+		} else if err := chezmoi.PersistentStateSet(c.persistentState, chezmoi.EntryStateBucket, absPath.Bytes(), entryState); err != nil {
+			return err
+		}
+	}
+
+	if err := c.persistentState.Delete(chezmoi.ApplyHistoryBucket, []byte(applyRecord.ID)); err != nil {
+		return err
+	}
+
+	if c.dryRun {
+		return nil
+	}
+	return c.removeUnreferencedBlobs(slices.Delete(applyRecords, index, index+1))
+}
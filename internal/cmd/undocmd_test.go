@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"runtime"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/twpayne/go-vfs/v5"
+	"github.com/twpayne/go-vfs/v5/vfst"
+
+	"chezmoi.io/chezmoi/v2/internal/chezmoi"
+	"chezmoi.io/chezmoi/v2/internal/chezmoitest"
+)
+
+func TestUndoCmdLaterApply(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user": map[string]any{
+			".file":                         "# original contents of .file\n",
+			".local/share/chezmoi/dot_file": "# first contents of .file\n",
+		},
+	}, func(fileSystem vfs.FS) {
+		assert.NoError(t, newTestConfig(t, fileSystem).execute([]string{"apply", "--force"}))
+		assert.NoError(t, fileSystem.WriteFile("/home/user/.local/share/chezmoi/dot_file", []byte("# second contents of .file\n"), 0o666))
+		assert.NoError(t, newTestConfig(t, fileSystem).execute([]string{"apply", "--force"}))
+
+		applyRecordSummaries := getApplyRecordSummaries(t, fileSystem)
+		assert.Equal(t, 2, len(applyRecordSummaries))
+
+		err := newTestConfig(t, fileSystem).execute([]string{"undo", "--apply-id", applyRecordSummaries[0].ID})
+		assert.EqualError(t, err, "/home/user/.file: modified by later apply "+applyRecordSummaries[1].ID+", use --force to undo anyway")
+		vfst.RunTests(t, fileSystem, "",
+			vfst.TestPath("/home/user/.file",
+				vfst.TestContentsString("# second contents of .file\n"),
+			),
+		)
+
+		assert.NoError(t, newTestConfig(t, fileSystem).execute([]string{"undo", "--force", "--apply-id", applyRecordSummaries[0].ID}))
+		vfst.RunTests(t, fileSystem, "",
+			vfst.TestPath("/home/user/.file",
+				vfst.TestContentsString("# original contents of .file\n"),
+			),
+		)
+	})
+}
+
+func TestUndoCmdHistoryKeep(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user": map[string]any{
+			".config/chezmoi/chezmoi.toml":  "[history]\n    keep = 1\n",
+			".file":                         "# original contents of .file\n",
+			".local/share/chezmoi/dot_file": "# first contents of .file\n",
+		},
+	}, func(fileSystem vfs.FS) {
+		assert.NoError(t, newTestConfig(t, fileSystem).execute([]string{"apply", "--force"}))
+		originalBlobPath := blobPath([]byte("# original contents of .file\n"))
+		if runtime.GOOS != "windows" {
+			vfst.RunTests(t, fileSystem, "",
+				vfst.TestPath("/home/user/.cache/chezmoi/blobs",
+					vfst.TestIsDir(),
+					vfst.TestModePerm(0o700),
+				),
+				vfst.TestPath(originalBlobPath,
+					vfst.TestModeIsRegular(),
+					vfst.TestModePerm(0o600),
+				),
+			)
+		}
+
+		assert.NoError(t, fileSystem.WriteFile("/home/user/.local/share/chezmoi/dot_file", []byte("# second contents of .file\n"), 0o666))
+		assert.NoError(t, newTestConfig(t, fileSystem).execute([]string{"apply", "--force"}))
+
+		assert.Equal(t, 1, len(getApplyRecordSummaries(t, fileSystem)))
+		vfst.RunTests(t, fileSystem, "",
+			vfst.TestPath(originalBlobPath,
+				vfst.TestDoesNotExist(),
+			),
+			vfst.TestPath(blobPath([]byte("# first contents of .file\n")),
+				vfst.TestModeIsRegular(),
+			),
+		)
+	})
+}
+
+func blobPath(data []byte) string {
+	dataSHA256 := sha256.Sum256(data)
+	hexSHA256 := hex.EncodeToString(dataSHA256[:])
+	return "/home/user/.cache/chezmoi/blobs/" + hexSHA256[:2] + "/" + hexSHA256[2:]
+}
+
+func getApplyRecordSummaries(t *testing.T, fileSystem vfs.FS) []*applyRecordSummary {
+	t.Helper()
+	stdout := &bytes.Buffer{}
+	assert.NoError(t, newTestConfig(t, fileSystem, withStdout(stdout)).execute([]string{"history", "--format=json"}))
+	var applyRecordSummaries []*applyRecordSummary
+	assert.NoError(t, chezmoi.FormatJSON.Unmarshal(stdout.Bytes(), &applyRecordSummaries))
+	return applyRecordSummaries
+}
@@ -93,13 +93,15 @@ func (c *Config) runUpdateCmd(cmd *cobra.Command, args []string) error {
 
 	if c.Update.Apply {
 		if err := c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, args, applyArgsOptions{
-			cmd:          cmd,
-			filter:       c.Update.filter,
-			init:         c.Update.init,
-			parentDirs:   c.Update.parentDirs,
-			recursive:    c.Update.recursive,
-			umask:        c.Umask,
-			preApplyFunc: c.defaultPreApplyFunc,
+			cmd:           cmd,
+			backup:        true,
+			filter:        c.Update.filter,
+			init:          c.Update.init,
+			parentDirs:    c.Update.parentDirs,
+			recordHistory: true,
+			recursive:     c.Update.recursive,
+			umask:         c.Umask,
+			preApplyFunc:  c.defaultPreApplyFunc,
 		}); err != nil {
 			return err
 		}